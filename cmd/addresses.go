@@ -0,0 +1,153 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// addressesCmd represents the addresses command
+var addressesCmd = &cobra.Command{
+	Use:   "addresses",
+	Short: "Report on the static IP addresses reserved with given credentials",
+	Long: `Show the static IP addresses reserved in each project visible from the
+account used, regional and global, with their status and the resources using
+them. External addresses which are reserved but attached to nothing are still
+charged for, and are flagged as UNUSED. For instance:
+    gcp-reports addresses our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, compute.ComputeReadonlyScope, func(clients *clients) (projectIngester, error) {
+			computeService, err := compute.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish compute engine service: %v", err)
+			}
+			taker := &TakerAddressesGCP{computeService: computeService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestAddresses(ctx, taker)
+			}, nil
+		})
+	},
+}
+
+type TakerAddresses interface {
+	ListAddresses(context.Context, *reportProject) ([]*compute.Address, error)
+}
+
+type TakerAddressesGCP struct {
+	computeService *compute.Service
+}
+
+type reportAddress struct {
+	gcpAddress *compute.Address
+	// unused is set for an external address reserved but attached to nothing
+	unused bool
+
+	project *reportProject // parent
+}
+
+func (ra *reportAddress) Parent() reportNode {
+	return ra.project
+}
+
+// ListAddresses gathers the project's regional addresses, across all its
+// regions, and its global ones
+func (taker *TakerAddressesGCP) ListAddresses(ctx context.Context, project *reportProject) (addresses []*compute.Address, err error) {
+	err = doWithRetry(ctx, func() error {
+		addresses = nil
+		regionalErr := taker.computeService.Addresses.AggregatedList(project.gcpProject.ProjectId).Pages(ctx, func(page *compute.AddressAggregatedList) error {
+			for _, scoped := range page.Items {
+				addresses = append(addresses, scoped.Addresses...)
+			}
+			return nil
+		})
+		if regionalErr != nil {
+			return regionalErr
+		}
+		return taker.computeService.GlobalAddresses.List(project.gcpProject.ProjectId).Pages(ctx, func(page *compute.AddressList) error {
+			addresses = append(addresses, page.Items...)
+			return nil
+		})
+	})
+	return
+}
+
+// IngestAddresses ingests the project's addresses ordered by region and name,
+// marking the external ones reserved without any user.
+func (p *reportProject) IngestAddresses(ctx context.Context, taker TakerAddresses) error {
+	var gcpAddresses []*compute.Address
+	listErr := limited(func() (err error) {
+		gcpAddresses, err = taker.ListAddresses(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+
+	for _, gcpAddress := range gcpAddresses {
+		address := &reportAddress{gcpAddress: gcpAddress, project: p}
+		if gcpAddress.Status == "RESERVED" && len(gcpAddress.Users) == 0 && address.addressType() == "EXTERNAL" {
+			address.unused = true
+			p.addFinding(severityWarn, "address/"+address.region()+"/"+gcpAddress.Name,
+				fmt.Sprintf("external address %s is reserved but not used", gcpAddress.Address))
+		}
+		p.addresses = append(p.addresses, address)
+	}
+	sort.Slice(p.addresses, func(i, j int) bool {
+		ai, aj := p.addresses[i], p.addresses[j]
+		if ai.region() != aj.region() {
+			return ai.region() < aj.region()
+		}
+		return ai.gcpAddress.Name < aj.gcpAddress.Name
+	})
+	return nil
+}
+
+// region is where a regional address is reserved, or global
+func (ra *reportAddress) region() string {
+	if ra.gcpAddress.Region == "" {
+		return "global"
+	}
+	return path.Base(ra.gcpAddress.Region)
+}
+
+// addressType is EXTERNAL or INTERNAL; an address without one is external
+func (ra *reportAddress) addressType() string {
+	return supplyDefault(ra.gcpAddress.AddressType, "EXTERNAL")
+}
+
+// displayAddresses shows the addresses as a table
+func displayAddresses(w io.Writer, addresses []*reportAddress) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  ADDRESS\tIP\tREGION\tTYPE\tUSED BY\tSTATUS")
+	for _, address := range addresses {
+		gcpAddress := address.gcpAddress
+		status := gcpAddress.Status
+		switch {
+		case address.unused:
+			status = alert("UNUSED")
+		case gcpAddress.Status == "IN_USE":
+			status = healthy(status)
+		}
+		users := make([]string, len(gcpAddress.Users))
+		for i, user := range gcpAddress.Users {
+			users[i] = path.Base(user)
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%s\t%s\t%s\n", gcpAddress.Name, gcpAddress.Address, address.region(),
+			address.addressType(), supplyDefault(strings.Join(users, ","), "-"), status)
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(addressesCmd)
+}
@@ -0,0 +1,62 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+var p2addresses = map[string][]*compute.Address{
+	"test1-project-000": []*compute.Address{
+		&compute.Address{Name: "lb", Address: "203.0.113.7", Status: "IN_USE",
+			Users: []string{networkPrefix + "global/forwardingRules/web"}},
+		&compute.Address{Name: "nat", Address: "203.0.113.9", Status: "IN_USE", Region: networkPrefix + "regions/us-central1",
+			Users: []string{networkPrefix + "regions/us-central1/routers/nat"}},
+		&compute.Address{Name: "spare", Address: "203.0.113.11", Status: "RESERVED", Region: networkPrefix + "regions/us-central1"},
+		&compute.Address{Name: "db", Address: "10.8.0.5", Status: "RESERVED", AddressType: "INTERNAL", Region: networkPrefix + "regions/us-central1"},
+	},
+}
+
+type TestAddressesTaker struct{}
+
+func (tt *TestAddressesTaker) ListAddresses(ctx context.Context, rp *reportProject) ([]*compute.Address, error) {
+	return p2addresses[rp.gcpProject.ProjectId], nil
+}
+
+func TestIngestAddresses(t *testing.T) {
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestAddresses(context.Background(), &TestAddressesTaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	var names []string
+	for _, address := range project.addresses {
+		names = append(names, address.region()+"/"+address.gcpAddress.Name)
+		if expected := address.gcpAddress.Name == "spare"; address.unused != expected {
+			t.Errorf("address %s: expected unused %t", address.gcpAddress.Name, expected)
+		}
+	}
+	if strings.Join(names, ",") != "global/lb,us-central1/db,us-central1/nat,us-central1/spare" {
+		t.Errorf("expected addresses by region and name, have %v", names)
+	}
+	if len(project.findings) != 1 || project.findings[0].resource != "address/us-central1/spare" {
+		t.Errorf("expected the orphaned external address alone flagged, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"project[test1-project-000]: 4 static addresses", "web", "UNUSED", "INTERNAL"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected display to contain %q, have:\n%s", expected, out)
+		}
+	}
+	if strings.Count(out, "UNUSED") != 1 {
+		t.Errorf("expected one address marked UNUSED:\n%s", out)
+	}
+}
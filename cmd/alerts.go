@@ -0,0 +1,182 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+// alertsCmd represents the alerts command
+var alertsCmd = &cobra.Command{
+	Use:   "alerts",
+	Short: "Audit the Cloud Monitoring alert policies available from given credentials",
+	Long: `Show the Cloud Monitoring alert policies of each project visible from the
+account used, with the resource types their conditions watch and the
+notification channels they alert. Disabled policies are flagged as DISABLED,
+and projects without any enabled policy as NO-ALERTS. With
+--require-resource-type, each resource type given that no enabled policy
+watches is flagged as UNCOVERED. For instance:
+    gcp-reports alerts --require-resource-type gae_app,cloudsql_database our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		required := getStringSlice("requireResourceType")
+		return runReport(args, monitoring.MonitoringReadScope, func(clients *clients) (projectIngester, error) {
+			monitoringService, err := monitoring.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish cloud monitoring service: %v", err)
+			}
+			taker := &TakerMonitoringGCP{monitoringService: monitoringService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestAlertPolicies(ctx, taker, required)
+			}, nil
+		})
+	},
+}
+
+type reportAlertPolicy struct {
+	gcpPolicy *monitoring.AlertPolicy
+	// resourceTypes are the monitored resource types the policy's conditions
+	// filter on, in order
+	resourceTypes []string
+
+	project *reportProject // parent
+}
+
+func (ra *reportAlertPolicy) Parent() reportNode {
+	return ra.project
+}
+
+// ListAlertPolicies gathers the alert policies of the project
+func (taker *TakerMonitoringGCP) ListAlertPolicies(ctx context.Context, project *reportProject) (policies []*monitoring.AlertPolicy, err error) {
+	err = doWithRetry(ctx, func() error {
+		policies = nil
+		return taker.monitoringService.Projects.AlertPolicies.List("projects/"+project.gcpProject.ProjectId).Pages(ctx, func(page *monitoring.ListAlertPoliciesResponse) error {
+			policies = append(policies, page.AlertPolicies...)
+			return nil
+		})
+	})
+	return
+}
+
+// resourceTypePattern finds the resource types of a monitoring filter, eg
+// resource.type = "gae_app"
+var resourceTypePattern = regexp.MustCompile(`resource\.type\s*=\s*"?([A-Za-z0-9_.]+)"?`)
+
+// conditionResourceTypes lists the resource types the policy's conditions
+// filter on, without repeats
+func conditionResourceTypes(policy *monitoring.AlertPolicy) []string {
+	var resourceTypes []string
+	for _, condition := range policy.Conditions {
+		var filters []string
+		if condition.ConditionThreshold != nil {
+			filters = append(filters, condition.ConditionThreshold.Filter)
+		}
+		if condition.ConditionAbsent != nil {
+			filters = append(filters, condition.ConditionAbsent.Filter)
+		}
+		for _, filter := range filters {
+			for _, match := range resourceTypePattern.FindAllStringSubmatch(filter, -1) {
+				if !containsString(resourceTypes, match[1]) {
+					resourceTypes = append(resourceTypes, match[1])
+				}
+			}
+		}
+	}
+	sort.Strings(resourceTypes)
+	return resourceTypes
+}
+
+// IngestAlertPolicies ingests the project's alert policies ordered by display
+// name, marking the project when none is enabled, and noting the required
+// resource types no enabled policy watches.
+func (p *reportProject) IngestAlertPolicies(ctx context.Context, taker TakerMonitoring, required []string) error {
+	var gcpPolicies []*monitoring.AlertPolicy
+	listErr := limited(func() (err error) {
+		gcpPolicies, err = taker.ListAlertPolicies(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+
+	covered := make(map[string]bool)
+	for _, gcpPolicy := range gcpPolicies {
+		policy := &reportAlertPolicy{gcpPolicy: gcpPolicy, resourceTypes: conditionResourceTypes(gcpPolicy), project: p}
+		p.alertPolicies = append(p.alertPolicies, policy)
+		if !gcpPolicy.Enabled {
+			continue
+		}
+		for _, resourceType := range policy.resourceTypes {
+			covered[resourceType] = true
+		}
+	}
+	sort.Slice(p.alertPolicies, func(i, j int) bool {
+		return p.alertPolicies[i].gcpPolicy.DisplayName < p.alertPolicies[j].gcpPolicy.DisplayName
+	})
+
+	p.alertsChecked = true
+	if p.enabledAlertPolicies() == 0 {
+		p.addFinding(severityWarn, "alerts", "has no enabled alert policy")
+	}
+	for _, resourceType := range required {
+		if resourceType = strings.TrimSpace(resourceType); resourceType != "" && !covered[resourceType] {
+			p.uncoveredResourceTypes = append(p.uncoveredResourceTypes, resourceType)
+			p.addFinding(severityWarn, "alerts/"+resourceType, "no enabled alert policy watches resource type "+resourceType)
+		}
+	}
+	return nil
+}
+
+// enabledAlertPolicies counts the project's enabled alert policies
+func (p *reportProject) enabledAlertPolicies() int {
+	enabled := 0
+	for _, policy := range p.alertPolicies {
+		if policy.gcpPolicy.Enabled {
+			enabled++
+		}
+	}
+	return enabled
+}
+
+// displayAlertPolicies shows the project's alert policies as a table, then
+// what they leave without alerting
+func (p *reportProject) displayAlertPolicies(w io.Writer) {
+	if len(p.alertPolicies) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d alert policies\n", p.gcpProject.ProjectId, len(p.alertPolicies))
+		table := newTable(w)
+		fmt.Fprintln(table, "  POLICY\tCONDITIONS\tRESOURCE TYPES\tCHANNELS\tSTATUS")
+		for _, policy := range p.alertPolicies {
+			gcpPolicy := policy.gcpPolicy
+			status := healthy("OK")
+			if !gcpPolicy.Enabled {
+				status = alert("DISABLED")
+			}
+			fmt.Fprintf(table, "  %s\t%d\t%s\t%d\t%s\n", supplyDefault(gcpPolicy.DisplayName, gcpPolicy.Name), len(gcpPolicy.Conditions),
+				supplyDefault(strings.Join(policy.resourceTypes, ","), "-"), len(gcpPolicy.NotificationChannels), status)
+		}
+		table.Flush()
+	}
+	if p.alertsChecked && p.enabledAlertPolicies() == 0 {
+		fmt.Fprintf(w, "project[%s]: %s: no enabled alert policy\n", p.gcpProject.ProjectId, alert("NO-ALERTS"))
+	}
+	for _, resourceType := range p.uncoveredResourceTypes {
+		fmt.Fprintf(w, "  resource-type[%s] %s: no enabled alert policy watches it\n", resourceType, alert("UNCOVERED"))
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(alertsCmd)
+
+	alertsCmd.Flags().StringSlice("require-resource-type", []string{}, "comma-separated monitored resource types, eg gae_app,cloudsql_database, each needing an enabled alert policy watching it")
+	viper.BindPFlag("requireResourceType", alertsCmd.Flags().Lookup("require-resource-type"))
+}
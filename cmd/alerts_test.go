@@ -0,0 +1,85 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+var p2policies = map[string][]*monitoring.AlertPolicy{
+	"test1-project-000": []*monitoring.AlertPolicy{
+		&monitoring.AlertPolicy{DisplayName: "latency", Enabled: true, NotificationChannels: []string{"projects/test1-project-000/notificationChannels/1"},
+			Conditions: []*monitoring.Condition{
+				&monitoring.Condition{ConditionThreshold: &monitoring.MetricThreshold{
+					Filter: `metric.type = "appengine.googleapis.com/http/server/response_latencies" AND resource.type = "gae_app"`}},
+			}},
+		&monitoring.AlertPolicy{DisplayName: "database down", Enabled: false,
+			Conditions: []*monitoring.Condition{
+				&monitoring.Condition{ConditionAbsent: &monitoring.MetricAbsence{Filter: `resource.type = "cloudsql_database"`}},
+			}},
+	},
+	"test1-project-006": []*monitoring.AlertPolicy{
+		&monitoring.AlertPolicy{DisplayName: "old", Enabled: false},
+	},
+}
+
+func (tt *TestMonitoringTaker) ListAlertPolicies(ctx context.Context, rp *reportProject) ([]*monitoring.AlertPolicy, error) {
+	return p2policies[rp.gcpProject.ProjectId], nil
+}
+
+func TestIngestAlertPolicies(t *testing.T) {
+	projects := filterFixture(fpTT[0])
+	covered, disabled := projects[0], projects[1]
+	required := []string{"gae_app", "cloudsql_database"}
+	for _, project := range projects {
+		if err := project.IngestAlertPolicies(context.Background(), &TestMonitoringTaker{}, required); err != nil {
+			t.Fatalf("unexpected ingest error: %v", err)
+		}
+	}
+
+	if len(covered.alertPolicies) != 2 || covered.alertPolicies[0].gcpPolicy.DisplayName != "database down" {
+		t.Fatalf("expected both policies in name order, have %d", len(covered.alertPolicies))
+	}
+	if types := covered.alertPolicies[1].resourceTypes; strings.Join(types, ",") != "gae_app" {
+		t.Errorf("expected the latency policy to watch gae_app, have %v", types)
+	}
+	if strings.Join(covered.uncoveredResourceTypes, ",") != "cloudsql_database" {
+		t.Errorf("expected the disabled policy to leave cloudsql_database uncovered, have %v", covered.uncoveredResourceTypes)
+	}
+
+	if disabled.enabledAlertPolicies() != 0 || len(disabled.findings) != 3 || disabled.findings[0].resource != "alerts" {
+		t.Errorf("expected a project with only a disabled policy flagged, have %v", disabled.findings)
+	}
+	var buf bytes.Buffer
+	disabled.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"1 alert policies", "DISABLED", "NO-ALERTS", "resource-type[gae_app] UNCOVERED"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in the display, have:\n%s", expected, out)
+		}
+	}
+}
+
+func TestNoAlertPolicies(t *testing.T) {
+	project := filterFixture(fpTT[1])[1]
+	if err := project.IngestAlertPolicies(context.Background(), &TestMonitoringTaker{}, nil); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.findings) != 1 || project.findings[0].problem != "has no enabled alert policy" {
+		t.Errorf("expected a project without policies flagged, have %v", project.findings)
+	}
+	var buf bytes.Buffer
+	project.Display(&buf)
+	if expected := "project[test1-project-001]: NO-ALERTS: no enabled alert policy\n"; buf.String() != expected {
+		t.Errorf("expected %q displayed, have %q", expected, buf.String())
+	}
+	if project.empty() {
+		t.Error("expected a project without policies to have something to report")
+	}
+}
@@ -4,20 +4,19 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
+	"os"
+	"path"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"google.golang.org/api/appengine/v1"
-	"google.golang.org/api/cloudresourcemanager/v1"
 )
 
-func max(i1, i2 int) int {
-	if i1 > i2 {
+func min(i1, i2 int) int {
+	if i1 < i2 {
 		return i1
 	}
 	return i2
@@ -40,55 +39,80 @@ information about all services and versions running as part of an app. To
 see apps matching a particular component name of 'our-foo', try this:
     gcp-reports apps our-foo
 Applications with the 'component' label matching 'our-foo' will be listed.
+Versions on a runtime named by --deprecated-runtime are flagged as
+DEPRECATED, and ones running more instances than --max-instances-warn as
+MANY-INSTANCES. When auditing a runtime migration, --runtime narrows the listing to the
+versions still on a runtime, eg:
+    gcp-reports apps --runtime 'python2*'
+With --price-table, the monthly cost of each version is estimated from its
+instance class and its instances running all month, as a rough figure for
+comparing versions rather than a bill.
 `,
-	Run: func(cmd *cobra.Command, args []string) {
-
-		ctx := oauth2.NoContext
-		client, err := google.DefaultClient(ctx, appengine.CloudPlatformReadOnlyScope)
-		if err != nil {
-			log.Fatalln("cannot create a gcloud client:", err)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if viper.GetInt("displayVersions") < 0 {
+			return errors.New("--display-versions must not be negative")
 		}
-
-		cloudResourceManagerService, err := cloudresourcemanager.New(client)
-		if err != nil {
-			log.Fatalln("cannot establish cloud resource-manager service:", err)
+		if viper.GetInt("maxInstancesWarn") < 0 {
+			return errors.New("--max-instances-warn must not be negative")
+		}
+		runtime := viper.GetString("runtime")
+		if _, err := path.Match(runtime, ""); err != nil {
+			return fmt.Errorf("invalid --runtime pattern %q: %v", runtime, err)
+		}
+		var prices *priceTable
+		if priceTablePath := viper.GetString("priceTable"); priceTablePath != "" {
+			var err error
+			if prices, err = loadPriceTable(priceTablePath); err != nil {
+				return err
+			}
 		}
 
-		pService := cloudresourcemanager.NewProjectsService(cloudResourceManagerService)
-		projectsResponse, projErr := pService.List().Context(ctx).Do()
-		if projErr != nil {
-			log.Fatalln("cannot list projects at Google Cloud:", projErr)
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+		defer cancel()
+		clients, err := setupClients(ctx, args, appengine.CloudPlatformReadOnlyScope)
+		if err != nil || clients.dryRun(textOutput()) {
+			return err
 		}
+		ourProjects := clients.projects
 
-		appEngine, err := appengine.New(client)
+		appEngine, err := appengine.New(clients.http)
 		if err != nil {
-			log.Fatalln("cannot establish app engine service:", err)
+			return fmt.Errorf("cannot establish app engine service: %v", err)
 		}
 
-		taker := &TakerGCP{crmService: cloudResourceManagerService, appEngine: appEngine}
-
-		ourProjects := filterProjects(projectsResponse.Projects, args, envFilter)
-		doneChan := make(chan string)
-		for _, project := range ourProjects {
-			fmt.Println("project pre:", project.gcpProject.ProjectId)
-			go func(project *reportProject) {
-				ingestErr := project.Ingest(taker)
-				doneChan <- project.gcpProject.ProjectId
-				fmt.Println("project inside done:", project.gcpProject.ProjectId, ingestErr)
-			}(project)
+		taker := &TakerGCP{appEngine: appEngine}
+
+		setConcurrency(viper.GetInt("concurrency"))
+		ingestErr := ingestProjects(ctx, ourProjects, func(ctx context.Context, project *reportProject) error {
+			return project.Ingest(ctx, taker)
+		})
+		logger.Infof("GCP information ingested...now to display")
+		if prices != nil {
+			estimateCosts(ourProjects, prices)
 		}
-		for _ = range ourProjects {
-			dp := <-doneChan
-			fmt.Println("project done", dp)
+		if runtime != "" {
+			ourProjects = projectsWithApplication(ourProjects)
 		}
-		fmt.Println("GCP information ingested...now to display")
-		for _, project := range ourProjects {
-			project.Display()
+		if !renderReport(os.Stdout, ourProjects) {
+			displayProjects(textOutput(), ourProjects)
+			summarizeProjects(ourProjects).DisplayApps(textOutput())
 		}
-
+		return ingestErr
 	},
 }
 
+// projectsWithApplication leaves out the projects without an application, or
+// whose application has no service left once versions are filtered
+func projectsWithApplication(projects []*reportProject) []*reportProject {
+	var withApplication []*reportProject
+	for _, project := range projects {
+		if project.application != nil && len(project.application.services) > 0 {
+			withApplication = append(withApplication, project)
+		}
+	}
+	return withApplication
+}
+
 func init() {
 	RootCmd.AddCommand(appsCmd)
 
@@ -102,5 +126,18 @@ func init() {
 	// is called directly, e.g.:
 	appsCmd.Flags().Int("version-limit", 3000, "How many versions (most recent) to be gathered")
 	viper.BindPFlag("versionLimit", appsCmd.Flags().Lookup("version-limit"))
+	appsCmd.Flags().Int("display-versions", 3, "how many of the most recent versions of each service to show without --verbose")
+	viper.BindPFlag("displayVersions", appsCmd.Flags().Lookup("display-versions"))
+	appsCmd.Flags().Bool("show-instances", false, "list the instances of each version shown, as --verbose does")
+	viper.BindPFlag("showInstances", appsCmd.Flags().Lookup("show-instances"))
+	appsCmd.Flags().StringArray("deprecated-runtime", []string{"python25", "python27", "python37", "go111", "go112", "java7", "java8", "php55", "php72", "nodejs8", "nodejs10", "ruby25"},
+		"flag versions running on this runtime (repeatable)")
+	viper.BindPFlag("appDeprecatedRuntime", appsCmd.Flags().Lookup("deprecated-runtime"))
+	appsCmd.Flags().Int("max-instances-warn", 0, "flag versions running more instances than this (0 flags none)")
+	viper.BindPFlag("maxInstancesWarn", appsCmd.Flags().Lookup("max-instances-warn"))
+	appsCmd.Flags().String("runtime", "", "only show versions whose runtime matches this glob, eg python27 or go1*, and the services and projects having any")
+	viper.BindPFlag("runtime", appsCmd.Flags().Lookup("runtime"))
+	appsCmd.Flags().String("price-table", "", "YAML or JSON file of hourly prices by instance class, under hourly with an optional currency, to estimate each version's monthly cost from")
+	viper.BindPFlag("priceTable", appsCmd.Flags().Lookup("price-table"))
 
 }
@@ -0,0 +1,546 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	appengine "google.golang.org/api/appengine/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// blockingTaker never answers: every call waits for its context to be done
+type blockingTaker struct {
+	TestTaker
+}
+
+func (bt *blockingTaker) GetApplication(ctx context.Context, rp *reportProject) (*appengine.Application, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestIngestProjectsTimeout(t *testing.T) {
+	projects := filterFixture(fpTT[0])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	taker := &blockingTaker{}
+	err := ingestProjects(ctx, projects, func(ctx context.Context, project *reportProject) error {
+		return project.Ingest(ctx, taker)
+	})
+	incomplete, ok := err.(*incompleteError)
+	if !ok {
+		t.Fatalf("expected an incompleteError, have %v", err)
+	}
+	if incomplete.cause != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, have %v", incomplete.cause)
+	}
+	if len(incomplete.projects) != len(projects) {
+		t.Errorf("expected %d incomplete projects, have %v", len(projects), incomplete.projects)
+	}
+}
+
+// blockingInstancesTaker answers every call but the listing of a version's
+// instances, as deep in the tree as ingestion goes
+type blockingInstancesTaker struct {
+	TestTaker
+}
+
+func (bt *blockingInstancesTaker) ListVersionInstances(ctx context.Context, rv *reportVersion) ([]*appengine.Instance, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestIngestProjectsTimeoutNested(t *testing.T) {
+	projects := filterFixture(fpTT[0])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	taker := &blockingInstancesTaker{}
+	err := ingestProjects(ctx, projects, func(ctx context.Context, project *reportProject) error {
+		return project.Ingest(ctx, taker)
+	})
+	incomplete, ok := err.(*incompleteError)
+	if !ok {
+		t.Fatalf("expected an incompleteError from the versions timing out, have %v", err)
+	}
+	if len(incomplete.projects) != len(projects) {
+		t.Errorf("expected %d incomplete projects, have %v", len(projects), incomplete.projects)
+	}
+}
+
+func TestPerProjectTimeout(t *testing.T) {
+	defer viper.Set("perProjectTimeout", viper.GetDuration("perProjectTimeout"))
+	viper.Set("perProjectTimeout", 20*time.Millisecond)
+	projects := filterFixture(fpTT[0])
+	slow := projects[0].gcpProject.ProjectId
+
+	var mu sync.Mutex
+	completed := make(map[string]bool)
+	err := ingestProjects(context.Background(), projects, func(ctx context.Context, project *reportProject) error {
+		if project.gcpProject.ProjectId == slow {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		completed[project.gcpProject.ProjectId] = true
+		return nil
+	})
+	failed, ok := err.(*ingestErrors)
+	if !ok || len(failed.projects) != 1 || failed.projects[0] != slow {
+		t.Fatalf("expected %s alone to fail, have %v", slow, err)
+	}
+	if _, ok := failed.errs[0].(*projectTimeoutError); !ok {
+		t.Errorf("expected %s to fail with a timeout, have %v", slow, failed.errs[0])
+	}
+	if len(completed) != len(projects)-1 {
+		t.Errorf("expected the other %d projects to complete, have %v", len(projects)-1, completed)
+	}
+}
+
+// slowInstancesTaker never lists the instances of one project's versions
+type slowInstancesTaker struct {
+	TestTaker
+	projectID string
+}
+
+func (st *slowInstancesTaker) ListVersionInstances(ctx context.Context, rv *reportVersion) ([]*appengine.Instance, error) {
+	if rv.service.application.project.gcpProject.ProjectId == st.projectID {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return st.TestTaker.ListVersionInstances(ctx, rv)
+}
+
+func TestPerProjectTimeoutNested(t *testing.T) {
+	defer viper.Set("perProjectTimeout", viper.GetDuration("perProjectTimeout"))
+	viper.Set("perProjectTimeout", 20*time.Millisecond)
+	projects := filterFixture(fpTT[0])
+	slow := projects[0].gcpProject.ProjectId
+	taker := &slowInstancesTaker{projectID: slow}
+
+	err := ingestProjects(context.Background(), projects, func(ctx context.Context, project *reportProject) error {
+		return project.Ingest(ctx, taker)
+	})
+	failed, ok := err.(*ingestErrors)
+	if !ok || len(failed.projects) != 1 || failed.projects[0] != slow {
+		t.Fatalf("expected %s alone to fail, have %v", slow, err)
+	}
+	if _, ok := failed.errs[0].(*projectTimeoutError); !ok {
+		t.Errorf("expected %s to fail with a timeout, have %v", slow, failed.errs[0])
+	}
+	for _, project := range projects[1:] {
+		if project.application == nil || len(project.application.services) == 0 {
+			t.Errorf("expected %s ingested, have %+v", project.gcpProject.ProjectId, project.application)
+		}
+	}
+}
+
+func TestShowInstances(t *testing.T) {
+	verbose = false
+	project := goldenProject()
+	version := project.application.services[0].versions[0]
+	version.instances[0].gcpVersionInstance = &appengine.Instance{
+		Id: "instance-0042", VmName: "gae-vm-0042", VmStatus: "RUNNING", Availability: "DYNAMIC", Requests: 17,
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	if strings.Contains(buf.String(), "instance-0042") {
+		t.Errorf("expected no instances without --show-instances, have:\n%s", buf.String())
+	}
+
+	viper.Set("showInstances", true)
+	defer viper.Set("showInstances", false)
+	buf.Reset()
+	project.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"instance-0042", "gae-vm-0042", "RUNNING", "DYNAMIC", "17"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q among the instances shown, have:\n%s", expected, out)
+		}
+	}
+}
+
+func TestCheckRollout(t *testing.T) {
+	for _, tt := range []struct {
+		allocations map[string]float64
+		stale       bool
+	}{
+		{map[string]float64{"v3": 1.0}, false},
+		{map[string]float64{"v2": 1.0}, true},
+		{map[string]float64{"v2": 0.9, "v3": 0.1}, false},
+		// a service without a traffic split
+		{nil, false},
+	} {
+		project := goldenProject()
+		service := project.application.services[0]
+		service.gcpService.Split.Allocations = tt.allocations
+		if tt.allocations == nil {
+			service.gcpService.Split = nil
+		}
+		newest, _ := time.Parse(time.RFC3339, "2017-06-01T10:00:00Z")
+		older, _ := time.Parse(time.RFC3339, "2017-05-01T10:00:00Z")
+		service.versions = []*reportVersion{
+			{gcpVersion: &appengine.Version{Id: "v3", ServingStatus: "SERVING"}, deployTime: newest, service: service},
+			{gcpVersion: &appengine.Version{Id: "v2", ServingStatus: "SERVING"}, deployTime: older, service: service},
+		}
+		service.CheckRollout(service.versions)
+
+		if service.staleRollout != tt.stale {
+			t.Errorf("%v: expected stale rollout %t", tt.allocations, tt.stale)
+		}
+		if stale := len(project.findings) == 1 && project.findings[0].resource == "service/default"; stale != tt.stale {
+			t.Errorf("%v: unexpected findings %v", tt.allocations, project.findings)
+		}
+		var buf bytes.Buffer
+		service.Display(&buf)
+		if strings.Contains(buf.String(), "STALE-ROLLOUT") != tt.stale {
+			t.Errorf("%v: unexpected display:\n%s", tt.allocations, buf.String())
+		}
+	}
+}
+
+func TestCheckInstancesEmptyServing(t *testing.T) {
+	project := goldenProject()
+	service := project.application.services[0]
+	manual := &reportVersion{gcpVersion: &appengine.Version{
+		Id: "manual", ServingStatus: "SERVING", ManualScaling: &appengine.ManualScaling{Instances: 2},
+	}, service: service}
+	automatic := &reportVersion{gcpVersion: &appengine.Version{
+		Id: "automatic", ServingStatus: "SERVING", AutomaticScaling: &appengine.AutomaticScaling{},
+	}, service: service}
+	for _, version := range []*reportVersion{manual, automatic} {
+		version.CheckInstances()
+	}
+	if !manual.emptyServing || automatic.emptyServing {
+		t.Errorf("expected only the manually scaled version flagged, have %t %t", manual.emptyServing, automatic.emptyServing)
+	}
+	if len(project.findings) != 1 || project.findings[0].resource != "version/default/manual" {
+		t.Errorf("unexpected findings %v", project.findings)
+	}
+
+	service.versions = []*reportVersion{manual, automatic}
+	var buf bytes.Buffer
+	service.Display(&buf)
+	if strings.Count(buf.String(), "EMPTY") != 1 {
+		t.Errorf("expected one version marked EMPTY, have:\n%s", buf.String())
+	}
+	record := newProjectJSON(project)
+	versions := record.Application.Services[0].Versions
+	if !versions[0].EmptyServing || versions[1].EmptyServing {
+		t.Errorf("expected the JSON to mark only the manually scaled version, have %+v", versions)
+	}
+}
+
+func TestCheckInstanceCount(t *testing.T) {
+	project := goldenProject()
+	service := project.application.services[0]
+	versionWith := func(id string, instances int) *reportVersion {
+		version := &reportVersion{gcpVersion: &appengine.Version{Id: id, ServingStatus: "SERVING"}, service: service}
+		for i := 0; i < instances; i++ {
+			version.instances = append(version.instances, &reportVersionInstance{gcpVersionInstance: &appengine.Instance{}, version: version})
+		}
+		return version
+	}
+	busy, quiet := versionWith("busy", 5), versionWith("quiet", 4)
+	for _, version := range []*reportVersion{busy, quiet} {
+		version.CheckInstanceCount(4)
+	}
+	if !busy.manyInstances || quiet.manyInstances {
+		t.Errorf("expected only the version above 4 instances flagged, have %t %t", busy.manyInstances, quiet.manyInstances)
+	}
+	if len(project.findings) != 1 || project.findings[0].resource != "version/default/busy" || project.findings[0].severity != severityWarn {
+		t.Errorf("unexpected findings %v", project.findings)
+	}
+
+	service.versions = []*reportVersion{busy, quiet}
+	var buf bytes.Buffer
+	service.Display(&buf)
+	if strings.Count(buf.String(), "MANY-INSTANCES") != 1 {
+		t.Errorf("expected one version marked MANY-INSTANCES, have:\n%s", buf.String())
+	}
+
+	busy.CheckInstanceCount(0)
+	if busy.manyInstances {
+		t.Error("expected no limit to flag nothing")
+	}
+}
+
+// failingTaker cannot get the application of one project
+type failingTaker struct {
+	TestTaker
+	projectID string
+}
+
+func (ft *failingTaker) GetApplication(ctx context.Context, rp *reportProject) (*appengine.Application, error) {
+	if rp.gcpProject.ProjectId == ft.projectID {
+		return nil, errors.New("permission denied")
+	}
+	return ft.TestTaker.GetApplication(ctx, rp)
+}
+
+func TestIngestProjectsErrors(t *testing.T) {
+	projects := filterFixture(fpTT[0])
+	if len(projects) < 2 {
+		t.Fatalf("expected several projects in the fixture, have %d", len(projects))
+	}
+	failing := projects[1].gcpProject.ProjectId
+	taker := &failingTaker{projectID: failing}
+	err := ingestProjects(context.Background(), projects, func(ctx context.Context, project *reportProject) error {
+		return project.Ingest(ctx, taker)
+	})
+	aggregate, ok := err.(*ingestErrors)
+	if !ok {
+		t.Fatalf("expected the projects' errors aggregated, have %v", err)
+	}
+	if len(aggregate.projects) != 1 || aggregate.projects[0] != failing {
+		t.Errorf("expected only %s to fail, have %v", failing, aggregate.projects)
+	}
+	if !strings.Contains(err.Error(), failing+": permission denied") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// failingVersionsTaker cannot list the versions of one project's services
+type failingVersionsTaker struct {
+	TestTaker
+	projectID string
+}
+
+func (ft *failingVersionsTaker) ListVersions(ctx context.Context, rs *reportService) ([]*appengine.Version, error) {
+	if rs.application.project.gcpProject.ProjectId == ft.projectID {
+		return nil, errors.New("backend unavailable")
+	}
+	return ft.TestTaker.ListVersions(ctx, rs)
+}
+
+func TestIngestProjectsNestedErrors(t *testing.T) {
+	projects := filterFixture(fpTT[0])
+	failing := projects[0].gcpProject.ProjectId
+	taker := &failingVersionsTaker{projectID: failing}
+	err := ingestProjects(context.Background(), projects, func(ctx context.Context, project *reportProject) error {
+		return project.Ingest(ctx, taker)
+	})
+	aggregate, ok := err.(*ingestErrors)
+	if !ok {
+		t.Fatalf("expected the versions' error aggregated, have %v", err)
+	}
+	if len(aggregate.projects) != 1 || aggregate.projects[0] != failing {
+		t.Errorf("expected only %s to fail, have %v", failing, aggregate.projects)
+	}
+	if !strings.Contains(err.Error(), failing+": backend unavailable") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// mixedRuntimeTaker serves an application per project, each service's
+// versions on the runtimes given
+type mixedRuntimeTaker struct {
+	TestTaker
+	runtimes map[string]map[string][]string
+}
+
+func (mt *mixedRuntimeTaker) GetApplication(ctx context.Context, rp *reportProject) (*appengine.Application, error) {
+	return &appengine.Application{Id: rp.gcpProject.ProjectId}, nil
+}
+
+func (mt *mixedRuntimeTaker) ListServices(ctx context.Context, ra *reportApplication) (services []*appengine.Service, err error) {
+	for serviceID := range mt.runtimes[ra.gcpApplication.Id] {
+		services = append(services, &appengine.Service{Id: serviceID, Split: &appengine.TrafficSplit{}})
+	}
+	return
+}
+
+func (mt *mixedRuntimeTaker) ListVersions(ctx context.Context, rs *reportService) (versions []*appengine.Version, err error) {
+	for i, runtime := range mt.runtimes[rs.application.gcpApplication.Id][rs.gcpService.Id] {
+		versions = append(versions, &appengine.Version{Id: fmt.Sprintf("v%d", i+1), Runtime: runtime,
+			CreateTime: fmt.Sprintf("2017-06-0%dT00:00:00Z", i+1)})
+	}
+	return
+}
+
+func TestRuntimeFilter(t *testing.T) {
+	defer viper.Set("runtime", viper.GetString("runtime"))
+	viper.Set("runtime", "python2*")
+	taker := &mixedRuntimeTaker{runtimes: map[string]map[string][]string{
+		gcpP[0].ProjectId: {"default": {"python27", "go111", "python27"}, "worker": {"python37"}},
+		gcpP[1].ProjectId: {"default": {"go111", "java8"}},
+	}}
+	projects := []*reportProject{{gcpProject: gcpP[0]}, {gcpProject: gcpP[1]}}
+	for _, project := range projects {
+		if err := project.Ingest(context.Background(), taker); err != nil {
+			t.Fatalf("unexpected ingest error: %v", err)
+		}
+	}
+
+	projects = projectsWithApplication(projects)
+	if len(projects) != 1 || projects[0].gcpProject.ProjectId != gcpP[0].ProjectId {
+		t.Fatalf("expected only the project running python27 to remain, have %d", len(projects))
+	}
+	services := projects[0].application.services
+	if len(services) != 1 || services[0].gcpService.Id != "default" {
+		t.Fatalf("expected only the default service to remain, have %d", len(services))
+	}
+	var ids []string
+	for _, version := range services[0].versions {
+		if version.gcpVersion.Runtime != "python27" {
+			t.Errorf("version %s on %s should have been filtered", version.gcpVersion.Id, version.gcpVersion.Runtime)
+		}
+		ids = append(ids, version.gcpVersion.Id)
+	}
+	if strings.Join(ids, ",") != "v3,v1" {
+		t.Errorf("expected the python27 versions newest first, have %v", ids)
+	}
+}
+
+func TestDeprecatedRuntime(t *testing.T) {
+	taker := &mixedRuntimeTaker{runtimes: map[string]map[string][]string{
+		gcpP[0].ProjectId: {"default": {"python27", "python39"}},
+	}}
+	project := &reportProject{gcpProject: gcpP[0]}
+	if err := project.Ingest(context.Background(), taker); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	versions := project.application.services[0].versions
+	if latest, old := versions[0], versions[1]; latest.deprecatedRuntime || !old.deprecatedRuntime {
+		t.Errorf("expected only the python27 version flagged, have python39 %v and python27 %v", latest.deprecatedRuntime, old.deprecatedRuntime)
+	}
+	if len(project.findings) != 1 || project.findings[0].resource != "version/default/v1" {
+		t.Errorf("expected a finding for the python27 version alone, have %v", project.findings)
+	}
+
+	defer func(shown bool) { verbose = shown }(verbose)
+	verbose = true
+	var buf bytes.Buffer
+	project.Display(&buf)
+	if out := buf.String(); strings.Count(out, "DEPRECATED") != 1 {
+		t.Errorf("expected one version displayed DEPRECATED:\n%s", out)
+	}
+	if record := newProjectJSON(project); !record.Application.Services[0].Versions[1].DeprecatedRuntime {
+		t.Errorf("expected the deprecated runtime in the JSON record, have %+v", record.Application.Services[0].Versions)
+	}
+}
+
+// missingAppTaker answers as App Engine does for a project which never
+// created an application
+type missingAppTaker struct {
+	TestTaker
+	projectID string
+	err       error
+}
+
+func (mt *missingAppTaker) GetApplication(ctx context.Context, rp *reportProject) (*appengine.Application, error) {
+	if rp.gcpProject.ProjectId == mt.projectID {
+		return nil, mt.err
+	}
+	return mt.TestTaker.GetApplication(ctx, rp)
+}
+
+func TestIngestWithoutApplication(t *testing.T) {
+	projects := filterFixture(fpTT[0])
+	missing := projects[0]
+	taker := &missingAppTaker{projectID: missing.gcpProject.ProjectId,
+		err: &googleapi.Error{Code: http.StatusNotFound, Message: "App does not exist."}}
+	if err := ingestProjects(context.Background(), projects, func(ctx context.Context, project *reportProject) error {
+		return project.Ingest(ctx, taker)
+	}); err != nil {
+		t.Fatalf("expected a project without an application not to fail, have %v", err)
+	}
+	if missing.application != nil {
+		t.Errorf("expected no application for %s, have %v", missing.gcpProject.ProjectId, missing.application)
+	}
+	if withApplication := projectsWithApplication(projects); len(withApplication) != len(projects)-1 {
+		t.Errorf("expected the other projects' applications ingested, have %d of %d", len(withApplication), len(projects))
+	}
+	var buf bytes.Buffer
+	missing.Display(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing displayed for the project, have:\n%s", buf.String())
+	}
+
+	taker.err = &googleapi.Error{Code: http.StatusForbidden, Message: "The caller does not have permission"}
+	missing.application = nil
+	if err := missing.Ingest(context.Background(), taker); err == nil {
+		t.Error("expected any other API error to fail the project")
+	}
+}
+
+// deniedTaker is refused, as the GCP takers are through doWithRetry, the
+// versions of one service and the application of one project
+type deniedTaker struct {
+	TestTaker
+	service, projectID string
+}
+
+func (dt *deniedTaker) GetApplication(ctx context.Context, rp *reportProject) (app *appengine.Application, err error) {
+	if rp.gcpProject.ProjectId != dt.projectID {
+		return dt.TestTaker.GetApplication(ctx, rp)
+	}
+	err = doWithRetry(ctx, func() error {
+		return &googleapi.Error{Code: http.StatusForbidden, Message: "The caller does not have permission"}
+	})
+	return
+}
+
+func (dt *deniedTaker) ListVersions(ctx context.Context, rs *reportService) (versions []*appengine.Version, err error) {
+	if rs.gcpService.Id != dt.service {
+		return dt.TestTaker.ListVersions(ctx, rs)
+	}
+	err = doWithRetry(ctx, func() error {
+		return &googleapi.Error{Code: http.StatusForbidden, Message: "Permission 'appengine.versions.list' denied"}
+	})
+	return
+}
+
+func TestIngestPermissionDenied(t *testing.T) {
+	projects := filterFixture(fpTT[0])
+	golden, denied := projects[0], projects[1]
+	taker := &deniedTaker{service: "test1S1", projectID: denied.gcpProject.ProjectId}
+	if err := ingestProjects(context.Background(), projects, func(ctx context.Context, project *reportProject) error {
+		return project.Ingest(ctx, taker)
+	}); err != nil {
+		t.Fatalf("expected the run to complete despite permissions denied, have %v", err)
+	}
+
+	if len(golden.application.services) != 3 {
+		t.Fatalf("expected every service of %s kept, have %d", golden.gcpProject.ProjectId, len(golden.application.services))
+	}
+	for _, service := range golden.application.services {
+		if denied := service.gcpService.Id == "test1S1"; denied != (len(service.versions) == 0) {
+			t.Errorf("service %s: expected versions ingested unless denied, have %d", service.gcpService.Id, len(service.versions))
+		}
+	}
+	for project, expected := range map[*reportProject]string{
+		golden: "permission denied on deniedTaker.ListVersions for " + golden.gcpProject.ProjectId + ": Permission 'appengine.versions.list' denied",
+		denied: "permission denied on deniedTaker.GetApplication for " + denied.gcpProject.ProjectId,
+	} {
+		var found bool
+		for _, f := range project.findings {
+			found = found || strings.HasPrefix(f.problem, expected) && strings.HasPrefix(f.resource, "permission/deniedTaker.")
+		}
+		if !found {
+			t.Errorf("expected a finding %q for %s, have %v", expected, project.gcpProject.ProjectId, project.findings)
+		}
+	}
+	if denied.application != nil {
+		t.Errorf("expected no application for %s, have %v", denied.gcpProject.ProjectId, denied.application)
+	}
+
+	var buf bytes.Buffer
+	displayProjects(&buf, projects)
+	if !strings.Contains(buf.String(), "service[test1S1]") {
+		t.Errorf("expected the service denied its versions still reported, have:\n%s", buf.String())
+	}
+}
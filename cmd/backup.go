@@ -4,15 +4,19 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"os"
+	"regexp"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 	"google.golang.org/api/cloudresourcemanager/v1"
+	cloudscheduler "google.golang.org/api/cloudscheduler/v1beta1"
+	monitoring "google.golang.org/api/monitoring/v3"
 	"google.golang.org/api/sqladmin/v1beta4"
 	"google.golang.org/api/storage/v1"
 )
@@ -35,7 +39,8 @@ One key is 'env' and the value is the environment for this command.
 Another key is 'component' and is the value of the runtime component.
 The third key is 'run-backups' and indicates, if true, that the storage should be backed up.
 A GCS bucket which has label match of  'backup' and env:<env>
-will be considered the backup bucket for this environment.
+will be considered the backup bucket for this environment; with --bucket-label,
+the buckets matching those labels are considered the backup buckets instead.
 Backup objects within this bucket are named: /backup/<component>/<env>/<resource-kind>
 Eg, /backup/foo/dev/datastore
 
@@ -45,42 +50,81 @@ should have backups enabled and should have a history of recent backups.
 For each project discovered that should have backed-up storage, the program will
 discover Cloud SQL instances and Datastore and determine if backups should be taken.
 If so, it will check to see if a backup has been done within the interval specified by
-the 'within' option (default is 24h).
+the 'within' option (default is 24h); --within-sql and --within-datastore give
+Cloud SQL and Datastore backups an interval of their own. Datastore kinds whose
+newest backup is older are marked STALE. Kinds named with --expected-kind, or listed under expectedKinds
+in the configuration file, which have no backup object at all are reported as MISSING, and Cloud SQL instances without automated backups or
+point-in-time recovery as NO-BACKUPS and NO-PITR. Backup buckets outside the
+locations given with --allowed-bucket-location are reported as NOT-ALLOWED.
+With --check-schedules, the Cloud Scheduler jobs whose name or description
+matches --schedule-pattern are taken as the jobs exporting the backups, each
+exporting the kinds it names or, naming none, every kind. Kinds backed up which
+no job exports are reported as UNSCHEDULED, and jobs whose kinds are all stale
+as NO-RECENT-BACKUP.
+With --fail-on-stale, any of these makes the command exit with an error.
+With --only-stale, as with --quiet no progress is shown, and the text report
+leaves out the projects whose backups are all as they should be; given
+expected kinds, the listing of a backup bucket also stops as soon as each of
+them, and every other kind listed so far, has a fresh backup.
+With --stream-objects, a backup bucket's objects older than the window are
+counted and dropped while listing, keeping only the newest older one of each
+kind, so that long backup histories do not all sit in memory. Every object is
+still listed: GCS cannot list by update time, and names ordered oldest first
+leave the newest backups to the end.
+With --max-age, each Cloud SQL instance shows every backup run, and each
+backup bucket every backup object, younger than it, as an inventory of the
+backups over a trailing window; --within still decides what is stale.
+With --push-metrics, the age of each resource's newest backup is also written to
+Cloud Monitoring in --metric-project as custom.googleapis.com/gcp_reports/backup_age_seconds.
 `,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		env = viper.GetString("envKey")
 		component = viper.GetString("componentKey")
 		backup = viper.GetString("backupKey")
 		withinDuration = viper.GetDuration("within")
+		if viper.GetInt("maxBackupRuns") < 0 {
+			return errors.New("--max-backup-runs must not be negative")
+		}
+		if viper.GetDuration("maxAge") < 0 {
+			return errors.New("--max-age must not be negative")
+		}
+		onlyStale := viper.GetBool("onlyStale")
+		if _, err := backupBucketSelector(); err != nil {
+			return err
+		}
+		checkSchedules := viper.GetBool("checkSchedules")
+		schedulePattern, patternErr := regexp.Compile(viper.GetString("schedulePattern"))
+		if patternErr != nil {
+			return fmt.Errorf("invalid --schedule-pattern: %v", patternErr)
+		}
 
-		fmt.Printf("using env key[%s], backup key[%s], component key[%s] across environments%v\n",
+		logger.Infof("using env key[%s], backup key[%s], component key[%s] across environments%v",
 			env, backup, component, envFilter)
-		ctx := oauth2.NoContext
-		client, err := google.DefaultClient(ctx, cloudresourcemanager.CloudPlatformReadOnlyScope)
-		if err != nil {
-			log.Fatalln("cannot create a gcloud client:", err)
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+		defer cancel()
+		pushMetrics, metricProject := viper.GetBool("pushMetrics"), viper.GetString("metricProject")
+		if pushMetrics && metricProject == "" {
+			return errors.New("--push-metrics needs a --metric-project to write to")
 		}
-
-		cloudResourceManagerService, err := cloudresourcemanager.New(client)
-		if err != nil {
-			log.Fatalln("cannot establish cloud resource-manager service:", err)
+		scopes := []string{cloudresourcemanager.CloudPlatformReadOnlyScope}
+		if pushMetrics {
+			scopes = append(scopes, monitoring.MonitoringWriteScope)
 		}
-
-		pService := cloudresourcemanager.NewProjectsService(cloudResourceManagerService)
-		projects, projErr := pService.List().Context(ctx).Do()
-		if projErr != nil {
-			log.Fatalln("cannot list projects at Google Cloud:", projErr)
+		clients, err := setupClients(ctx, args, scopes...)
+		if err != nil || clients.dryRun(textOutput()) {
+			return err
 		}
+		ourProjects := clients.projects
 
-		sqladminService, saErr := sqladmin.New(client)
+		sqladminService, saErr := sqladmin.New(clients.http)
 		if saErr != nil {
-			log.Fatalln("cannot create an sql admin service:", saErr)
+			return fmt.Errorf("cannot create an sql admin service: %v", saErr)
 		}
 
-		storageService, storageErr := storage.New(client)
+		storageService, storageErr := storage.New(clients.http)
 		// get GCS buckets that belong to project to see if any marked as backup
 		if storageErr != nil {
-			log.Fatalln("cannot use storage API successfully:", storageErr)
+			return fmt.Errorf("cannot use storage API successfully: %v", storageErr)
 		}
 
 		storageTaker := &TakerStorageGCP{
@@ -89,22 +133,120 @@ the 'within' option (default is 24h).
 		sqladminTaker := &TakerSQLAdminGCP{
 			sqladminService: sqladminService,
 		}
-		ourProjects := filterProjects(projects.Projects, args, envFilter)
+		var schedulerTaker *TakerSchedulerGCP
+		if checkSchedules {
+			schedulerService, schedulerErr := cloudscheduler.New(clients.http)
+			if schedulerErr != nil {
+				return fmt.Errorf("cannot establish cloud scheduler service: %v", schedulerErr)
+			}
+			schedulerTaker = &TakerSchedulerGCP{schedulerService: schedulerService}
+		}
+		setConcurrency(viper.GetInt("concurrency"))
 
 		// we now have a list of (filtered) projects that should have backups
+		errs := newProjectErrors()
+		var bar *progress
+		if !onlyStale {
+			bar = stderrProgress(len(ourProjects))
+		}
 		for _, project := range ourProjects {
-			fmt.Printf("project ID[%32s]: env[%8s], component[%28s]\n",
-				project.gcpProject.ProjectId, project.env, project.component)
+			projectCtx, cancelProject := projectContext(ctx)
+			storageErr, sqlErr := project.IngestBackups(projectCtx, storageTaker, sqladminTaker)
+			storageErr, sqlErr = project.recordDenied(storageErr), project.recordDenied(sqlErr)
+			storageErr, sqlErr = projectTimedOut(ctx, projectCtx, storageErr), projectTimedOut(ctx, projectCtx, sqlErr)
+			if checkSchedules && storageErr == nil {
+				scheduleErr := project.IngestSchedulerJobs(projectCtx, schedulerTaker, schedulePattern)
+				switch {
+				case scheduleErr == nil:
+					project.CheckSchedules()
+				case project.recordDenied(scheduleErr) != nil:
+					logger.Warnf("cannot list the scheduler jobs of %s: %v", project.gcpProject.ProjectId, projectTimedOut(ctx, projectCtx, scheduleErr))
+				}
+			}
+			cancelProject()
+			errs.add(project.gcpProject.ProjectId, backupsError(storageErr, sqlErr))
+			projectStream.Emit(project)
+			bar.Done()
+		}
+		bar.Finish()
+		ingestErr := errs.Err()
+		if ctx.Err() != nil {
+			if failed := errs.projects(); len(failed) > 0 {
+				ingestErr = newIncompleteError(failed, ctx.Err())
+			}
+		}
 
-			storageErr = project.IngestStorage(storageTaker)
-			sqlErr := project.IngestSQLInstances(sqladminTaker)
-			if storageErr != nil || sqlErr != nil {
-				log.Println("at least some GCP info cannot be ingested:", sqlErr, storageErr)
+		if !renderReport(os.Stdout, ourProjects) {
+			w := textOutput()
+			for _, group := range groupProjects(reportableProjects(ourProjects)) {
+				group.DisplayHeader(w)
+				for _, project := range group.projects {
+					if onlyStale && project.Summarize().BackupProblems() == 0 {
+						continue
+					}
+					if project.empty() {
+						project.displayEmpty(w)
+						continue
+					}
+					project.displayBackupHeader(w)
+					project.Display(w)
+				}
 			}
+			summarizeProjects(ourProjects).DisplayBackups(w)
 		}
+		failOnStale := viper.GetBool("failOnStale")
+
+		if pushMetrics {
+			monitoringService, monErr := monitoring.New(clients.http)
+			if monErr != nil {
+				return fmt.Errorf("cannot establish monitoring service: %v", monErr)
+			}
+			taker := &TakerMonitoringGCP{monitoringService: monitoringService}
+			if pushErr := pushBackupMetrics(ctx, taker, metricProject, ourProjects, time.Now()); pushErr != nil {
+				return fmt.Errorf("cannot push backup metrics to %s: %v", metricProject, pushErr)
+			}
+		}
+		if ingestErr != nil {
+			// a scan failed or left incomplete fails regardless of --fail-on-stale
+			return ingestErr
+		}
+		if problems := summarizeProjects(ourProjects).BackupProblems(); failOnStale && problems > 0 {
+			return fmt.Errorf("%d stale, missing, unprotected or mislocated backups found", problems)
+		}
+		return nil
 	},
 }
 
+// backupsError is the failure to ingest a project's backups, from its
+// storage buckets, its Cloud SQL instances or both
+func backupsError(storageErr, sqlErr error) error {
+	switch {
+	case storageErr != nil && sqlErr != nil:
+		return fmt.Errorf("%v; %v", storageErr, sqlErr)
+	case storageErr != nil:
+		return storageErr
+	}
+	return sqlErr
+}
+
+// displayBackupHeader introduces the backups of the project with its env and
+// component, as a table of the one project
+func (p *reportProject) displayBackupHeader(w io.Writer) {
+	table := newTable(w)
+	fmt.Fprintln(table, "PROJECT\tENV\tCOMPONENT")
+	fmt.Fprintf(table, "%s\t%s\t%s\n", p.gcpProject.ProjectId, supplyDefault(p.env, "-"), supplyDefault(p.component, "-"))
+	table.Flush()
+}
+
+// backupWithin is the interval within which a backup of the resource type
+// should have completed: its --within-<type> when set, otherwise --within.
+func backupWithin(resourceType string) time.Duration {
+	if within := viper.GetDuration("within" + resourceType); within > 0 {
+		return within
+	}
+	return viper.GetDuration("within")
+}
+
 var (
 	within       *time.Duration
 	envKey       *string
@@ -125,14 +267,46 @@ func init() {
 	// is called directly, e.g.:
 	duration, _ := time.ParseDuration("24h")
 	within = backupCmd.Flags().DurationP("within", "w", duration, "interval from now last backup should have occurred")
+	backupCmd.Flags().Duration("within-sql", 0, "interval for Cloud SQL backups alone (default is --within)")
+	backupCmd.Flags().Duration("within-datastore", 0, "interval for Datastore backups alone (default is --within)")
 	envKey = backupCmd.Flags().String("env-key", "env", "platform label key describing environment")
 	componentKey = backupCmd.Flags().String("component-key", "component", "platform label key describing component")
+	backupCmd.Flags().StringArray("bucket-label", []string{}, "treat buckets carrying this label key=value as backup buckets instead of those with --backup-key true (repeatable; values of one key are alternatives)")
+	backupCmd.Flags().StringArray("allowed-bucket-location", []string{}, "location a backup bucket may be in, eg EUROPE-WEST1 or EU (repeatable; default allows any)")
+	backupCmd.Flags().String("backup-prefix", "backup/", "only list backup bucket objects whose names start with this; empty lists all")
+	backupCmd.Flags().Int("max-backup-runs", 3, "how many of the most recent backup runs of each Cloud SQL instance to show")
+	backupCmd.Flags().Duration("max-age", 0, "display every backup run and backup object younger than this, eg 720h for an inventory, instead of the most recent runs alone; --within still decides what is stale")
+	backupCmd.Flags().Bool("fail-on-stale", false, "exit with an error when a backup is stale or missing, or a SQL instance lacks backups or point-in-time recovery")
+	backupCmd.Flags().StringArray("production-env", []string{"prod", "production"}, "env label value of production projects, whose Cloud SQL instances should be regional (repeatable)")
+	backupCmd.Flags().StringArray("expected-kind", []string{}, "datastore kind which must have a backup object (repeatable)")
+	backupCmd.Flags().Bool("only-stale", false, "report only the projects with backup problems, without progress, stopping bucket listings early once the --expected-kind kinds are fresh")
+	backupCmd.Flags().Bool("stream-objects", false, "keep only the objects of each kind within --within, and the newest one older, while listing backup buckets, bounding memory on long backup histories")
+	backupCmd.Flags().Bool("check-schedules", false, "also check that Cloud Scheduler jobs export the kinds backed up")
+	backupCmd.Flags().String("schedule-pattern", "(?i)backup|export", "regular expression matching the name or description of the scheduler jobs running backups")
+	backupCmd.Flags().Bool("push-metrics", false, "also write the age of each backup to Cloud Monitoring as a custom metric")
+	backupCmd.Flags().String("metric-project", "", "project whose Cloud Monitoring receives --push-metrics")
 	backupKey = backupCmd.Flags().String("backup-key", "backup", "GCS label key whose value (true/false) indicates whether a bucket is a backup bucket for Datastore")
 
 	// bind things together....
 	viper.BindPFlag("within", backupCmd.Flags().Lookup("within"))
+	viper.BindPFlag("withinSQL", backupCmd.Flags().Lookup("within-sql"))
+	viper.BindPFlag("withinDatastore", backupCmd.Flags().Lookup("within-datastore"))
 	viper.BindPFlag("envKey", backupCmd.Flags().Lookup("env-key"))
 	viper.BindPFlag("componentKey", backupCmd.Flags().Lookup("component-key"))
 	viper.BindPFlag("backupKey", backupCmd.Flags().Lookup("backup-key"))
+	viper.BindPFlag("pushMetrics", backupCmd.Flags().Lookup("push-metrics"))
+	viper.BindPFlag("metricProject", backupCmd.Flags().Lookup("metric-project"))
+	viper.BindPFlag("bucketLabel", backupCmd.Flags().Lookup("bucket-label"))
+	viper.BindPFlag("allowedBucketLocation", backupCmd.Flags().Lookup("allowed-bucket-location"))
+	viper.BindPFlag("backupPrefix", backupCmd.Flags().Lookup("backup-prefix"))
+	viper.BindPFlag("maxBackupRuns", backupCmd.Flags().Lookup("max-backup-runs"))
+	viper.BindPFlag("maxAge", backupCmd.Flags().Lookup("max-age"))
+	viper.BindPFlag("failOnStale", backupCmd.Flags().Lookup("fail-on-stale"))
+	viper.BindPFlag("productionEnv", backupCmd.Flags().Lookup("production-env"))
+	viper.BindPFlag("expectedKind", backupCmd.Flags().Lookup("expected-kind"))
+	viper.BindPFlag("onlyStale", backupCmd.Flags().Lookup("only-stale"))
+	viper.BindPFlag("streamObjects", backupCmd.Flags().Lookup("stream-objects"))
+	viper.BindPFlag("checkSchedules", backupCmd.Flags().Lookup("check-schedules"))
+	viper.BindPFlag("schedulePattern", backupCmd.Flags().Lookup("schedule-pattern"))
 
 }
@@ -0,0 +1,98 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+var p2ds = map[string][]*bigqueryDataset{
+	"test1-project-000": []*bigqueryDataset{
+		&bigqueryDataset{
+			Dataset: bigquery.Dataset{DatasetReference: &bigquery.DatasetReference{DatasetId: "events"}, Location: "US",
+				DefaultTableExpirationMs: 3600000},
+			DefaultEncryptionConfiguration: &bigquery.EncryptionConfiguration{KmsKeyName: "projects/k/locations/us/keyRings/r/cryptoKeys/bq"},
+		},
+		&bigqueryDataset{
+			Dataset: bigquery.Dataset{DatasetReference: &bigquery.DatasetReference{DatasetId: "scratch"}, Location: "asia-northeast1"},
+		},
+	},
+}
+
+type TestBigQueryTaker struct{}
+
+func (tt *TestBigQueryTaker) ListDatasets(ctx context.Context, rp *reportProject) ([]*bigquery.DatasetListDatasets, error) {
+	var listed []*bigquery.DatasetListDatasets
+	for _, dataset := range p2ds[rp.gcpProject.ProjectId] {
+		listed = append(listed, &bigquery.DatasetListDatasets{DatasetReference: dataset.DatasetReference})
+	}
+	return listed, nil
+}
+
+func (tt *TestBigQueryTaker) GetDataset(ctx context.Context, rp *reportProject, datasetID string) (*bigqueryDataset, error) {
+	for _, dataset := range p2ds[rp.gcpProject.ProjectId] {
+		if dataset.DatasetReference.DatasetId == datasetID {
+			return dataset, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestIngestDatasets(t *testing.T) {
+	defer viper.Set("allowedLocation", []string{})
+	for _, tt := range []struct {
+		allowed    []string
+		unexpected []bool
+		findings   int
+	}{
+		{nil, []bool{false, false}, 1},
+		{[]string{"US", "EU"}, []bool{false, true}, 2},
+	} {
+		viper.Set("allowedLocation", tt.allowed)
+		project := filterFixture(fpTT[0])[0]
+		if err := project.IngestDatasets(context.Background(), &TestBigQueryTaker{}); err != nil {
+			t.Fatalf("unexpected ingest error: %v", err)
+		}
+		if len(project.datasets) != 2 {
+			t.Fatalf("expected 2 datasets, have %d", len(project.datasets))
+		}
+		for i, dataset := range project.datasets {
+			if dataset.unexpectedLocation != tt.unexpected[i] {
+				t.Errorf("allowed%v: dataset %s expected unexpected-location[%t]", tt.allowed,
+					dataset.gcpDataset.DatasetReference.DatasetId, tt.unexpected[i])
+			}
+		}
+		if !project.datasets[0].cmek() || project.datasets[1].cmek() {
+			t.Errorf("expected only the events dataset to use CMEK")
+		}
+		if len(project.findings) != tt.findings {
+			t.Errorf("allowed%v: expected %d findings, have %v", tt.allowed, tt.findings, project.findings)
+		}
+
+		var buf bytes.Buffer
+		project.Display(&buf)
+		if out := buf.String(); strings.Count(out, "NO-CMEK") != 1 || !strings.Contains(out, "table-expiration[    1h0m0s]") {
+			t.Errorf("unexpected display:\n%s", out)
+		}
+	}
+}
+
+func TestDecodeDatasetEncryption(t *testing.T) {
+	raw := `{"datasetReference":{"datasetId":"events"},"location":"US",
+		"defaultEncryptionConfiguration":{"kmsKeyName":"projects/k/locations/us/keyRings/r/cryptoKeys/bq"}}`
+	var dataset bigqueryDataset
+	if err := json.Unmarshal([]byte(raw), &dataset); err != nil {
+		t.Fatalf("cannot decode dataset: %v", err)
+	}
+	if dataset.Location != "US" || dataset.DefaultEncryptionConfiguration == nil {
+		t.Errorf("expected location and encryption to be decoded, have %+v", dataset)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/appengine/v1"
+)
+
+// browseCmd represents the browse command
+var browseCmd = &cobra.Command{
+	Use:   "browse",
+	Short: "Explore the App Engine tree available from given credentials in a terminal UI",
+	Long: `Ingest the App Engine applications of the projects visible from the account
+used, as the apps command does, and present them as a tree to explore: expand
+a project down to its application, services, versions and instances with
+Enter, and see the details of the one selected beside the tree. Resources
+needing attention are shown in red. Quit with q or Escape. For instance:
+    gcp-reports browse our-foo
+The terminal UI is only part of gcp-reports built with -tags browse.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !browseAvailable {
+			return errors.New("browse needs gcp-reports built with the terminal UI: go build -tags browse")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+		defer cancel()
+		clients, err := setupClients(ctx, args, appengine.CloudPlatformReadOnlyScope)
+		if err != nil || clients.dryRun(textOutput()) {
+			return err
+		}
+		ourProjects := clients.projects
+
+		appEngine, err := appengine.New(clients.http)
+		if err != nil {
+			return fmt.Errorf("cannot establish app engine service: %v", err)
+		}
+		taker := &TakerGCP{appEngine: appEngine}
+
+		setConcurrency(viper.GetInt("concurrency"))
+		if ingestErr := ingestProjects(ctx, ourProjects, func(ctx context.Context, project *reportProject) error {
+			return project.Ingest(ctx, taker)
+		}); ingestErr != nil {
+			logger.Errorf("%v", ingestErr)
+		}
+		return runBrowser(newBrowseTree(ourProjects))
+	},
+}
+
+// browseNode is an entry of the browse tree standing for one report node,
+// shown by its label, with its details shown beside the tree when selected
+type browseNode struct {
+	// node is the *reportProject, *reportApplication, *reportService,
+	// *reportVersion or *reportVersionInstance shown, none for the root
+	node     interface{}
+	label    string
+	details  string
+	children []*browseNode
+	// alert is set when the node, or one of its descendants, has a problem
+	alert bool
+}
+
+// newBrowseTree makes the browse tree of the ingested projects: each project
+// over its application, services, versions and their instances, in the
+// order ingested
+func newBrowseTree(projects []*reportProject) *browseNode {
+	root := &browseNode{label: fmt.Sprintf("%d projects", len(projects))}
+	for _, project := range projects {
+		root.add(newBrowseProject(project))
+	}
+	return root
+}
+
+// add makes child one of the node's children, passing up its alert
+func (n *browseNode) add(child *browseNode) {
+	n.children = append(n.children, child)
+	n.alert = n.alert || child.alert
+}
+
+func newBrowseProject(project *reportProject) *browseNode {
+	gcpProject := project.gcpProject
+	var details bytes.Buffer
+	fmt.Fprintf(&details, "project[%s]\n", gcpProject.ProjectId)
+	fmt.Fprintf(&details, "  name[%s] number[%d]\n", gcpProject.Name, gcpProject.ProjectNumber)
+	fmt.Fprintf(&details, "  env[%s] component[%s]\n", supplyDefault(project.env, "-"), supplyDefault(project.component, "-"))
+	var keys []string
+	for key := range gcpProject.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var labels []string
+	for _, key := range keys {
+		labels = append(labels, key+"="+gcpProject.Labels[key])
+	}
+	fmt.Fprintf(&details, "  labels[%s]\n", strings.Join(labels, " "))
+	for _, finding := range project.findings {
+		fmt.Fprintf(&details, "  %s %s: %s\n", alert(strings.ToUpper(finding.severity.String())), finding.resource, finding.problem)
+	}
+
+	node := &browseNode{node: project, label: gcpProject.ProjectId, details: details.String(), alert: len(project.findings) > 0}
+	if project.application != nil {
+		node.add(newBrowseApplication(project.application))
+	}
+	return node
+}
+
+func newBrowseApplication(app *reportApplication) *browseNode {
+	gcpApplication := app.gcpApplication
+	var details bytes.Buffer
+	fmt.Fprintf(&details, "application[%s]: status[%s]\n", gcpApplication.Id, servingStatus(gcpApplication.ServingStatus))
+	fmt.Fprintf(&details, "  location[%s] hostname[%s]\n", supplyDefault(gcpApplication.LocationId, "-"), supplyDefault(gcpApplication.DefaultHostname, "-"))
+	fmt.Fprintf(&details, "  %d services\n", len(app.services))
+
+	node := &browseNode{node: app, label: "application[" + gcpApplication.Id + "]", details: details.String()}
+	for _, service := range app.services {
+		node.add(newBrowseService(service))
+	}
+	return node
+}
+
+func newBrowseService(service *reportService) *browseNode {
+	var details bytes.Buffer
+	service.Display(&details)
+
+	node := &browseNode{node: service, label: "service[" + service.gcpService.Id + "]", details: details.String(), alert: service.staleRollout}
+	for _, version := range service.versions {
+		node.add(newBrowseVersion(version))
+	}
+	return node
+}
+
+func newBrowseVersion(version *reportVersion) *browseNode {
+	gcpVersion := version.gcpVersion
+	deployed := formatTime(version.deployTime)
+	if version.deployTimeUnknown {
+		deployed = "unknown"
+	}
+	var split float64
+	if version.service.gcpService.Split != nil {
+		split = version.service.gcpService.Split.Allocations[gcpVersion.Id] * 100.0
+	}
+	var details bytes.Buffer
+	fmt.Fprintf(&details, "version[%s]: %s\n", gcpVersion.Id, versionStatus(version))
+	fmt.Fprintf(&details, "  runtime[%s] env[%s] split[%.0f%%] instances[%d]\n", gcpVersion.Runtime,
+		supplyDefault(gcpVersion.Env, "standard"), split, len(version.instances))
+	fmt.Fprintf(&details, "  deployed by[%s] at [%s]\n", supplyDefault(gcpVersion.CreatedBy, "-"), deployed)
+	fmt.Fprintf(&details, "  url[%s]\n", supplyDefault(gcpVersion.VersionUrl, "-"))
+
+	node := &browseNode{node: version, label: "version[" + gcpVersion.Id + "]", details: details.String(),
+		alert: version.emptyServing || version.deprecatedRuntime || version.manyInstances}
+	for _, instance := range version.instances {
+		node.add(newBrowseInstance(instance))
+	}
+	return node
+}
+
+func newBrowseInstance(instance *reportVersionInstance) *browseNode {
+	gcpInstance := instance.gcpVersionInstance
+	var details bytes.Buffer
+	fmt.Fprintf(&details, "instance[%s]\n", gcpInstance.Id)
+	fmt.Fprintf(&details, "  vm[%s] vm status[%s] availability[%s]\n", supplyDefault(gcpInstance.VmName, "-"),
+		supplyDefault(gcpInstance.VmStatus, "-"), supplyDefault(gcpInstance.Availability, "-"))
+	fmt.Fprintf(&details, "  requests[%d] started[%s]\n", gcpInstance.Requests, supplyDefault(formatTimestamp(gcpInstance.StartTime), "-"))
+	return &browseNode{node: instance, label: "instance[" + gcpInstance.Id + "]", details: details.String()}
+}
+
+func init() {
+	RootCmd.AddCommand(browseCmd)
+}
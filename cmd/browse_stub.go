@@ -0,0 +1,17 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+//go:build !browse
+// +build !browse
+
+package cmd
+
+// browseAvailable is false in builds without the browse tag, which leave out
+// the terminal UI and its dependencies
+const browseAvailable = false
+
+// runBrowser is never reached without the terminal UI, browse refusing to
+// run beforehand
+func runBrowser(root *browseNode) error {
+	return nil
+}
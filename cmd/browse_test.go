@@ -0,0 +1,67 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBrowseTree(t *testing.T) {
+	project := goldenProject()
+	version := project.application.services[0].versions[0]
+	version.emptyServing = true
+	project.addFinding(severityWarn, "sql/db", "has no backup")
+
+	root := newBrowseTree([]*reportProject{project, {gcpProject: gcpP[9]}})
+	if root.label != "2 projects" || len(root.children) != 2 || !root.alert {
+		t.Fatalf("expected a root over both projects needing attention, have %q with %d children", root.label, len(root.children))
+	}
+
+	var labels []string
+	for node := root.children[0]; ; node = node.children[0] {
+		labels = append(labels, node.label)
+		if !node.alert && node.node != version.instances[0] {
+			t.Errorf("expected %s to need attention as the version under it does", node.label)
+		}
+		if len(node.children) == 0 {
+			break
+		}
+	}
+	expected := "test1-project-000 application[golden-app] service[default] version[v2] instance[i1]"
+	if have := strings.Join(labels, " "); have != expected {
+		t.Errorf("expected the path %q down the tree, have %q", expected, have)
+	}
+	if versions := root.children[0].children[0].children[0].children; len(versions) != 2 || versions[1].alert {
+		t.Errorf("expected both versions under the service and v1 fine, have %d", len(versions))
+	}
+
+	for node, contains := range map[*browseNode][]string{
+		root.children[0]:                                                 {"env[e1] component[c1]", "labels[component=c1 env=e1]", "sql/db: has no backup"},
+		root.children[0].children[0].children[0]:                         {"service[default] shard strat[IP]", "v2"},
+		root.children[0].children[0].children[0].children[0]:             {"version[v2]: SERVING EMPTY", "runtime[go] env[standard] split[100%] instances[1]"},
+		root.children[0].children[0].children[0].children[0].children[0]: {"instance[i1]"},
+	} {
+		for _, expected := range contains {
+			if !strings.Contains(node.details, expected) {
+				t.Errorf("expected %q in the details of %s, have:\n%s", expected, node.label, node.details)
+			}
+		}
+	}
+
+	if bare := root.children[1]; bare.alert || len(bare.children) != 0 {
+		t.Errorf("expected the project without an application to be a fine leaf, have %+v", bare)
+	}
+}
+
+func TestBrowseWithoutUI(t *testing.T) {
+	if browseAvailable {
+		t.Skip("built with the terminal UI")
+	}
+	defer RootCmd.SetArgs(nil)
+	RootCmd.SetArgs([]string{"browse"})
+	if err := RootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "-tags browse") {
+		t.Errorf("expected browse refused without the terminal UI, have %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+//go:build browse
+// +build browse
+
+package cmd
+
+import (
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+const browseAvailable = true
+
+// runBrowser shows the browse tree beside the details of its current node
+// until the user quits
+func runBrowser(root *browseNode) error {
+	details := tview.NewTextView().SetDynamicColors(true).SetWrap(false)
+	details.SetBorder(true).SetTitle(" details ")
+	showDetails := func(node *tview.TreeNode) {
+		if browsed, ok := node.GetReference().(*browseNode); ok {
+			details.SetText(tview.TranslateANSI(tview.Escape(browsed.details))).ScrollToBeginning()
+		}
+	}
+
+	treeRoot := newTreeNode(root).SetExpanded(true)
+	tree := tview.NewTreeView().SetRoot(treeRoot).SetCurrentNode(treeRoot)
+	tree.SetBorder(true).SetTitle(" projects ")
+	tree.SetChangedFunc(showDetails)
+	tree.SetSelectedFunc(func(node *tview.TreeNode) {
+		node.SetExpanded(!node.IsExpanded())
+	})
+	showDetails(treeRoot)
+
+	app := tview.NewApplication()
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || (event.Key() == tcell.KeyRune && event.Rune() == 'q') {
+			app.Stop()
+			return nil
+		}
+		return event
+	})
+	layout := tview.NewFlex().AddItem(tree, 0, 1, true).AddItem(details, 0, 2, false)
+	return app.SetRoot(layout, true).Run()
+}
+
+// newTreeNode makes the collapsed tree view node showing node and its
+// children, in red when they need attention
+func newTreeNode(node *browseNode) *tview.TreeNode {
+	treeNode := tview.NewTreeNode(node.label).SetReference(node).SetExpanded(false)
+	if node.alert {
+		treeNode.SetColor(tcell.ColorRed)
+	}
+	for _, child := range node.children {
+		treeNode.AddChild(newTreeNode(child))
+	}
+	return treeNode
+}
@@ -0,0 +1,141 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/appengine/v1"
+)
+
+// certsCmd represents the certs command
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Show the SSL certificates of App Engine custom domains",
+	Long: `Show the SSL certificates authorized for the App Engine app of each
+project visible from the account used, with the domains they cover and when
+they expire. Certificates expiring within the --within window (default 30
+days) are flagged as EXPIRING. For instance:
+    gcp-reports certs --within 168h our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, appengine.CloudPlatformReadOnlyScope, func(clients *clients) (projectIngester, error) {
+			appEngine, err := appengine.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish app engine service: %v", err)
+			}
+			taker := &TakerCertsGCP{appEngine: appEngine}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestCertificates(ctx, taker)
+			}, nil
+		})
+	},
+}
+
+type TakerCerts interface {
+	ListCertificates(context.Context, *reportProject) ([]*appengine.AuthorizedCertificate, error)
+}
+
+type TakerCertsGCP struct {
+	appEngine *appengine.APIService
+}
+
+type reportCertificate struct {
+	gcpCertificate *appengine.AuthorizedCertificate
+	expireTime     time.Time
+	expiring       bool
+
+	project *reportProject // parent
+}
+
+func (rc *reportCertificate) Parent() reportNode {
+	return rc.project
+}
+
+// ListCertificates gathers the certificates authorized for the project's app
+func (taker *TakerCertsGCP) ListCertificates(ctx context.Context, project *reportProject) (certs []*appengine.AuthorizedCertificate, err error) {
+	err = doWithRetry(ctx, func() error {
+		certs = nil
+		return taker.appEngine.Apps.AuthorizedCertificates.List(project.gcpProject.ProjectId).Pages(ctx,
+			func(page *appengine.ListAuthorizedCertificatesResponse) error {
+				certs = append(certs, page.Certificates...)
+				return nil
+			})
+	})
+	return
+}
+
+// IngestCertificates ingests the app's certificates ordered by expiry,
+// marking those which expire within the configured window.
+func (p *reportProject) IngestCertificates(ctx context.Context, taker TakerCerts) error {
+	var gcpCerts []*appengine.AuthorizedCertificate
+	listErr := limited(func() (err error) {
+		gcpCerts, err = taker.ListCertificates(ctx, p)
+		return
+	})
+	if isNotFound(listErr) {
+		// a project without an App Engine application has no certificates
+		logger.Debugf("project %s has no App Engine application", p.gcpProject.ProjectId)
+		return nil
+	}
+	if listErr != nil {
+		return listErr
+	}
+
+	window := viper.GetDuration("certWithin")
+	for _, gcpCert := range gcpCerts {
+		cert := &reportCertificate{gcpCertificate: gcpCert, project: p}
+		expireTime, parseErr := time.Parse(time.RFC3339, gcpCert.ExpireTime)
+		if parseErr != nil {
+			logger.Warnf("cannot parse expiry of certificate %s: %v", gcpCert.Id, parseErr)
+		} else {
+			cert.expireTime = expireTime
+			if time.Until(expireTime) < window {
+				cert.expiring = true
+				p.addFinding(severityWarn, "certificate/"+gcpCert.Id,
+					fmt.Sprintf("expires %s, within %v", formatTime(expireTime), window))
+			}
+		}
+		p.certificates = append(p.certificates, cert)
+	}
+	sort.SliceStable(p.certificates, func(i, j int) bool {
+		return p.certificates[i].expireTime.Before(p.certificates[j].expireTime)
+	})
+	return nil
+}
+
+// displayCertificates tabulates the certificates, with all the domains each
+// covers
+func displayCertificates(w io.Writer, certs []*reportCertificate) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  CERTIFICATE\tNAME\tEXPIRES\tMAPPINGS\tDOMAINS\tSTATUS")
+	for _, cert := range certs {
+		gcpCert := cert.gcpCertificate
+		expires := "unknown"
+		if !cert.expireTime.IsZero() {
+			expires = formatTime(cert.expireTime)
+		}
+		status := healthy("OK")
+		if cert.expiring {
+			status = alert("EXPIRING")
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%d\t%s\t%s\n", gcpCert.Id, supplyDefault(gcpCert.DisplayName, "-"), expires,
+			gcpCert.DomainMappingsCount, strings.Join(gcpCert.DomainNames, ","), status)
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(certsCmd)
+
+	certsCmd.Flags().Duration("within", 30*24*time.Hour, "flag certificates expiring within this interval from now")
+	viper.BindPFlag("certWithin", certsCmd.Flags().Lookup("within"))
+}
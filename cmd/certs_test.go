@@ -0,0 +1,99 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func expiresIn(d time.Duration) string {
+	return time.Now().Add(d).Format(time.RFC3339)
+}
+
+var p2cert = map[string][]*appengine.AuthorizedCertificate{
+	"test1-project-000": []*appengine.AuthorizedCertificate{
+		&appengine.AuthorizedCertificate{Id: "1111", DisplayName: "www", ExpireTime: expiresIn(90 * 24 * time.Hour),
+			DomainNames: []string{"www.example.com"}, DomainMappingsCount: 1},
+		&appengine.AuthorizedCertificate{Id: "2222", DisplayName: "wildcard", ExpireTime: expiresIn(5 * 24 * time.Hour),
+			DomainNames: []string{"*.example.com", "example.com"}, DomainMappingsCount: 3},
+	},
+}
+
+type TestCertsTaker struct{}
+
+func (tt *TestCertsTaker) ListCertificates(ctx context.Context, rp *reportProject) ([]*appengine.AuthorizedCertificate, error) {
+	return p2cert[rp.gcpProject.ProjectId], nil
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	viper.Set("certWithin", 30*24*time.Hour)
+	defer viper.Set("certWithin", 0)
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestCertificates(context.Background(), &TestCertsTaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.certificates) != 2 {
+		t.Fatalf("expected 2 certificates, have %d", len(project.certificates))
+	}
+	soon, later := project.certificates[0], project.certificates[1]
+	if soon.gcpCertificate.Id != "2222" || !soon.expiring {
+		t.Errorf("expected the certificate expiring in 5 days first and flagged")
+	}
+	if later.expiring {
+		t.Errorf("certificate %s should not be flagged", later.gcpCertificate.Id)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	if strings.Count(out, "EXPIRING") != 1 || !strings.Contains(out, "*.example.com,example.com") {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
+
+// noApplicationCertsTaker answers as for a project without an application
+type noApplicationCertsTaker struct{}
+
+func (nt *noApplicationCertsTaker) ListCertificates(ctx context.Context, rp *reportProject) ([]*appengine.AuthorizedCertificate, error) {
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: "Could not find Application"}
+}
+
+func TestCertificatesWithoutApplication(t *testing.T) {
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestCertificates(context.Background(), &noApplicationCertsTaker{}); err != nil {
+		t.Fatalf("expected no error for a project without an application, have %v", err)
+	}
+	if len(project.certificates) != 0 || len(project.findings) != 0 {
+		t.Errorf("expected no certificates nor findings, have %v and %v", project.certificates, project.findings)
+	}
+}
+
+func TestCertificateTimeFormat(t *testing.T) {
+	viper.Set("timeFormat", timeFormatRFC3339)
+	defer viper.Set("timeFormat", timeFormatRelative)
+	expiry, _ := time.Parse(time.RFC3339, "2030-01-02T03:04:05Z")
+	project := filterFixture(fpTT[0])[0]
+	project.certificates = []*reportCertificate{{gcpCertificate: &appengine.AuthorizedCertificate{Id: "3333"}, expireTime: expiry, project: project}}
+
+	var buf bytes.Buffer
+	displayCertificates(&buf, project.certificates)
+	if !strings.Contains(buf.String(), "2030-01-02T03:04:05Z") {
+		t.Errorf("expected the expiry in --time-format rfc3339, have:\n%s", buf.String())
+	}
+	viper.Set("timeFormat", timeFormatRelative)
+	buf.Reset()
+	displayCertificates(&buf, project.certificates)
+	if strings.Contains(buf.String(), "2030-01-02T03:04:05Z") {
+		t.Errorf("expected the expiry relative to now, have:\n%s", buf.String())
+	}
+}
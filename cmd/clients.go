@@ -0,0 +1,115 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// clients is what a command needs before it ingests anything: an authorized
+// HTTP client to create GCP services from, and the projects to report on
+type clients struct {
+	http     *http.Client
+	projects []*reportProject
+}
+
+// reportedProjects are the projects the running command selected, graded
+// against --exit-code-on and notified of once it completes
+var reportedProjects []*reportProject
+
+// setupClients authorizes with the command's scopes and selects the projects
+// named by args and the project filters
+func setupClients(ctx context.Context, args []string, scopes ...string) (*clients, error) {
+	client, err := newClient(ctx, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create a gcloud client: %v", err)
+	}
+	projects, err := selectProjects(ctx, client, args, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	reportedProjects = projects
+	return &clients{http: client, projects: projects}, nil
+}
+
+// dryRun lists the projects selected when --dry-run is given, reporting
+// whether it did so and the command should stop short of ingesting them
+func (c *clients) dryRun(w io.Writer) bool {
+	if !viper.GetBool("dryRun") {
+		return false
+	}
+	// nothing is scanned, so there is nothing to notify of
+	reportedProjects = nil
+	table := newTable(w)
+	fmt.Fprintln(table, "PROJECT\tENV\tCOMPONENT")
+	for _, project := range c.projects {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", project.gcpProject.ProjectId, supplyDefault(project.env, "-"), supplyDefault(project.component, "-"))
+	}
+	table.Flush()
+	fmt.Fprintf(w, "%d projects would be scanned\n", len(c.projects))
+	return true
+}
+
+// newClient builds the HTTP client every GCP service is created from,
+// authorized by the token source newTokenSource gives.
+func newClient(ctx context.Context, defaultScopes ...string) (*http.Client, error) {
+	tokenSource, err := newTokenSource(ctx, defaultScopes...)
+	if err != nil {
+		return nil, err
+	}
+	return oauth2.NewClient(ctx, tokenSource), nil
+}
+
+// newTokenSource gives the OAuth tokens GCP calls are authorized with: those
+// of the credentials file named by --credentials when given, be it a service
+// account key or user credentials, and of Application Default Credentials
+// otherwise. The scopes asked for are those of --scopes, or the command's own
+// when that is not given.
+func newTokenSource(ctx context.Context, defaultScopes ...string) (oauth2.TokenSource, error) {
+	scopes, err := effectiveScopes(defaultScopes...)
+	if err != nil {
+		return nil, err
+	}
+	keyFile := viper.GetString("credentials")
+	if keyFile == "" {
+		return google.DefaultTokenSource(ctx, scopes...)
+	}
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read credentials: %v", err)
+	}
+	creds, err := google.CredentialsFromJSON(ctx, key, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use credentials in %s: %v", keyFile, err)
+	}
+	return creds.TokenSource, nil
+}
+
+// effectiveScopes returns the OAuth scopes given with --scopes, falling back
+// to defaultScopes when the flag is not used.
+func effectiveScopes(defaultScopes ...string) ([]string, error) {
+	given := getStringSlice("scopes")
+	if len(given) == 0 {
+		return defaultScopes, nil
+	}
+	var scopes []string
+	for _, scope := range given {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("--scopes must name at least one OAuth scope")
+	}
+	return scopes, nil
+}
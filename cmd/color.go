@@ -0,0 +1,74 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+var colorNames = []string{colorAuto, colorAlways, colorNever}
+
+var (
+	alertStyle   = color.New(color.FgRed, color.Bold)
+	healthyStyle = color.New(color.FgGreen)
+)
+
+// setupColor turns colored output on or off for --color. With auto, color
+// is used only when stdout is a terminal and NO_COLOR is not set.
+func setupColor(mode string) error {
+	switch mode {
+	case colorAlways:
+		color.NoColor = false
+	case colorNever:
+		color.NoColor = true
+	case colorAuto:
+		_, noColor := os.LookupEnv("NO_COLOR")
+		color.NoColor = noColor || !stdoutIsTerminal()
+	default:
+		return fmt.Errorf("unknown color mode %q: expecting one of %v", mode, colorNames)
+	}
+	return nil
+}
+
+func stdoutIsTerminal() bool {
+	return isTerminal(os.Stdout)
+}
+
+// isTerminal reports whether f is a terminal able to show color and redraws
+func isTerminal(f *os.File) bool {
+	fd := f.Fd()
+	return os.Getenv("TERM") != "dumb" && (isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd))
+}
+
+// alert highlights a marker calling for attention, such as STALE
+func alert(s string) string {
+	return alertStyle.Sprint(s)
+}
+
+// healthy highlights what is as it should be
+func healthy(s string) string {
+	return healthyStyle.Sprint(s)
+}
+
+// servingStatus colors an App Engine serving status, which may carry padding
+func servingStatus(status string) string {
+	switch strings.TrimSpace(status) {
+	case "SERVING":
+		return healthy(status)
+	case "STOPPED", "USER_DISABLED", "SYSTEM_DISABLED":
+		return alert(status)
+	}
+	return status
+}
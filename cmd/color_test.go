@@ -0,0 +1,74 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+)
+
+func staleDisplay() string {
+	project := goldenProject()
+	instance := &reportSQLInstance{
+		gcpSQLInstance: &sqladmin.DatabaseInstance{
+			Name:     "db",
+			Settings: &sqladmin.Settings{BackupConfiguration: &sqladmin.BackupConfiguration{Enabled: true}},
+		},
+		project: project,
+	}
+	instance.CheckFreshness(time.Now(), 24*time.Hour)
+	project.sqlInstances = []*reportSQLInstance{instance}
+	project.missingKinds = []string{"Widget"}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	return buf.String()
+}
+
+func TestColorNever(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+
+	if err := setupColor(colorNever); err != nil {
+		t.Fatalf("unexpected color error: %v", err)
+	}
+	out := staleDisplay()
+	if strings.Contains(out, "\x1b[") {
+		t.Errorf("expected no ANSI escapes with --color never, have:\n%q", out)
+	}
+	if !strings.Contains(out, " STALE") || !strings.Contains(out, "MISSING") {
+		t.Errorf("expected the markers still shown, have:\n%s", out)
+	}
+
+	if err := setupColor(colorAlways); err != nil {
+		t.Fatalf("unexpected color error: %v", err)
+	}
+	if out := staleDisplay(); !strings.Contains(out, alertStyle.Sprint("STALE")) || !strings.Contains(out, "\x1b[") {
+		t.Errorf("expected STALE highlighted with --color always, have:\n%q", out)
+	}
+}
+
+func TestColorAutoNoColor(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	defer func(value string, set bool) {
+		if set {
+			os.Setenv("NO_COLOR", value)
+		} else {
+			os.Unsetenv("NO_COLOR")
+		}
+	}(os.LookupEnv("NO_COLOR"))
+
+	os.Setenv("NO_COLOR", "1")
+	if err := setupColor(colorAuto); err != nil || !color.NoColor {
+		t.Errorf("expected NO_COLOR to turn color off, have %v %v", color.NoColor, err)
+	}
+	if err := setupColor("sometimes"); err == nil {
+		t.Errorf("expected an error for an unknown color mode")
+	}
+}
@@ -4,9 +4,18 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"fmt"
+	"io"
+	"os"
+	"path"
 	"regexp"
 	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/viper"
@@ -17,27 +26,29 @@ import (
 )
 
 type Taker interface {
-	GetApplication(*reportProject) (*appengine.Application, error)
-	ListServices(*reportApplication) ([]*appengine.Service, error)
-	ListVersions(*reportService) ([]*appengine.Version, error)
-	ListVersionInstances(*reportVersion) ([]*appengine.Instance, error)
+	GetApplication(context.Context, *reportProject) (*appengine.Application, error)
+	ListServices(context.Context, *reportApplication) ([]*appengine.Service, error)
+	ListVersions(context.Context, *reportService) ([]*appengine.Version, error)
+	ListVersionInstances(context.Context, *reportVersion) ([]*appengine.Instance, error)
 	// ListSQLInstances(*reportSQLInstance)
 	// ListBuckets(*reportBucket)
 }
 
 type TakerSQLAdmin interface {
-	ListSQLInstances(*reportProject) ([]*sqladmin.DatabaseInstance, error)
-	ListBackupRuns(*reportProject, *reportSQLInstance) ([]*sqladmin.BackupRun, error)
+	ListSQLInstances(context.Context, *reportProject) ([]*sqladmin.DatabaseInstance, error)
+	ListBackupRuns(context.Context, *reportProject, *reportSQLInstance) ([]*sqladmin.BackupRun, error)
 }
 
 type TakerStorage interface {
-	ListBuckets(*reportProject) ([]*storage.Bucket, error)
-	ListObjects(*reportBucket) ([]*storage.Object, error)
+	ListBuckets(context.Context, *reportProject) ([]*storage.Bucket, error)
+	// ListObjects hands each page of the objects listed to page, in order,
+	// until page returns false or none are left
+	ListObjects(ctx context.Context, bucket *reportBucket, prefix string, page func([]*storage.Object) bool) error
 }
 
 type reportNode interface {
 	Parent() reportNode
-	Ingest(Taker) error
+	Ingest(context.Context, Taker) error
 }
 
 type reportBucket struct {
@@ -46,6 +57,23 @@ type reportBucket struct {
 	gcpObjects []*storage.Object
 	objects    []*reportObject
 	kindMap    map[string][]*reportObject
+	audit      *bucketAudit
+	// totalSize is the byte size of all the objects, kindSizes that of each kind
+	totalSize int64
+	kindSizes map[string]int64
+	// staleKinds are the kinds whose newest backup is older than --within
+	staleKinds map[string]bool
+	// misplaced counts the backup objects whose path does not match the project
+	misplaced int
+	// mislocated is set when the bucket lies outside the allowed locations
+	mislocated bool
+	// listingStopped is set when --only-stale stopped listing the objects
+	// once every kind had a fresh backup, leaving the rest unlisted
+	listingStopped bool
+	// discarded tallies the objects listed that --stream-objects left out of
+	// objects, discardedKinds those of each kind among them
+	discarded      objectTally
+	discardedKinds map[string]objectTally
 
 	project *reportProject
 }
@@ -54,9 +82,29 @@ func (rb *reportBucket) Parent() reportNode {
 	return rb.project
 }
 
+// objectTally counts objects and their byte size
+type objectTally struct {
+	count int
+	size  int64
+}
+
+func (t *objectTally) add(object *storage.Object) {
+	t.count++
+	t.size += int64(object.Size)
+}
+
 type reportSQLInstance struct {
 	gcpSQLInstance *sqladmin.DatabaseInstance
 	backupRuns     []*reportBackupRun
+	backupRunsErr  error
+	// stale is set when no backup run has completed within --within
+	stale bool
+	// zonal is set for a production instance without regional availability
+	zonal bool
+	// backupsDisabled is set when automated backups are off, and noPITR when
+	// they are on but binary logging, needed for point-in-time recovery, is not
+	backupsDisabled bool
+	noPITR          bool
 
 	project *reportProject // parent
 }
@@ -83,6 +131,20 @@ type reportVersion struct {
 	gcpVersion *appengine.Version
 	instances  []*reportVersionInstance
 	deployTime time.Time
+	// deployTimeUnknown is set when the version's CreateTime would not parse;
+	// such versions sort as the oldest.
+	deployTimeUnknown bool
+	// emptyServing is set when a version under basic or manual scaling is
+	// SERVING without any instance
+	emptyServing bool
+	// deprecatedRuntime is set when the version runs on a runtime named by
+	// --deprecated-runtime
+	deprecatedRuntime bool
+	// manyInstances is set when the version runs more instances than
+	// --max-instances-warn
+	manyInstances bool
+	// cost is the version's monthly cost estimate from --price-table, if any
+	cost *costEstimate
 
 	service *reportService // parent
 }
@@ -94,6 +156,8 @@ func (rv *reportVersion) Parent() reportNode {
 type reportService struct {
 	gcpService *appengine.Service
 	versions   []*reportVersion
+	// staleRollout is set when all traffic goes to a version other than the newest
+	staleRollout bool
 
 	application *reportApplication //parent
 }
@@ -122,15 +186,249 @@ type reportProject struct {
 	backupBuckets []*reportBucket
 	sqlInstances  []*reportSQLInstance
 	application   *reportApplication
+
+	computeInstances []*reportComputeInstance
+	clusters         []*reportCluster
+	bindings         []*reportBinding
+	serviceAccounts  []*reportServiceAccount
+	certificates     []*reportCertificate
+	topics           []*reportTopic
+	datasets         []*reportDataset
+	storageBuckets   []*reportBucket
+	repositories     []*reportRepository
+	functions        []*reportFunction
+	runServices      []*reportRunService
+	firewallRules    []*reportFirewallRule
+	disks            []*reportDisk
+	dnsZones         []*reportDNSZone
+	networks         []*reportNetwork
+	addresses        []*reportAddress
+	schedulerJobs    []*reportSchedulerJob
+	keyRings         []*reportKeyRing
+	secrets          []*reportSecret
+	sinks            []*reportSink
+	alertPolicies    []*reportAlertPolicy
+	// missingKinds are expected datastore kinds without any backup object
+	missingKinds []string
+	// unscheduledKinds are backed up kinds without a scheduler job exporting them
+	unscheduledKinds []string
+	// alertsChecked is set once the alert policies are ingested, telling no
+	// policies from policies not looked for
+	alertsChecked bool
+	// uncoveredResourceTypes are required resource types no enabled alert
+	// policy watches
+	uncoveredResourceTypes []string
+
+	findingsMu sync.Mutex
+	findings   []finding
+}
+
+// finding is a problem noticed about one of a project's resources
+type finding struct {
+	severity severity
+	resource string
+	problem  string
+}
+
+// addFinding records a problem of severity s with the named resource; it is
+// safe to call from concurrent ingestion.
+func (rp *reportProject) addFinding(s severity, resource, problem string) {
+	rp.findingsMu.Lock()
+	defer rp.findingsMu.Unlock()
+	rp.findings = append(rp.findings, finding{severity: s, resource: resource, problem: problem})
+}
+
+// recordDenied records err, when it is a permission the credentials lack, as
+// a finding on the project, and returns any other error: the project is then
+// reported on as far as it could be ingested rather than failing the run.
+func (rp *reportProject) recordDenied(err error) error {
+	call, apiErr, denied := permissionDenied(err)
+	if !denied {
+		return err
+	}
+	resource := supplyDefault(call, "api")
+	problem := fmt.Sprintf("permission denied on %s for %s", resource, rp.gcpProject.ProjectId)
+	if apiErr.Message != "" {
+		problem += ": " + apiErr.Message
+	}
+	rp.addFinding(severityWarn, "permission/"+resource, problem)
+	return nil
 }
 
 func (rp *reportProject) Parent() reportNode {
 	return rp
 }
 
+// projectIngester ingests the resources of one project for a report
+type projectIngester func(context.Context, *reportProject) error
+
+// runReport does the work of a resource command: it selects the projects args
+// name with credentials given scope, all within --timeout, ingests each with
+// the ingester that newIngester builds on the clients, and renders their
+// report. A project failing to ingest still has its report rendered, and then
+// the returned error names it.
+func runReport(args []string, scope string, newIngester func(*clients) (projectIngester, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+	defer cancel()
+	clients, err := setupClients(ctx, args, scope)
+	if err != nil || clients.dryRun(textOutput()) {
+		return err
+	}
+	ingest, err := newIngester(clients)
+	if err != nil {
+		return err
+	}
+
+	setConcurrency(viper.GetInt("concurrency"))
+	ingestErr := ingestProjects(ctx, clients.projects, ingest)
+	if !renderReport(os.Stdout, clients.projects) {
+		displayProjects(textOutput(), clients.projects)
+	}
+	return ingestErr
+}
+
+// ingestProjects runs ingest against each project concurrently. If ctx is
+// done before every project completes, the unfinished projects are named in
+// the returned error. A project outlasting --per-project-timeout fails alone,
+// leaving the others to complete, while one denied a permission is recorded
+// with a finding instead of failing.
+func ingestProjects(ctx context.Context, projects []*reportProject, ingest func(context.Context, *reportProject) error) error {
+	errs := newProjectErrors()
+	doneChan := make(chan string)
+	for _, project := range projects {
+		logger.Debugf("project pre: %s", project.gcpProject.ProjectId)
+		go func(project *reportProject) {
+			projectCtx, cancel := projectContext(ctx)
+			ingestErr := project.recordDenied(ingest(projectCtx, project))
+			ingestErr = projectTimedOut(ctx, projectCtx, ingestErr)
+			cancel()
+			projectStream.Emit(project)
+			logger.Debugf("project inside done: %s %v", project.gcpProject.ProjectId, ingestErr)
+			errs.add(project.gcpProject.ProjectId, ingestErr)
+			doneChan <- project.gcpProject.ProjectId
+		}(project)
+	}
+	bar := stderrProgress(len(projects))
+	for range projects {
+		logger.Debugf("project done %s", <-doneChan)
+		bar.Done()
+	}
+	bar.Finish()
+	if ctx.Err() != nil {
+		if failed := errs.projects(); len(failed) > 0 {
+			return newIncompleteError(failed, ctx.Err())
+		}
+	}
+	return errs.Err()
+}
+
+// projectContext bounds the ingestion of one project by --per-project-timeout,
+// when that is set, as well as by ctx
+func projectContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := viper.GetDuration("perProjectTimeout"); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// projectTimedOut marks err as a projectTimeoutError when projectCtx ran out
+// of its own time while ctx, bounding every project, had not
+func projectTimedOut(ctx, projectCtx context.Context, err error) error {
+	if err != nil && ctx.Err() == nil && projectCtx.Err() == context.DeadlineExceeded {
+		return &projectTimeoutError{timeout: viper.GetDuration("perProjectTimeout"), cause: err}
+	}
+	return err
+}
+
+// projectTimeoutError fails a project not ingested within --per-project-timeout
+type projectTimeoutError struct {
+	timeout time.Duration
+	cause   error
+}
+
+func (e *projectTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v: %v", e.timeout, e.cause)
+}
+
+// projectErrors collects the ingestion errors of projects ingested
+// concurrently, keyed by project ID
+type projectErrors struct {
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+func newProjectErrors() *projectErrors {
+	return &projectErrors{errs: make(map[string]error)}
+}
+
+// add records the project's error; a nil error is not a failure
+func (pe *projectErrors) add(projectID string, err error) {
+	if err == nil {
+		return
+	}
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	pe.errs[projectID] = err
+}
+
+// projects names the projects that failed, sorted
+func (pe *projectErrors) projects() []string {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	var projectIDs []string
+	for projectID := range pe.errs {
+		projectIDs = append(projectIDs, projectID)
+	}
+	sort.Strings(projectIDs)
+	return projectIDs
+}
+
+// Err is nil when no project failed, and otherwise lists every failure
+func (pe *projectErrors) Err() error {
+	failed := pe.projects()
+	if len(failed) == 0 {
+		return nil
+	}
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	aggregate := &ingestErrors{projects: failed}
+	for _, projectID := range failed {
+		aggregate.errs = append(aggregate.errs, pe.errs[projectID])
+	}
+	return aggregate
+}
+
+// ingestErrors is the consolidated failure of several projects' ingestion
+type ingestErrors struct {
+	projects []string
+	errs     []error
+}
+
+func (e *ingestErrors) Error() string {
+	failures := make([]string, len(e.projects))
+	for index, projectID := range e.projects {
+		failures[index] = fmt.Sprintf("%s: %v", projectID, e.errs[index])
+	}
+	return fmt.Sprintf("ingestion failed for %d projects: %s", len(e.projects), strings.Join(failures, "; "))
+}
+
+// incompleteError names the projects whose ingestion was cut short
+type incompleteError struct {
+	projects []string
+	cause    error
+}
+
+func newIncompleteError(projects []string, cause error) *incompleteError {
+	sort.Strings(projects)
+	return &incompleteError{projects: projects, cause: cause}
+}
+
+func (e *incompleteError) Error() string {
+	return fmt.Sprintf("ingestion did not complete for projects %v: %v", e.projects, e.cause)
+}
+
 type TakerGCP struct {
-	crmService *cloudresourcemanager.Service
-	appEngine  *appengine.APIService
+	appEngine *appengine.APIService
 }
 
 type TakerStorageGCP struct {
@@ -142,50 +440,82 @@ type TakerSQLAdminGCP struct {
 }
 
 // ListServices takes GCP-provided data about services provided by an application
-func (taker *TakerGCP) ListServices(ra *reportApplication) (services []*appengine.Service, err error) {
+func (taker *TakerGCP) ListServices(ctx context.Context, ra *reportApplication) (services []*appengine.Service, err error) {
 	servicesService := appengine.NewAppsServicesService(taker.appEngine)
-	serviceResponse, serr := servicesService.List(ra.gcpApplication.Id).Do()
-	if err == nil {
-		services = serviceResponse.Services
-	}
-	err = serr
+	err = doWithRetry(ctx, func() error {
+		serviceResponse, serr := servicesService.List(ra.gcpApplication.Id).Context(ctx).Do()
+		if serr == nil {
+			services = serviceResponse.Services
+		}
+		return serr
+	})
 	return
 }
 
-func (app *reportApplication) Ingest(taker Taker) error {
-	if services, svcErr := taker.ListServices(app); svcErr != nil {
+// CheckServing flags an application that is stopped or disabled, and so
+// serves none of its services
+func (app *reportApplication) CheckServing() {
+	if status := strings.TrimSpace(app.gcpApplication.ServingStatus); status != "" && status != "SERVING" {
+		app.project.addFinding(severityWarn, "application/"+app.gcpApplication.Id, "is "+status+", not serving")
+	}
+}
+
+func (app *reportApplication) Ingest(ctx context.Context, taker Taker) error {
+	var services []*appengine.Service
+	if svcErr := limited(func() (err error) {
+		services, err = taker.ListServices(ctx, app)
+		return
+	}); svcErr != nil {
 		return svcErr
-	} else {
-		doneChan := make(chan string)
-		for _, service := range services {
-			// fmt.Println("ingest service:", app.gcpApplication.Id+"."+service.Id)
-			repService := &reportService{gcpService: service, application: app}
-			app.services = append(app.services, repService)
-			go func(service *reportService) {
-				repService.Ingest(taker)
-				doneChan <- repService.application.gcpApplication.Id + "." + service.gcpService.Id
-			}(repService)
+	}
+	doneChan := make(chan error)
+	for _, service := range services {
+		logger.Debugf("ingest service: %s.%s", app.gcpApplication.Id, service.Id)
+		repService := &reportService{gcpService: service, application: app}
+		app.services = append(app.services, repService)
+		go func(service *reportService) {
+			doneChan <- app.project.recordDenied(service.Ingest(ctx, taker))
+		}(repService)
+	}
+	// the first failure of a service is the application's
+	var ingestErr error
+	for range services {
+		if err := <-doneChan; ingestErr == nil {
+			ingestErr = err
 		}
-		for range services {
-			_ = <-doneChan
+	}
+	if viper.GetString("runtime") != "" {
+		// leave out the services that --runtime filtered every version from
+		matching := app.services[:0]
+		for _, service := range app.services {
+			if len(service.versions) > 0 {
+				matching = append(matching, service)
+			}
 		}
+		app.services = matching
 	}
-	return nil
+	return ingestErr
 }
 
 // ListVersionInstances returns a list of instances running at a particular version
-func (taker *TakerGCP) ListVersionInstances(rv *reportVersion) (instances []*appengine.Instance, err error) {
+func (taker *TakerGCP) ListVersionInstances(ctx context.Context, rv *reportVersion) (instances []*appengine.Instance, err error) {
 	versionsService := appengine.NewAppsServicesVersionsService(taker.appEngine)
-	if instancesResponse, instanceErr := versionsService.Instances.List(rv.service.application.gcpApplication.Id, rv.service.gcpService.Id, rv.gcpVersion.Id).Do(); instanceErr == nil {
-		instances = instancesResponse.Instances
-	} else {
-		err = instanceErr
-	}
+	err = doWithRetry(ctx, func() error {
+		instancesResponse, instanceErr := versionsService.Instances.List(rv.service.application.gcpApplication.Id, rv.service.gcpService.Id, rv.gcpVersion.Id).Context(ctx).Do()
+		if instanceErr == nil {
+			instances = instancesResponse.Instances
+		}
+		return instanceErr
+	})
 	return
 }
 
-func (rv *reportVersion) Ingest(taker Taker) error {
-	if instances, instanceErr := taker.ListVersionInstances(rv); instanceErr == nil {
+func (rv *reportVersion) Ingest(ctx context.Context, taker Taker) error {
+	var instances []*appengine.Instance
+	if instanceErr := limited(func() (err error) {
+		instances, err = taker.ListVersionInstances(ctx, rv)
+		return
+	}); instanceErr == nil {
 		for _, gcpInstance := range instances {
 			instance := &reportVersionInstance{gcpVersionInstance: gcpInstance, version: rv}
 			rv.instances = append(rv.instances, instance)
@@ -193,56 +523,201 @@ func (rv *reportVersion) Ingest(taker Taker) error {
 	} else {
 		return instanceErr
 	}
+	rv.CheckInstances()
+	rv.CheckInstanceCount(viper.GetInt("maxInstancesWarn"))
 	return nil
 }
 
+// CheckInstances flags a version that is SERVING with no instances although
+// its scaling is basic or manual; automatic scaling may legitimately scale to
+// zero.
+func (rv *reportVersion) CheckInstances() {
+	gcpVersion := rv.gcpVersion
+	fixedScaling := gcpVersion.BasicScaling != nil || gcpVersion.ManualScaling != nil
+	rv.emptyServing = gcpVersion.ServingStatus == "SERVING" && fixedScaling && len(rv.instances) == 0
+	if rv.emptyServing {
+		rv.service.application.project.addFinding(severityWarn, "version/"+rv.service.gcpService.Id+"/"+gcpVersion.Id,
+			"SERVING with no instances under basic or manual scaling")
+	}
+}
+
+// CheckInstanceCount flags a version running more than limit instances; a
+// limit of 0 checks nothing.
+func (rv *reportVersion) CheckInstanceCount(limit int) {
+	rv.manyInstances = limit > 0 && len(rv.instances) > limit
+	if rv.manyInstances {
+		rv.service.application.project.addFinding(severityWarn, "version/"+rv.service.gcpService.Id+"/"+rv.gcpVersion.Id,
+			fmt.Sprintf("runs %d instances, more than %d", len(rv.instances), limit))
+	}
+}
+
+// CheckRuntime flags a version running on one of the deprecated runtimes
+func (rv *reportVersion) CheckRuntime(deprecated []string) {
+	rv.deprecatedRuntime = containsString(deprecated, rv.gcpVersion.Runtime)
+	if rv.deprecatedRuntime {
+		rv.service.application.project.addFinding(severityWarn, "version/"+rv.service.gcpService.Id+"/"+rv.gcpVersion.Id,
+			fmt.Sprintf("runs on deprecated runtime %s", rv.gcpVersion.Runtime))
+	}
+}
+
 // ListVersions will take in all existing versions of the service in full detail.
-func (taker *TakerGCP) ListVersions(rs *reportService) (versions []*appengine.Version, err error) {
+func (taker *TakerGCP) ListVersions(ctx context.Context, rs *reportService) (versions []*appengine.Version, err error) {
 	serviceService := appengine.NewAppsServicesVersionsService(taker.appEngine)
-	if listResponse, listErr := serviceService.List(rs.application.gcpApplication.Id, rs.gcpService.Id).View("FULL").Do(); listErr == nil {
-		versions = listResponse.Versions
-	} else {
-		err = listErr
-	}
+	err = doWithRetry(ctx, func() error {
+		listResponse, listErr := serviceService.List(rs.application.gcpApplication.Id, rs.gcpService.Id).View("FULL").Context(ctx).Do()
+		if listErr == nil {
+			versions = listResponse.Versions
+		}
+		return listErr
+	})
 	return
 }
 
 // Ingest takes information 'taken' from the service providing the Google APIs
-func (svc *reportService) Ingest(taker Taker) error {
-	versions, versionErr := taker.ListVersions(svc)
+func (svc *reportService) Ingest(ctx context.Context, taker Taker) error {
+	var versions []*appengine.Version
+	versionErr := limited(func() (err error) {
+		versions, err = taker.ListVersions(ctx, svc)
+		return
+	})
 	if versionErr != nil {
 		return versionErr
 	}
-	versionLimit := viper.GetInt("versionLimit")
-	if versionLimit > len(versions) {
-		versionLimit = len(versions)
-	}
-	shortVersions := versions[len(versions)-versionLimit:]
-	doneChan := make(chan string)
-	for i := len(shortVersions) - 1; i >= 0; i-- {
+	// newest first: the API's own ordering is not something to rely on
+	allVersions := make([]*reportVersion, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
 		gcpVersion := versions[i]
 		version := &reportVersion{gcpVersion: gcpVersion, service: svc}
-		// fmt.Println("ingest version:", svc.application.gcpApplication.Id+"."+svc.gcpService.Id+"."+version.gcpVersion.Id)
-		svc.versions = append(svc.versions, version)
+		if deployTime, utErr := time.Parse(time.RFC3339, gcpVersion.CreateTime); utErr == nil {
+			version.deployTime = deployTime
+		} else {
+			version.deployTimeUnknown = true
+		}
+		allVersions = append(allVersions, version)
+	}
+	sort.Stable(versionSlice(allVersions))
+	svc.CheckRollout(allVersions)
+	if pattern := viper.GetString("runtime"); pattern != "" {
+		matching := allVersions[:0]
+		for _, version := range allVersions {
+			if matched, _ := path.Match(pattern, version.gcpVersion.Runtime); matched {
+				matching = append(matching, version)
+			}
+		}
+		allVersions = matching
+	}
+
+	versionLimit := viper.GetInt("versionLimit")
+	if versionLimit > len(allVersions) {
+		versionLimit = len(allVersions)
+	}
+	svc.versions = allVersions[:versionLimit]
+	deprecated := getStringSlice("appDeprecatedRuntime")
+	for _, version := range svc.versions {
+		version.CheckRuntime(deprecated)
+	}
+	doneChan := make(chan error)
+	for _, version := range svc.versions {
+		logger.Debugf("ingest version: %s.%s.%s", svc.application.gcpApplication.Id, svc.gcpService.Id, version.gcpVersion.Id)
 		go func(version *reportVersion) {
-			version.Ingest(taker)
-			doneChan <- version.service.gcpService.Id + "." + version.gcpVersion.Id
+			doneChan <- svc.application.project.recordDenied(version.Ingest(ctx, taker))
 		}(version)
+	}
 
-		deployTime, utErr := time.Parse(time.RFC3339, gcpVersion.CreateTime)
-		if utErr != nil {
-			fmt.Println("cannot parse date:", utErr)
+	// the first failure of a version is the service's
+	var ingestErr error
+	for range svc.versions {
+		if err := <-doneChan; ingestErr == nil {
+			ingestErr = err
 		}
+	}
+	return ingestErr
+}
 
-		version.deployTime = deployTime
+// CheckRollout flags the service when every request is split to one version
+// and that is not the newest one deployed, which may be a rollout left
+// unfinished. versions must be newest first.
+func (svc *reportService) CheckRollout(versions []*reportVersion) {
+	svc.staleRollout = false
+	if len(versions) == 0 || svc.gcpService.Split == nil {
+		return
+	}
+	newest := versions[0].gcpVersion.Id
+	for versionID, fraction := range svc.gcpService.Split.Allocations {
+		if fraction >= 1.0 && versionID != newest {
+			svc.staleRollout = true
+			svc.application.project.addFinding(severityWarn, "service/"+svc.gcpService.Id,
+				fmt.Sprintf("all traffic goes to version %s, not the newest version %s", versionID, newest))
+		}
+	}
+}
 
+// traffic lists the split's allocations, eg v1=90% v2=10%
+func (rs *reportService) traffic() string {
+	if rs.gcpService.Split == nil {
+		return ""
+	}
+	var versionIDs []string
+	for versionID := range rs.gcpService.Split.Allocations {
+		versionIDs = append(versionIDs, versionID)
 	}
+	sort.Strings(versionIDs)
+	var allocations []string
+	for _, versionID := range versionIDs {
+		allocations = append(allocations, fmt.Sprintf("%s=%.0f%%", versionID, rs.allocation(versionID)*100.0))
+	}
+	return strings.Join(allocations, " ")
+}
 
-	for i := len(shortVersions) - 1; i >= 0; i-- {
-		_ = <-doneChan
+// allocation is the fraction of the service's traffic split to the version;
+// a service with no split sends it none
+func (rs *reportService) allocation(versionID string) float64 {
+	if rs.gcpService.Split == nil {
+		return 0
 	}
+	return rs.gcpService.Split.Allocations[versionID]
+}
 
-	return nil
+// newTable aligns the tab-separated cells written to it into columns, keeping
+// those of --fields; it must be flushed once the last row is written
+func newTable(w io.Writer) *columnTable {
+	return &columnTable{out: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0), fields: displayFields}
+}
+
+// versionStatus is the version's serving status, marked EMPTY when it has
+// no instances to serve with, DEPRECATED when its runtime is and
+// MANY-INSTANCES when it runs more than --max-instances-warn
+func versionStatus(version *reportVersion) string {
+	status := servingStatus(version.gcpVersion.ServingStatus)
+	if version.emptyServing {
+		status += " " + alert("EMPTY")
+	}
+	if version.deprecatedRuntime {
+		status += " " + alert("DEPRECATED")
+	}
+	if version.manyInstances {
+		status += " " + alert("MANY-INSTANCES")
+	}
+	return status
+}
+
+// displayInstances shows a table of the instances running each version
+func displayInstances(w io.Writer, versions []*reportVersion) {
+	table := newTable(w)
+	header := false
+	for _, version := range versions {
+		for _, instance := range version.instances {
+			if !header {
+				fmt.Fprintln(table, "    VERSION\tINSTANCE\tVM\tVM STATUS\tAVAILABILITY\tREQUESTS\tSTARTED")
+				header = true
+			}
+			gcpInstance := instance.gcpVersionInstance
+			fmt.Fprintf(table, "    %s\t%s\t%s\t%s\t%s\t%d\t%s\n", version.gcpVersion.Id, gcpInstance.Id,
+				supplyDefault(gcpInstance.VmName, "-"), supplyDefault(gcpInstance.VmStatus, "-"),
+				gcpInstance.Availability, gcpInstance.Requests, supplyDefault(formatTimestamp(gcpInstance.StartTime), "-"))
+		}
+	}
+	table.Flush()
 }
 
 type versionSlice []*reportVersion
@@ -259,122 +734,301 @@ func (o versionSlice) Swap(i, j int) {
 	o[i], o[j] = o[j], o[i]
 }
 
-func (rs *reportService) Display() {
-	allocs := ""
-	for v, f := range rs.gcpService.Split.Allocations {
-		allocs += fmt.Sprintf("%s=%2d", v, int(f*100.0))
+func (rs *reportService) Display(w io.Writer) {
+	shardBy := "-"
+	if rs.gcpService.Split != nil {
+		shardBy = supplyDefault(rs.gcpService.Split.ShardBy, "-")
+	}
+	fmt.Fprintf(w, "  service[%s] shard strat[%s] traffic[%s]", rs.gcpService.Id, shardBy, supplyDefault(rs.traffic(), "-"))
+	if rs.staleRollout {
+		fmt.Fprintf(w, " %s", alert("STALE-ROLLOUT"))
+	}
+	fmt.Fprintf(w, "\n")
+	if len(rs.versions) == 0 {
+		// none deployed, or their listing was denied
+		return
 	}
-	fmt.Printf("  service[%18s], shard strat[%s]\n", rs.gcpService.Id, rs.gcpService.Split.ShardBy)
-
-	limit := max(1, len(rs.versions)-2)
 
-	if verbose {
-		limit = len(rs.versions)
-	} else if limit > 2 {
-		limit = 3
-		fmt.Println("    ...earlier versions elided...")
+	limit := len(rs.versions)
+	if !verbose {
+		limit = min(viper.GetInt("displayVersions"), len(rs.versions))
+	}
+	if limit < len(rs.versions) {
+		fmt.Fprintln(w, "    ...earlier versions elided...")
 	}
 
+	table := newTable(w)
+	fmt.Fprintln(table, "    VERSION\tRUNTIME\tENV\tINSTANCES\tSPLIT\tNETWORK\tSERVING")
 	for _, version := range rs.versions[0:limit] {
 		gcpVersion := version.gcpVersion
 		env := supplyDefault(version.gcpVersion.Env, "standard")
-		numInstances := len(version.instances)
-		network := &appengine.Network{Name: "<default>", SubnetworkName: ""}
-		if gcpVersion.Network != nil {
-			network = gcpVersion.Network
-		}
-
-		fmt.Printf("    version[%16s] runtime[%10s] env[%7s] serving[%12s] instances[%4d] split[%2.0f]",
-			gcpVersion.Id, gcpVersion.Runtime, env, gcpVersion.ServingStatus, numInstances, rs.gcpService.Split.Allocations[gcpVersion.Id]*100.0)
+		network := "-"
 		if env == "flexible" {
-			fmt.Printf(" net[%16s/%16s] ports[%v]\n", network.Name, network.SubnetworkName, network.ForwardedPorts)
-		} else {
-			fmt.Printf("\n")
-		}
-		if verbose {
-			fmt.Printf("      deployed by[%s] at [%s]", gcpVersion.CreatedBy, gcpVersion.CreateTime)
-			fmt.Printf("      url[%s]\n", gcpVersion.VersionUrl)
-			fmt.Printf("      env-vars[%v]\n", gcpVersion.EnvVariables)
-			if gcpVersion.BasicScaling != nil {
-				fmt.Printf("      basic-scaling max[%4d] idle-timeout[%6s]",
-					gcpVersion.BasicScaling.MaxInstances, gcpVersion.BasicScaling.IdleTimeout)
-			}
-			if gcpVersion.AutomaticScaling != nil {
-				fmt.Printf("      auto-scaling max pending latency[%6s] max concurrent reqs[%6d] max total instances[%4d]\n",
-					gcpVersion.AutomaticScaling.MaxPendingLatency,
-					gcpVersion.AutomaticScaling.MaxConcurrentRequests,
-					gcpVersion.AutomaticScaling.MaxTotalInstances,
-				)
+			gcpNetwork := &appengine.Network{Name: "<default>"}
+			if gcpVersion.Network != nil {
+				gcpNetwork = gcpVersion.Network
 			}
-			fmt.Printf("\n")
+			network = fmt.Sprintf("%s/%s ports%v", gcpNetwork.Name, gcpNetwork.SubnetworkName, gcpNetwork.ForwardedPorts)
 		}
-		for _, handler := range gcpVersion.Handlers {
-			fmt.Printf("      handler: URL regex[%26s], scriptpath[%s]\n",
-				handler.UrlRegex, handler.Script.ScriptPath)
+		fmt.Fprintf(table, "    %s\t%s\t%s\t%d\t%.0f\t%s\t%s\n",
+			gcpVersion.Id, gcpVersion.Runtime, env, len(version.instances), rs.allocation(gcpVersion.Id)*100.0,
+			network, versionStatus(version))
+	}
+	table.Flush()
+
+	displayCosts(w, rs.versions[0:limit])
+	if verbose || viper.GetBool("showInstances") {
+		displayInstances(w, rs.versions[0:limit])
+	}
+	if !verbose {
+		return
+	}
+	for _, version := range rs.versions[0:limit] {
+		gcpVersion := version.gcpVersion
+		deployed := formatTime(version.deployTime)
+		if version.deployTimeUnknown {
+			deployed = "unknown"
+		}
+		fmt.Fprintf(w, "    version[%s] deployed by[%s] at [%s]\n", gcpVersion.Id, gcpVersion.CreatedBy, deployed)
+		fmt.Fprintf(w, "      url[%s]\n", gcpVersion.VersionUrl)
+		fmt.Fprintf(w, "      env-vars[%v]\n", gcpVersion.EnvVariables)
+		if gcpVersion.BasicScaling != nil {
+			fmt.Fprintf(w, "      basic-scaling max[%d] idle-timeout[%s]\n",
+				gcpVersion.BasicScaling.MaxInstances, gcpVersion.BasicScaling.IdleTimeout)
+		}
+		if gcpVersion.AutomaticScaling != nil {
+			fmt.Fprintf(w, "      auto-scaling max pending latency[%s] max concurrent reqs[%d] max total instances[%d]\n",
+				gcpVersion.AutomaticScaling.MaxPendingLatency,
+				gcpVersion.AutomaticScaling.MaxConcurrentRequests,
+				gcpVersion.AutomaticScaling.MaxTotalInstances,
+			)
+		}
+		if len(gcpVersion.Handlers) > 0 {
+			handlers := newTable(w)
+			fmt.Fprintln(handlers, "      URL REGEX\tSCRIPT PATH")
+			for _, handler := range gcpVersion.Handlers {
+				scriptPath := ""
+				if handler.Script != nil {
+					scriptPath = handler.Script.ScriptPath
+				}
+				fmt.Fprintf(handlers, "      %s\t%s\n", handler.UrlRegex, scriptPath)
+			}
+			handlers.Flush()
 		}
 	}
 }
 
-func (p *reportProject) Display() {
+// empty reports whether the project has nothing to display
+func (p *reportProject) empty() bool {
+	var buf bytes.Buffer
+	p.Display(&buf)
+	return buf.Len() == 0
+}
+
+func (p *reportProject) Display(w io.Writer) {
 	if p.application != nil {
-		p.application.Display()
+		p.application.Display(w)
+	}
+	if len(p.sqlInstances) > 0 {
+		displaySQLInstances(w, p.sqlInstances)
+	}
+	for _, bucket := range p.backupBuckets {
+		if bucket.isBackup {
+			bucket.Display(w)
+		}
+	}
+	for _, kind := range p.missingKinds {
+		fmt.Fprintf(w, "  kind[%s] %s: no backup object found\n", kind, alert("MISSING"))
+	}
+	if len(p.schedulerJobs) > 0 {
+		displaySchedulerJobs(w, p.schedulerJobs)
+	}
+	for _, kind := range p.unscheduledKinds {
+		fmt.Fprintf(w, "  kind[%s] %s: no scheduler job exports it\n", kind, alert("UNSCHEDULED"))
+	}
+	if len(p.storageBuckets) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d storage buckets\n", p.gcpProject.ProjectId, len(p.storageBuckets))
+		for _, bucket := range p.storageBuckets {
+			bucket.DisplayAudit(w)
+		}
+	}
+	if len(p.certificates) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d certificates\n", p.gcpProject.ProjectId, len(p.certificates))
+		displayCertificates(w, p.certificates)
+	}
+	if len(p.datasets) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d BigQuery datasets\n", p.gcpProject.ProjectId, len(p.datasets))
+		for _, dataset := range p.datasets {
+			dataset.Display(w)
+		}
+	}
+	if len(p.topics) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d Pub/Sub topics\n", p.gcpProject.ProjectId, len(p.topics))
+		for _, topic := range p.topics {
+			topic.Display(w)
+		}
+	}
+	if len(p.runServices) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d Cloud Run services\n", p.gcpProject.ProjectId, len(p.runServices))
+		displayRunServices(w, p.runServices)
+	}
+	if len(p.functions) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d Cloud Functions\n", p.gcpProject.ProjectId, len(p.functions))
+		displayFunctions(w, p.functions)
+	}
+	if len(p.repositories) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d Artifact Registry repositories\n", p.gcpProject.ProjectId, len(p.repositories))
+		displayRepositories(w, p.repositories)
+	}
+	if len(p.bindings) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d IAM bindings\n", p.gcpProject.ProjectId, len(p.bindings))
+		for _, binding := range p.bindings {
+			binding.Display(w)
+		}
+	}
+	if len(p.serviceAccounts) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d service accounts\n", p.gcpProject.ProjectId, len(p.serviceAccounts))
+		for _, account := range p.serviceAccounts {
+			account.Display(w)
+		}
+	}
+	if len(p.clusters) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d GKE clusters\n", p.gcpProject.ProjectId, len(p.clusters))
+		for _, cluster := range p.clusters {
+			cluster.Display(w)
+		}
+	}
+	if len(p.disks) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d persistent disks\n", p.gcpProject.ProjectId, len(p.disks))
+		displayDisks(w, p.disks)
+	}
+	if len(p.firewallRules) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d firewall rules\n", p.gcpProject.ProjectId, len(p.firewallRules))
+		displayFirewallRules(w, p.firewallRules)
+	}
+	if len(p.networks) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d VPC networks\n", p.gcpProject.ProjectId, len(p.networks))
+		displayNetworks(w, p.networks)
+	}
+	if len(p.addresses) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d static addresses\n", p.gcpProject.ProjectId, len(p.addresses))
+		displayAddresses(w, p.addresses)
+	}
+	if len(p.dnsZones) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d DNS zones\n", p.gcpProject.ProjectId, len(p.dnsZones))
+		displayDNSZones(w, p.dnsZones)
+	}
+	if len(p.keyRings) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d KMS key rings\n", p.gcpProject.ProjectId, len(p.keyRings))
+		displayKeyRings(w, p.keyRings)
+	}
+	if len(p.secrets) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d secrets\n", p.gcpProject.ProjectId, len(p.secrets))
+		displaySecrets(w, p.secrets)
+	}
+	if len(p.sinks) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d logging sinks\n", p.gcpProject.ProjectId, len(p.sinks))
+		displaySinks(w, p.sinks)
+	}
+	p.displayAlertPolicies(w)
+	if len(p.computeInstances) > 0 {
+		fmt.Fprintf(w, "project[%s]: %d compute instances\n", p.gcpProject.ProjectId, len(p.computeInstances))
+		for _, instance := range p.computeInstances {
+			instance.Display(w)
+		}
 	}
 }
 
-// Display sends appropriate output the console
-func (app *reportApplication) Display() {
-	fmt.Printf("application[%30s]: status[%s]\n", app.gcpApplication.Id, app.gcpApplication.ServingStatus)
-	for _, dispatchRule := range app.gcpApplication.DispatchRules {
-		fmt.Printf("  route: domain[%28s] dispatch[%18s] service[%16s]\n", dispatchRule.Domain, dispatchRule.Path, dispatchRule.Service)
+// Display sends appropriate output to the given writer
+func (app *reportApplication) Display(w io.Writer) {
+	fmt.Fprintf(w, "application[%s]: status[%s]\n", app.gcpApplication.Id, servingStatus(app.gcpApplication.ServingStatus))
+	if len(app.gcpApplication.DispatchRules) > 0 {
+		table := newTable(w)
+		fmt.Fprintln(table, "  ROUTE DOMAIN\tDISPATCH\tSERVICE")
+		for _, dispatchRule := range app.gcpApplication.DispatchRules {
+			fmt.Fprintf(table, "  %s\t%s\t%s\n", dispatchRule.Domain, dispatchRule.Path, dispatchRule.Service)
+		}
+		table.Flush()
 	}
 	for _, service := range app.services {
-		service.Display()
+		service.Display(w)
 	}
 }
 
 // GetApplication finds (maybe) an App Engine application associated with the project
-func (taker *TakerGCP) GetApplication(rp *reportProject) (application *appengine.Application, err error) {
-	getResponse, getErr := taker.appEngine.Apps.Get(rp.gcpProject.ProjectId).Do()
-	if getErr != nil {
-		//				log.Println("cannot get application for project:", appErr)
-		err = getErr
-	} else {
-		application = getResponse
-	}
+func (taker *TakerGCP) GetApplication(ctx context.Context, rp *reportProject) (application *appengine.Application, err error) {
+	err = doWithRetry(ctx, func() error {
+		getResponse, getErr := taker.appEngine.Apps.Get(rp.gcpProject.ProjectId).Context(ctx).Do()
+		if getErr == nil {
+			application = getResponse
+		}
+		return getErr
+	})
 	return
 }
 
-func (p *reportProject) Ingest(taker Taker) error {
-	application, appErr := taker.GetApplication(p)
+func (p *reportProject) Ingest(ctx context.Context, taker Taker) error {
+	var application *appengine.Application
+	appErr := limited(func() (err error) {
+		application, err = taker.GetApplication(ctx, p)
+		return
+	})
+	if isNotFound(appErr) || (appErr == nil && application == nil) {
+		// most projects never create an App Engine application
+		logger.Debugf("project %s has no App Engine application", p.gcpProject.ProjectId)
+		return nil
+	}
 	if appErr != nil {
-		//				log.Println("cannot get application for project:", appErr)
 		return appErr
 	}
 	p.application = &reportApplication{gcpApplication: application, project: p}
-	if siErr := p.application.Ingest(taker); siErr != nil {
+	p.application.CheckServing()
+	if siErr := p.application.Ingest(ctx, taker); siErr != nil {
 		return siErr
 	}
 
 	return nil
 }
 
-func (taker TakerStorageGCP) ListObjects(bucket *reportBucket) (gcpObjects []*storage.Object, err error) {
-	if objResponse, objErr := taker.storageService.Objects.List(bucket.gcpBucket.Id).Do(); objErr == nil {
-		gcpObjects = objResponse.Items
-	} else {
-		err = objErr
+// ListObjects lists the objects of the bucket whose names start with prefix,
+// a page at a time; an empty prefix lists them all. Each page is retried on
+// its own, so that page never sees a page twice.
+func (taker TakerStorageGCP) ListObjects(ctx context.Context, bucket *reportBucket, prefix string, page func([]*storage.Object) bool) error {
+	pageToken := ""
+	for {
+		var objResponse *storage.Objects
+		err := doWithRetry(ctx, func() (objErr error) {
+			call := taker.storageService.Objects.List(bucket.gcpBucket.Id).PageToken(pageToken)
+			if prefix != "" {
+				call = call.Prefix(prefix)
+			}
+			objResponse, objErr = call.Context(ctx).Do()
+			return
+		})
+		if err != nil {
+			return err
+		}
+		if !page(objResponse.Items) || objResponse.NextPageToken == "" {
+			return nil
+		}
+		pageToken = objResponse.NextPageToken
 	}
-	return
 }
 
 type reportObject struct {
 	gcpObject  *storage.Object
 	updateTime time.Time
 	kind       string
+	// component and env are taken from the backup/<component>/<env>/ path;
+	// both are empty when the object is not named that way.
+	component string
+	env       string
 }
 
 var objectDatastoreKindRegex = regexp.MustCompile("\\.([^.]+)\\.backup_info")
 
+var objectBackupPathRegex = regexp.MustCompile("^/?backup/([^/]+)/([^/]+)/[^/]+")
+
 func (o *reportObject) DatastoreGleanMeta() {
 	// organise an object map by 'kind', and then have a reverse-chronological listing of backups for that kind.
 	matches := objectDatastoreKindRegex.FindStringSubmatch(o.gcpObject.Id)
@@ -383,6 +1037,36 @@ func (o *reportObject) DatastoreGleanMeta() {
 	}
 }
 
+// BackupPathGleanMeta records the component and env named in the object's
+// backup/<component>/<env>/<resource-kind> path, and reports whether the
+// object is named that way at all.
+func (o *reportObject) BackupPathGleanMeta() bool {
+	matches := objectBackupPathRegex.FindStringSubmatch(o.gcpObject.Name)
+	if len(matches) != 3 {
+		return false
+	}
+	o.component, o.env = matches[1], matches[2]
+	return true
+}
+
+// checkBackupPath flags backup objects whose path does not follow the
+// documented layout or names another component or env than the project's.
+func (rb *reportBucket) checkBackupPath(object *reportObject) {
+	name := "object/" + rb.gcpBucket.Name + "/" + object.gcpObject.Name
+	if !object.BackupPathGleanMeta() {
+		if object.kind != "" {
+			rb.misplaced++
+			rb.project.addFinding(severityInfo, name, "is not under backup/<component>/<env>/")
+		}
+		return
+	}
+	if object.component != rb.project.component || object.env != rb.project.env {
+		rb.misplaced++
+		rb.project.addFinding(severityWarn, name, fmt.Sprintf("is for component[%s] env[%s], project is component[%s] env[%s]",
+			object.component, object.env, rb.project.component, rb.project.env))
+	}
+}
+
 type objectSlice []*reportObject
 
 func (o objectSlice) Len() int {
@@ -402,15 +1086,94 @@ func (rb *reportBucket) UpdateKindMap() {
 	oSlice := objectSlice(rb.objects)
 	sort.Sort(oSlice)
 	kindMap := make(map[string][]*reportObject)
+	rb.totalSize, rb.kindSizes = 0, make(map[string]int64)
 	for _, object := range rb.objects {
+		rb.totalSize += int64(object.gcpObject.Size)
 		if object.kind == "" {
 			continue
 		}
 		kindMap[object.kind] = append(kindMap[object.kind], object)
+		rb.kindSizes[object.kind] += int64(object.gcpObject.Size)
+	}
+	rb.totalSize += rb.discarded.size
+	for kind, tally := range rb.discardedKinds {
+		rb.kindSizes[kind] += tally.size
 	}
 	rb.kindMap = kindMap
 }
 
+// objectCount is the number of objects listed in the bucket, those discarded
+// by --stream-objects included
+func (rb *reportBucket) objectCount() int {
+	return len(rb.objects) + rb.discarded.count
+}
+
+// kindObjectCount is the number of objects of the kind listed in the bucket,
+// those discarded by --stream-objects included
+func (rb *reportBucket) kindObjectCount(kind string) int {
+	return len(rb.kindMap[kind]) + rb.discardedKinds[kind].count
+}
+
+// CheckFreshness marks the kinds whose newest backup is older than within
+func (rb *reportBucket) CheckFreshness(now time.Time, within time.Duration) {
+	rb.staleKinds = make(map[string]bool)
+	for _, kind := range rb.kindNames() {
+		objects := rb.kindMap[kind]
+		if now.Sub(objects[0].updateTime) > within {
+			rb.staleKinds[kind] = true
+			rb.project.addFinding(severityWarn, "kind/"+kind, fmt.Sprintf("newest backup in %s is %v old, older than %v",
+				rb.gcpBucket.Name, now.Sub(objects[0].updateTime).Round(time.Minute), within))
+		}
+	}
+}
+
+// expectedKinds merges the kinds given with --expected-kind and those listed
+// under expectedKinds in the configuration file.
+func expectedKinds() []string {
+	var kinds []string
+	for _, kind := range append(getStringSlice("expectedKind"), getStringSlice("expectedKinds")...) {
+		if kind != "" && !containsString(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// CheckLocation marks the bucket as mislocated when allowed locations are
+// given and its own is not one of them. GCS reports locations in upper case,
+// so they are compared regardless of case.
+func (rb *reportBucket) CheckLocation(allowed []string) {
+	if len(allowed) == 0 {
+		return
+	}
+	for _, location := range allowed {
+		if strings.EqualFold(strings.TrimSpace(location), rb.gcpBucket.Location) {
+			return
+		}
+	}
+	rb.mislocated = true
+	rb.project.addFinding(severityCritical, "bucket/"+rb.gcpBucket.Name,
+		fmt.Sprintf("location %s is not one of the allowed %s", rb.gcpBucket.Location, strings.Join(allowed, ",")))
+}
+
+// CheckExpectedKinds records the expected kinds that have no backup object in
+// any of the project's backup buckets.
+func (p *reportProject) CheckExpectedKinds(expected []string) {
+	p.missingKinds = nil
+	for _, kind := range expected {
+		found := false
+		for _, bucket := range p.backupBuckets {
+			if _, ok := bucket.kindMap[kind]; ok && bucket.isBackup {
+				found = true
+			}
+		}
+		if !found {
+			p.missingKinds = append(p.missingKinds, kind)
+			p.addFinding(severityCritical, "kind/"+kind, "no backup object found")
+		}
+	}
+}
+
 func ellipsize(s string, lhs int, rhs int) string {
 	sz := len(s)
 	if sz < (lhs + rhs + 3) {
@@ -419,56 +1182,228 @@ func ellipsize(s string, lhs int, rhs int) string {
 	return s[0:lhs] + "..." + s[sz-rhs:]
 }
 
-// IngestObjects takes in all objects in a GCS bucket
-func (rb *reportBucket) IngestObjects(taker TakerStorage) (ingestErr error) {
-	gcpObjects, listObjErr := taker.ListObjects(rb)
+// humanizeBytes shows a byte size in the largest binary unit it reaches, eg 1.5 MiB
+func humanizeBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, units := float64(size)/unit, []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	i := 0
+	for ; value >= unit && i < len(units)-1; i++ {
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
+
+// IngestObjects takes in all objects in a GCS bucket. With --only-stale and
+// expected kinds to go by, the listing stops at the first page leaving every
+// expected kind, and every other kind listed so far, with a fresh backup:
+// no later object could make any of them stale.
+//
+// With --stream-objects, only the objects of each kind updated within the
+// backup window, or --max-age when longer, and the newest one older are kept, the others being
+// tallied and dropped as each page is listed, bounding memory on buckets of
+// long backup histories. The listing itself cannot stop at the first object
+// older than the window: GCS lists objects by name alone, and backup names
+// ordered oldest first leave the newest backups to the last pages.
+func (rb *reportBucket) IngestObjects(ctx context.Context, taker TakerStorage) (ingestErr error) {
+	now, within := time.Now(), backupWithin("Datastore")
+	kinds := expectedKinds()
+	shortCircuit := viper.GetBool("onlyStale") && len(kinds) > 0
+	stream := viper.GetBool("streamObjects")
+	// streaming keeps what --max-age displays too
+	keepWithin := within
+	if maxAge := viper.GetDuration("maxAge"); maxAge > keepWithin {
+		keepWithin = maxAge
+	}
+	fresh := make(map[string]bool)
+	// older holds the newest object of each kind older than the window while
+	// streaming, as it will be kept
+	older := make(map[string]*reportObject)
+	listObjErr := limited(func() error {
+		return taker.ListObjects(ctx, rb, viper.GetString("backupPrefix"), func(gcpObjects []*storage.Object) bool {
+			for _, gcpObject := range gcpObjects {
+				updateTime, utErr := time.Parse(time.RFC3339, gcpObject.Updated)
+				if utErr != nil {
+					logger.Warnf("cannot parse date: %v", utErr)
+				}
+				object := &reportObject{gcpObject: gcpObject, updateTime: updateTime}
+				object.DatastoreGleanMeta()
+				rb.checkBackupPath(object)
+				if object.kind != "" {
+					if !containsString(kinds, object.kind) {
+						kinds = append(kinds, object.kind)
+					}
+					fresh[object.kind] = fresh[object.kind] || now.Sub(updateTime) <= within
+				}
+				if stream && now.Sub(updateTime) > keepWithin {
+					rb.discard(older, object)
+					continue
+				}
+				rb.objects = append(rb.objects, object)
+			}
+			if !shortCircuit {
+				return true
+			}
+			for _, kind := range kinds {
+				if !fresh[kind] {
+					return true
+				}
+			}
+			rb.listingStopped = true
+			return false
+		})
+	})
+	for _, object := range older {
+		rb.objects = append(rb.objects, object)
+	}
 	if listObjErr != nil {
 		ingestErr = listObjErr
 		return
 	}
-	fmt.Printf("bucket %s has %d objects\n", rb.gcpBucket.Id, len(gcpObjects))
-	for _, gcpObject := range gcpObjects {
-		updateTime, utErr := time.Parse(time.RFC3339, gcpObject.Updated)
-		if utErr != nil {
-			fmt.Println("cannot parse date:", utErr)
+
+	rb.UpdateKindMap()
+	rb.CheckFreshness(now, within)
+	return
+}
+
+// discard tallies an object older than the backup window and drops it, unless
+// it is the newest of its kind seen so far, which older keeps in its stead
+func (rb *reportBucket) discard(older map[string]*reportObject, object *reportObject) {
+	if object.kind != "" {
+		kept, ok := older[object.kind]
+		if !ok || object.updateTime.After(kept.updateTime) {
+			older[object.kind] = object
+			if !ok {
+				return
+			}
+			object = kept
 		}
-		object := &reportObject{gcpObject: gcpObject, updateTime: updateTime}
-		object.DatastoreGleanMeta()
-		rb.objects = append(rb.objects, object)
+		if rb.discardedKinds == nil {
+			rb.discardedKinds = make(map[string]objectTally)
+		}
+		tally := rb.discardedKinds[object.kind]
+		tally.add(object.gcpObject)
+		rb.discardedKinds[object.kind] = tally
 	}
+	rb.discarded.add(object.gcpObject)
+}
 
-	rb.UpdateKindMap()
-	for kind, objectSlice := range rb.kindMap {
-		fmt.Printf("    kind[%s] most recently updated object[%s] at [%s], size[%d]\n", kind,
-			ellipsize(objectSlice[0].gcpObject.Id, 8, 12), objectSlice[0].updateTime, objectSlice[0].gcpObject.Size)
+// Display shows the bucket and the freshest object of each kind within it
+func (rb *reportBucket) Display(w io.Writer) {
+	fmt.Fprintf(w, "  bucket[%s] has %d objects totalling %s", rb.gcpBucket.Id, rb.objectCount(), humanizeBytes(rb.totalSize))
+	if rb.listingStopped {
+		fmt.Fprint(w, " (listing stopped once every kind was fresh)")
 	}
-	return
+	fmt.Fprintln(w)
+	if rb.mislocated {
+		fmt.Fprintf(w, "    location[%s] %s\n", rb.gcpBucket.Location, alert("NOT-ALLOWED"))
+	}
+	if rb.misplaced > 0 {
+		fmt.Fprintf(w, "    %d objects %s outside backup/%s/%s/\n", rb.misplaced, alert("MISPLACED"), rb.project.component, rb.project.env)
+	}
+	if len(rb.kindMap) == 0 {
+		return
+	}
+	table := newTable(w)
+	fmt.Fprintln(table, "    KIND\tNEWEST OBJECT\tUPDATED\tSIZE\tOBJECTS\tTOTAL SIZE\tSTATUS")
+	for _, kind := range rb.sortedKinds() {
+		objectSlice := rb.kindMap[kind]
+		newest := objectSlice[0]
+		status := healthy("OK")
+		if rb.staleKinds[kind] {
+			status = fmt.Sprintf("%s age[%v]", alert("STALE"), time.Since(newest.updateTime).Round(time.Minute))
+		}
+		fmt.Fprintf(table, "    %s\t%s\t%s\t%d\t%d\t%s\t%s\n", kind, ellipsize(newest.gcpObject.Id, 8, 12), formatTime(newest.updateTime),
+			newest.gcpObject.Size, rb.kindObjectCount(kind), humanizeBytes(rb.kindSizes[kind]), status)
+	}
+	table.Flush()
+	rb.displayInventory(w)
 }
 
-// ListBuckets queries actual GCP to get buckets for a project
-func (taker TakerStorageGCP) ListBuckets(project *reportProject) (gcpBuckets []*storage.Bucket, err error) {
-	if objResponse, objErr := taker.storageService.Buckets.List(project.gcpProject.ProjectId).Do(); objErr == nil {
-		gcpBuckets = objResponse.Items
-	} else {
-		err = objErr
+// displayInventory lists, newest first, every backup object of the bucket
+// updated within --max-age, when given
+func (rb *reportBucket) displayInventory(w io.Writer) {
+	maxAge := viper.GetDuration("maxAge")
+	if maxAge <= 0 {
+		return
 	}
+	var objects []*reportObject
+	for _, object := range rb.objects {
+		if object.kind != "" && displayNow().Sub(object.updateTime) <= maxAge {
+			objects = append(objects, object)
+		}
+	}
+	sort.SliceStable(objects, func(i, j int) bool { return objects[i].updateTime.After(objects[j].updateTime) })
+	fmt.Fprintf(w, "    %d backup objects within %v\n", len(objects), maxAge)
+	if len(objects) == 0 {
+		return
+	}
+	table := newTable(w)
+	fmt.Fprintln(table, "    OBJECT\tKIND\tUPDATED\tSIZE")
+	for _, object := range objects {
+		fmt.Fprintf(table, "    %s\t%s\t%s\t%s\n", object.gcpObject.Name, object.kind, formatTime(object.updateTime), humanizeBytes(int64(object.gcpObject.Size)))
+	}
+	table.Flush()
+}
+
+// ListBuckets queries actual GCP to get buckets for a project
+func (taker TakerStorageGCP) ListBuckets(ctx context.Context, project *reportProject) (gcpBuckets []*storage.Bucket, err error) {
+	err = doWithRetry(ctx, func() error {
+		objResponse, objErr := taker.storageService.Buckets.List(project.gcpProject.ProjectId).Context(ctx).Do()
+		if objErr == nil {
+			gcpBuckets = objResponse.Items
+		}
+		return objErr
+	})
 	return
 }
 
-func (p *reportProject) IngestStorage(taker TakerStorage) (ingestErr error) {
-	gcpBuckets, listErr := taker.ListBuckets(p)
+// backupBucketSelector chooses buckets by the --bucket-label selectors; it is
+// nil when none are given and the backup key alone marks backup buckets.
+func backupBucketSelector() (*projectSelector, error) {
+	labels := getStringSlice("bucketLabel")
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return newProjectSelector(nil, nil, labels, nil)
+}
+
+// IngestStorage ingests the project's buckets, and the objects of those which
+// hold backups: the buckets matching --bucket-label when given, otherwise
+// those whose backup key label is true.
+func (p *reportProject) IngestStorage(ctx context.Context, taker TakerStorage) (ingestErr error) {
+	selector, selectorErr := backupBucketSelector()
+	if selectorErr != nil {
+		return selectorErr
+	}
+	allowed := getStringSlice("allowedBucketLocation")
+	var gcpBuckets []*storage.Bucket
+	listErr := limited(func() (err error) {
+		gcpBuckets, err = taker.ListBuckets(ctx, p)
+		return
+	})
 	if listErr == nil {
 		for _, gcpBucket := range gcpBuckets {
 			isBackup := false
-			if gcpBucket.Labels[*backupKey] == "true" {
+			if selector != nil {
+				isBackup = selector.matches(gcpBucket.Labels)
+			} else if gcpBucket.Labels[*backupKey] == "true" {
 				isBackup = true
 			}
-			bucket := &reportBucket{gcpBucket: gcpBucket, isBackup: isBackup}
+			bucket := &reportBucket{gcpBucket: gcpBucket, isBackup: isBackup, project: p}
 			p.backupBuckets = append(p.backupBuckets, bucket)
 			if isBackup {
-				ingestErr = bucket.IngestObjects(taker)
+				bucket.CheckLocation(allowed)
+				// a later bucket must not hide the failure of an earlier one
+				if objectsErr := bucket.IngestObjects(ctx, taker); ingestErr == nil {
+					ingestErr = objectsErr
+				}
 			}
-
+		}
+		if ingestErr == nil {
+			p.CheckExpectedKinds(expectedKinds())
 		}
 	} else {
 		ingestErr = listErr
@@ -476,87 +1411,451 @@ func (p *reportProject) IngestStorage(taker TakerStorage) (ingestErr error) {
 	return
 }
 
+// IngestBackups ingests the project's storage and its Cloud SQL instances
+// side by side, as they come from independent APIs. Each API call still takes
+// one of the global slots, and the error of each ingestion is returned.
+func (p *reportProject) IngestBackups(ctx context.Context, storageTaker TakerStorage, sqlTaker TakerSQLAdmin) (storageErr, sqlErr error) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		storageErr = p.IngestStorage(ctx, storageTaker)
+	}()
+	go func() {
+		defer wg.Done()
+		sqlErr = p.IngestSQLInstances(ctx, sqlTaker)
+	}()
+	wg.Wait()
+	return
+}
+
 // ListSQLInstances lists out the SQL instances associated with the given project
-func (taker TakerSQLAdminGCP) ListSQLInstances(project *reportProject) (gcpInstances []*sqladmin.DatabaseInstance, err error) {
-	sqlInstanceResponse, silErr := taker.sqladminService.Instances.List(project.gcpProject.ProjectId).Do()
-	if silErr == nil {
-		gcpInstances = sqlInstanceResponse.Items
-	}
-	err = silErr
+func (taker TakerSQLAdminGCP) ListSQLInstances(ctx context.Context, project *reportProject) (gcpInstances []*sqladmin.DatabaseInstance, err error) {
+	err = doWithRetry(ctx, func() error {
+		sqlInstanceResponse, silErr := taker.sqladminService.Instances.List(project.gcpProject.ProjectId).Context(ctx).Do()
+		if silErr == nil {
+			gcpInstances = sqlInstanceResponse.Items
+		}
+		return silErr
+	})
 	return
 }
 
 // ListBackupRuns gathers any listed backup-runs for the given SQL Instance
-func (taker *TakerSQLAdminGCP) ListBackupRuns(project *reportProject, dbi *reportSQLInstance) (gcpRuns []*sqladmin.BackupRun, err error) {
-	backupResponse, backupErr := taker.sqladminService.BackupRuns.List(project.gcpProject.ProjectId, dbi.gcpSQLInstance.Name).Do()
-	if backupErr == nil {
-		gcpRuns = backupResponse.Items
-	}
-	err = backupErr
+func (taker *TakerSQLAdminGCP) ListBackupRuns(ctx context.Context, project *reportProject, dbi *reportSQLInstance) (gcpRuns []*sqladmin.BackupRun, err error) {
+	err = doWithRetry(ctx, func() error {
+		backupResponse, backupErr := taker.sqladminService.BackupRuns.List(project.gcpProject.ProjectId, dbi.gcpSQLInstance.Name).Context(ctx).Do()
+		if backupErr == nil {
+			gcpRuns = backupResponse.Items
+		}
+		return backupErr
+	})
 	return
 }
 
-// IngestSQLInstances ingests all the SQL instances for this project
-func (p *reportProject) IngestSQLInstances(taker TakerSQLAdmin) error {
-	gcpInstances, listErr := taker.ListSQLInstances(p)
+// IngestSQLInstances ingests all the SQL instances for this project. The
+// backup runs of the instances are fetched at once, each call holding an API
+// slot, and checked in the order the instances were listed. Backup runs which
+// cannot be listed for want of a permission are recorded as a finding, and the
+// first failure to list them otherwise is returned as the project's.
+func (p *reportProject) IngestSQLInstances(ctx context.Context, taker TakerSQLAdmin) error {
+	var gcpInstances []*sqladmin.DatabaseInstance
+	listErr := limited(func() (err error) {
+		gcpInstances, err = taker.ListSQLInstances(ctx, p)
+		return
+	})
 	if listErr != nil {
 		return listErr
 	}
 	for _, gcpInstance := range gcpInstances {
-		instance := &reportSQLInstance{gcpSQLInstance: gcpInstance}
+		instance := &reportSQLInstance{gcpSQLInstance: gcpInstance, project: p}
 		p.sqlInstances = append(p.sqlInstances, instance)
-		fmt.Printf("  sql instance[%s] has backup enabled[%t]\n", gcpInstance.Name, gcpInstance.Settings.BackupConfiguration.Enabled)
-		if gcpInstance.Settings.BackupConfiguration.Enabled {
-			gcpBackups, backupErr := taker.ListBackupRuns(p, instance)
-			if backupErr != nil {
-				fmt.Printf("  cannot get list of backup runs for instance[%s]: %v", gcpInstance.Name, backupErr)
-				continue
-			}
-			for _, gcpBackup := range gcpBackups {
-				backup := &reportBackupRun{gcpBackupRun: gcpBackup}
-				instance.backupRuns = append(instance.backupRuns, backup)
+		instance.CheckProtection()
+	}
+
+	doneChan := make(chan string)
+	fetching := 0
+	for _, instance := range p.sqlInstances {
+		if instance.backupsDisabled {
+			continue
+		}
+		fetching++
+		go func(instance *reportSQLInstance) {
+			instance.IngestBackupRuns(ctx, taker)
+			doneChan <- instance.gcpSQLInstance.Name
+		}(instance)
+	}
+	for i := 0; i < fetching; i++ {
+		logger.Debugf("backup runs done: %s", <-doneChan)
+	}
+
+	var runsErr error
+	for _, instance := range p.sqlInstances {
+		switch {
+		case instance.backupRunsErr != nil:
+			if err := p.recordDenied(instance.backupRunsErr); err != nil && runsErr == nil {
+				runsErr = err
 			}
-			maxRuns := 3
-			if maxRuns >= len(gcpBackups) {
-				maxRuns = len(gcpBackups)
+		case !instance.backupsDisabled:
+			instance.CheckFreshness(time.Now(), backupWithin("SQL"))
+		}
+		instance.CheckAvailability(getStringSlice("productionEnv"))
+	}
+	return runsErr
+}
+
+// IngestBackupRuns ingests the instance's backup runs, keeping any error
+// listing them for display
+func (rdb *reportSQLInstance) IngestBackupRuns(ctx context.Context, taker TakerSQLAdmin) {
+	var gcpBackups []*sqladmin.BackupRun
+	backupErr := limited(func() (err error) {
+		gcpBackups, err = taker.ListBackupRuns(ctx, rdb.project, rdb)
+		return
+	})
+	if backupErr != nil {
+		rdb.backupRunsErr = backupErr
+		return
+	}
+	for _, gcpBackup := range gcpBackups {
+		rdb.backupRuns = append(rdb.backupRuns, &reportBackupRun{gcpBackupRun: gcpBackup})
+	}
+}
+
+// CheckProtection flags an instance whose automated backups are disabled,
+// or whose backups cannot be recovered to a point in time.
+func (rdb *reportSQLInstance) CheckProtection() {
+	var config *sqladmin.BackupConfiguration
+	if settings := rdb.gcpSQLInstance.Settings; settings != nil {
+		config = settings.BackupConfiguration
+	}
+	rdb.backupsDisabled = config == nil || !config.Enabled
+	rdb.noPITR = !rdb.backupsDisabled && !config.BinaryLogEnabled
+	switch {
+	case rdb.backupsDisabled:
+		rdb.project.addFinding(severityCritical, "sql/"+rdb.gcpSQLInstance.Name, "automated backups are disabled")
+	case rdb.noPITR:
+		rdb.project.addFinding(severityWarn, "sql/"+rdb.gcpSQLInstance.Name, "binary logging is disabled, so there is no point-in-time recovery")
+	}
+}
+
+// CheckAvailability marks the instance zonal when its project's env is one
+// of productionEnvs and it is not regionally available.
+func (rdb *reportSQLInstance) CheckAvailability(productionEnvs []string) {
+	rdb.zonal = false
+	if !containsString(productionEnvs, rdb.project.env) {
+		return
+	}
+	if settings := rdb.gcpSQLInstance.Settings; settings == nil || settings.AvailabilityType != "REGIONAL" {
+		rdb.zonal = true
+		rdb.project.addFinding(severityWarn, "sql/"+rdb.gcpSQLInstance.Name, "production instance is zonal rather than regional")
+	}
+}
+
+// lastBackup returns when the most recent successful backup run ended. Runs
+// that did not succeed do not count.
+func (rdb *reportSQLInstance) lastBackup() (last time.Time, ok bool) {
+	for _, backupRun := range rdb.backupRuns {
+		gcpRun := backupRun.gcpBackupRun
+		if gcpRun.Status != "" && gcpRun.Status != "SUCCESSFUL" {
+			continue
+		}
+		endTime, err := time.Parse(time.RFC3339, gcpRun.EndTime)
+		if err == nil && (!ok || endTime.After(last)) {
+			last, ok = endTime, true
+		}
+	}
+	return
+}
+
+// CheckFreshness marks the instance stale unless a backup run ended within
+// the interval.
+func (rdb *reportSQLInstance) CheckFreshness(now time.Time, within time.Duration) {
+	if last, ok := rdb.lastBackup(); ok && now.Sub(last) <= within {
+		rdb.stale = false
+		return
+	}
+	rdb.stale = true
+	rdb.project.addFinding(severityWarn, "sql/"+rdb.gcpSQLInstance.Name, fmt.Sprintf("no backup completed within %v", within))
+}
+
+// displayedBackupRuns gives the indexes of the backup runs to display: with
+// --max-age every run ended, or enqueued, within it, otherwise the --max-backup-runs
+// most recent
+func (rdb *reportSQLInstance) displayedBackupRuns() []int {
+	var shown []int
+	maxAge := viper.GetDuration("maxAge")
+	for index, backupRun := range rdb.backupRuns {
+		if maxAge > 0 {
+			// runs still going have no end time yet
+			when := supplyDefault(backupRun.gcpBackupRun.EndTime, backupRun.gcpBackupRun.EnqueuedTime)
+			at, err := time.Parse(time.RFC3339, when)
+			if err != nil || displayNow().Sub(at) > maxAge {
+				continue
 			}
-			for index, backupRun := range instance.backupRuns[0:maxRuns] {
-				fmt.Printf("    backup [%2d]: enqueued[%16s] start[%16s] end[%16s]\n",
-					index, backupRun.gcpBackupRun.EnqueuedTime, backupRun.gcpBackupRun.StartTime, backupRun.gcpBackupRun.EndTime)
+		} else if index >= viper.GetInt("maxBackupRuns") {
+			break
+		}
+		shown = append(shown, index)
+	}
+	return shown
+}
+
+// displaySQLInstances shows a table of the instances' backup configuration,
+// then one of the backup runs displayedBackupRuns gives
+func displaySQLInstances(w io.Writer, instances []*reportSQLInstance) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  SQL INSTANCE\tVERSION\tTIER\tREGION\tAVAILABILITY\tBACKUP ENABLED\tPITR\tSTATUS")
+	for _, rdb := range instances {
+		gcpInstance := rdb.gcpSQLInstance
+		tier, availability, enabled, pitr := "-", "ZONAL", false, false
+		if settings := gcpInstance.Settings; settings != nil {
+			tier = supplyDefault(settings.Tier, "-")
+			availability = supplyDefault(settings.AvailabilityType, availability)
+			if settings.BackupConfiguration != nil {
+				enabled = settings.BackupConfiguration.Enabled
+				pitr = settings.BackupConfiguration.BinaryLogEnabled
 			}
 		}
+		var markers []string
+		if rdb.backupsDisabled {
+			markers = append(markers, alert("NO-BACKUPS"))
+		}
+		if rdb.noPITR {
+			markers = append(markers, alert("NO-PITR"))
+		}
+		if rdb.stale {
+			markers = append(markers, alert("STALE"))
+		}
+		if rdb.zonal {
+			markers = append(markers, alert("ZONAL"))
+		}
+		status := healthy("OK")
+		if len(markers) > 0 {
+			status = strings.Join(markers, " ")
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%s\t%s\t%t\t%t\t%s\n", gcpInstance.Name, supplyDefault(gcpInstance.DatabaseVersion, "-"),
+			tier, supplyDefault(gcpInstance.Region, "-"), availability, enabled, pitr, status)
+	}
+	table.Flush()
+
+	table = newTable(w)
+	header := false
+	for _, rdb := range instances {
+		if rdb.backupRunsErr != nil {
+			continue
+		}
+		shown := rdb.displayedBackupRuns()
+		if len(shown) > 0 && !header {
+			fmt.Fprintln(table, "    SQL INSTANCE\tBACKUP\tENQUEUED\tSTART\tEND")
+			header = true
+		}
+		for _, index := range shown {
+			backupRun := rdb.backupRuns[index]
+			fmt.Fprintf(table, "    %s\t%d\t%s\t%s\t%s\n", rdb.gcpSQLInstance.Name,
+				index, formatTimestamp(backupRun.gcpBackupRun.EnqueuedTime), formatTimestamp(backupRun.gcpBackupRun.StartTime),
+				formatTimestamp(backupRun.gcpBackupRun.EndTime))
+		}
+	}
+	table.Flush()
+	for _, rdb := range instances {
+		if rdb.backupRunsErr != nil {
+			fmt.Fprintf(w, "  cannot get list of backup runs for instance[%s]: %v\n", rdb.gcpSQLInstance.Name, rdb.backupRunsErr)
+		}
 	}
-	return nil
 }
 
-func filterProjects(gcpProjects []*cloudresourcemanager.Project, components []string, envList []string) (retProjects []*reportProject) {
-	compKey := viper.GetString("componentKey")
-	envKey := viper.GetString("envKey")
-	// fmt.Println("envKey:", envKey, ", compKey", compKey, ", envList", envList, ", components", components)
-	compMap := make(map[string]bool, 0)
-	envMap := make(map[string]bool, 0)
-	for _, component := range components {
-		compMap[component] = true
+// projectSelector chooses projects by their labels. A project is selected
+// when every key constrained by the selector is satisfied.
+type projectSelector struct {
+	// labels maps a label key to its acceptable values
+	labels map[string][]string
+	// patterns maps a label key to expressions, one of which must match the whole value
+	patterns map[string][]*regexp.Regexp
+}
+
+// newProjectSelector builds the selector used by filterProjects. The
+// component and environment lists select on the configured component and env
+// keys; each generic selector is of the form key=value and each pattern is of
+// the form key=regex.
+func newProjectSelector(components []string, envList []string, labels []string, labelPatterns []string) (*projectSelector, error) {
+	selector := &projectSelector{labels: make(map[string][]string), patterns: make(map[string][]*regexp.Regexp)}
+	add := func(key string, values ...string) {
+		if len(values) > 0 {
+			selector.labels[key] = append(selector.labels[key], values...)
+		}
+	}
+	add(viper.GetString("envKey"), envList...)
+	add(viper.GetString("componentKey"), components...)
+	for _, label := range labels {
+		key, value, err := splitKeyValue(label)
+		if err != nil {
+			return nil, err
+		}
+		add(key, value)
 	}
-	for _, e := range envList {
-		envMap[e] = true
+	for _, labelPattern := range labelPatterns {
+		key, pattern, err := splitKeyValue(labelPattern)
+		if err != nil {
+			return nil, err
+		}
+		re, reErr := regexp.Compile("^(?:" + pattern + ")$")
+		if reErr != nil {
+			return nil, fmt.Errorf("label pattern for key %q is not a valid regular expression: %v", key, reErr)
+		}
+		selector.patterns[key] = append(selector.patterns[key], re)
 	}
-	mapArr := []map[string]bool{envMap, compMap}
+	return selector, nil
+}
 
-	for _, project := range gcpProjects {
-		// fmt.Println("project", project.ProjectId, "labels", project.Labels, ", envMap", envMap, ", compMap", compMap)
-		ok := true
-		for idx, key := range []string{envKey, compKey} {
-			if len(mapArr[idx]) != 0 && !mapArr[idx][project.Labels[key]] {
-				// fmt.Println(key, ": couldn't match:", idx, key, project.Labels, mapArr[idx][project.Labels[key]])
-				ok = false
+func splitKeyValue(s string) (key, value string, err error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", "", fmt.Errorf("label selector %q is not of the form key=value", s)
+	}
+	return kv[0], kv[1], nil
+}
+
+func (ps *projectSelector) matches(labels map[string]string) bool {
+	for key, values := range ps.labels {
+		if !containsString(values, labels[key]) {
+			return false
+		}
+	}
+	for key, patterns := range ps.patterns {
+		matched := false
+		for _, re := range patterns {
+			if re.MatchString(labels[key]) {
+				matched = true
 				break
 			}
 		}
-		if ok {
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// warnMissingLabelKeys warns of each label key the selector needs that no
+// project carries at all, likely a mistyped --env-key or --component-key
+// rather than an empty selection, listing the keys the projects do carry
+func warnMissingLabelKeys(gcpProjects []*cloudresourcemanager.Project, selector *projectSelector) {
+	present := make(map[string]bool)
+	for _, project := range gcpProjects {
+		for key := range project.Labels {
+			present[key] = true
+		}
+	}
+	var needed []string
+	for key := range selector.labels {
+		needed = append(needed, key)
+	}
+	for key := range selector.patterns {
+		if _, ok := selector.labels[key]; !ok {
+			needed = append(needed, key)
+		}
+	}
+	sort.Strings(needed)
+	var available []string
+	for key := range present {
+		available = append(available, key)
+	}
+	sort.Strings(available)
+	for _, key := range needed {
+		if !present[key] {
+			logger.Warnf("no project has a label %q to select on; the label keys present are %v", key, available)
+		}
+	}
+}
+
+// filterProjects keeps the projects whose labels satisfy the selector. When
+// projectIDs is not empty, only the projects listed there are considered at
+// all, so the selector narrows the named projects further rather than adding
+// to them.
+func filterProjects(gcpProjects []*cloudresourcemanager.Project, projectIDs []string, selector *projectSelector) (retProjects []*reportProject) {
+	compKey := viper.GetString("componentKey")
+	envKey := viper.GetString("envKey")
+
+	for _, project := range gcpProjects {
+		if len(projectIDs) > 0 && !containsString(projectIDs, project.ProjectId) {
+			continue
+		}
+		if selector.matches(project.Labels) {
 			retProj := &reportProject{gcpProject: project, env: project.Labels[envKey], component: project.Labels[compKey]}
 			retProjects = append(retProjects, retProj)
 		}
 	}
 	return retProjects
 }
+
+// projectExclusion removes projects from a selection, either by exact
+// project ID or by label key=value
+type projectExclusion struct {
+	projectIDs map[string]bool
+	labels     map[string][]string
+}
+
+func newProjectExclusion(projectIDs []string, labels []string) (*projectExclusion, error) {
+	exclusion := &projectExclusion{projectIDs: make(map[string]bool), labels: make(map[string][]string)}
+	for _, projectID := range projectIDs {
+		exclusion.projectIDs[projectID] = true
+	}
+	for _, label := range labels {
+		key, value, err := splitKeyValue(label)
+		if err != nil {
+			return nil, err
+		}
+		exclusion.labels[key] = append(exclusion.labels[key], value)
+	}
+	return exclusion, nil
+}
+
+func (pe *projectExclusion) excludes(project *cloudresourcemanager.Project) bool {
+	if pe.projectIDs[project.ProjectId] {
+		return true
+	}
+	for key, values := range pe.labels {
+		if value, ok := project.Labels[key]; ok && containsString(values, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the projects not excluded
+func (pe *projectExclusion) apply(projects []*reportProject) (retProjects []*reportProject) {
+	for _, project := range projects {
+		if !pe.excludes(project.gcpProject) {
+			retProjects = append(retProjects, project)
+		}
+	}
+	return retProjects
+}
+
+func containsString(list []string, s string) bool {
+	for _, candidate := range list {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
+
+// getStringSlice reads a list-valued setting. Viper hands slice and array
+// flags back in their "[a,b]" string form, so that is unpacked here; lists
+// from the configuration file come through as they are.
+func getStringSlice(key string) []string {
+	value, ok := viper.Get(key).(string)
+	if !ok {
+		return viper.GetStringSlice(key)
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if value == "" {
+		return nil
+	}
+	list, err := csv.NewReader(strings.NewReader(value)).Read()
+	if err != nil {
+		return strings.Split(value, ",")
+	}
+	return list
+}
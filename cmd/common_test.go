@@ -4,11 +4,24 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 	appengine "google.golang.org/api/appengine/v1"
 	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/googleapi"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	storage "google.golang.org/api/storage/v1"
 )
 
 type fpTestTable struct {
@@ -82,6 +95,12 @@ var s2v = map[string][]*appengine.Version{
 		&appengine.Version{Id: "foo", Env: "flexible", VersionUrl: "https://a.b.com/test1-006/default/foo"},
 		&appengine.Version{Id: "bar", Env: "standard", VersionUrl: "https://a.b.com/test1-006/default/bar"},
 	},
+	"test1-sort/default": []*appengine.Version{
+		&appengine.Version{Id: "middle", CreateTime: "2017-05-02T10:00:00Z"},
+		&appengine.Version{Id: "newest", CreateTime: "2017-06-01T10:00:00Z"},
+		&appengine.Version{Id: "oldest", CreateTime: "2017-01-15T10:00:00Z"},
+		&appengine.Version{Id: "newer", CreateTime: "2017-05-20T10:00:00Z"},
+	},
 	"test1-006/test1.6S1": []*appengine.Version{
 		&appengine.Version{Id: "one", Env: "flexible", EnvVariables: envTest1, VersionUrl: "https://a.b.com/test1-000/test1.6S1/one"},
 		&appengine.Version{Id: "two", Env: "standard", VersionUrl: "https://a.b.com/test1-000/test1.6S1/two"},
@@ -160,17 +179,137 @@ func idProj(pList []*reportProject) (displays []string) {
 	return
 }
 
+// filterFixture filters the table's projects by its env and component lists
+func filterFixture(fpt fpTestTable) []*reportProject {
+	viper.Set("envKey", fpt.envKey)
+	viper.Set("componentKey", fpt.compKey)
+	selector, _ := newProjectSelector(fpt.compList, fpt.envList, nil, nil)
+	return filterProjects(fpt.gcpProjList, nil, selector)
+}
+
 func TestFilterProjects(t *testing.T) {
 	for index, fpt := range fpTT {
-		viper.Set("envKey", fpt.envKey)
-		viper.Set("componentKey", fpt.compKey)
-		outP := filterProjects(fpt.gcpProjList, fpt.compList, fpt.envList)
+		outP := filterFixture(fpt)
 		if len(outP) != len(fpt.expectedRetProjects) {
 			t.Errorf("TestFilterProjects: step %d: expected %d projects, but got %d projects: %v\n", index, len(fpt.expectedRetProjects), len(outP), idProj(outP))
 		}
 	}
 }
 
+func TestWarnMissingLabelKeys(t *testing.T) {
+	saved := logger
+	defer func() { logger = saved }()
+	defer viper.Set("envKey", viper.GetString("envKey"))
+	var buf bytes.Buffer
+	logger = &leveledLogger{level: levelWarn, out: log.New(&buf, "", 0)}
+
+	viper.Set("envKey", "environment")
+	selector, _ := newProjectSelector(nil, []string{"e1"}, nil, nil)
+	warnMissingLabelKeys(gcpP, selector)
+	expected := `no project has a label "environment" to select on; the label keys present are [altcomponent altenv component env envbad extraneous]`
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected the mistyped env key warned of with the keys present, have %q", buf.String())
+	}
+
+	buf.Reset()
+	viper.Set("envKey", "env")
+	selector, _ = newProjectSelector(nil, []string{"e1"}, nil, []string{"extraneous=pole.*"})
+	warnMissingLabelKeys(gcpP, selector)
+	if buf.Len() != 0 {
+		t.Errorf("expected no warning for keys some project carries, have %q", buf.String())
+	}
+}
+
+var selectorTT = []struct {
+	labels   []string
+	expected []string
+}{
+	{nil, []string{"test1-project-000", "test1-project-001", "test1-project-002", "test1-project-003", "test1-project-004",
+		"test1-project-005", "test1-project-006", "test1-project-007", "test1-project-008", "test1-project-009", "test1-project-007"}},
+	{[]string{"extraneous=polevault"}, []string{"test1-project-005", "test1-project-006", "test1-project-007", "test1-project-007"}},
+	{[]string{"extraneous=polevault", "component=c1"}, []string{"test1-project-006", "test1-project-007"}},
+	{[]string{"component=c1", "component=c2", "env=e1"}, []string{"test1-project-000", "test1-project-006"}},
+	{[]string{"component=c9"}, nil},
+}
+
+func TestFilterProjectsByLabel(t *testing.T) {
+	viper.Set("envKey", "env")
+	viper.Set("componentKey", "component")
+	for index, tt := range selectorTT {
+		selector, err := newProjectSelector(nil, nil, tt.labels, nil)
+		if err != nil {
+			t.Fatalf("step %d: unexpected selector error: %v", index, err)
+		}
+		if have := idProj(filterProjects(gcpP, nil, selector)); !reflect.DeepEqual(have, tt.expected) {
+			t.Errorf("step %d: expected projects %v, have %v", index, tt.expected, have)
+		}
+	}
+	if _, err := newProjectSelector(nil, nil, []string{"no-equals-sign"}, nil); err == nil {
+		t.Errorf("expected an error for a malformed label selector")
+	}
+}
+
+var projectIDTT = []struct {
+	projectIDs []string
+	labels     []string
+	expected   []string
+}{
+	{[]string{"test1-project-003", "test1-project-006"}, nil, []string{"test1-project-003", "test1-project-006"}},
+	{[]string{"test1-project-003", "test1-project-006"}, []string{"component=c1"}, []string{"test1-project-006"}},
+	{[]string{"test1-project-003", "no-such-project"}, nil, []string{"test1-project-003"}},
+	{[]string{"test1-project-003"}, []string{"component=c9"}, nil},
+}
+
+func TestFilterProjectsByID(t *testing.T) {
+	viper.Set("envKey", "env")
+	viper.Set("componentKey", "component")
+	for index, tt := range projectIDTT {
+		selector, _ := newProjectSelector(nil, nil, tt.labels, nil)
+		if have := idProj(filterProjects(gcpP, tt.projectIDs, selector)); !reflect.DeepEqual(have, tt.expected) {
+			t.Errorf("step %d: expected projects %v, have %v", index, tt.expected, have)
+		}
+	}
+}
+
+var patternTT = []struct {
+	patterns []string
+	expected []string
+}{
+	{[]string{"component=c[13]"}, []string{"test1-project-000", "test1-project-001", "test1-project-004", "test1-project-006", "test1-project-007", "test1-project-008"}},
+	{[]string{"component=c.*", "env=e1"}, []string{"test1-project-000", "test1-project-006"}},
+	{[]string{"extraneous=pole"}, nil},
+	{[]string{"component=c[4-9]", "component=x.*"}, nil},
+}
+
+func TestFilterProjectsByPattern(t *testing.T) {
+	viper.Set("envKey", "env")
+	viper.Set("componentKey", "component")
+	for index, tt := range patternTT {
+		selector, err := newProjectSelector(nil, nil, nil, tt.patterns)
+		if err != nil {
+			t.Fatalf("step %d: unexpected selector error: %v", index, err)
+		}
+		if have := idProj(filterProjects(gcpP, nil, selector)); !reflect.DeepEqual(have, tt.expected) {
+			t.Errorf("step %d: expected projects %v, have %v", index, tt.expected, have)
+		}
+	}
+	if _, err := newProjectSelector(nil, nil, nil, []string{"component=c[1"}); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
+
+func TestExcludeProjects(t *testing.T) {
+	exclusion, err := newProjectExclusion([]string{"test1-project-001", "test1-project-004"}, []string{"extraneous=polevault"})
+	if err != nil {
+		t.Fatalf("unexpected exclusion error: %v", err)
+	}
+	have := idProj(exclusion.apply(filterFixture(fpTT[1])))
+	expected := []string{"test1-project-000", "test1-project-008"}
+	if !reflect.DeepEqual(have, expected) {
+		t.Errorf("expected projects %v, have %v", expected, have)
+	}
+}
+
 type Stat struct {
 	listCall int
 	getCall  int
@@ -184,21 +323,21 @@ type TestTaker struct {
 	callStats map[string]*ApplicationStats
 }
 
-func (tt *TestTaker) GetApplication(rp *reportProject) (app *appengine.Application, err error) {
+func (tt *TestTaker) GetApplication(ctx context.Context, rp *reportProject) (app *appengine.Application, err error) {
 	app = p2a[rp.gcpProject.ProjectId]
 	return
 }
 
-func (tt *TestTaker) ListServices(ra *reportApplication) (services []*appengine.Service, err error) {
+func (tt *TestTaker) ListServices(ctx context.Context, ra *reportApplication) (services []*appengine.Service, err error) {
 	services = a2s[ra.gcpApplication.Id]
 	return
 }
 
-func (tt *TestTaker) ListVersions(rs *reportService) (versions []*appengine.Version, err error) {
+func (tt *TestTaker) ListVersions(ctx context.Context, rs *reportService) (versions []*appengine.Version, err error) {
 	versions = s2v[rs.application.gcpApplication.Id+"/"+rs.gcpService.Id]
 	return
 }
-func (tt *TestTaker) ListVersionInstances(rv *reportVersion) (instances []*appengine.Instance, err error) {
+func (tt *TestTaker) ListVersionInstances(ctx context.Context, rv *reportVersion) (instances []*appengine.Instance, err error) {
 	instances = v2i[rv.service.application.gcpApplication.Id+"/"+rv.service.gcpService.Id+"/"+rv.gcpVersion.Id]
 	return
 }
@@ -209,12 +348,10 @@ var ttaker = &TestTaker{callStats: make(map[string]*ApplicationStats, 0)}
 // ListBuckets(*reportBucket)
 
 func TestIngestProjects(t *testing.T) {
-	viper.Set("envKey", fpTT[0].envKey)
-	viper.Set("componentKey", fpTT[0].compKey)
 	verbose = true
-	testProjList := filterProjects(fpTT[0].gcpProjList, fpTT[0].compList, fpTT[0].envList)
+	testProjList := filterFixture(fpTT[0])
 	for _, testProj := range testProjList {
-		err := testProj.Ingest(ttaker)
+		err := testProj.Ingest(context.Background(), ttaker)
 		if err != nil {
 			t.Errorf("app[%s] error calling TestTaker not expected: %s\n", testProj.gcpProject.ProjectId, err)
 		}
@@ -252,3 +389,1051 @@ func TestIngestProjects(t *testing.T) {
 		}
 	}
 }
+
+func goldenProject() *reportProject {
+	project := &reportProject{gcpProject: gcpP[0], env: "e1", component: "c1"}
+	app := &reportApplication{
+		gcpApplication: &appengine.Application{Id: "golden-app", ServingStatus: "SERVING"},
+		project:        project,
+	}
+	service := &reportService{
+		gcpService: &appengine.Service{
+			Id:    "default",
+			Split: &appengine.TrafficSplit{ShardBy: "IP", Allocations: map[string]float64{"v2": 1.0}},
+		},
+		application: app,
+	}
+	service.versions = []*reportVersion{
+		{gcpVersion: &appengine.Version{Id: "v2", Runtime: "go", ServingStatus: "SERVING"}, service: service},
+		{gcpVersion: &appengine.Version{Id: "v1", Runtime: "go", ServingStatus: "STOPPED"}, service: service},
+	}
+	service.versions[0].instances = []*reportVersionInstance{{gcpVersionInstance: &appengine.Instance{Id: "i1"}, version: service.versions[0]}}
+	app.services = []*reportService{service}
+	project.application = app
+	return project
+}
+
+const goldenDisplay = `application[golden-app]: status[SERVING]
+  service[default] shard strat[IP] traffic[v2=100%]
+    VERSION  RUNTIME  ENV       INSTANCES  SPLIT  NETWORK  SERVING
+    v2       go       standard  1          100    -        SERVING
+    v1       go       standard  0          0      -        STOPPED
+`
+
+func TestDisplayGolden(t *testing.T) {
+	verbose = false
+	var buf bytes.Buffer
+	goldenProject().Display(&buf)
+	if buf.String() != goldenDisplay {
+		t.Errorf("unexpected display output:\nhave:\n%s\nwant:\n%s", buf.String(), goldenDisplay)
+	}
+}
+
+const goldenUnsplitDisplay = `application[golden-app]: status[SERVING]
+  service[default] shard strat[-] traffic[-]
+    VERSION  RUNTIME  ENV       INSTANCES  SPLIT  NETWORK  SERVING
+    v2       go       standard  1          0      -        SERVING
+    v1       go       standard  0          0      -        STOPPED
+`
+
+func TestDisplayWithoutSplit(t *testing.T) {
+	verbose = false
+	project := goldenProject()
+	project.application.services[0].gcpService.Split = nil
+	var buf bytes.Buffer
+	project.Display(&buf)
+	if buf.String() != goldenUnsplitDisplay {
+		t.Errorf("unexpected display output:\nhave:\n%s\nwant:\n%s", buf.String(), goldenUnsplitDisplay)
+	}
+}
+
+const goldenAlignedDisplay = `  service[default] shard strat[IP] traffic[v2=100%]
+    ...earlier versions elided...
+    VERSION                          RUNTIME  ENV       INSTANCES  SPLIT  NETWORK  SERVING
+    v2                               go       standard  1          100    -        SERVING
+    release-2017-06-01-long-version  python   standard  0          0      -        STOPPED
+`
+
+func TestDisplayAligned(t *testing.T) {
+	verbose = false
+	defer viper.Set("displayVersions", viper.GetInt("displayVersions"))
+	viper.Set("displayVersions", 2)
+	service := goldenProject().application.services[0]
+	// with four versions, the newest two are shown
+	service.versions[1].gcpVersion.Id = "release-2017-06-01-long-version"
+	service.versions[1].gcpVersion.Runtime = "python"
+	service.versions = append(service.versions,
+		&reportVersion{gcpVersion: &appengine.Version{Id: "v0"}, service: service},
+		&reportVersion{gcpVersion: &appengine.Version{Id: "v-1"}, service: service})
+	var buf bytes.Buffer
+	service.Display(&buf)
+	if buf.String() != goldenAlignedDisplay {
+		t.Errorf("unexpected display output:\nhave:\n%s\nwant:\n%s", buf.String(), goldenAlignedDisplay)
+	}
+}
+
+func TestDisplayVersionsLimit(t *testing.T) {
+	verbose = false
+	defer viper.Set("displayVersions", viper.GetInt("displayVersions"))
+	for _, tt := range []struct {
+		shown, versions, displayed int
+		elided                     bool
+	}{
+		{5, 6, 5, true},
+		{3, 4, 3, true},
+		{10, 8, 8, false},
+		{1, 1, 1, false},
+	} {
+		viper.Set("displayVersions", tt.shown)
+		service := goldenProject().application.services[0]
+		service.versions = nil
+		for i := 0; i < tt.versions; i++ {
+			service.versions = append(service.versions,
+				&reportVersion{gcpVersion: &appengine.Version{Id: fmt.Sprintf("ver-%d", i)}, service: service})
+		}
+		var buf bytes.Buffer
+		service.Display(&buf)
+		out := buf.String()
+		if have := strings.Count(out, "ver-"); have != tt.displayed {
+			t.Errorf("--display-versions %d of %d: expected %d versions shown, have %d:\n%s", tt.shown, tt.versions, tt.displayed, have, out)
+		}
+		if strings.Contains(out, "elided") != tt.elided {
+			t.Errorf("--display-versions %d of %d: expected elided %t, have:\n%s", tt.shown, tt.versions, tt.elided, out)
+		}
+	}
+}
+
+const goldenSQLDisplay = `  SQL INSTANCE                 VERSION    TIER              REGION       AVAILABILITY  BACKUP ENABLED  PITR   STATUS
+  db                           MYSQL_5_7  db-n1-standard-1  us-central1  REGIONAL      true            true   OK
+  a-much-longer-instance-name  -          -                 -            ZONAL         false           false  STALE
+`
+
+func TestDisplaySQLAligned(t *testing.T) {
+	project := &reportProject{gcpProject: gcpP[0]}
+	enabled := &sqladmin.Settings{
+		Tier: "db-n1-standard-1", AvailabilityType: "REGIONAL",
+		BackupConfiguration: &sqladmin.BackupConfiguration{Enabled: true, BinaryLogEnabled: true},
+	}
+	project.sqlInstances = []*reportSQLInstance{
+		{gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "db", DatabaseVersion: "MYSQL_5_7", Region: "us-central1", Settings: enabled}, project: project},
+		{gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "a-much-longer-instance-name"}, stale: true, project: project},
+	}
+	var buf bytes.Buffer
+	project.Display(&buf)
+	if buf.String() != goldenSQLDisplay {
+		t.Errorf("unexpected display output:\nhave:\n%s\nwant:\n%s", buf.String(), goldenSQLDisplay)
+	}
+}
+
+func TestMaxBackupRuns(t *testing.T) {
+	defer viper.Set("maxBackupRuns", 3)
+	runs := []*reportBackupRun{
+		{gcpBackupRun: &sqladmin.BackupRun{EndTime: "2017-06-03T01:00:00Z"}},
+		{gcpBackupRun: &sqladmin.BackupRun{EndTime: "2017-06-02T01:00:00Z"}},
+		{gcpBackupRun: &sqladmin.BackupRun{EndTime: "2017-06-01T01:00:00Z"}},
+	}
+	instances := []*reportSQLInstance{{gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "db"}, backupRuns: runs}}
+	for _, tt := range []struct {
+		maxRuns, shown int
+	}{
+		{1, 1},
+		{3, 3},
+		{5, 3},
+		{0, 0},
+	} {
+		viper.Set("maxBackupRuns", tt.maxRuns)
+		var buf bytes.Buffer
+		displaySQLInstances(&buf, instances)
+		if shown := strings.Count(buf.String(), "\n    db "); shown != tt.shown {
+			t.Errorf("max %d: expected %d backup runs shown, have %d:\n%s", tt.maxRuns, tt.shown, shown, buf.String())
+		}
+	}
+
+	defer RootCmd.SetArgs(nil)
+	// a flag given on the command line would otherwise outrank later viper.Set calls
+	defer func() {
+		flag := backupCmd.Flags().Lookup("max-backup-runs")
+		flag.Value.Set(flag.DefValue)
+		flag.Changed = false
+	}()
+	RootCmd.SetArgs([]string{"backups", "--max-backup-runs", "-1"})
+	if err := RootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "must not be negative") {
+		t.Errorf("expected a negative --max-backup-runs to be refused, have %v", err)
+	}
+}
+
+func TestMaxAgeInventory(t *testing.T) {
+	defer viper.Set("maxAge", viper.GetDuration("maxAge"))
+	defer viper.Set("maxBackupRuns", viper.GetInt("maxBackupRuns"))
+	viper.Set("maxBackupRuns", 1)
+	now := time.Now()
+	ago := func(age time.Duration) string { return now.Add(-age).Format(time.RFC3339) }
+
+	project := &reportProject{gcpProject: gcpP[0], component: "c1", env: "e1"}
+	instance := &reportSQLInstance{
+		gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "db"},
+		backupRuns: []*reportBackupRun{
+			{gcpBackupRun: &sqladmin.BackupRun{EndTime: ago(3 * 24 * time.Hour)}},
+			{gcpBackupRun: &sqladmin.BackupRun{EndTime: ago(10 * 24 * time.Hour)}},
+			{gcpBackupRun: &sqladmin.BackupRun{EndTime: ago(40 * 24 * time.Hour)}},
+		},
+		project: project,
+	}
+	instance.CheckFreshness(now, 24*time.Hour)
+	bucket := &reportBucket{gcpBucket: &storage.Bucket{Id: "b1", Name: "b1"}, isBackup: true, project: project}
+	for _, age := range []time.Duration{2 * 24 * time.Hour, 20 * 24 * time.Hour, 45 * 24 * time.Hour} {
+		name := fmt.Sprintf("backup/c1/e1/%d/datastore.Widget.backup_info", age/time.Hour)
+		bucket.objects = append(bucket.objects, &reportObject{gcpObject: &storage.Object{Id: "b1/" + name, Name: name}, kind: "Widget", updateTime: now.Add(-age)})
+	}
+	bucket.UpdateKindMap()
+	bucket.CheckFreshness(now, 24*time.Hour)
+
+	for _, tt := range []struct {
+		maxAge        time.Duration
+		runs, objects int
+	}{
+		{0, 1, 0},
+		{30 * 24 * time.Hour, 2, 2},
+	} {
+		viper.Set("maxAge", tt.maxAge)
+		var buf bytes.Buffer
+		displaySQLInstances(&buf, []*reportSQLInstance{instance})
+		bucket.Display(&buf)
+		out := buf.String()
+		if runs := strings.Count(out, "\n    db "); runs != tt.runs {
+			t.Errorf("max-age %v: expected %d backup runs shown, have %d:\n%s", tt.maxAge, tt.runs, runs, out)
+		}
+		if objects := strings.Count(out, "datastore.Widget.backup_info "); objects != tt.objects {
+			t.Errorf("max-age %v: expected %d backup objects listed, have %d:\n%s", tt.maxAge, tt.objects, objects, out)
+		}
+		if !instance.stale || !bucket.staleKinds["Widget"] || strings.Count(out, "STALE") != 2 {
+			t.Errorf("max-age %v: expected the instance and kind still stale by --within:\n%s", tt.maxAge, out)
+		}
+	}
+}
+
+func TestVersionLimitKeepsNewest(t *testing.T) {
+	viper.Set("versionLimit", 2)
+	defer viper.Set("versionLimit", 3000)
+	app := &reportApplication{gcpApplication: &appengine.Application{Id: "test1-sort"}}
+	service := &reportService{gcpService: &appengine.Service{Id: "default"}, application: app}
+	if err := service.Ingest(context.Background(), ttaker); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	var ids []string
+	for _, version := range service.versions {
+		ids = append(ids, version.gcpVersion.Id)
+	}
+	if len(ids) != 2 || ids[0] != "newest" || ids[1] != "newer" {
+		t.Errorf("expected versions [newest newer], have %v", ids)
+	}
+}
+
+// TestIngestVersionsConcurrently is most useful under 'go test -race'
+func TestIngestVersionsConcurrently(t *testing.T) {
+	app := &reportApplication{gcpApplication: &appengine.Application{Id: "test1-sort"}}
+	services := make([]*reportService, 4)
+	done := make(chan error)
+	for i := range services {
+		services[i] = &reportService{gcpService: &appengine.Service{Id: "default"}, application: app}
+		go func(service *reportService) {
+			done <- service.Ingest(context.Background(), ttaker)
+		}(services[i])
+	}
+	for range services {
+		if err := <-done; err != nil {
+			t.Errorf("unexpected ingest error: %v", err)
+		}
+	}
+	for _, service := range services {
+		for i, version := range service.versions {
+			if version.deployTimeUnknown {
+				t.Errorf("version[%s] deploy time should have parsed", version.gcpVersion.Id)
+			}
+			if i > 0 && version.deployTime.After(service.versions[i-1].deployTime) {
+				t.Errorf("version[%s] is out of order", version.gcpVersion.Id)
+			}
+		}
+	}
+
+	unparsed := &reportService{gcpService: &appengine.Service{Id: "default"}, application: &reportApplication{gcpApplication: &appengine.Application{Id: "test1-000"}}}
+	if err := unparsed.Ingest(context.Background(), ttaker); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	for _, version := range unparsed.versions {
+		if !version.deployTimeUnknown {
+			t.Errorf("version[%s] has no create time and should be flagged", version.gcpVersion.Id)
+		}
+	}
+}
+
+func TestDisplayBackups(t *testing.T) {
+	project := &reportProject{gcpProject: gcpP[0]}
+	instance := &reportSQLInstance{
+		gcpSQLInstance: &sqladmin.DatabaseInstance{
+			Name:     "golden-sql",
+			Settings: &sqladmin.Settings{BackupConfiguration: &sqladmin.BackupConfiguration{Enabled: true}},
+		},
+		backupRuns: []*reportBackupRun{
+			{gcpBackupRun: &sqladmin.BackupRun{EnqueuedTime: "2017-06-01T01:00:00Z", StartTime: "2017-06-01T01:00:05Z", EndTime: "2017-06-01T01:02:00Z"}},
+		},
+		project: project,
+	}
+	bucket := &reportBucket{gcpBucket: &storage.Bucket{Id: "golden-backups"}, isBackup: true, project: project}
+	bucket.objects = []*reportObject{
+		{gcpObject: &storage.Object{Id: "golden-backups/backup/c1/e1/datastore.Widget.backup_info"}, kind: "Widget"},
+	}
+	bucket.UpdateKindMap()
+	project.sqlInstances = []*reportSQLInstance{instance}
+	project.backupBuckets = []*reportBucket{bucket}
+
+	viper.Set("timeFormat", timeFormatRFC3339)
+	defer viper.Set("timeFormat", timeFormatRelative)
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"  golden-sql    -        -     -       ZONAL         true            false  OK\n", "  2017-06-01T01:00:05Z  ", "bucket[golden-backups]", "    Widget  golden-b"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected display to contain %q, have:\n%s", expected, out)
+		}
+	}
+}
+
+var b2o = map[string][]*storage.Object{
+	"golden-backups": []*storage.Object{
+		&storage.Object{Id: "golden-backups/backup/c1/e1/datastore.Widget.backup_info/1", Name: "backup/c1/e1/datastore.Widget.backup_info", Updated: "2017-06-01T01:00:00Z"},
+		&storage.Object{Id: "golden-backups/backup/c1/prod/datastore.Gadget.backup_info/1", Name: "backup/c1/prod/datastore.Gadget.backup_info", Updated: "2017-06-01T01:00:00Z"},
+		&storage.Object{Id: "golden-backups/exports/datastore.Sprocket.backup_info/1", Name: "exports/datastore.Sprocket.backup_info", Updated: "2017-06-01T01:00:00Z"},
+		&storage.Object{Id: "golden-backups/README/1", Name: "README", Updated: "2017-06-01T01:00:00Z"},
+	},
+}
+
+type TestStorageTaker struct {
+	prefixes []string
+}
+
+func (tt *TestStorageTaker) ListBuckets(ctx context.Context, rp *reportProject) ([]*storage.Bucket, error) {
+	return []*storage.Bucket{&storage.Bucket{Id: "golden-backups", Name: "golden-backups", Labels: map[string]string{*backupKey: "true"}}}, nil
+}
+
+func (tt *TestStorageTaker) ListObjects(ctx context.Context, rb *reportBucket, prefix string, page func([]*storage.Object) bool) error {
+	tt.prefixes = append(tt.prefixes, prefix)
+	var objects []*storage.Object
+	for _, object := range b2o[rb.gcpBucket.Name] {
+		if strings.HasPrefix(object.Name, prefix) {
+			objects = append(objects, object)
+		}
+	}
+	page(objects)
+	return nil
+}
+
+func TestBackupPath(t *testing.T) {
+	viper.Set("backupPrefix", "")
+	project := &reportProject{gcpProject: gcpP[0], component: "c1", env: "e1"}
+	if err := project.IngestStorage(context.Background(), &TestStorageTaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	bucket := project.backupBuckets[0]
+	expected := map[string][2]string{
+		"backup/c1/e1/datastore.Widget.backup_info":   {"c1", "e1"},
+		"backup/c1/prod/datastore.Gadget.backup_info": {"c1", "prod"},
+		"exports/datastore.Sprocket.backup_info":      {"", ""},
+		"README":                                      {"", ""},
+	}
+	for _, object := range bucket.objects {
+		if have := [2]string{object.component, object.env}; have != expected[object.gcpObject.Name] {
+			t.Errorf("object[%s]: expected component/env %v, have %v", object.gcpObject.Name, expected[object.gcpObject.Name], have)
+		}
+	}
+	misplacedFindings := 0
+	for _, f := range project.findings {
+		if strings.HasPrefix(f.resource, "object/") {
+			misplacedFindings++
+		}
+	}
+	if bucket.misplaced != 2 || misplacedFindings != 2 {
+		t.Errorf("expected the prod and exports objects to be misplaced, have %d: %v", bucket.misplaced, project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	if out := buf.String(); !strings.Contains(out, "2 objects MISPLACED outside backup/c1/e1/") {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
+
+func TestBackupFreshness(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+	project := &reportProject{gcpProject: gcpP[0]}
+	bucket := &reportBucket{gcpBucket: &storage.Bucket{Id: "golden-backups", Name: "golden-backups"}, isBackup: true, project: project}
+	for _, fixture := range []struct{ kind, updated string }{
+		{"Fresh", "2017-06-02T06:00:00Z"},
+		{"Stale", "2017-06-01T06:00:00Z"},
+		{"Stale", "2017-05-30T06:00:00Z"},
+	} {
+		updateTime, _ := time.Parse(time.RFC3339, fixture.updated)
+		bucket.objects = append(bucket.objects, &reportObject{
+			gcpObject: &storage.Object{Id: "golden-backups/datastore." + fixture.kind + ".backup_info"}, kind: fixture.kind, updateTime: updateTime})
+	}
+	bucket.UpdateKindMap()
+	bucket.CheckFreshness(now, 24*time.Hour)
+
+	if bucket.staleKinds["Fresh"] || !bucket.staleKinds["Stale"] {
+		t.Errorf("expected only Stale to be stale, have %v", bucket.staleKinds)
+	}
+
+	var buf bytes.Buffer
+	bucket.Display(&buf)
+	out := buf.String()
+	if strings.Count(out, "STALE") != 1 {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
+
+func TestExpectedKindsMissing(t *testing.T) {
+	viper.Set("expectedKind", []string{"Widget", "Gizmo"})
+	viper.Set("expectedKinds", []string{"Gadget", "Widget"})
+	defer viper.Set("expectedKind", []string{})
+	defer viper.Set("expectedKinds", []string{})
+	if kinds := expectedKinds(); !reflect.DeepEqual(kinds, []string{"Widget", "Gizmo", "Gadget"}) {
+		t.Errorf("expected flag and configured kinds merged, have %v", kinds)
+	}
+
+	project := &reportProject{gcpProject: gcpP[0], component: "c1", env: "e1"}
+	if err := project.IngestStorage(context.Background(), &TestStorageTaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if !reflect.DeepEqual(project.missingKinds, []string{"Gizmo"}) {
+		t.Errorf("expected only Gizmo missing, have %v", project.missingKinds)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	if out := buf.String(); !strings.Contains(out, "kind[Gizmo] MISSING") {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
+
+func TestBackupPrefix(t *testing.T) {
+	defer viper.Set("backupPrefix", "")
+	for _, tt := range []struct {
+		prefix  string
+		objects int
+	}{
+		{"backup/", 2},
+		{"", 4},
+	} {
+		viper.Set("backupPrefix", tt.prefix)
+		taker := &TestStorageTaker{}
+		project := &reportProject{gcpProject: gcpP[0], component: "c1", env: "e1"}
+		if err := project.IngestStorage(context.Background(), taker); err != nil {
+			t.Fatalf("unexpected ingest error: %v", err)
+		}
+		if !reflect.DeepEqual(taker.prefixes, []string{tt.prefix}) {
+			t.Errorf("expected prefix %q to be forwarded, have %q", tt.prefix, taker.prefixes)
+		}
+		if have := len(project.backupBuckets[0].objects); have != tt.objects {
+			t.Errorf("prefix %q: expected %d objects, have %d", tt.prefix, tt.objects, have)
+		}
+	}
+}
+
+// labeledStorageTaker offers the golden backups under a custom label alone,
+// beside a bucket carrying the backup key but not that label
+type labeledStorageTaker struct {
+	TestStorageTaker
+}
+
+func (tt *labeledStorageTaker) ListBuckets(ctx context.Context, rp *reportProject) ([]*storage.Bucket, error) {
+	return []*storage.Bucket{
+		&storage.Bucket{Id: "golden-backups", Name: "golden-backups", Labels: map[string]string{"purpose": "archive"}},
+		&storage.Bucket{Id: "golden-logs", Name: "golden-logs", Labels: map[string]string{*backupKey: "true", "purpose": "logs"}},
+	}, nil
+}
+
+func TestBucketLabelSelector(t *testing.T) {
+	defer viper.Set("bucketLabel", getStringSlice("bucketLabel"))
+	viper.Set("bucketLabel", []string{"purpose=archive"})
+	taker := &labeledStorageTaker{}
+	project := &reportProject{gcpProject: gcpP[0], component: "c1", env: "e1"}
+	if err := project.IngestStorage(context.Background(), taker); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.backupBuckets) != 2 {
+		t.Fatalf("expected both buckets ingested, have %d", len(project.backupBuckets))
+	}
+	archive, logs := project.backupBuckets[0], project.backupBuckets[1]
+	if !archive.isBackup || len(archive.objects) == 0 {
+		t.Errorf("expected the bucket matching the selector to have its objects ingested, have %d", len(archive.objects))
+	}
+	if logs.isBackup || len(taker.prefixes) != 1 {
+		t.Errorf("expected the bucket with only the backup key to be skipped, listed objects %d times", len(taker.prefixes))
+	}
+
+	viper.Set("bucketLabel", []string{"purpose"})
+	if err := (&reportProject{gcpProject: gcpP[0]}).IngestStorage(context.Background(), taker); err == nil {
+		t.Error("expected a selector without a value to be refused")
+	}
+}
+
+// locatedStorageTaker offers backup buckets in a European and a US location
+type locatedStorageTaker struct {
+	TestStorageTaker
+}
+
+func (tt *locatedStorageTaker) ListBuckets(ctx context.Context, rp *reportProject) ([]*storage.Bucket, error) {
+	return []*storage.Bucket{
+		&storage.Bucket{Id: "golden-backups", Name: "golden-backups", Location: "EUROPE-WEST1", Labels: map[string]string{*backupKey: "true"}},
+		&storage.Bucket{Id: "golden-us", Name: "golden-us", Location: "US", Labels: map[string]string{*backupKey: "true"}},
+	}, nil
+}
+
+func TestAllowedBucketLocation(t *testing.T) {
+	defer viper.Set("allowedBucketLocation", getStringSlice("allowedBucketLocation"))
+	viper.Set("allowedBucketLocation", []string{"europe-west1", "EU"})
+	project := &reportProject{gcpProject: gcpP[0], component: "c1", env: "e1"}
+	if err := project.IngestStorage(context.Background(), &locatedStorageTaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	europe, us := project.backupBuckets[0], project.backupBuckets[1]
+	if europe.mislocated || !us.mislocated {
+		t.Errorf("expected only the US bucket to be mislocated, have %v and %v", europe.mislocated, us.mislocated)
+	}
+	found := false
+	for _, f := range project.findings {
+		if f.resource == "bucket/golden-us" && f.severity == severityCritical {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a critical finding for the US bucket, have %v", project.findings)
+	}
+	if summary := project.Summarize(); summary.MislocatedBuckets != 1 || summary.BackupProblems() == 0 {
+		t.Errorf("expected the mislocated bucket to be a backup problem, have %+v", summary)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	if out := buf.String(); strings.Count(out, "NOT-ALLOWED") != 1 || !strings.Contains(out, "location[US] NOT-ALLOWED") {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+
+	viper.Set("allowedBucketLocation", []string{})
+	project = &reportProject{gcpProject: gcpP[0], component: "c1", env: "e1"}
+	if err := project.IngestStorage(context.Background(), &locatedStorageTaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if project.backupBuckets[1].mislocated {
+		t.Error("expected any location to be allowed without --allowed-bucket-location")
+	}
+}
+
+func TestBucketSizes(t *testing.T) {
+	project := &reportProject{gcpProject: gcpP[0]}
+	bucket := &reportBucket{gcpBucket: &storage.Bucket{Id: "golden-backups", Name: "golden-backups"}, isBackup: true, project: project}
+	for _, fixture := range []struct {
+		kind string
+		size uint64
+	}{
+		{"Widget", 3 << 20},
+		{"Widget", 1 << 19},
+		{"Gadget", 1536},
+		{"", 100},
+	} {
+		bucket.objects = append(bucket.objects, &reportObject{
+			gcpObject: &storage.Object{Id: "golden-backups/datastore." + fixture.kind + ".backup_info", Size: fixture.size}, kind: fixture.kind})
+	}
+	bucket.UpdateKindMap()
+	if bucket.totalSize != 3<<20+1<<19+1536+100 {
+		t.Errorf("unexpected bucket total size %d", bucket.totalSize)
+	}
+	if bucket.kindSizes["Widget"] != 3<<20+1<<19 || bucket.kindSizes["Gadget"] != 1536 {
+		t.Errorf("unexpected kind sizes %v", bucket.kindSizes)
+	}
+
+	var buf bytes.Buffer
+	bucket.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"has 4 objects totalling 3.5 MiB", "  2        3.5 MiB ", "  1        1.5 KiB "} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected display to contain %q, have:\n%s", expected, out)
+		}
+	}
+}
+
+func TestHumanizeBytes(t *testing.T) {
+	for size, expected := range map[int64]string{
+		0:             "0 B",
+		1023:          "1023 B",
+		1024:          "1.0 KiB",
+		5 << 30:       "5.0 GiB",
+		1<<40 + 1<<39: "1.5 TiB",
+		1 << 60:       "1.0 EiB",
+	} {
+		if have := humanizeBytes(size); have != expected {
+			t.Errorf("%d: expected %q, have %q", size, expected, have)
+		}
+	}
+}
+
+func TestGetStringSlice(t *testing.T) {
+	defer viper.Set("listKey", nil)
+	for _, tt := range []struct {
+		value    interface{}
+		expected []string
+	}{
+		{"[]", nil},
+		{"[a,b]", []string{"a", "b"}},
+		{`["a,b",c]`, []string{"a,b", "c"}},
+		{[]string{"x", "y"}, []string{"x", "y"}},
+		{[]interface{}{"z"}, []string{"z"}},
+	} {
+		viper.Set("listKey", tt.value)
+		if have := getStringSlice("listKey"); !reflect.DeepEqual(have, tt.expected) {
+			t.Errorf("value %#v: expected %v, have %v", tt.value, tt.expected, have)
+		}
+	}
+}
+
+// TestSQLAdminTaker answers with fixed instances, each with the same backup runs
+type TestSQLAdminTaker struct {
+	instances []*sqladmin.DatabaseInstance
+	runs      []*sqladmin.BackupRun
+}
+
+func (tt *TestSQLAdminTaker) ListSQLInstances(ctx context.Context, project *reportProject) ([]*sqladmin.DatabaseInstance, error) {
+	return tt.instances, nil
+}
+
+func (tt *TestSQLAdminTaker) ListBackupRuns(ctx context.Context, project *reportProject, dbi *reportSQLInstance) ([]*sqladmin.BackupRun, error) {
+	return tt.runs, nil
+}
+
+func TestSQLAvailability(t *testing.T) {
+	viper.Set("productionEnv", []string{"prod"})
+	defer viper.Set("productionEnv", []string{})
+	backupsOn := &sqladmin.BackupConfiguration{Enabled: true, BinaryLogEnabled: true}
+	taker := &TestSQLAdminTaker{instances: []*sqladmin.DatabaseInstance{
+		{Name: "zonal", Settings: &sqladmin.Settings{AvailabilityType: "ZONAL", BackupConfiguration: backupsOn}},
+		{Name: "regional", Settings: &sqladmin.Settings{AvailabilityType: "REGIONAL", BackupConfiguration: backupsOn}},
+	}, runs: []*sqladmin.BackupRun{{Status: "SUCCESSFUL", EndTime: time.Now().Format(time.RFC3339)}}}
+
+	for _, env := range []string{"prod", "dev"} {
+		project := &reportProject{gcpProject: gcpP[0], env: env}
+		if err := project.IngestSQLInstances(context.Background(), taker); err != nil {
+			t.Fatalf("unexpected ingest error: %v", err)
+		}
+		zonal, regional := project.sqlInstances[0], project.sqlInstances[1]
+		if zonal.zonal != (env == "prod") || regional.zonal {
+			t.Errorf("%s: expected only a production zonal instance flagged, have %t %t", env, zonal.zonal, regional.zonal)
+		}
+		marked := 0
+		if env == "prod" {
+			marked = 1
+		}
+		if len(project.findings) != marked {
+			t.Errorf("%s: unexpected findings %v", env, project.findings)
+		}
+		var buf bytes.Buffer
+		project.Display(&buf)
+		if strings.Count(buf.String(), " ZONAL\n") != marked {
+			t.Errorf("%s: unexpected display:\n%s", env, buf.String())
+		}
+	}
+}
+
+func TestSQLProtection(t *testing.T) {
+	recent := []*sqladmin.BackupRun{{Status: "SUCCESSFUL", EndTime: time.Now().Format(time.RFC3339)}}
+	for _, tt := range []struct {
+		config   *sqladmin.BackupConfiguration
+		marker   string
+		problems int
+	}{
+		{&sqladmin.BackupConfiguration{}, "NO-BACKUPS", 1},
+		{&sqladmin.BackupConfiguration{Enabled: true}, "NO-PITR", 1},
+		{&sqladmin.BackupConfiguration{Enabled: true, BinaryLogEnabled: true}, "", 0},
+	} {
+		taker := &TestSQLAdminTaker{instances: []*sqladmin.DatabaseInstance{
+			{Name: "db", Settings: &sqladmin.Settings{AvailabilityType: "REGIONAL", BackupConfiguration: tt.config}},
+		}, runs: recent}
+		project := &reportProject{gcpProject: gcpP[0]}
+		if err := project.IngestSQLInstances(context.Background(), taker); err != nil {
+			t.Fatalf("unexpected ingest error: %v", err)
+		}
+		instance := project.sqlInstances[0]
+		if instance.backupsDisabled != (tt.marker == "NO-BACKUPS") || instance.noPITR != (tt.marker == "NO-PITR") {
+			t.Errorf("%+v: unexpected flags backups disabled %t, no PITR %t", tt.config, instance.backupsDisabled, instance.noPITR)
+		}
+		if len(project.findings) != tt.problems {
+			t.Errorf("%+v: unexpected findings %v", tt.config, project.findings)
+		}
+		if problems := summarizeProjects([]*reportProject{project}).BackupProblems(); problems != tt.problems {
+			t.Errorf("%+v: expected %d problems to fail on, have %d", tt.config, tt.problems, problems)
+		}
+
+		var buf bytes.Buffer
+		project.Display(&buf)
+		if tt.marker != "" && !strings.Contains(buf.String(), " "+tt.marker+"\n") {
+			t.Errorf("%+v: expected %s in the display, have:\n%s", tt.config, tt.marker, buf.String())
+		}
+		record := newProjectJSON(project).SQLInstances[0]
+		if record.BackupsDisabled != instance.backupsDisabled || record.NoPITR != instance.noPITR {
+			t.Errorf("%+v: JSON does not match the instance, have %+v", tt.config, record)
+		}
+	}
+}
+
+func TestBackupWithinPerType(t *testing.T) {
+	defer viper.Set("within", viper.GetDuration("within"))
+	defer viper.Set("withinSQL", 0)
+	defer viper.Set("withinDatastore", 0)
+	viper.Set("within", 24*time.Hour)
+	viper.Set("withinSQL", 72*time.Hour)
+	viper.Set("withinDatastore", 0)
+	if within := backupWithin("SQL"); within != 72*time.Hour {
+		t.Errorf("expected --within-sql to take precedence, have %v", within)
+	}
+	if within := backupWithin("Datastore"); within != 24*time.Hour {
+		t.Errorf("expected an unset --within-datastore to fall back to --within, have %v", within)
+	}
+
+	twoDaysAgo := []*sqladmin.BackupRun{{Status: "SUCCESSFUL", EndTime: time.Now().Add(-48 * time.Hour).Format(time.RFC3339)}}
+	for _, tt := range []struct {
+		withinSQL time.Duration
+		stale     bool
+	}{
+		{0, true},
+		{72 * time.Hour, false},
+	} {
+		viper.Set("withinSQL", tt.withinSQL)
+		taker := &TestSQLAdminTaker{instances: []*sqladmin.DatabaseInstance{
+			{Name: "db", Settings: &sqladmin.Settings{AvailabilityType: "REGIONAL",
+				BackupConfiguration: &sqladmin.BackupConfiguration{Enabled: true, BinaryLogEnabled: true}}},
+		}, runs: twoDaysAgo}
+		project := &reportProject{gcpProject: gcpP[0]}
+		if err := project.IngestSQLInstances(context.Background(), taker); err != nil {
+			t.Fatalf("unexpected ingest error: %v", err)
+		}
+		if stale := project.sqlInstances[0].stale; stale != tt.stale {
+			t.Errorf("within-sql %v: expected a backup run two days ago to be stale[%t], have %t", tt.withinSQL, tt.stale, stale)
+		}
+	}
+}
+
+// rendezvousTaker fails both listings, but only once the other listing has
+// started too, so it also proves the two run concurrently
+type rendezvousTaker struct {
+	storageStarted, sqlStarted chan struct{}
+}
+
+func (rt *rendezvousTaker) meet(mine, theirs chan struct{}, err error) error {
+	close(mine)
+	select {
+	case <-theirs:
+		return err
+	case <-time.After(5 * time.Second):
+		return errors.New("the other ingestion never started")
+	}
+}
+
+func (rt *rendezvousTaker) ListBuckets(ctx context.Context, rp *reportProject) ([]*storage.Bucket, error) {
+	return nil, rt.meet(rt.storageStarted, rt.sqlStarted, errors.New("storage is unavailable"))
+}
+
+func (rt *rendezvousTaker) ListObjects(ctx context.Context, rb *reportBucket, prefix string, page func([]*storage.Object) bool) error {
+	return nil
+}
+
+func (rt *rendezvousTaker) ListSQLInstances(ctx context.Context, project *reportProject) ([]*sqladmin.DatabaseInstance, error) {
+	return nil, rt.meet(rt.sqlStarted, rt.storageStarted, errors.New("sql admin is unavailable"))
+}
+
+func (rt *rendezvousTaker) ListBackupRuns(ctx context.Context, project *reportProject, dbi *reportSQLInstance) ([]*sqladmin.BackupRun, error) {
+	return nil, nil
+}
+
+func TestIngestBackupsConcurrently(t *testing.T) {
+	setConcurrency(2)
+	defer setConcurrency(8)
+	taker := &rendezvousTaker{storageStarted: make(chan struct{}), sqlStarted: make(chan struct{})}
+	project := &reportProject{gcpProject: gcpP[0]}
+	storageErr, sqlErr := project.IngestBackups(context.Background(), taker, taker)
+	if storageErr == nil || storageErr.Error() != "storage is unavailable" {
+		t.Errorf("expected the storage error, have %v", storageErr)
+	}
+	if sqlErr == nil || sqlErr.Error() != "sql admin is unavailable" {
+		t.Errorf("expected the sql admin error, have %v", sqlErr)
+	}
+}
+
+// pagedStorageTaker lists its objects a page of one at a time, counting the
+// pages handed out
+type pagedStorageTaker struct {
+	TestStorageTaker
+	objects []*storage.Object
+	pages   int
+}
+
+func (pt *pagedStorageTaker) ListObjects(ctx context.Context, rb *reportBucket, prefix string, page func([]*storage.Object) bool) error {
+	for _, object := range pt.objects {
+		pt.pages++
+		if !page([]*storage.Object{object}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// failingStorageTaker lists two backup buckets, failing to list the objects
+// of the first
+type failingStorageTaker struct {
+	TestStorageTaker
+}
+
+func (ft *failingStorageTaker) ListBuckets(ctx context.Context, rp *reportProject) ([]*storage.Bucket, error) {
+	labels := map[string]string{*backupKey: "true"}
+	return []*storage.Bucket{{Id: "broken", Name: "broken", Labels: labels}, {Id: "golden-backups", Name: "golden-backups", Labels: labels}}, nil
+}
+
+func (ft *failingStorageTaker) ListObjects(ctx context.Context, rb *reportBucket, prefix string, page func([]*storage.Object) bool) error {
+	if rb.gcpBucket.Name == "broken" {
+		return errors.New("listing broken")
+	}
+	return ft.TestStorageTaker.ListObjects(ctx, rb, prefix, page)
+}
+
+func TestIngestStorageKeepsFirstError(t *testing.T) {
+	viper.Set("backupPrefix", "")
+	project := &reportProject{gcpProject: gcpP[0], component: "c1", env: "e1"}
+	if err := project.IngestStorage(context.Background(), &failingStorageTaker{}); err == nil || err.Error() != "listing broken" {
+		t.Errorf("expected the first bucket's error despite the second listing, have %v", err)
+	}
+	if len(project.backupBuckets) != 2 || len(project.backupBuckets[1].objects) == 0 {
+		t.Errorf("expected the second bucket still ingested, have %d buckets", len(project.backupBuckets))
+	}
+}
+
+func TestOnlyStaleStopsListing(t *testing.T) {
+	defer viper.Set("onlyStale", viper.GetBool("onlyStale"))
+	defer viper.Set("expectedKind", viper.Get("expectedKind"))
+	defer viper.Set("backupPrefix", viper.GetString("backupPrefix"))
+	viper.Set("backupPrefix", "")
+	viper.Set("expectedKind", []string{"Widget", "Gadget"})
+	recent, old := time.Now().Add(-time.Hour).Format(time.RFC3339), time.Now().Add(-72*time.Hour).Format(time.RFC3339)
+	object := func(kind, updated string) *storage.Object {
+		name := "backup/c1/e1/datastore." + kind + ".backup_info"
+		return &storage.Object{Id: "golden-backups/" + name + "/1", Name: name, Updated: updated}
+	}
+
+	for _, tt := range []struct {
+		onlyStale bool
+		objects   []*storage.Object
+		pages     int
+	}{
+		{true, []*storage.Object{object("Widget", old), object("Widget", recent), object("Gadget", recent), object("Widget", old), object("Gizmo", old)}, 3},
+		{false, []*storage.Object{object("Widget", old), object("Widget", recent), object("Gadget", recent), object("Widget", old), object("Gizmo", old)}, 5},
+		{true, []*storage.Object{object("Sprocket", old), object("Widget", recent), object("Gadget", recent), object("Sprocket", recent), object("Gizmo", old)}, 4},
+	} {
+		viper.Set("onlyStale", tt.onlyStale)
+		project := &reportProject{gcpProject: gcpP[0], component: "c1", env: "e1"}
+		bucket := &reportBucket{gcpBucket: &storage.Bucket{Id: "golden-backups", Name: "golden-backups"}, isBackup: true, project: project}
+		taker := &pagedStorageTaker{objects: tt.objects}
+		if err := bucket.IngestObjects(context.Background(), taker); err != nil {
+			t.Fatalf("unexpected ingest error: %v", err)
+		}
+		if taker.pages != tt.pages || bucket.listingStopped != (tt.pages < len(tt.objects)) {
+			t.Errorf("only-stale[%t]: expected %d pages listed, have %d, stopped[%t]", tt.onlyStale, tt.pages, taker.pages, bucket.listingStopped)
+		}
+		if len(bucket.staleKinds) != 0 && tt.onlyStale {
+			t.Errorf("only-stale[%t]: expected no stale kind among those listed, have %v", tt.onlyStale, bucket.staleKinds)
+		}
+	}
+}
+
+func TestStreamObjectsDiscardsOldObjects(t *testing.T) {
+	defer viper.Set("streamObjects", viper.GetBool("streamObjects"))
+	defer viper.Set("onlyStale", viper.GetBool("onlyStale"))
+	defer viper.Set("backupPrefix", viper.GetString("backupPrefix"))
+	viper.Set("backupPrefix", "")
+	viper.Set("onlyStale", false)
+	object := func(kind string, age time.Duration, size uint64) *storage.Object {
+		name := "backup/c1/e1/datastore." + kind + ".backup_info"
+		return &storage.Object{Id: "golden-backups/" + name + "/1", Name: name, Size: size,
+			Updated: time.Now().Add(-age).Format(time.RFC3339)}
+	}
+	objects := []*storage.Object{
+		object("Widget", 96*time.Hour, 1), object("Widget", 48*time.Hour, 2), object("Widget", 72*time.Hour, 4),
+		object("Widget", time.Hour, 8), object("Gizmo", 120*time.Hour, 16), object("Gizmo", 240*time.Hour, 32),
+	}
+
+	ingest := func(stream bool) *reportBucket {
+		viper.Set("streamObjects", stream)
+		project := &reportProject{gcpProject: gcpP[0], component: "c1", env: "e1"}
+		bucket := &reportBucket{gcpBucket: &storage.Bucket{Id: "golden-backups", Name: "golden-backups"}, isBackup: true, project: project}
+		taker := &pagedStorageTaker{objects: objects}
+		if err := bucket.IngestObjects(context.Background(), taker); err != nil {
+			t.Fatalf("unexpected ingest error: %v", err)
+		}
+		if taker.pages != len(objects) {
+			t.Errorf("stream[%t]: expected every page listed, have %d", stream, taker.pages)
+		}
+		return bucket
+	}
+	all, streamed := ingest(false), ingest(true)
+
+	if len(streamed.objects) != 3 {
+		t.Errorf("expected the fresh Widget and the newest older Widget and Gizmo kept, have %d objects", len(streamed.objects))
+	}
+	if widget := streamed.kindMap["Widget"]; len(widget) != 2 || widget[1].gcpObject.Size != 2 {
+		t.Errorf("expected the newest Widget older than the window kept, have %v", widget)
+	}
+	if gizmo := streamed.kindMap["Gizmo"]; len(gizmo) != 1 || gizmo[0].gcpObject.Size != 16 {
+		t.Errorf("expected the newest Gizmo kept, have %v", gizmo)
+	}
+	for _, kind := range []string{"Widget", "Gizmo"} {
+		if streamed.kindObjectCount(kind) != all.kindObjectCount(kind) || streamed.kindSizes[kind] != all.kindSizes[kind] {
+			t.Errorf("%s: expected the discarded objects still counted, have %d objects of %d bytes, not %d of %d", kind,
+				streamed.kindObjectCount(kind), streamed.kindSizes[kind], all.kindObjectCount(kind), all.kindSizes[kind])
+		}
+	}
+	if streamed.objectCount() != len(objects) || streamed.totalSize != all.totalSize {
+		t.Errorf("expected %d objects of %d bytes, have %d of %d", len(objects), all.totalSize, streamed.objectCount(), streamed.totalSize)
+	}
+	if !reflect.DeepEqual(streamed.staleKinds, all.staleKinds) || !streamed.staleKinds["Gizmo"] || streamed.staleKinds["Widget"] {
+		t.Errorf("expected Gizmo alone stale either way, have %v and %v", streamed.staleKinds, all.staleKinds)
+	}
+}
+
+// overlappingSQLTaker lists its instances, then holds each backup-run call
+// until the given number are in flight at once, or a second has passed
+type overlappingSQLTaker struct {
+	instances      []*sqladmin.DatabaseInstance
+	want           int32
+	inFlight, peak int32
+	calls          int32
+}
+
+func (ot *overlappingSQLTaker) ListSQLInstances(ctx context.Context, project *reportProject) ([]*sqladmin.DatabaseInstance, error) {
+	return ot.instances, nil
+}
+
+func (ot *overlappingSQLTaker) ListBackupRuns(ctx context.Context, project *reportProject, dbi *reportSQLInstance) ([]*sqladmin.BackupRun, error) {
+	atomic.AddInt32(&ot.calls, 1)
+	n := atomic.AddInt32(&ot.inFlight, 1)
+	defer atomic.AddInt32(&ot.inFlight, -1)
+	for {
+		peak := atomic.LoadInt32(&ot.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&ot.peak, peak, n) {
+			break
+		}
+	}
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&ot.peak) < ot.want && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	return []*sqladmin.BackupRun{{Status: "SUCCESSFUL", EndTime: time.Now().Format(time.RFC3339)}}, nil
+}
+
+func TestBackupRunsFetchedConcurrently(t *testing.T) {
+	setConcurrency(3)
+	defer setConcurrency(8)
+	enabled := &sqladmin.Settings{BackupConfiguration: &sqladmin.BackupConfiguration{Enabled: true, BinaryLogEnabled: true}}
+	taker := &overlappingSQLTaker{want: 3}
+	for _, name := range []string{"db-c", "db-a", "db-b", "db-off"} {
+		instance := &sqladmin.DatabaseInstance{Name: name, Settings: enabled}
+		if name == "db-off" {
+			instance.Settings = nil
+		}
+		taker.instances = append(taker.instances, instance)
+	}
+
+	project := &reportProject{gcpProject: gcpP[0]}
+	if err := project.IngestSQLInstances(context.Background(), taker); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if taker.calls != 3 || taker.peak != 3 {
+		t.Errorf("expected the 3 instances with backups fetched at once, have %d calls, at most %d in flight", taker.calls, taker.peak)
+	}
+	var names []string
+	for _, instance := range project.sqlInstances {
+		names = append(names, instance.gcpSQLInstance.Name)
+		if instance.stale || (len(instance.backupRuns) != 1) != instance.backupsDisabled {
+			t.Errorf("instance %s: unexpected stale[%t] with %d backup runs", instance.gcpSQLInstance.Name, instance.stale, len(instance.backupRuns))
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"db-c", "db-a", "db-b", "db-off"}) {
+		t.Errorf("expected the instances in the order listed, have %v", names)
+	}
+}
+
+func TestDisplayBackupHeader(t *testing.T) {
+	defer func() { displayFields = nil }()
+	project := &reportProject{gcpProject: gcpP[0], component: "c1"}
+	var buf bytes.Buffer
+	project.displayBackupHeader(&buf)
+	if out := buf.String(); !strings.Contains(out, "PROJECT") || !strings.Contains(out, gcpP[0].ProjectId) || !strings.Contains(out, "c1") {
+		t.Errorf("expected the project, env and component tabulated, have:\n%s", out)
+	}
+
+	displayFields = []string{"project"}
+	buf.Reset()
+	project.displayBackupHeader(&buf)
+	if out := buf.String(); strings.Contains(out, "COMPONENT") || !strings.Contains(out, gcpP[0].ProjectId) {
+		t.Errorf("expected --fields project to keep the project column alone, have:\n%s", out)
+	}
+}
+
+func TestBackupsError(t *testing.T) {
+	storageErr, sqlErr := errors.New("bucket listing failed"), errors.New("instance listing failed")
+	for _, tt := range []struct {
+		storageErr, sqlErr error
+		expected           string
+	}{
+		{nil, nil, ""},
+		{storageErr, nil, "bucket listing failed"},
+		{nil, sqlErr, "instance listing failed"},
+		{storageErr, sqlErr, "bucket listing failed; instance listing failed"},
+	} {
+		err := backupsError(tt.storageErr, tt.sqlErr)
+		if have := fmt.Sprint(err); (err == nil) != (tt.expected == "") || err != nil && have != tt.expected {
+			t.Errorf("storage %v, sql %v: expected %q, have %v", tt.storageErr, tt.sqlErr, tt.expected, err)
+		}
+	}
+}
+
+// failingRunsTaker cannot list the backup runs of the instances it has errors for
+type failingRunsTaker struct {
+	TestSQLAdminTaker
+	errs map[string]error
+}
+
+func (ft *failingRunsTaker) ListBackupRuns(ctx context.Context, project *reportProject, dbi *reportSQLInstance) ([]*sqladmin.BackupRun, error) {
+	if err := ft.errs[dbi.gcpSQLInstance.Name]; err != nil {
+		return nil, err
+	}
+	return ft.TestSQLAdminTaker.ListBackupRuns(ctx, project, dbi)
+}
+
+func TestBackupRunsErrors(t *testing.T) {
+	enabled := &sqladmin.Settings{BackupConfiguration: &sqladmin.BackupConfiguration{Enabled: true, BinaryLogEnabled: true}}
+	taker := &failingRunsTaker{
+		TestSQLAdminTaker: TestSQLAdminTaker{instances: []*sqladmin.DatabaseInstance{
+			{Name: "db-denied", Settings: enabled}, {Name: "db-slow", Settings: enabled}, {Name: "db-ok", Settings: enabled},
+		}},
+		errs: map[string]error{
+			"db-denied": &googleapi.Error{Code: http.StatusForbidden, Message: "no backupRuns.list"},
+			"db-slow":   context.DeadlineExceeded,
+		},
+	}
+	project := &reportProject{gcpProject: gcpP[0]}
+	if err := project.IngestSQLInstances(context.Background(), taker); err != context.DeadlineExceeded {
+		t.Errorf("expected the backup runs timing out to fail the project, have %v", err)
+	}
+	var denied bool
+	for _, f := range project.findings {
+		denied = denied || strings.HasPrefix(f.resource, "permission/") && strings.Contains(f.problem, "no backupRuns.list")
+	}
+	if !denied {
+		t.Errorf("expected a finding for the backup runs denied, have %v", project.findings)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+
+	"github.com/spf13/cobra"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// computeCmd represents the compute command
+var computeCmd = &cobra.Command{
+	Use:   "compute",
+	Short: "Show Compute Engine VM instances available from given credentials",
+	Long: `Show the Compute Engine VM instances of each project visible from the
+account used, with their zone, machine type, status and IP addresses.
+Projects are selected the same way as for the other reports; to see the
+instances of projects with a component label of 'our-foo', try this:
+    gcp-reports compute our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, compute.ComputeReadonlyScope, func(clients *clients) (projectIngester, error) {
+			computeService, err := compute.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish compute engine service: %v", err)
+			}
+			taker := &TakerComputeGCP{computeService: computeService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestComputeInstances(ctx, taker)
+			}, nil
+		})
+	},
+}
+
+type TakerCompute interface {
+	ListInstances(context.Context, *reportProject) ([]*compute.Instance, error)
+}
+
+type TakerComputeGCP struct {
+	computeService *compute.Service
+}
+
+type reportComputeInstance struct {
+	gcpInstance *compute.Instance
+
+	project *reportProject // parent
+}
+
+func (rci *reportComputeInstance) Parent() reportNode {
+	return rci.project
+}
+
+// ListInstances gathers the VM instances of the project across all its zones
+func (taker *TakerComputeGCP) ListInstances(ctx context.Context, project *reportProject) (instances []*compute.Instance, err error) {
+	err = doWithRetry(ctx, func() error {
+		instances = nil
+		return taker.computeService.Instances.AggregatedList(project.gcpProject.ProjectId).Pages(ctx, func(page *compute.InstanceAggregatedList) error {
+			for _, scoped := range page.Items {
+				instances = append(instances, scoped.Instances...)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// IngestComputeInstances ingests all the VM instances for this project
+func (p *reportProject) IngestComputeInstances(ctx context.Context, taker TakerCompute) error {
+	var gcpInstances []*compute.Instance
+	listErr := limited(func() (err error) {
+		gcpInstances, err = taker.ListInstances(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+	sort.Sort(computeInstanceSlice(gcpInstances))
+	for _, gcpInstance := range gcpInstances {
+		p.computeInstances = append(p.computeInstances, &reportComputeInstance{gcpInstance: gcpInstance, project: p})
+	}
+	return nil
+}
+
+type computeInstanceSlice []*compute.Instance
+
+func (o computeInstanceSlice) Len() int {
+	return len(o)
+}
+
+func (o computeInstanceSlice) Less(i, j int) bool {
+	if o[i].Zone != o[j].Zone {
+		return o[i].Zone < o[j].Zone
+	}
+	return o[i].Name < o[j].Name
+}
+
+func (o computeInstanceSlice) Swap(i, j int) {
+	o[i], o[j] = o[j], o[i]
+}
+
+// addresses returns the first internal and external IP of the instance, if any
+func (rci *reportComputeInstance) addresses() (internal, external string) {
+	for _, nic := range rci.gcpInstance.NetworkInterfaces {
+		if internal == "" {
+			internal = nic.NetworkIP
+		}
+		for _, access := range nic.AccessConfigs {
+			if external == "" {
+				external = access.NatIP
+			}
+		}
+	}
+	return supplyDefault(internal, "-"), supplyDefault(external, "-")
+}
+
+// Display shows the instance on a single line
+func (rci *reportComputeInstance) Display(w io.Writer) {
+	gcpInstance := rci.gcpInstance
+	internal, external := rci.addresses()
+	fmt.Fprintf(w, "  instance[%24s] zone[%16s] machine[%16s] status[%10s] internal[%15s] external[%15s]\n",
+		gcpInstance.Name, path.Base(gcpInstance.Zone), path.Base(gcpInstance.MachineType), gcpInstance.Status, internal, external)
+}
+
+func init() {
+	RootCmd.AddCommand(computeCmd)
+}
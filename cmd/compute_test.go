@@ -0,0 +1,70 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+var p2ci = map[string][]*compute.Instance{
+	"test1-project-000": []*compute.Instance{
+		&compute.Instance{
+			Name:        "web-1",
+			Zone:        "https://www.googleapis.com/compute/v1/projects/test1-project-000/zones/us-east1-c",
+			MachineType: "https://www.googleapis.com/compute/v1/projects/test1-project-000/zones/us-east1-c/machineTypes/n1-standard-1",
+			Status:      "RUNNING",
+			NetworkInterfaces: []*compute.NetworkInterface{
+				&compute.NetworkInterface{NetworkIP: "10.0.0.2", AccessConfigs: []*compute.AccessConfig{&compute.AccessConfig{NatIP: "35.1.2.3"}}},
+			},
+		},
+		&compute.Instance{
+			Name:        "batch-1",
+			Zone:        "https://www.googleapis.com/compute/v1/projects/test1-project-000/zones/us-east1-b",
+			MachineType: "https://www.googleapis.com/compute/v1/projects/test1-project-000/zones/us-east1-b/machineTypes/n1-highmem-4",
+			Status:      "TERMINATED",
+			NetworkInterfaces: []*compute.NetworkInterface{
+				&compute.NetworkInterface{NetworkIP: "10.0.0.3"},
+			},
+		},
+	},
+}
+
+type TestComputeTaker struct{}
+
+func (tt *TestComputeTaker) ListInstances(ctx context.Context, rp *reportProject) ([]*compute.Instance, error) {
+	return p2ci[rp.gcpProject.ProjectId], nil
+}
+
+func TestIngestComputeInstances(t *testing.T) {
+	projects := filterFixture(fpTT[0])
+	for _, project := range projects {
+		if err := project.IngestComputeInstances(context.Background(), &TestComputeTaker{}); err != nil {
+			t.Errorf("project[%s]: unexpected ingest error: %v", project.gcpProject.ProjectId, err)
+		}
+	}
+	project := projects[0]
+	if len(project.computeInstances) != 2 {
+		t.Fatalf("expected 2 compute instances, have %d", len(project.computeInstances))
+	}
+	if project.computeInstances[0].gcpInstance.Name != "batch-1" {
+		t.Errorf("expected instances ordered by zone, have %s first", project.computeInstances[0].gcpInstance.Name)
+	}
+	if len(projects[1].computeInstances) != 0 {
+		t.Errorf("expected no compute instances for %s", projects[1].gcpProject.ProjectId)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"zone[      us-east1-c]", "machine[   n1-standard-1]", "internal[       10.0.0.2]", "external[       35.1.2.3]", "external[              -]", "status[TERMINATED]"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected display to contain %q, have:\n%s", expected, out)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// configCmd groups the subcommands managing the configuration file
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Create or show the gcp-reports configuration",
+	Long: `Every flag bound to a configuration key may instead be set in a YAML
+configuration file, read from $HOME/.gcp-reports.yaml unless --config names
+another. Flags given on the command line take precedence over the file.
+`,
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Write a starter configuration file",
+	Long: `Write a starter configuration file documenting the most used keys, set to
+their defaults. The file is written to --config, or $HOME/.gcp-reports.yaml,
+and an existing file is only replaced with --force.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := cfgFile
+		if path == "" {
+			path = filepath.Join(os.Getenv("HOME"), ".gcp-reports.yaml")
+		}
+		if err := writeStarterConfig(path, viper.GetBool("force")); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "wrote %s\n", path)
+		return nil
+	},
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Show the effective configuration",
+	Long: `Show every configuration key with the value it has once the configuration
+file, environment and flags have been merged.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return viewConfig(cmd.OutOrStdout(), viper.AllSettings())
+	},
+}
+
+var starterConfig = template.Must(template.New("config").Parse(`# gcp-reports configuration; any of these may also be given as a flag,
+# which takes precedence over this file.
+
+# project label key whose value names a project's environment
+envKey: {{.envKey}}
+# project label key whose value names a project's runtime component
+componentKey: {{.componentKey}}
+# bucket label key whose value (true/false) marks a Datastore backup bucket
+backupKey: {{.backupKey}}
+# how recently a backup must have completed not to be stale
+within: {{.within}}
+# the same for Cloud SQL or Datastore backups alone, when they differ
+# withinSQL: 72h
+# withinDatastore: 168h
+# locations backup buckets must be in, for data residency
+# allowedBucketLocation: [EUROPE-WEST1, EU]
+# refuse to scan more projects than this, in case a filter selects too many
+# maxProjects: 50
+# maximum number of GCP API calls in flight at once
+concurrency: {{.concurrency}}
+# how many of the most recent App Engine versions to gather
+versionLimit: {{.versionLimit}}
+`))
+
+// writeStarterConfig writes the starter configuration, with each key set to
+// its flag's default, to path. An existing file is only replaced when force
+// is set.
+func writeStarterConfig(path string, force bool) error {
+	flags := map[string]string{
+		"envKey":       backupCmd.Flags().Lookup("env-key").DefValue,
+		"componentKey": backupCmd.Flags().Lookup("component-key").DefValue,
+		"backupKey":    backupCmd.Flags().Lookup("backup-key").DefValue,
+		"within":       backupCmd.Flags().Lookup("within").DefValue,
+		"concurrency":  RootCmd.PersistentFlags().Lookup("concurrency").DefValue,
+		"versionLimit": appsCmd.Flags().Lookup("version-limit").DefValue,
+	}
+	mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		mode |= os.O_EXCL
+	}
+	file, err := os.OpenFile(path, mode, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists: use --force to replace it", path)
+	} else if err != nil {
+		return fmt.Errorf("cannot write configuration: %v", err)
+	}
+	if err := starterConfig.Execute(file, flags); err != nil {
+		file.Close()
+		return fmt.Errorf("cannot write configuration: %v", err)
+	}
+	return file.Close()
+}
+
+// viewConfig shows the settings as YAML, keys sorted
+func viewConfig(w io.Writer, settings map[string]interface{}) error {
+	out, err := yaml.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("cannot show configuration: %v", err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configViewCmd)
+
+	configInitCmd.Flags().Bool("force", false, "replace an existing configuration file")
+	viper.BindPFlag("force", configInitCmd.Flags().Lookup("force"))
+}
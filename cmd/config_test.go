@@ -0,0 +1,95 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestConfigInitAndView(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcp-reports-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "gcp-reports.yaml")
+	if err := writeStarterConfig(path, false); err != nil {
+		t.Fatalf("unexpected init error: %v", err)
+	}
+	if err := writeStarterConfig(path, false); err == nil {
+		t.Errorf("expected init to refuse to replace the file without --force")
+	}
+	if err := writeStarterConfig(path, true); err != nil {
+		t.Errorf("unexpected init error with --force: %v", err)
+	}
+
+	written := viper.New()
+	written.SetConfigFile(path)
+	if err := written.ReadInConfig(); err != nil {
+		t.Fatalf("starter configuration does not parse: %v", err)
+	}
+	if written.GetString("envKey") != "env" || written.GetString("backupKey") != "backup" ||
+		written.GetDuration("within") != 24*time.Hour || written.GetInt("concurrency") != 8 ||
+		written.GetInt("versionLimit") != 3000 {
+		t.Errorf("unexpected starter configuration %v", written.AllSettings())
+	}
+
+	written.Set("envKey", "lifecycle")
+	var buf bytes.Buffer
+	if err := viewConfig(&buf, written.AllSettings()); err != nil {
+		t.Fatalf("unexpected view error: %v", err)
+	}
+	for _, expected := range []string{"envkey: lifecycle\n", "componentkey: component\n", "versionlimit: 3000\n"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in the view, have:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestConfigFileFlag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcp-reports-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer RootCmd.SetArgs(nil)
+	defer func() { cfgFile = "" }()
+
+	path := filepath.Join(dir, "gcp-reports.yaml")
+	if err := ioutil.WriteFile(path, []byte("color: sometimes\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// leave the global viper holding an empty configuration for later tests
+	defer func() {
+		ioutil.WriteFile(path, []byte("{}\n"), 0600)
+		viper.ReadInConfig()
+	}()
+
+	RootCmd.SetArgs([]string{"apps", "--config", path})
+	if err := RootCmd.Execute(); err == nil || !strings.Contains(err.Error(), `"sometimes"`) {
+		t.Errorf("expected the color set in the config file to be used, have %v", err)
+	}
+
+	os.Setenv("GCP_REPORTS_COLOR", "rarely")
+	err = RootCmd.Execute()
+	os.Unsetenv("GCP_REPORTS_COLOR")
+	if err == nil || !strings.Contains(err.Error(), `"rarely"`) {
+		t.Errorf("expected GCP_REPORTS_COLOR to override the config file, have %v", err)
+	}
+
+	missing := filepath.Join(dir, "missing.yaml")
+	RootCmd.SetArgs([]string{"apps", "--config", missing})
+	if err := RootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "cannot read config file "+missing) {
+		t.Errorf("expected a missing config file to be reported, have %v", err)
+	}
+}
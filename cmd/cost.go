@@ -0,0 +1,126 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// hoursPerMonth is the average month the cost estimates are made over
+const hoursPerMonth = 730
+
+// priceTable is the hourly price of each App Engine instance class, as read
+// from --price-table
+type priceTable struct {
+	currency string
+	// hourly maps an upper-case instance class, eg F2, to its hourly price
+	hourly map[string]float64
+}
+
+// loadPriceTable reads a price table from a YAML, JSON or TOML file, eg:
+//
+//	currency: USD
+//	hourly:
+//	  F1: 0.05
+//	  B2: 0.10
+func loadPriceTable(path string) (*priceTable, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("cannot read price table %s: %v", path, err)
+	}
+	table := &priceTable{currency: v.GetString("currency"), hourly: make(map[string]float64)}
+	for class := range v.GetStringMap("hourly") {
+		price := v.GetFloat64("hourly." + class)
+		if price < 0 {
+			return nil, fmt.Errorf("price table %s: negative price %v for instance class %s", path, price, class)
+		}
+		table.hourly[strings.ToUpper(class)] = price
+	}
+	if len(table.hourly) == 0 {
+		return nil, fmt.Errorf("price table %s has no hourly prices", path)
+	}
+	return table, nil
+}
+
+// instanceClass is the version's instance class, or the App Engine default
+// for its scaling when none is set; flexible versions have none
+func instanceClass(version *reportVersion) string {
+	gcpVersion := version.gcpVersion
+	switch {
+	case gcpVersion.Env == "flexible" || gcpVersion.Env == "flex":
+		return ""
+	case gcpVersion.InstanceClass != "":
+		return strings.ToUpper(gcpVersion.InstanceClass)
+	case gcpVersion.BasicScaling != nil || gcpVersion.ManualScaling != nil:
+		return "B2"
+	}
+	return "F1"
+}
+
+// costEstimate is what a version would cost running its current instances
+// all month long
+type costEstimate struct {
+	instanceClass string
+	monthly       float64
+	currency      string
+}
+
+func (c *costEstimate) String() string {
+	if c.currency == "" {
+		return fmt.Sprintf("%.2f", c.monthly)
+	}
+	return fmt.Sprintf("%s %.2f", c.currency, c.monthly)
+}
+
+// Estimate sets the monthly cost estimate of the version, when the table
+// prices its instance class
+func (pt *priceTable) Estimate(version *reportVersion) {
+	class := instanceClass(version)
+	price, ok := pt.hourly[class]
+	if !ok {
+		return
+	}
+	version.cost = &costEstimate{instanceClass: class, monthly: price * hoursPerMonth * float64(len(version.instances)), currency: pt.currency}
+}
+
+// estimateCosts estimates the monthly cost of every version of the projects
+func estimateCosts(projects []*reportProject, table *priceTable) {
+	for _, project := range projects {
+		if project.application == nil {
+			continue
+		}
+		for _, service := range project.application.services {
+			for _, version := range service.versions {
+				table.Estimate(version)
+			}
+		}
+	}
+}
+
+// displayCosts shows the monthly cost estimates of the versions as a table,
+// when --price-table gave any
+func displayCosts(w io.Writer, versions []*reportVersion) {
+	estimated := false
+	for _, version := range versions {
+		estimated = estimated || version.cost != nil
+	}
+	if !estimated {
+		return
+	}
+	table := newTable(w)
+	fmt.Fprintln(table, "    VERSION\tCLASS\tINSTANCES\tEST. MONTHLY COST")
+	for _, version := range versions {
+		class, cost := supplyDefault(instanceClass(version), "-"), "-"
+		if version.cost != nil {
+			cost = version.cost.String()
+		}
+		fmt.Fprintf(table, "    %s\t%s\t%d\t%s\n", version.gcpVersion.Id, class, len(version.instances), cost)
+	}
+	table.Flush()
+}
@@ -0,0 +1,73 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/appengine/v1"
+)
+
+func TestCostEstimate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcp-reports-prices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "prices.yaml")
+	if err := ioutil.WriteFile(path, []byte("currency: USD\nhourly:\n  F1: 0.05\n  f4: 0.20\n  B2: 0.10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prices, err := loadPriceTable(path)
+	if err != nil {
+		t.Fatalf("cannot load price table: %v", err)
+	}
+
+	project := goldenProject()
+	service := project.application.services[0]
+	service.versions[0].gcpVersion.InstanceClass = "F4"
+	instances := service.versions[0].instances
+	service.versions[0].instances = append(instances, &reportVersionInstance{gcpVersionInstance: &appengine.Instance{Id: "i2"}, version: service.versions[0]})
+	service.versions[1].gcpVersion.ManualScaling = &appengine.ManualScaling{Instances: 1}
+	service.versions[1].instances = instances
+	flexible := &reportVersion{gcpVersion: &appengine.Version{Id: "v0", Env: "flexible"}, instances: instances, service: service}
+	service.versions = append(service.versions, flexible)
+	estimateCosts([]*reportProject{project}, prices)
+
+	for _, tt := range []struct {
+		version  *reportVersion
+		class    string
+		expected float64
+	}{
+		{service.versions[0], "F4", 2 * 0.20 * 730},
+		{service.versions[1], "B2", 0.10 * 730},
+	} {
+		cost := tt.version.cost
+		if cost == nil || cost.instanceClass != tt.class || cost.monthly < tt.expected-0.001 || cost.monthly > tt.expected+0.001 {
+			t.Errorf("version %s: expected %s to cost %.2f a month, have %+v", tt.version.gcpVersion.Id, tt.class, tt.expected, cost)
+		}
+	}
+	if flexible.cost != nil {
+		t.Errorf("expected no estimate for a flexible version, have %+v", flexible.cost)
+	}
+
+	var out bytes.Buffer
+	displayCosts(&out, service.versions)
+	if !strings.Contains(out.String(), "USD 292.00") || !strings.Contains(out.String(), "USD 73.00") {
+		t.Errorf("expected the estimates displayed:\n%s", out.String())
+	}
+	record := newProjectJSON(project)
+	if monthly := record.Application.Services[0].Versions[0].EstimatedMonthlyCost; monthly == nil || *monthly != service.versions[0].cost.monthly {
+		t.Errorf("expected the estimate in the JSON record, have %v", monthly)
+	}
+
+	if _, err := loadPriceTable(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Errorf("expected a missing price table to be an error")
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <old.json> <new.json>",
+	Short: "Show what changed between two saved reports",
+	Long: `Compare two reports saved with --save-snapshot or --format ndjson, an
+older and a newer one, and show the projects, App Engine services and versions
+added (+) or removed (-) between them, along with the SQL instances and
+Datastore kinds whose backups went stale since the older one (NEWLY-STALE).
+Nothing is read from Google Cloud. For instance:
+    gcp-reports backups --save-snapshot today.json
+    gcp-reports diff yesterday.json today.json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("diff needs an older and a newer report to compare")
+		}
+		older, err := loadReport(args[0])
+		if err != nil {
+			return err
+		}
+		newer, err := loadReport(args[1])
+		if err != nil {
+			return err
+		}
+		diffReports(older, newer).Display(textOutput())
+		return nil
+	},
+}
+
+// loadReport reads the projects of a report saved with --format ndjson, by
+// project ID
+func loadReport(path string) (map[string]*projectJSON, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open report: %v", err)
+	}
+	defer file.Close()
+	projects := make(map[string]*projectJSON)
+	decoder := json.NewDecoder(file)
+	for {
+		record := &projectJSON{}
+		if err := decoder.Decode(record); err == io.EOF {
+			return projects, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read report %s: %v", path, err)
+		}
+		if record.SchemaVersion > reportSchemaVersion {
+			return nil, fmt.Errorf("report %s has schema version %d, newer than the %d understood", path, record.SchemaVersion, reportSchemaVersion)
+		}
+		projects[record.ProjectID] = record
+	}
+}
+
+// reportDiff is what changed between two reports; each entry is the path of
+// a resource, eg project/service/version, in order
+type reportDiff struct {
+	addedProjects   []string
+	removedProjects []string
+	addedServices   []string
+	removedServices []string
+	addedVersions   []string
+	removedVersions []string
+	// newlyStale are the backups stale in the newer report but not the older,
+	// as project/sql/instance or project/kind/kind
+	newlyStale []string
+}
+
+// diffReports finds what changed from the older to the newer report
+func diffReports(older, newer map[string]*projectJSON) *reportDiff {
+	diff := &reportDiff{}
+	diff.addedProjects, diff.removedProjects = diffKeys(projectKeys(older), projectKeys(newer))
+	for id, newProject := range newer {
+		oldProject, ok := older[id]
+		if !ok {
+			continue
+		}
+		added, removed := diffKeys(serviceKeys(oldProject), serviceKeys(newProject))
+		diff.addedServices = append(diff.addedServices, added...)
+		diff.removedServices = append(diff.removedServices, removed...)
+		added, removed = diffKeys(versionKeys(oldProject), versionKeys(newProject))
+		diff.addedVersions = append(diff.addedVersions, added...)
+		diff.removedVersions = append(diff.removedVersions, removed...)
+		stale, _ := diffKeys(staleKeys(oldProject), staleKeys(newProject))
+		diff.newlyStale = append(diff.newlyStale, stale...)
+	}
+	for _, keys := range [][]string{diff.addedServices, diff.removedServices, diff.addedVersions, diff.removedVersions, diff.newlyStale} {
+		sort.Strings(keys)
+	}
+	return diff
+}
+
+// diffKeys lists, in order, the keys of newer missing from older and those
+// of older missing from newer
+func diffKeys(older, newer map[string]bool) (added, removed []string) {
+	for key := range newer {
+		if !older[key] {
+			added = append(added, key)
+		}
+	}
+	for key := range older {
+		if !newer[key] {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return
+}
+
+func projectKeys(projects map[string]*projectJSON) map[string]bool {
+	keys := make(map[string]bool)
+	for id := range projects {
+		keys[id] = true
+	}
+	return keys
+}
+
+func serviceKeys(project *projectJSON) map[string]bool {
+	keys := make(map[string]bool)
+	if project.Application != nil {
+		for _, service := range project.Application.Services {
+			keys[project.ProjectID+"/"+service.ID] = true
+		}
+	}
+	return keys
+}
+
+func versionKeys(project *projectJSON) map[string]bool {
+	keys := make(map[string]bool)
+	if project.Application != nil {
+		for _, service := range project.Application.Services {
+			for _, version := range service.Versions {
+				keys[project.ProjectID+"/"+service.ID+"/"+version.ID] = true
+			}
+		}
+	}
+	return keys
+}
+
+// staleKeys are the project's stale SQL instances and Datastore kinds
+func staleKeys(project *projectJSON) map[string]bool {
+	keys := make(map[string]bool)
+	for _, instance := range project.SQLInstances {
+		if instance.Stale {
+			keys[project.ProjectID+"/sql/"+instance.Name] = true
+		}
+	}
+	for _, bucket := range project.BackupBuckets {
+		for _, kind := range bucket.Kinds {
+			if kind.Stale {
+				keys[project.ProjectID+"/kind/"+kind.Kind] = true
+			}
+		}
+	}
+	return keys
+}
+
+// Display shows each change on a line of its own, or that there are none
+func (d *reportDiff) Display(w io.Writer) {
+	changes := 0
+	for _, section := range []struct {
+		marker, resource string
+		keys             []string
+	}{
+		{"+", "project", d.addedProjects},
+		{"-", "project", d.removedProjects},
+		{"+", "service", d.addedServices},
+		{"-", "service", d.removedServices},
+		{"+", "version", d.addedVersions},
+		{"-", "version", d.removedVersions},
+		{alert("NEWLY-STALE"), "backup", d.newlyStale},
+	} {
+		for _, key := range section.keys {
+			fmt.Fprintf(w, "%s %s[%s]\n", section.marker, section.resource, key)
+		}
+		changes += len(section.keys)
+	}
+	if changes == 0 {
+		fmt.Fprintln(w, "no changes")
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(diffCmd)
+}
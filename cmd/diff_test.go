@@ -0,0 +1,97 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const olderReport = `{"schemaVersion":1,"projectId":"test1-project-000","application":{"id":"test1-project-000","servingStatus":"SERVING","services":[{"id":"default","versions":[{"id":"v1","servingStatus":"SERVING","instances":1}]}]},"sqlInstances":[{"name":"db","backupEnabled":true,"pointInTimeRecovery":true,"stale":false}],"summary":{}}
+{"schemaVersion":1,"projectId":"test1-project-001","summary":{}}
+`
+
+const newerReport = `{"schemaVersion":1,"projectId":"test1-project-000","application":{"id":"test1-project-000","servingStatus":"SERVING","services":[{"id":"default","versions":[{"id":"v1","servingStatus":"STOPPED","instances":0},{"id":"v2","servingStatus":"SERVING","instances":1}]}]},"sqlInstances":[{"name":"db","backupEnabled":true,"pointInTimeRecovery":true,"stale":true}],"summary":{}}
+{"schemaVersion":1,"projectId":"test1-project-001","summary":{}}
+`
+
+// writeReports saves the reports in a temporary directory, returning their
+// paths and the directory to remove
+func writeReports(t *testing.T, reports ...string) (string, []string) {
+	dir, err := ioutil.TempDir("", "gcp-reports-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for i, report := range reports {
+		path := filepath.Join(dir, string('a'+rune(i))+".json")
+		if err := ioutil.WriteFile(path, []byte(report), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return dir, paths
+}
+
+func TestDiffReports(t *testing.T) {
+	dir, paths := writeReports(t, olderReport, newerReport)
+	defer os.RemoveAll(dir)
+	older, err := loadReport(paths[0])
+	if err != nil {
+		t.Fatalf("cannot load older report: %v", err)
+	}
+	newer, err := loadReport(paths[1])
+	if err != nil {
+		t.Fatalf("cannot load newer report: %v", err)
+	}
+
+	diff := diffReports(older, newer)
+	if !reflect.DeepEqual(diff.addedVersions, []string{"test1-project-000/default/v2"}) || len(diff.removedVersions) != 0 {
+		t.Errorf("expected version v2 alone added, have +%v -%v", diff.addedVersions, diff.removedVersions)
+	}
+	if !reflect.DeepEqual(diff.newlyStale, []string{"test1-project-000/sql/db"}) {
+		t.Errorf("expected sql instance db newly stale, have %v", diff.newlyStale)
+	}
+	if len(diff.addedProjects)+len(diff.removedProjects)+len(diff.addedServices)+len(diff.removedServices) != 0 {
+		t.Errorf("expected no project or service changes, have %+v", diff)
+	}
+
+	var buf bytes.Buffer
+	diff.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"+ version[test1-project-000/default/v2]", "NEWLY-STALE backup[test1-project-000/sql/db]"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected diff to show %q, have:\n%s", expected, out)
+		}
+	}
+	if strings.Count(out, "\n") != 2 {
+		t.Errorf("expected two changes shown, have:\n%s", out)
+	}
+
+	buf.Reset()
+	diffReports(newer, newer).Display(&buf)
+	if buf.String() != "no changes\n" {
+		t.Errorf("expected a report to have no changes from itself, have:\n%s", buf.String())
+	}
+}
+
+func TestDiffProjectsAndSchema(t *testing.T) {
+	dir, paths := writeReports(t, olderReport, `{"schemaVersion":1,"projectId":"test1-project-002"}`, `{"schemaVersion":99,"projectId":"x"}`)
+	defer os.RemoveAll(dir)
+	older, _ := loadReport(paths[0])
+	newer, _ := loadReport(paths[1])
+	diff := diffReports(older, newer)
+	if !reflect.DeepEqual(diff.addedProjects, []string{"test1-project-002"}) ||
+		!reflect.DeepEqual(diff.removedProjects, []string{"test1-project-000", "test1-project-001"}) {
+		t.Errorf("expected one project added and two removed, have +%v -%v", diff.addedProjects, diff.removedProjects)
+	}
+	if _, err := loadReport(paths[2]); err == nil || !strings.Contains(err.Error(), "schema version 99") {
+		t.Errorf("expected a newer schema refused, have %v", err)
+	}
+}
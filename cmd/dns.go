@@ -0,0 +1,210 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	dns "google.golang.org/api/dns/v1"
+)
+
+// dnsCmd represents the dns command
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Audit the Cloud DNS zones available from given credentials",
+	Long: `Show the managed Cloud DNS zones of each project visible from the account
+used, with their DNS name and DNSSEC state. Zones without DNSSEC turned on are
+flagged as NO-DNSSEC. With --records, the record sets of each zone are listed
+too, narrowed with --record-type to the types given. For instance:
+    gcp-reports dns --records --record-type A,CNAME our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		recordTypes := getStringSlice("dnsRecordType")
+		withRecords := viper.GetBool("dnsRecords") || len(recordTypes) > 0
+		return runReport(args, dns.NdevClouddnsReadonlyScope, func(clients *clients) (projectIngester, error) {
+			dnsService, err := dns.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish cloud dns service: %v", err)
+			}
+			taker := &TakerDNSGCP{dnsService: dnsService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestDNSZones(ctx, taker, withRecords, recordTypes)
+			}, nil
+		})
+	},
+}
+
+type TakerDNS interface {
+	ListManagedZones(context.Context, *reportProject) ([]*dns.ManagedZone, error)
+	ListResourceRecordSets(context.Context, *reportDNSZone) ([]*dns.ResourceRecordSet, error)
+}
+
+type TakerDNSGCP struct {
+	dnsService *dns.Service
+}
+
+type reportDNSZone struct {
+	gcpZone    *dns.ManagedZone
+	recordSets []*reportRecordSet
+	// noDNSSEC is set when DNSSEC is not turned on for the zone
+	noDNSSEC bool
+
+	project *reportProject // parent
+}
+
+func (rz *reportDNSZone) Parent() reportNode {
+	return rz.project
+}
+
+type reportRecordSet struct {
+	gcpRecordSet *dns.ResourceRecordSet
+
+	zone *reportDNSZone // parent
+}
+
+// ListManagedZones gathers the managed zones of the project
+func (taker *TakerDNSGCP) ListManagedZones(ctx context.Context, project *reportProject) (zones []*dns.ManagedZone, err error) {
+	err = doWithRetry(ctx, func() error {
+		zones = nil
+		return taker.dnsService.ManagedZones.List(project.gcpProject.ProjectId).Pages(ctx, func(page *dns.ManagedZonesListResponse) error {
+			zones = append(zones, page.ManagedZones...)
+			return nil
+		})
+	})
+	return
+}
+
+// ListResourceRecordSets gathers the record sets of the zone
+func (taker *TakerDNSGCP) ListResourceRecordSets(ctx context.Context, zone *reportDNSZone) (recordSets []*dns.ResourceRecordSet, err error) {
+	err = doWithRetry(ctx, func() error {
+		recordSets = nil
+		call := taker.dnsService.ResourceRecordSets.List(zone.project.gcpProject.ProjectId, zone.gcpZone.Name)
+		return call.Pages(ctx, func(page *dns.ResourceRecordSetsListResponse) error {
+			recordSets = append(recordSets, page.Rrsets...)
+			return nil
+		})
+	})
+	return
+}
+
+// dnssecState is the zone's DNSSEC state: on, off or transfer
+func (rz *reportDNSZone) dnssecState() string {
+	if rz.gcpZone.DnssecConfig == nil {
+		return "off"
+	}
+	return supplyDefault(rz.gcpZone.DnssecConfig.State, "off")
+}
+
+// IngestDNSZones ingests the project's managed zones ordered by name, marking
+// those without DNSSEC turned on. With withRecords, each zone's record sets are
+// ingested too, ordered by name and type and narrowed to recordTypes when any
+// are given.
+func (p *reportProject) IngestDNSZones(ctx context.Context, taker TakerDNS, withRecords bool, recordTypes []string) error {
+	var gcpZones []*dns.ManagedZone
+	listErr := limited(func() (err error) {
+		gcpZones, err = taker.ListManagedZones(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+
+	for _, gcpZone := range gcpZones {
+		zone := &reportDNSZone{gcpZone: gcpZone, project: p}
+		if zone.dnssecState() != "on" {
+			zone.noDNSSEC = true
+			p.addFinding(severityWarn, "dns/"+gcpZone.Name, fmt.Sprintf("DNSSEC is %s for %s", zone.dnssecState(), gcpZone.DnsName))
+		}
+		p.dnsZones = append(p.dnsZones, zone)
+	}
+	sort.Slice(p.dnsZones, func(i, j int) bool { return p.dnsZones[i].gcpZone.Name < p.dnsZones[j].gcpZone.Name })
+	if !withRecords {
+		return nil
+	}
+
+	for _, zone := range p.dnsZones {
+		var gcpRecordSets []*dns.ResourceRecordSet
+		recordErr := limited(func() (err error) {
+			gcpRecordSets, err = taker.ListResourceRecordSets(ctx, zone)
+			return
+		})
+		if recordErr != nil {
+			return recordErr
+		}
+		for _, gcpRecordSet := range gcpRecordSets {
+			if len(recordTypes) > 0 && !containsFold(recordTypes, gcpRecordSet.Type) {
+				continue
+			}
+			zone.recordSets = append(zone.recordSets, &reportRecordSet{gcpRecordSet: gcpRecordSet, zone: zone})
+		}
+		sort.Slice(zone.recordSets, func(i, j int) bool {
+			ri, rj := zone.recordSets[i].gcpRecordSet, zone.recordSets[j].gcpRecordSet
+			if ri.Name != rj.Name {
+				return ri.Name < rj.Name
+			}
+			return ri.Type < rj.Type
+		})
+	}
+	return nil
+}
+
+// containsFold reports whether list holds s regardless of case
+func containsFold(list []string, s string) bool {
+	for _, candidate := range list {
+		if strings.EqualFold(strings.TrimSpace(candidate), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// displayDNSZones shows the zones as a table, followed by a table of the
+// record sets ingested
+func displayDNSZones(w io.Writer, zones []*reportDNSZone) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  DNS ZONE\tDNS NAME\tDNSSEC\tRECORD SETS\tSTATUS")
+	recordSets := 0
+	for _, zone := range zones {
+		status := healthy("OK")
+		if zone.noDNSSEC {
+			status = alert("NO-DNSSEC")
+		}
+		records := "-"
+		if len(zone.recordSets) > 0 {
+			records = fmt.Sprint(len(zone.recordSets))
+		}
+		recordSets += len(zone.recordSets)
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%s\t%s\n", zone.gcpZone.Name, zone.gcpZone.DnsName, zone.dnssecState(), records, status)
+	}
+	table.Flush()
+
+	if recordSets == 0 {
+		return
+	}
+	table = newTable(w)
+	fmt.Fprintln(table, "  DNS ZONE\tNAME\tTYPE\tTTL\tDATA")
+	for _, zone := range zones {
+		for _, recordSet := range zone.recordSets {
+			gcpRecordSet := recordSet.gcpRecordSet
+			fmt.Fprintf(table, "  %s\t%s\t%s\t%d\t%s\n", zone.gcpZone.Name, gcpRecordSet.Name, gcpRecordSet.Type,
+				gcpRecordSet.Ttl, ellipsize(strings.Join(gcpRecordSet.Rrdatas, " "), 30, 12))
+		}
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(dnsCmd)
+
+	dnsCmd.Flags().Bool("records", false, "list the record sets of each zone too")
+	viper.BindPFlag("dnsRecords", dnsCmd.Flags().Lookup("records"))
+	dnsCmd.Flags().StringSlice("record-type", []string{}, "comma-separated record types to list, eg A,CNAME; implies --records")
+	viper.BindPFlag("dnsRecordType", dnsCmd.Flags().Lookup("record-type"))
+}
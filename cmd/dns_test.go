@@ -0,0 +1,74 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	dns "google.golang.org/api/dns/v1"
+)
+
+var p2zones = map[string][]*dns.ManagedZone{
+	"test1-project-000": []*dns.ManagedZone{
+		&dns.ManagedZone{Name: "public", DnsName: "example.com.", DnssecConfig: &dns.ManagedZoneDnsSecConfig{State: "on"}},
+		&dns.ManagedZone{Name: "legacy", DnsName: "example.org."},
+	},
+}
+
+var z2records = map[string][]*dns.ResourceRecordSet{
+	"public": []*dns.ResourceRecordSet{
+		&dns.ResourceRecordSet{Name: "www.example.com.", Type: "CNAME", Ttl: 300, Rrdatas: []string{"example.com."}},
+		&dns.ResourceRecordSet{Name: "example.com.", Type: "NS", Ttl: 21600, Rrdatas: []string{"ns-cloud-a1.googledomains.com."}},
+		&dns.ResourceRecordSet{Name: "example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"192.0.2.10"}},
+	},
+}
+
+type TestDNSTaker struct{}
+
+func (tt *TestDNSTaker) ListManagedZones(ctx context.Context, rp *reportProject) ([]*dns.ManagedZone, error) {
+	return p2zones[rp.gcpProject.ProjectId], nil
+}
+
+func (tt *TestDNSTaker) ListResourceRecordSets(ctx context.Context, rz *reportDNSZone) ([]*dns.ResourceRecordSet, error) {
+	return z2records[rz.gcpZone.Name], nil
+}
+
+func TestIngestDNSZones(t *testing.T) {
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestDNSZones(context.Background(), &TestDNSTaker{}, true, []string{"a", "CNAME"}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.dnsZones) != 2 {
+		t.Fatalf("expected 2 zones, have %d", len(project.dnsZones))
+	}
+	legacy, public := project.dnsZones[0], project.dnsZones[1]
+	if !legacy.noDNSSEC || public.noDNSSEC {
+		t.Errorf("expected only the legacy zone flagged, have %t %t", legacy.noDNSSEC, public.noDNSSEC)
+	}
+	if len(project.findings) != 1 || project.findings[0].resource != "dns/legacy" {
+		t.Errorf("unexpected findings %v", project.findings)
+	}
+	var types []string
+	for _, recordSet := range public.recordSets {
+		types = append(types, recordSet.gcpRecordSet.Type)
+	}
+	if strings.Join(types, ",") != "A,CNAME" {
+		t.Errorf("expected the A and CNAME records alone, in name order, have %v", types)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"project[test1-project-000]: 2 DNS zones", "NO-DNSSEC", "www.example.com."} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected display to contain %q, have:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "googledomains") {
+		t.Errorf("expected the NS record filtered out:\n%s", out)
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/appengine/v1"
+	bigquery "google.golang.org/api/bigquery/v2"
+	cloudfunctions "google.golang.org/api/cloudfunctions/v1"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	cloudscheduler "google.golang.org/api/cloudscheduler/v1beta1"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+	dns "google.golang.org/api/dns/v1"
+	iam "google.golang.org/api/iam/v1"
+	logging "google.golang.org/api/logging/v2"
+	monitoring "google.golang.org/api/monitoring/v3"
+	pubsub "google.golang.org/api/pubsub/v1"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// tokenInfoEndpoint describes an access token, the scopes granted included
+const tokenInfoEndpoint = "https://oauth2.googleapis.com/tokeninfo"
+
+// cloudPlatformScope grants every GCP API, so covers any scope asked for
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor <project>",
+	Short: "Check that credentials and the GCP APIs used work for a project",
+	Long: `Check, before a scheduled run, that gcp-reports can do its job: that the
+--credentials key file or Application Default Credentials give an access
+token, that the token is granted the scopes asked for with --scopes (by
+default, read-only access to the whole of Google Cloud), and that a sample
+call to each GCP API the commands use succeeds for the project given,
+failing when the API is disabled or not permitted. Each check is reported as
+OK or FAIL, and any failure makes the command exit with an error. For
+instance:
+    gcp-reports doctor our-foo-prod
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("doctor needs the ID of a project to try the GCP APIs on")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+		defer cancel()
+		scopes, err := effectiveScopes(cloudresourcemanager.CloudPlatformReadOnlyScope)
+		if err != nil {
+			return err
+		}
+
+		var token *oauth2.Token
+		checks := []doctorCheck{
+			{"credentials", func(ctx context.Context) (string, error) {
+				tokenSource, err := newTokenSource(ctx, scopes...)
+				if err != nil {
+					return "", err
+				}
+				token, err = tokenSource.Token()
+				if keyFile := viper.GetString("credentials"); keyFile != "" {
+					return "credentials file " + keyFile, err
+				}
+				return "application default credentials", err
+			}},
+			{"scopes", func(ctx context.Context) (string, error) {
+				if token == nil {
+					return "", errors.New("no access token to check")
+				}
+				granted, err := grantedScopes(ctx, http.DefaultClient, tokenInfoEndpoint, token.AccessToken)
+				if err != nil {
+					return "", err
+				}
+				return checkScopes(scopes, granted)
+			}},
+		}
+		if client, err := newClient(ctx, cloudresourcemanager.CloudPlatformReadOnlyScope); err == nil {
+			checks = append(checks, apiChecks(client, args[0])...)
+		} else {
+			checks = append(checks, doctorCheck{"apis", func(ctx context.Context) (string, error) {
+				return "", fmt.Errorf("cannot create a gcloud client: %v", err)
+			}})
+		}
+		if failed := runDoctorChecks(ctx, textOutput(), checks); failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+		}
+		return nil
+	},
+}
+
+// doctorCheck is one check of the doctor command; run gives a detail to show
+// beside OK, or the error making it FAIL
+type doctorCheck struct {
+	name string
+	run  func(context.Context) (string, error)
+}
+
+// runDoctorChecks runs the checks in order, showing each as OK or FAIL in a
+// table, and counts those failing
+func runDoctorChecks(ctx context.Context, w io.Writer, checks []doctorCheck) int {
+	failed := 0
+	table := newTable(w)
+	fmt.Fprintln(table, "CHECK\tSTATUS\tDETAIL")
+	for _, check := range checks {
+		detail, err := check.run(ctx)
+		status := healthy("OK")
+		if err != nil {
+			failed++
+			status, detail = alert("FAIL"), err.Error()
+		}
+		// API errors may run over several lines
+		fmt.Fprintf(table, "%s\t%s\t%s\n", check.name, status, supplyDefault(strings.Join(strings.Fields(detail), " "), "-"))
+	}
+	table.Flush()
+	return failed
+}
+
+// grantedScopes asks the token info endpoint which scopes the access token
+// is granted
+func grantedScopes(ctx context.Context, client *http.Client, endpoint, accessToken string) ([]string, error) {
+	var info struct {
+		Scope string `json:"scope"`
+	}
+	if err := getJSON(ctx, client, endpoint+"?access_token="+url.QueryEscape(accessToken), &info); err != nil {
+		return nil, fmt.Errorf("cannot get token info: %v", err)
+	}
+	return strings.Fields(info.Scope), nil
+}
+
+// checkScopes fails when a scope asked for is not among those granted,
+// unless the cloud-platform scope covering them all is
+func checkScopes(requested, granted []string) (string, error) {
+	var missing []string
+	for _, scope := range requested {
+		if !containsString(granted, scope) && !containsString(granted, cloudPlatformScope) {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("not granted %s", strings.Join(missing, " "))
+	}
+	return fmt.Sprintf("%d granted", len(granted)), nil
+}
+
+// apiCheck makes a check of the named API from a sample call; a call finding
+// nothing still shows the API to work
+func apiCheck(name string, call func(context.Context) error) doctorCheck {
+	return doctorCheck{name: name, run: func(ctx context.Context) (string, error) {
+		err := call(ctx)
+		if isNotFound(err) {
+			return "reachable, nothing found", nil
+		}
+		return "", err
+	}}
+}
+
+// apiChecks makes a sample call to each GCP API the commands use, for the
+// project through client
+func apiChecks(client *http.Client, project string) []doctorCheck {
+	parent := "projects/" + project
+	// rest checks the APIs called through getJSON
+	rest := func(address string) func(context.Context) error {
+		return func(ctx context.Context) error {
+			var v map[string]interface{}
+			return getJSON(ctx, client, address, &v)
+		}
+	}
+	return []doctorCheck{
+		apiCheck("cloudresourcemanager", func(ctx context.Context) error {
+			service, err := cloudresourcemanager.New(client)
+			if err == nil {
+				_, err = service.Projects.Get(project).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("appengine", func(ctx context.Context) error {
+			service, err := appengine.New(client)
+			if err == nil {
+				_, err = service.Apps.Get(project).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("storage", func(ctx context.Context) error {
+			service, err := storage.New(client)
+			if err == nil {
+				_, err = service.Buckets.List(project).MaxResults(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("sqladmin", func(ctx context.Context) error {
+			service, err := sqladmin.New(client)
+			if err == nil {
+				_, err = service.Instances.List(project).MaxResults(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("monitoring", func(ctx context.Context) error {
+			service, err := monitoring.New(client)
+			if err == nil {
+				_, err = service.Projects.AlertPolicies.List(parent).PageSize(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("logging", func(ctx context.Context) error {
+			service, err := logging.New(client)
+			if err == nil {
+				_, err = service.Projects.Sinks.List(parent).PageSize(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("compute", func(ctx context.Context) error {
+			service, err := compute.New(client)
+			if err == nil {
+				_, err = service.Firewalls.List(project).MaxResults(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("container", func(ctx context.Context) error {
+			service, err := container.New(client)
+			if err == nil {
+				_, err = service.Projects.Locations.Clusters.List(parent + "/locations/-").Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("dns", func(ctx context.Context) error {
+			service, err := dns.New(client)
+			if err == nil {
+				_, err = service.ManagedZones.List(project).MaxResults(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("cloudkms", func(ctx context.Context) error {
+			service, err := cloudkms.New(client)
+			if err == nil {
+				_, err = service.Projects.Locations.List(parent).PageSize(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("cloudfunctions", func(ctx context.Context) error {
+			service, err := cloudfunctions.New(client)
+			if err == nil {
+				_, err = service.Projects.Locations.Functions.List(parent + "/locations/-").PageSize(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("cloudscheduler", func(ctx context.Context) error {
+			service, err := cloudscheduler.New(client)
+			if err == nil {
+				_, err = service.Projects.Locations.List(parent).PageSize(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("bigquery", func(ctx context.Context) error {
+			service, err := bigquery.New(client)
+			if err == nil {
+				_, err = service.Datasets.List(project).MaxResults(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("iam", func(ctx context.Context) error {
+			service, err := iam.New(client)
+			if err == nil {
+				_, err = service.Projects.ServiceAccounts.List(parent).PageSize(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("pubsub", func(ctx context.Context) error {
+			service, err := pubsub.New(client)
+			if err == nil {
+				_, err = service.Projects.Topics.List(parent).PageSize(1).Context(ctx).Do()
+			}
+			return err
+		}),
+		apiCheck("run", rest(cloudRunEndpoint+parent+"/locations/-/services?pageSize=1")),
+		apiCheck("secretmanager", rest(secretManagerEndpoint+parent+"/secrets?pageSize=1")),
+		apiCheck("artifactregistry", rest(artifactRegistryEndpoint+parent+"/locations?pageSize=1")),
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(doctorCmd)
+}
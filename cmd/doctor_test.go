@@ -0,0 +1,73 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestDoctorChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != "tok" {
+			http.Error(w, `{"error": "invalid_token"}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"scope": "https://www.googleapis.com/auth/cloud-platform.read-only https://www.googleapis.com/auth/userinfo.email"}`)
+	}))
+	defer server.Close()
+
+	readOnly := "https://www.googleapis.com/auth/cloud-platform.read-only"
+	granted, err := grantedScopes(context.Background(), server.Client(), server.URL, "tok")
+	if err != nil || !reflect.DeepEqual(granted, []string{readOnly, "https://www.googleapis.com/auth/userinfo.email"}) {
+		t.Errorf("unexpected granted scopes %v, %v", granted, err)
+	}
+	if _, err := grantedScopes(context.Background(), server.Client(), server.URL, "expired"); err == nil {
+		t.Errorf("expected a rejected token to be an error")
+	}
+	if _, err := checkScopes([]string{readOnly}, granted); err != nil {
+		t.Errorf("expected the read-only scope granted, have %v", err)
+	}
+	if _, err := checkScopes([]string{readOnly, cloudPlatformScope}, granted); err == nil || !strings.Contains(err.Error(), cloudPlatformScope) {
+		t.Errorf("expected the cloud-platform scope reported missing, have %v", err)
+	}
+	if _, err := checkScopes([]string{readOnly, "https://www.googleapis.com/auth/monitoring"}, []string{cloudPlatformScope}); err != nil {
+		t.Errorf("expected cloud-platform to cover every scope, have %v", err)
+	}
+
+	checks := []doctorCheck{
+		{"credentials", func(ctx context.Context) (string, error) { return "application default credentials", nil }},
+		apiCheck("appengine", func(ctx context.Context) error { return &googleapi.Error{Code: http.StatusNotFound} }),
+		apiCheck("storage", func(ctx context.Context) error { return nil }),
+		apiCheck("sqladmin", func(ctx context.Context) error {
+			return &googleapi.Error{Code: http.StatusForbidden, Message: "Cloud SQL Admin API has not been used\nin project 1"}
+		}),
+		{"scopes", func(ctx context.Context) (string, error) { return "", errors.New("not granted monitoring") }},
+	}
+	var out bytes.Buffer
+	if failed := runDoctorChecks(context.Background(), &out, checks); failed != 2 {
+		t.Errorf("expected 2 checks to fail, have %d", failed)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(checks)+1 {
+		t.Fatalf("expected a line for each check:\n%s", out.String())
+	}
+	for i, expected := range []string{"OK", "OK", "OK", "FAIL", "FAIL"} {
+		if fields := strings.Fields(lines[i+1]); fields[0] != checks[i].name || fields[1] != expected {
+			t.Errorf("expected %s to be %s, have %q", checks[i].name, expected, lines[i+1])
+		}
+	}
+	if !strings.Contains(lines[2], "reachable, nothing found") || !strings.Contains(lines[4], "has not been used in project 1") {
+		t.Errorf("expected the details of each check on its line:\n%s", out.String())
+	}
+}
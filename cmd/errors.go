@@ -0,0 +1,78 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+)
+
+// apiStatus is the HTTP status code of the GCP API error err is, seeing
+// through the permissionDeniedError doWithRetry wraps a 403 in
+func apiStatus(err error) (int, bool) {
+	switch e := err.(type) {
+	case *permissionDeniedError:
+		return e.cause.Code, true
+	case *googleapi.Error:
+		return e.Code, true
+	}
+	return 0, false
+}
+
+// isRetryable reports whether err is a GCP API error worth trying again: the
+// API is throttling us or failed on its side
+func isRetryable(err error) bool {
+	code, ok := apiStatus(err)
+	if !ok {
+		return false
+	}
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isNotFound reports whether err is a GCP API error saying the resource asked
+// for does not exist
+func isNotFound(err error) bool {
+	code, ok := apiStatus(err)
+	return ok && code == http.StatusNotFound
+}
+
+// isPermissionDenied reports whether err is a GCP API error saying the
+// credentials lack a permission the call needs
+func isPermissionDenied(err error) bool {
+	code, ok := apiStatus(err)
+	return ok && code == http.StatusForbidden
+}
+
+// permissionDeniedError is a 403 answered to the taker method named by call:
+// the credentials lack a permission it needs
+type permissionDeniedError struct {
+	call  string
+	cause *googleapi.Error
+}
+
+func (e *permissionDeniedError) Error() string {
+	return fmt.Sprintf("permission denied on %s: %v", e.call, e.cause)
+}
+
+// permissionDenied finds the 403 err is, along with the taker method it was
+// answered to when doWithRetry knows it
+func permissionDenied(err error) (call string, apiErr *googleapi.Error, ok bool) {
+	if !isPermissionDenied(err) {
+		return "", nil, false
+	}
+	switch e := err.(type) {
+	case *permissionDeniedError:
+		return e.call, e.cause, true
+	case *googleapi.Error:
+		return "", e, true
+	}
+	return "", nil, false
+}
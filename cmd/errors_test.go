@@ -0,0 +1,54 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestErrorClassification(t *testing.T) {
+	for _, test := range []struct {
+		err                       error
+		retryable, notFound, deny bool
+	}{
+		{&googleapi.Error{Code: http.StatusBadRequest}, false, false, false},
+		{&googleapi.Error{Code: http.StatusForbidden}, false, false, true},
+		{&googleapi.Error{Code: http.StatusNotFound}, false, true, false},
+		{&googleapi.Error{Code: http.StatusTooManyRequests}, true, false, false},
+		{&googleapi.Error{Code: http.StatusInternalServerError}, true, false, false},
+		{&googleapi.Error{Code: http.StatusNotImplemented}, false, false, false},
+		{&googleapi.Error{Code: http.StatusServiceUnavailable}, true, false, false},
+		{&googleapi.Error{Code: http.StatusGatewayTimeout}, true, false, false},
+		{&permissionDeniedError{call: "TakerGCP.ListThings", cause: &googleapi.Error{Code: http.StatusForbidden}}, false, false, true},
+		{errors.New("connection reset"), false, false, false},
+		{nil, false, false, false},
+	} {
+		if retryable := isRetryable(test.err); retryable != test.retryable {
+			t.Errorf("expected isRetryable(%v) %v, have %v", test.err, test.retryable, retryable)
+		}
+		if notFound := isNotFound(test.err); notFound != test.notFound {
+			t.Errorf("expected isNotFound(%v) %v, have %v", test.err, test.notFound, notFound)
+		}
+		if deny := isPermissionDenied(test.err); deny != test.deny {
+			t.Errorf("expected isPermissionDenied(%v) %v, have %v", test.err, test.deny, deny)
+		}
+	}
+}
+
+func TestPermissionDenied(t *testing.T) {
+	cause := &googleapi.Error{Code: http.StatusForbidden, Message: "no"}
+	if call, apiErr, ok := permissionDenied(&permissionDeniedError{call: "TakerGCP.ListThings", cause: cause}); !ok || call != "TakerGCP.ListThings" || apiErr != cause {
+		t.Errorf("expected the wrapped 403 and its call, have call[%s] err[%v] ok[%v]", call, apiErr, ok)
+	}
+	if call, apiErr, ok := permissionDenied(cause); !ok || call != "" || apiErr != cause {
+		t.Errorf("expected a raw 403 without a call, have call[%s] err[%v] ok[%v]", call, apiErr, ok)
+	}
+	if _, _, ok := permissionDenied(&googleapi.Error{Code: http.StatusNotFound}); ok {
+		t.Error("expected a 404 not to be a permission denied")
+	}
+}
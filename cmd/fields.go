@@ -0,0 +1,151 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// displayFields are the table columns --fields keeps in the text report, by
+// field name; nil keeps every column
+var displayFields []string
+
+// sharedFields are the columns of the tables any command may display: the
+// --dry-run project list and the --timings table
+var sharedFields = []string{"project", "env", "component", "api-call", "calls", "total", "mean"}
+
+// commandFields are the columns of the tables each command displays, besides
+// the shared ones
+var commandFields = map[string][]string{
+	"addresses": {"address", "ip", "region", "type", "used-by", "status"},
+	"alerts":    {"policy", "conditions", "resource-types", "channels", "status"},
+	"apps": {"route-domain", "dispatch", "service", "version", "runtime", "env", "instances", "split", "network", "serving",
+		"instance", "vm", "vm-status", "availability", "requests", "started", "class", "est-monthly-cost"},
+	"backups": {"sql-instance", "version", "tier", "region", "availability", "backup-enabled", "pitr", "status",
+		"backup", "enqueued", "start", "end", "kind", "newest-object", "updated", "size", "objects", "total-size", "object",
+		"scheduler-job", "location", "schedule", "state", "last-attempt", "kinds"},
+	"doctor":    {"check", "status", "detail"},
+	"dns":       {"dns-zone", "dns-name", "dnssec", "record-sets", "status", "name", "type", "ttl", "data"},
+	"firewall":  {"firewall-rule", "network", "direction", "priority", "sources", "allowed", "status"},
+	"functions": {"function", "runtime", "trigger", "memory", "deployed", "status"},
+	"images":    {"repository", "format", "location", "images", "last-push", "status"},
+	"kms":       {"key-ring", "location", "crypto-key", "purpose", "rotation-period", "next-rotation", "status"},
+	"network": {"network", "mode", "routing", "subnets", "subnet", "region", "range", "secondary", "private-google-access",
+		"status"},
+	"run":       {"run-service", "region", "latest-revision", "min", "max", "unauthenticated", "status"},
+	"secrets":   {"secret", "replication", "versions", "enabled", "created", "last-access", "status"},
+	"sinks":     {"sink", "destination", "destination-project", "filter", "status"},
+	"snapshots": {"disk", "location", "size", "snapshots", "newest-snapshot", "status", "snapshot", "created", "stored"},
+}
+
+// validFields lists, in order, the field names --fields takes for the command
+func validFields(command string) []string {
+	var fields []string
+	for _, field := range append(append([]string{}, commandFields[command]...), sharedFields...) {
+		if !containsString(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// parseFields takes the --fields names regardless of case, rejecting any
+// that is not a column of the command's tables; none gives nil
+func parseFields(command string, entries []string) ([]string, error) {
+	valid := validFields(command)
+	var fields []string
+	for _, field := range entries {
+		if field = strings.ToLower(strings.TrimSpace(field)); field == "" {
+			continue
+		}
+		if !containsString(valid, field) {
+			return nil, fmt.Errorf("unknown field %q for %s: expecting some of %s", field, command, strings.Join(valid, ","))
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// fieldName is the --fields name of a table header cell, eg
+// "  SQL INSTANCE" is sql-instance
+func fieldName(header string) string {
+	words := strings.FieldsFunc(strings.ToLower(header), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
+// columnTable aligns the tab-separated cells written to it into columns, as
+// a tabwriter does, leaving out the columns whose header is not one of
+// fields. A table keeping none of its columns is left out altogether.
+type columnTable struct {
+	out    *tabwriter.Writer
+	fields []string
+	// keep is set from the header, the first row written
+	keep    []bool
+	header  bool
+	pending bytes.Buffer
+}
+
+func (t *columnTable) Write(p []byte) (int, error) {
+	if t.fields == nil {
+		return t.out.Write(p)
+	}
+	t.pending.Write(p)
+	for {
+		line, err := t.pending.ReadString('\n')
+		if err != nil {
+			// keep the incomplete row for the next write
+			t.pending.Reset()
+			t.pending.WriteString(line)
+			return len(p), nil
+		}
+		if err := t.writeRow(strings.TrimSuffix(line, "\n")); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// writeRow writes the kept cells of a row, indented as its first cell is
+func (t *columnTable) writeRow(row string) error {
+	cells := strings.Split(row, "\t")
+	indent := cells[0][:len(cells[0])-len(strings.TrimLeft(cells[0], " "))]
+	cells[0] = cells[0][len(indent):]
+	if !t.header {
+		t.header = true
+		for _, cell := range cells {
+			t.keep = append(t.keep, containsString(t.fields, fieldName(cell)))
+		}
+	}
+	var kept []string
+	for i, cell := range cells {
+		if i < len(t.keep) && t.keep[i] {
+			kept = append(kept, cell)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(t.out, indent+strings.Join(kept, "\t")+"\n")
+	return err
+}
+
+// Flush writes any row left without a line end, then aligns the rows
+func (t *columnTable) Flush() error {
+	if t.pending.Len() > 0 {
+		row := t.pending.String()
+		t.pending.Reset()
+		if err := t.writeRow(row); err != nil {
+			return err
+		}
+	}
+	return t.out.Flush()
+}
@@ -0,0 +1,60 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const goldenFieldsDisplay = `application[golden-app]: status[SERVING]
+  service[default] shard strat[IP] traffic[v2=100%]
+    VERSION  INSTANCES  SERVING
+    v2       1          SERVING
+`
+
+func TestFields(t *testing.T) {
+	verbose = false
+	defer viper.Set("displayVersions", viper.GetInt("displayVersions"))
+	defer viper.Set("showInstances", viper.GetBool("showInstances"))
+	viper.Set("displayVersions", 3)
+	viper.Set("showInstances", true)
+	defer func() { displayFields = nil }()
+
+	var err error
+	if displayFields, err = parseFields("apps", []string{"Version", " serving", "instances"}); err != nil {
+		t.Fatalf("unexpected fields error: %v", err)
+	}
+	if !reflect.DeepEqual(displayFields, []string{"version", "serving", "instances"}) {
+		t.Errorf("expected the fields in lower case, have %v", displayFields)
+	}
+	var buf bytes.Buffer
+	goldenProject().application.Display(&buf)
+	// the instances table has a version column too
+	if have := buf.String(); !strings.HasPrefix(have, goldenFieldsDisplay) || !strings.HasSuffix(have, "    VERSION\n    v2\n") {
+		t.Errorf("unexpected display with fields:\nhave:\n%s\nwant:\n%s", have, goldenFieldsDisplay)
+	}
+
+	displayFields = []string{"project"}
+	buf.Reset()
+	goldenProject().application.Display(&buf)
+	if have := buf.String(); have != "application[golden-app]: status[SERVING]\n  service[default] shard strat[IP] traffic[v2=100%]\n" {
+		t.Errorf("expected tables without a field selected left out, have:\n%s", have)
+	}
+
+	_, err = parseFields("apps", []string{"version", "owner"})
+	if err == nil || !strings.Contains(err.Error(), `"owner"`) || !strings.Contains(err.Error(), "est-monthly-cost,instance,instances") {
+		t.Errorf("expected an unknown field refused with the valid ones, have %v", err)
+	}
+	if _, err := parseFields("sinks", []string{"runtime"}); err == nil {
+		t.Errorf("expected a column of another command refused")
+	}
+	if fields, err := parseFields("apps", nil); err != nil || fields != nil {
+		t.Errorf("expected no fields to keep every column, have %v, %v", fields, err)
+	}
+}
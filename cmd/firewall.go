@@ -0,0 +1,208 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// firewallCmd represents the firewall command
+var firewallCmd = &cobra.Command{
+	Use:   "firewall",
+	Short: "Audit the VPC firewall rules available from given credentials",
+	Long: `Show the VPC firewall rules of each project visible from the account used,
+with their network, direction, source ranges and what they allow. Enabled
+ingress rules letting any address (0.0.0.0/0 or ::/0) reach one of the
+--sensitive-ports (default 22 and 3389) are flagged as OPEN. For instance:
+    gcp-reports firewall --sensitive-ports 22,3389,5432 our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ports, err := sensitivePorts()
+		if err != nil {
+			return err
+		}
+		return runReport(args, compute.ComputeReadonlyScope, func(clients *clients) (projectIngester, error) {
+			computeService, err := compute.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish compute engine service: %v", err)
+			}
+			taker := &TakerFirewallGCP{computeService: computeService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestFirewallRules(ctx, taker, ports)
+			}, nil
+		})
+	},
+}
+
+type TakerFirewall interface {
+	ListFirewalls(context.Context, *reportProject) ([]*compute.Firewall, error)
+}
+
+type TakerFirewallGCP struct {
+	computeService *compute.Service
+}
+
+type reportFirewallRule struct {
+	gcpFirewall *compute.Firewall
+	// openPorts are the sensitive ports the rule lets any address reach
+	openPorts []int
+
+	project *reportProject // parent
+}
+
+func (rf *reportFirewallRule) Parent() reportNode {
+	return rf.project
+}
+
+// sensitivePorts parses the configured --sensitive-ports
+func sensitivePorts() ([]int, error) {
+	var ports []int
+	for _, value := range getStringSlice("sensitivePorts") {
+		port, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid sensitive port %q: expecting a number from 1 to 65535", value)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// ListFirewalls gathers the firewall rules of all the project's networks
+func (taker *TakerFirewallGCP) ListFirewalls(ctx context.Context, project *reportProject) (firewalls []*compute.Firewall, err error) {
+	err = doWithRetry(ctx, func() error {
+		firewalls = nil
+		return taker.computeService.Firewalls.List(project.gcpProject.ProjectId).Pages(ctx, func(page *compute.FirewallList) error {
+			firewalls = append(firewalls, page.Items...)
+			return nil
+		})
+	})
+	return
+}
+
+// IngestFirewallRules ingests the project's firewall rules ordered by name,
+// marking those which open any of ports to the whole internet.
+func (p *reportProject) IngestFirewallRules(ctx context.Context, taker TakerFirewall, ports []int) error {
+	var gcpFirewalls []*compute.Firewall
+	listErr := limited(func() (err error) {
+		gcpFirewalls, err = taker.ListFirewalls(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+
+	for _, gcpFirewall := range gcpFirewalls {
+		rule := &reportFirewallRule{gcpFirewall: gcpFirewall, project: p}
+		if gcpFirewall.Direction != "EGRESS" && !gcpFirewall.Disabled &&
+			(containsString(gcpFirewall.SourceRanges, "0.0.0.0/0") || containsString(gcpFirewall.SourceRanges, "::/0")) {
+			for _, port := range ports {
+				if firewallAllows(gcpFirewall, port) {
+					rule.openPorts = append(rule.openPorts, port)
+				}
+			}
+		}
+		if len(rule.openPorts) > 0 {
+			p.addFinding(severityCritical, "firewall/"+gcpFirewall.Name,
+				fmt.Sprintf("lets any address reach port %s", joinPorts(rule.openPorts)))
+		}
+		p.firewallRules = append(p.firewallRules, rule)
+	}
+	sort.Slice(p.firewallRules, func(i, j int) bool {
+		return p.firewallRules[i].gcpFirewall.Name < p.firewallRules[j].gcpFirewall.Name
+	})
+	return nil
+}
+
+// firewallAllows reports whether one of the rule's allowed entries covers
+// port, for a protocol which has ports
+func firewallAllows(firewall *compute.Firewall, port int) bool {
+	for _, allowed := range firewall.Allowed {
+		switch allowed.IPProtocol {
+		case "all":
+			return true
+		case "tcp", "udp", "sctp", "6", "17", "132":
+		default:
+			continue
+		}
+		if len(allowed.Ports) == 0 {
+			return true
+		}
+		for _, portRange := range allowed.Ports {
+			low, high := portRange, portRange
+			if dash := strings.Index(portRange, "-"); dash >= 0 {
+				low, high = portRange[:dash], portRange[dash+1:]
+			}
+			lowPort, lowErr := strconv.Atoi(low)
+			highPort, highErr := strconv.Atoi(high)
+			if lowErr == nil && highErr == nil && lowPort <= port && port <= highPort {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func joinPorts(ports []int) string {
+	values := make([]string, len(ports))
+	for i, port := range ports {
+		values[i] = strconv.Itoa(port)
+	}
+	return strings.Join(values, ",")
+}
+
+// allowedSummary lists what the rule allows, eg tcp:22,80 icmp
+func (rf *reportFirewallRule) allowedSummary() string {
+	var entries []string
+	for _, allowed := range rf.gcpFirewall.Allowed {
+		entry := allowed.IPProtocol
+		if len(allowed.Ports) > 0 {
+			entry += ":" + strings.Join(allowed.Ports, ",")
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return "-"
+	}
+	return strings.Join(entries, " ")
+}
+
+// displayFirewallRules shows the rules as a table
+func displayFirewallRules(w io.Writer, rules []*reportFirewallRule) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  FIREWALL RULE\tNETWORK\tDIRECTION\tPRIORITY\tSOURCES\tALLOWED\tSTATUS")
+	for _, rule := range rules {
+		gcpFirewall := rule.gcpFirewall
+		status := healthy("OK")
+		switch {
+		case len(rule.openPorts) > 0:
+			status = alert("OPEN")
+		case gcpFirewall.Disabled:
+			status = "DISABLED"
+		}
+		sources := "-"
+		if len(gcpFirewall.SourceRanges) > 0 {
+			sources = strings.Join(gcpFirewall.SourceRanges, ",")
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%d\t%s\t%s\t%s\n", gcpFirewall.Name, path.Base(gcpFirewall.Network),
+			supplyDefault(gcpFirewall.Direction, "INGRESS"), gcpFirewall.Priority, sources, rule.allowedSummary(), status)
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(firewallCmd)
+
+	firewallCmd.Flags().StringSlice("sensitive-ports", []string{"22", "3389"}, "comma-separated ports which ingress rules should not open to any address")
+	viper.BindPFlag("sensitivePorts", firewallCmd.Flags().Lookup("sensitive-ports"))
+}
@@ -0,0 +1,93 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	compute "google.golang.org/api/compute/v1"
+)
+
+var p2firewalls = map[string][]*compute.Firewall{
+	"test1-project-000": []*compute.Firewall{
+		&compute.Firewall{Name: "allow-ssh", Network: "global/networks/default", Direction: "INGRESS", Priority: 1000,
+			SourceRanges: []string{"0.0.0.0/0"},
+			Allowed:      []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "tcp", Ports: []string{"22"}}}},
+		&compute.Firewall{Name: "allow-internal", Network: "global/networks/default", Direction: "INGRESS", Priority: 65534,
+			SourceRanges: []string{"10.128.0.0/9"},
+			Allowed:      []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "tcp", Ports: []string{"0-65535"}}}},
+		&compute.Firewall{Name: "allow-web", Network: "global/networks/default", Priority: 1000,
+			SourceRanges: []string{"0.0.0.0/0"},
+			Allowed: []*compute.FirewallAllowed{
+				&compute.FirewallAllowed{IPProtocol: "tcp", Ports: []string{"80", "443"}},
+				&compute.FirewallAllowed{IPProtocol: "icmp"},
+			}},
+		&compute.Firewall{Name: "allow-rdp-range", Network: "global/networks/default", Priority: 1000, Disabled: true,
+			SourceRanges: []string{"0.0.0.0/0"},
+			Allowed:      []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "tcp", Ports: []string{"3000-4000"}}}},
+	},
+}
+
+type TestFirewallTaker struct{}
+
+func (tt *TestFirewallTaker) ListFirewalls(ctx context.Context, rp *reportProject) ([]*compute.Firewall, error) {
+	return p2firewalls[rp.gcpProject.ProjectId], nil
+}
+
+func TestIngestFirewallRules(t *testing.T) {
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestFirewallRules(context.Background(), &TestFirewallTaker{}, []int{22, 3389}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.firewallRules) != 4 {
+		t.Fatalf("expected 4 rules, have %d", len(project.firewallRules))
+	}
+	for _, rule := range project.firewallRules {
+		expected := []int(nil)
+		if rule.gcpFirewall.Name == "allow-ssh" {
+			expected = []int{22}
+		}
+		if !reflect.DeepEqual(rule.openPorts, expected) {
+			t.Errorf("%s: expected open ports %v, have %v", rule.gcpFirewall.Name, expected, rule.openPorts)
+		}
+	}
+	if len(project.findings) != 1 || project.findings[0].resource != "firewall/allow-ssh" {
+		t.Errorf("expected a finding for allow-ssh alone, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	if strings.Count(out, "OPEN") != 1 || !strings.Contains(out, "tcp:80,443 icmp") {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
+
+func TestFirewallAllows(t *testing.T) {
+	rule := &compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "tcp", Ports: []string{"3000-4000"}}}}
+	if !firewallAllows(rule, 3389) || firewallAllows(rule, 22) {
+		t.Errorf("expected a port range to cover 3389 and not 22")
+	}
+	rule = &compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "all"}}}
+	if !firewallAllows(rule, 22) {
+		t.Errorf("expected all protocols to cover every port")
+	}
+}
+
+func TestSensitivePorts(t *testing.T) {
+	defer viper.Set("sensitivePorts", []string{})
+	viper.Set("sensitivePorts", "[22,5432]")
+	if ports, err := sensitivePorts(); err != nil || !reflect.DeepEqual(ports, []int{22, 5432}) {
+		t.Errorf("expected ports 22 and 5432, have %v (%v)", ports, err)
+	}
+	viper.Set("sensitivePorts", []string{"ssh"})
+	if _, err := sensitivePorts(); err == nil {
+		t.Errorf("expected a port name to be refused")
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	formatText   = "text"
+	formatNDJSON = "ndjson"
+	formatHTML   = "html"
+	formatJUnit  = "junit"
+)
+
+var formatNames = []string{formatText, formatNDJSON, formatHTML, formatJUnit}
+
+// reportSchemaVersion is given as schemaVersion in machine-readable output.
+// Adding a field keeps it; removing or renaming one, or changing what one
+// means, bumps it.
+const reportSchemaVersion = 1
+
+// reportOutput is the file --output sends the report to; when nil the report
+// goes to the writer it is rendered to
+var reportOutput io.Writer
+
+// textOutput is where the plain text report goes: the --output file when
+// given, otherwise stdout
+func textOutput() io.Writer {
+	if reportOutput != nil {
+		return reportOutput
+	}
+	return os.Stdout
+}
+
+// reportHTML is set by --format html
+var reportHTML bool
+
+// projectStream is set when --format asks for projects to be written as they
+// finish ingesting rather than displayed once all are done
+var projectStream *ndjsonStream
+
+// setupFormat checks the --format name and prepares the output it asks for
+func setupFormat(name string, w io.Writer) error {
+	switch name {
+	case formatText:
+		projectStream, reportHTML, reportJUnit = nil, false, false
+	case formatNDJSON:
+		projectStream, reportHTML, reportJUnit = newNDJSONStream(w), false, false
+	case formatHTML:
+		projectStream, reportHTML, reportJUnit = nil, true, false
+	case formatJUnit:
+		projectStream, reportHTML, reportJUnit = nil, false, true
+	default:
+		return fmt.Errorf("unknown format %q: expecting one of %v", name, formatNames)
+	}
+	return nil
+}
+
+// renderReport writes the projects in the output chosen by --template or
+// --format, or as the problems alone with --quiet, reporting false when that
+// is plain text for the caller to display. Either way, the projects are first
+// put in the order --sort asks for, and saved with --save-snapshot.
+func renderReport(w io.Writer, projects []*reportProject) bool {
+	sortProjects(projects)
+	if path := viper.GetString("saveSnapshot"); path != "" {
+		if err := saveSnapshot(path, projects); err != nil {
+			logger.Errorf("cannot save snapshot: %v", err)
+		}
+	}
+	if reportOutput != nil {
+		w = reportOutput
+	}
+	switch {
+	case reportTemplate != nil:
+		if err := reportTemplate.Execute(w, newReportData(projects)); err != nil {
+			logger.Errorf("cannot render template: %v", err)
+		}
+		return true
+	case reportHTML:
+		if err := htmlReport.Execute(w, newReportData(projects)); err != nil {
+			logger.Errorf("cannot render HTML report: %v", err)
+		}
+		return true
+	case reportJUnit:
+		if err := writeJUnitReport(w, projects); err != nil {
+			logger.Errorf("cannot write JUnit report: %v", err)
+		}
+		return true
+	case projectStream != nil:
+		// projects were written as they completed
+		return true
+	case viper.GetBool("quiet"):
+		displayProblems(w, projects)
+		return true
+	}
+	return false
+}
+
+// displayProblems is the --quiet text report: a line for each finding of warn
+// severity or above, by project then resource, and nothing at all when every
+// resource is healthy
+func displayProblems(w io.Writer, projects []*reportProject) {
+	for _, project := range projects {
+		var problems []finding
+		for _, f := range project.findings {
+			if f.severity >= severityWarn {
+				problems = append(problems, f)
+			}
+		}
+		sort.SliceStable(problems, func(i, j int) bool {
+			return problems[i].resource < problems[j].resource
+		})
+		for _, f := range problems {
+			fmt.Fprintf(w, "project[%s]: %s %s: %s\n", project.gcpProject.ProjectId,
+				alert(strings.ToUpper(f.severity.String())), f.resource, f.problem)
+		}
+	}
+}
+
+// saveSnapshot writes the projects to path as --format ndjson would, for the
+// diff command to compare with a later report
+func saveSnapshot(path string, projects []*reportProject) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, project := range projects {
+		if err := encoder.Encode(newProjectJSON(project)); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// ndjsonStream writes one JSON object per line. Projects complete ingestion
+// concurrently, so every write goes through a single encoder under a mutex.
+type ndjsonStream struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func newNDJSONStream(w io.Writer) *ndjsonStream {
+	return &ndjsonStream{encoder: json.NewEncoder(w)}
+}
+
+// Emit writes the project as a single line; a nil stream writes nothing
+func (s *ndjsonStream) Emit(p *reportProject) {
+	if s == nil {
+		return
+	}
+	record := newProjectJSON(p)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.encoder.Encode(record); err != nil {
+		logger.Errorf("cannot write project %s: %v", p.gcpProject.ProjectId, err)
+	}
+}
+
+// reportData is the whole report tree as given to templates
+type reportData struct {
+	SchemaVersion int
+	GeneratedAt   time.Time
+	Projects      []*projectJSON
+	Summary       reportSummary
+}
+
+func newReportData(projects []*reportProject) *reportData {
+	data := &reportData{SchemaVersion: reportSchemaVersion, GeneratedAt: displayNow().UTC(), Summary: summarizeProjects(projects)}
+	for _, project := range projects {
+		data.Projects = append(data.Projects, newProjectJSON(project))
+	}
+	return data
+}
+
+// projectJSON is the machine-readable form of an ingested project
+type projectJSON struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	GeneratedAt   time.Time          `json:"generatedAt"`
+	ProjectID     string             `json:"projectId"`
+	Env           string             `json:"env,omitempty"`
+	Component     string             `json:"component,omitempty"`
+	Labels        map[string]string  `json:"labels,omitempty"`
+	Application   *applicationJSON   `json:"application,omitempty"`
+	SQLInstances  []sqlInstanceJSON  `json:"sqlInstances,omitempty"`
+	BackupBuckets []backupBucketJSON `json:"backupBuckets,omitempty"`
+	MissingKinds  []string           `json:"missingKinds,omitempty"`
+	Findings      []findingJSON      `json:"findings,omitempty"`
+	Summary       reportSummary      `json:"summary"`
+}
+
+type applicationJSON struct {
+	ID            string        `json:"id"`
+	ServingStatus string        `json:"servingStatus"`
+	Services      []serviceJSON `json:"services,omitempty"`
+}
+
+type serviceJSON struct {
+	ID       string        `json:"id"`
+	Versions []versionJSON `json:"versions,omitempty"`
+}
+
+type versionJSON struct {
+	ID                string     `json:"id"`
+	Runtime           string     `json:"runtime,omitempty"`
+	ServingStatus     string     `json:"servingStatus"`
+	DeployTime        *time.Time `json:"deployTime,omitempty"`
+	Instances         int        `json:"instances"`
+	EmptyServing      bool       `json:"emptyServing,omitempty"`
+	DeprecatedRuntime bool       `json:"deprecatedRuntime,omitempty"`
+	ManyInstances     bool       `json:"manyInstances,omitempty"`
+	// the cost estimate, with --price-table
+	InstanceClass        string   `json:"instanceClass,omitempty"`
+	EstimatedMonthlyCost *float64 `json:"estimatedMonthlyCost,omitempty"`
+	Currency             string   `json:"currency,omitempty"`
+}
+
+type sqlInstanceJSON struct {
+	Name             string     `json:"name"`
+	DatabaseVersion  string     `json:"databaseVersion,omitempty"`
+	Tier             string     `json:"tier,omitempty"`
+	Region           string     `json:"region,omitempty"`
+	AvailabilityType string     `json:"availabilityType,omitempty"`
+	BackupEnabled    bool       `json:"backupEnabled"`
+	PointInTime      bool       `json:"pointInTimeRecovery"`
+	LastBackup       *time.Time `json:"lastBackup,omitempty"`
+	Stale            bool       `json:"stale"`
+	Zonal            bool       `json:"zonal,omitempty"`
+	BackupsDisabled  bool       `json:"backupsDisabled,omitempty"`
+	NoPITR           bool       `json:"noPointInTimeRecovery,omitempty"`
+}
+
+type backupBucketJSON struct {
+	Name       string     `json:"name"`
+	Location   string     `json:"location,omitempty"`
+	Objects    int        `json:"objects"`
+	TotalSize  int64      `json:"totalSize"`
+	Misplaced  int        `json:"misplaced,omitempty"`
+	Mislocated bool       `json:"mislocated,omitempty"`
+	Kinds      []kindJSON `json:"kinds,omitempty"`
+}
+
+type kindJSON struct {
+	Kind       string    `json:"kind"`
+	LastBackup time.Time `json:"lastBackup"`
+	Objects    int       `json:"objects"`
+	TotalSize  int64     `json:"totalSize"`
+	Stale      bool      `json:"stale"`
+}
+
+type findingJSON struct {
+	Severity string `json:"severity"`
+	Resource string `json:"resource"`
+	Problem  string `json:"problem"`
+}
+
+func newProjectJSON(p *reportProject) *projectJSON {
+	record := &projectJSON{
+		SchemaVersion: reportSchemaVersion,
+		GeneratedAt:   displayNow().UTC(),
+		ProjectID:     p.gcpProject.ProjectId,
+		Env:           p.env,
+		Component:     p.component,
+		Labels:        p.gcpProject.Labels,
+		MissingKinds:  p.missingKinds,
+		Summary:       p.Summarize(),
+	}
+	if app := p.application; app != nil {
+		record.Application = &applicationJSON{ID: app.gcpApplication.Id, ServingStatus: app.gcpApplication.ServingStatus}
+		for _, service := range app.services {
+			serviceRecord := serviceJSON{ID: service.gcpService.Id}
+			for _, version := range service.versions {
+				versionRecord := versionJSON{
+					ID:                version.gcpVersion.Id,
+					Runtime:           version.gcpVersion.Runtime,
+					ServingStatus:     version.gcpVersion.ServingStatus,
+					Instances:         len(version.instances),
+					EmptyServing:      version.emptyServing,
+					DeprecatedRuntime: version.deprecatedRuntime,
+					ManyInstances:     version.manyInstances,
+				}
+				if version.cost != nil {
+					monthly := version.cost.monthly
+					versionRecord.InstanceClass, versionRecord.EstimatedMonthlyCost, versionRecord.Currency = version.cost.instanceClass, &monthly, version.cost.currency
+				}
+				if !version.deployTimeUnknown && !version.deployTime.IsZero() {
+					deployTime := version.deployTime
+					versionRecord.DeployTime = &deployTime
+				}
+				serviceRecord.Versions = append(serviceRecord.Versions, versionRecord)
+			}
+			record.Application.Services = append(record.Application.Services, serviceRecord)
+		}
+	}
+	for _, instance := range p.sqlInstances {
+		gcpInstance := instance.gcpSQLInstance
+		instanceRecord := sqlInstanceJSON{
+			Name:            gcpInstance.Name,
+			DatabaseVersion: gcpInstance.DatabaseVersion,
+			Region:          gcpInstance.Region,
+			Stale:           instance.stale,
+			Zonal:           instance.zonal,
+			BackupsDisabled: instance.backupsDisabled,
+			NoPITR:          instance.noPITR,
+		}
+		if settings := gcpInstance.Settings; settings != nil {
+			instanceRecord.Tier, instanceRecord.AvailabilityType = settings.Tier, settings.AvailabilityType
+			if settings.BackupConfiguration != nil {
+				instanceRecord.BackupEnabled = settings.BackupConfiguration.Enabled
+				instanceRecord.PointInTime = settings.BackupConfiguration.BinaryLogEnabled
+			}
+		}
+		if last, ok := instance.lastBackup(); ok {
+			instanceRecord.LastBackup = &last
+		}
+		record.SQLInstances = append(record.SQLInstances, instanceRecord)
+	}
+	for _, bucket := range p.backupBuckets {
+		if !bucket.isBackup {
+			continue
+		}
+		bucketRecord := backupBucketJSON{Name: bucket.gcpBucket.Name, Location: bucket.gcpBucket.Location, Objects: bucket.objectCount(), TotalSize: bucket.totalSize,
+			Misplaced: bucket.misplaced, Mislocated: bucket.mislocated}
+		for _, kind := range bucket.sortedKinds() {
+			bucketRecord.Kinds = append(bucketRecord.Kinds, kindJSON{
+				Kind:       kind,
+				LastBackup: bucket.kindMap[kind][0].updateTime,
+				Objects:    bucket.kindObjectCount(kind),
+				TotalSize:  bucket.kindSizes[kind],
+				Stale:      bucket.staleKinds[kind],
+			})
+		}
+		record.BackupBuckets = append(record.BackupBuckets, bucketRecord)
+	}
+	p.findingsMu.Lock()
+	for _, f := range p.findings {
+		record.Findings = append(record.Findings, findingJSON{Severity: f.severity.String(), Resource: f.resource, Problem: f.problem})
+	}
+	p.findingsMu.Unlock()
+	return record
+}
@@ -0,0 +1,202 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	appengine "google.golang.org/api/appengine/v1"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+)
+
+func TestNDJSONStream(t *testing.T) {
+	var out bytes.Buffer
+	if err := setupFormat(formatNDJSON, &out); err != nil {
+		t.Fatalf("unexpected format error: %v", err)
+	}
+	defer setupFormat(formatText, nil)
+	if !renderReport(&out, nil) || out.Len() != 0 {
+		t.Errorf("ndjson format should neither display text nor write again once ingested")
+	}
+
+	var projects []*reportProject
+	for _, gcpProject := range gcpP {
+		projects = append(projects, &reportProject{gcpProject: gcpProject})
+	}
+	projects[0].application = goldenProject().application
+	projects[1].addFinding(severityWarn, "sql/db", "no backup completed within 24h0m0s")
+
+	if err := ingestProjects(context.Background(), projects, func(ctx context.Context, project *reportProject) error {
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+
+	count, seen := 0, make(map[string]projectJSON)
+	decoder := json.NewDecoder(&out)
+	for {
+		var record projectJSON
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("stream is not newline-delimited JSON: %v", err)
+		}
+		count++
+		seen[record.ProjectID] = record
+	}
+	if count != len(projects) {
+		t.Fatalf("expected %d objects, one per project, have %d", len(projects), count)
+	}
+	if app := seen[gcpP[0].ProjectId].Application; app == nil || len(app.Services) != 1 {
+		t.Errorf("expected the application and its service in the stream, have %+v", app)
+	}
+	if findings := seen[gcpP[1].ProjectId].Findings; len(findings) != 1 || findings[0].Resource != "sql/db" {
+		t.Errorf("expected the finding in the stream, have %+v", findings)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+	displayNow = func() time.Time { return now }
+	defer func() { displayNow = time.Now }()
+
+	var out bytes.Buffer
+	newNDJSONStream(&out).Emit(&reportProject{gcpProject: gcpP[0]})
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("unexpected json error: %v", err)
+	}
+	if record["schemaVersion"] != float64(reportSchemaVersion) || record["generatedAt"] != "2017-06-02T12:00:00Z" {
+		t.Errorf("expected schemaVersion %d generated at %v, have %v and %v", reportSchemaVersion, now, record["schemaVersion"], record["generatedAt"])
+	}
+
+	out.Reset()
+	if err := htmlReport.Execute(&out, newReportData(nil)); err != nil {
+		t.Fatalf("unexpected html error: %v", err)
+	}
+	if page := out.String(); !strings.Contains(page, fmt.Sprintf("generated 2017-06-02T12:00:00Z, schema version %d", reportSchemaVersion)) {
+		t.Errorf("expected the schema version in the page:\n%s", page)
+	}
+}
+
+func TestSetupFormatUnknown(t *testing.T) {
+	if err := setupFormat("yaml", nil); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestQuietReportsOnlyProblems(t *testing.T) {
+	defer viper.Set("quiet", viper.GetBool("quiet"))
+	viper.Set("quiet", true)
+	now := time.Now()
+	project := &reportProject{gcpProject: &cloudresourcemanager.Project{ProjectId: "p-a"}, env: "prod"}
+	for _, name := range []string{"db1", "db2"} {
+		instance := &reportSQLInstance{
+			gcpSQLInstance: &sqladmin.DatabaseInstance{Name: name},
+			backupRuns:     []*reportBackupRun{{gcpBackupRun: &sqladmin.BackupRun{EndTime: now.Add(-time.Hour).Format(time.RFC3339)}}},
+			project:        project,
+		}
+		project.sqlInstances = append(project.sqlInstances, instance)
+		instance.CheckFreshness(now, 24*time.Hour)
+	}
+	// info findings are no problem
+	project.addFinding(severityInfo, "bucket/b1", "is not under backup/<component>/<env>/")
+
+	var buf bytes.Buffer
+	if !renderReport(&buf, []*reportProject{project}) {
+		t.Fatal("expected --quiet to render the report")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing for a healthy project, have:\n%s", buf.String())
+	}
+
+	project.sqlInstances[1].backupRuns[0].gcpBackupRun.EndTime = now.Add(-48 * time.Hour).Format(time.RFC3339)
+	project.sqlInstances[1].CheckFreshness(now, 24*time.Hour)
+	buf.Reset()
+	renderReport(&buf, []*reportProject{project})
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], "project[p-a]") || !strings.Contains(lines[0], "sql/db2: no backup completed within 24h0m0s") {
+		t.Errorf("expected a single line for the stale instance, have:\n%s", buf.String())
+	}
+}
+
+func TestCheckServing(t *testing.T) {
+	for _, tt := range []struct {
+		status  string
+		flagged bool
+	}{
+		{"SERVING", false},
+		{"", false},
+		{"USER_DISABLED", true},
+		{"SYSTEM_DISABLED", true},
+	} {
+		project := &reportProject{gcpProject: &cloudresourcemanager.Project{ProjectId: "p-a"}}
+		app := &reportApplication{gcpApplication: &appengine.Application{Id: "p-a", ServingStatus: tt.status}, project: project}
+		app.CheckServing()
+		if flagged := len(project.findings) > 0; flagged != tt.flagged {
+			t.Errorf("status %q: expected flagged %t, have findings %v", tt.status, tt.flagged, project.findings)
+		}
+	}
+}
+
+func TestSaveSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcp-reports-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+	defer viper.Set("saveSnapshot", viper.GetString("saveSnapshot"))
+	viper.Set("saveSnapshot", path)
+
+	var projects []*reportProject
+	for _, gcpProject := range gcpP[:3] {
+		projects = append(projects, &reportProject{gcpProject: gcpProject})
+	}
+	projects[0].application = goldenProject().application
+	projects[1].addFinding(severityWarn, "sql/db", "no backup completed within 24h0m0s")
+
+	var out bytes.Buffer
+	if renderReport(&out, projects) {
+		t.Fatalf("expected text still left for the caller to display")
+	}
+	saved, err := loadReport(path)
+	if err != nil {
+		t.Fatalf("cannot reload the snapshot: %v", err)
+	}
+	if len(saved) != len(projects) {
+		t.Fatalf("expected %d projects saved, have %d", len(projects), len(saved))
+	}
+	first := saved[projects[0].gcpProject.ProjectId]
+	if first == nil || first.SchemaVersion != reportSchemaVersion || first.Application == nil || len(first.Application.Services) == 0 {
+		t.Errorf("expected the application saved with its services, have %+v", first)
+	}
+	if second := saved[projects[1].gcpProject.ProjectId]; second == nil || len(second.Findings) != 1 || second.Findings[0].Resource != "sql/db" {
+		t.Errorf("expected the finding saved, have %+v", second)
+	}
+}
+
+func TestTextOutput(t *testing.T) {
+	defer func() { reportOutput = nil }()
+	if textOutput() != os.Stdout {
+		t.Error("expected the text report on stdout by default")
+	}
+	var buf bytes.Buffer
+	reportOutput = &buf
+	if textOutput() != &buf {
+		t.Error("expected the text report sent to --output")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	cloudfunctions "google.golang.org/api/cloudfunctions/v1"
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+// functionsCmd represents the functions command
+var functionsCmd = &cobra.Command{
+	Use:   "functions",
+	Short: "Show Cloud Functions available from given credentials",
+	Long: `Show the Cloud Functions of each project visible from the account used,
+with their runtime, trigger, memory and when they were last deployed.
+Functions on a runtime named by --deprecated-runtime are flagged as
+DEPRECATED-RUNTIME, and those not deployed within the --within window
+(default 180 days) as STALE. For instance:
+    gcp-reports functions --deprecated-runtime nodejs8 --within 2160h our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, cloudresourcemanager.CloudPlatformReadOnlyScope, func(clients *clients) (projectIngester, error) {
+			functionsService, err := cloudfunctions.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish cloud functions service: %v", err)
+			}
+			taker := &TakerFunctionsGCP{functionsService: functionsService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestFunctions(ctx, taker, time.Now())
+			}, nil
+		})
+	},
+}
+
+type TakerFunctions interface {
+	ListFunctions(context.Context, *reportProject) ([]*cloudfunctions.CloudFunction, error)
+}
+
+type TakerFunctionsGCP struct {
+	functionsService *cloudfunctions.Service
+}
+
+type reportFunction struct {
+	gcpFunction       *cloudfunctions.CloudFunction
+	updateTime        time.Time
+	deprecatedRuntime bool
+	stale             bool
+
+	project *reportProject // parent
+}
+
+func (rf *reportFunction) Parent() reportNode {
+	return rf.project
+}
+
+// ListFunctions gathers the functions of the project in every location
+func (taker *TakerFunctionsGCP) ListFunctions(ctx context.Context, project *reportProject) (functions []*cloudfunctions.CloudFunction, err error) {
+	err = doWithRetry(ctx, func() error {
+		functions = nil
+		return taker.functionsService.Projects.Locations.Functions.List("projects/"+project.gcpProject.ProjectId+"/locations/-").Pages(ctx,
+			func(page *cloudfunctions.ListFunctionsResponse) error {
+				functions = append(functions, page.Functions...)
+				return nil
+			})
+	})
+	return
+}
+
+// IngestFunctions ingests the project's functions ordered by name, marking
+// those on a deprecated runtime or not deployed within the configured window
+// of now.
+func (p *reportProject) IngestFunctions(ctx context.Context, taker TakerFunctions, now time.Time) error {
+	var gcpFunctions []*cloudfunctions.CloudFunction
+	listErr := limited(func() (err error) {
+		gcpFunctions, err = taker.ListFunctions(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+
+	deprecated := make(map[string]bool)
+	for _, runtime := range getStringSlice("functionDeprecatedRuntime") {
+		deprecated[runtime] = true
+	}
+	window := viper.GetDuration("functionWithin")
+	for _, gcpFunction := range gcpFunctions {
+		function := &reportFunction{gcpFunction: gcpFunction, project: p}
+		name := "function/" + path.Base(gcpFunction.Name)
+		if deprecated[gcpFunction.Runtime] {
+			function.deprecatedRuntime = true
+			p.addFinding(severityWarn, name, fmt.Sprintf("runs on deprecated runtime %s", gcpFunction.Runtime))
+		}
+		updateTime, parseErr := time.Parse(time.RFC3339, gcpFunction.UpdateTime)
+		if parseErr != nil {
+			logger.Warnf("cannot parse update time of function %s: %v", gcpFunction.Name, parseErr)
+		} else {
+			function.updateTime = updateTime
+			if now.Sub(updateTime) > window {
+				function.stale = true
+				p.addFinding(severityInfo, name, fmt.Sprintf("not deployed within %v", window))
+			}
+		}
+		p.functions = append(p.functions, function)
+	}
+	sort.Slice(p.functions, func(i, j int) bool {
+		return p.functions[i].gcpFunction.Name < p.functions[j].gcpFunction.Name
+	})
+	return nil
+}
+
+// trigger is "http" for an HTTPS function, otherwise the type of event it observes
+func (rf *reportFunction) trigger() string {
+	switch {
+	case rf.gcpFunction.HttpsTrigger != nil:
+		return "http"
+	case rf.gcpFunction.EventTrigger != nil:
+		return rf.gcpFunction.EventTrigger.EventType
+	}
+	return "unknown"
+}
+
+// displayFunctions shows the functions as a table
+func displayFunctions(w io.Writer, functions []*reportFunction) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  FUNCTION\tRUNTIME\tTRIGGER\tMEMORY\tDEPLOYED\tSTATUS")
+	for _, function := range functions {
+		deployed := "unknown"
+		if !function.updateTime.IsZero() {
+			deployed = formatTime(function.updateTime)
+		}
+		var markers []string
+		if function.deprecatedRuntime {
+			markers = append(markers, alert("DEPRECATED-RUNTIME"))
+		}
+		if function.stale {
+			markers = append(markers, alert("STALE"))
+		}
+		status := healthy("OK")
+		if len(markers) > 0 {
+			status = strings.Join(markers, " ")
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%dMB\t%s\t%s\n", path.Base(function.gcpFunction.Name), function.gcpFunction.Runtime,
+			function.trigger(), function.gcpFunction.AvailableMemoryMb, deployed, status)
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(functionsCmd)
+
+	functionsCmd.Flags().StringArray("deprecated-runtime", []string{"nodejs6", "nodejs8", "nodejs10", "python37", "go111"},
+		"flag functions running on this runtime (repeatable)")
+	viper.BindPFlag("functionDeprecatedRuntime", functionsCmd.Flags().Lookup("deprecated-runtime"))
+	functionsCmd.Flags().Duration("within", 180*24*time.Hour, "flag functions not deployed within this interval from now")
+	viper.BindPFlag("functionWithin", functionsCmd.Flags().Lookup("within"))
+}
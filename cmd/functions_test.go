@@ -0,0 +1,73 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	cloudfunctions "google.golang.org/api/cloudfunctions/v1"
+)
+
+var p2functions = map[string][]*cloudfunctions.CloudFunction{
+	"test1-project-000": []*cloudfunctions.CloudFunction{
+		&cloudfunctions.CloudFunction{Name: "projects/test1-project-000/locations/us-central1/functions/resize",
+			Runtime: "nodejs8", AvailableMemoryMb: 256, UpdateTime: "2018-03-01T10:00:00.5Z",
+			EventTrigger: &cloudfunctions.EventTrigger{EventType: "google.storage.object.finalize"}},
+		&cloudfunctions.CloudFunction{Name: "projects/test1-project-000/locations/us-central1/functions/hook",
+			Runtime: "go116", AvailableMemoryMb: 128, UpdateTime: "2017-06-01T10:00:00Z",
+			HttpsTrigger: &cloudfunctions.HttpsTrigger{Url: "https://example.com/hook"}},
+		&cloudfunctions.CloudFunction{Name: "projects/test1-project-000/locations/europe-west1/functions/audit",
+			Runtime: "python39", AvailableMemoryMb: 512, UpdateTime: "2018-02-20T10:00:00Z",
+			HttpsTrigger: &cloudfunctions.HttpsTrigger{}},
+	},
+}
+
+type TestFunctionsTaker struct{}
+
+func (tt *TestFunctionsTaker) ListFunctions(ctx context.Context, rp *reportProject) ([]*cloudfunctions.CloudFunction, error) {
+	return p2functions[rp.gcpProject.ProjectId], nil
+}
+
+func TestIngestFunctions(t *testing.T) {
+	viper.Set("functionDeprecatedRuntime", []string{"nodejs8", "python37"})
+	viper.Set("functionWithin", 90*24*time.Hour)
+	defer viper.Set("functionDeprecatedRuntime", []string{})
+	defer viper.Set("functionWithin", 0)
+	now := time.Date(2018, 3, 10, 0, 0, 0, 0, time.UTC)
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestFunctions(context.Background(), &TestFunctionsTaker{}, now); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.functions) != 3 {
+		t.Fatalf("expected 3 functions, have %d", len(project.functions))
+	}
+	audit, hook, resize := project.functions[0], project.functions[1], project.functions[2]
+	if audit.deprecatedRuntime || audit.stale {
+		t.Errorf("expected audit to be healthy")
+	}
+	if hook.deprecatedRuntime || !hook.stale {
+		t.Errorf("expected hook to be stale alone")
+	}
+	if !resize.deprecatedRuntime || resize.stale {
+		t.Errorf("expected resize to be on a deprecated runtime alone")
+	}
+	if resize.trigger() != "google.storage.object.finalize" || hook.trigger() != "http" {
+		t.Errorf("unexpected triggers %s and %s", resize.trigger(), hook.trigger())
+	}
+	if len(project.findings) != 2 {
+		t.Errorf("expected 2 findings, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	if strings.Count(out, "DEPRECATED-RUNTIME") != 1 || strings.Count(out, "STALE") != 1 || !strings.Contains(out, "256MB") {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	container "google.golang.org/api/container/v1"
+)
+
+// gkeCmd represents the gke command
+var gkeCmd = &cobra.Command{
+	Use:   "gke",
+	Short: "Show Kubernetes Engine clusters available from given credentials",
+	Long: `Show the Kubernetes Engine clusters of each project visible from the
+account used: location, node count, node version and whether the node pools
+upgrade automatically. Clusters whose master runs a version older than
+--min-version are marked OUTDATED. For instance:
+    gcp-reports gke --min-version 1.11 our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, container.CloudPlatformScope, func(clients *clients) (projectIngester, error) {
+			containerService, err := container.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish kubernetes engine service: %v", err)
+			}
+			taker := &TakerGKEGCP{containerService: containerService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestClusters(ctx, taker)
+			}, nil
+		})
+	},
+}
+
+type TakerGKE interface {
+	ListClusters(context.Context, *reportProject) ([]*container.Cluster, error)
+}
+
+type TakerGKEGCP struct {
+	containerService *container.Service
+}
+
+type reportCluster struct {
+	gcpCluster *container.Cluster
+	outdated   bool
+
+	project *reportProject // parent
+}
+
+func (rc *reportCluster) Parent() reportNode {
+	return rc.project
+}
+
+// ListClusters gathers the clusters of the project in every location
+func (taker *TakerGKEGCP) ListClusters(ctx context.Context, project *reportProject) (clusters []*container.Cluster, err error) {
+	parent := "projects/" + project.gcpProject.ProjectId + "/locations/-"
+	err = doWithRetry(ctx, func() error {
+		listResponse, listErr := taker.containerService.Projects.Locations.Clusters.List(parent).Context(ctx).Do()
+		if listErr == nil {
+			clusters = listResponse.Clusters
+		}
+		return listErr
+	})
+	return
+}
+
+// IngestClusters ingests all the GKE clusters for this project, marking
+// those whose master is older than the configured minimum version.
+func (p *reportProject) IngestClusters(ctx context.Context, taker TakerGKE) error {
+	var gcpClusters []*container.Cluster
+	listErr := limited(func() (err error) {
+		gcpClusters, err = taker.ListClusters(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+	minVersion := viper.GetString("minVersion")
+	for _, gcpCluster := range gcpClusters {
+		cluster := &reportCluster{gcpCluster: gcpCluster, project: p}
+		if minVersion != "" && compareVersions(gcpCluster.CurrentMasterVersion, minVersion) < 0 {
+			cluster.outdated = true
+			p.addFinding(severityWarn, "cluster/"+gcpCluster.Name,
+				fmt.Sprintf("master version %s is older than %s", gcpCluster.CurrentMasterVersion, minVersion))
+		}
+		p.clusters = append(p.clusters, cluster)
+	}
+	return nil
+}
+
+// autoUpgrade reports whether every node pool of the cluster upgrades automatically
+func (rc *reportCluster) autoUpgrade() bool {
+	for _, pool := range rc.gcpCluster.NodePools {
+		if pool.Management == nil || !pool.Management.AutoUpgrade {
+			return false
+		}
+	}
+	return len(rc.gcpCluster.NodePools) > 0
+}
+
+// Display shows the cluster on a single line
+func (rc *reportCluster) Display(w io.Writer) {
+	gcpCluster := rc.gcpCluster
+	fmt.Fprintf(w, "  cluster[%24s] location[%14s] nodes[%4d] master[%16s] node-version[%16s] auto-upgrade[%t]",
+		gcpCluster.Name, gcpCluster.Location, gcpCluster.CurrentNodeCount, gcpCluster.CurrentMasterVersion,
+		gcpCluster.CurrentNodeVersion, rc.autoUpgrade())
+	if rc.outdated {
+		fmt.Fprintf(w, " %s", alert("OUTDATED"))
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+var versionNumberRegex = regexp.MustCompile("[0-9]+")
+
+// compareVersions orders GKE-style versions such as 1.12.7-gke.10 by their
+// numeric components, returning -1, 0 or 1. Missing components count as zero.
+func compareVersions(a, b string) int {
+	an := versionNumberRegex.FindAllString(a, -1)
+	bn := versionNumberRegex.FindAllString(b, -1)
+	for i := 0; i < len(an) || i < len(bn); i++ {
+		var ai, bi int
+		if i < len(an) {
+			ai, _ = strconv.Atoi(an[i])
+		}
+		if i < len(bn) {
+			bi, _ = strconv.Atoi(bn[i])
+		}
+		if ai != bi {
+			if ai < bi {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func init() {
+	RootCmd.AddCommand(gkeCmd)
+
+	gkeCmd.Flags().String("min-version", "", "mark clusters whose master version is older than this")
+	viper.BindPFlag("minVersion", gkeCmd.Flags().Lookup("min-version"))
+}
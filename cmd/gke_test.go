@@ -0,0 +1,71 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	container "google.golang.org/api/container/v1"
+)
+
+var p2gke = map[string][]*container.Cluster{
+	"test1-project-000": []*container.Cluster{
+		&container.Cluster{Name: "current", Location: "us-east1", CurrentMasterVersion: "1.12.7-gke.10", CurrentNodeCount: 3,
+			NodePools: []*container.NodePool{&container.NodePool{Management: &container.NodeManagement{AutoUpgrade: true}}}},
+		&container.Cluster{Name: "ancient", Location: "us-east1-b", CurrentMasterVersion: "1.9.7-gke.11", CurrentNodeCount: 1},
+		&container.Cluster{Name: "exact", Location: "us-east1-c", CurrentMasterVersion: "1.11.0"},
+	},
+}
+
+type TestGKETaker struct{}
+
+func (tt *TestGKETaker) ListClusters(ctx context.Context, rp *reportProject) ([]*container.Cluster, error) {
+	return p2gke[rp.gcpProject.ProjectId], nil
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tt := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.12.7-gke.10", "1.11", 1},
+		{"1.9.7-gke.11", "1.11", -1},
+		{"1.11.0", "1.11", 0},
+		{"1.11.0-gke.1", "1.11.0-gke.2", -1},
+	} {
+		if have := compareVersions(tt.a, tt.b); have != tt.expected {
+			t.Errorf("compareVersions(%s, %s): expected %d, have %d", tt.a, tt.b, tt.expected, have)
+		}
+	}
+}
+
+func TestIngestClustersMinVersion(t *testing.T) {
+	viper.Set("minVersion", "1.11")
+	defer viper.Set("minVersion", "")
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestClusters(context.Background(), &TestGKETaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.clusters) != 3 {
+		t.Fatalf("expected 3 clusters, have %d", len(project.clusters))
+	}
+	for _, cluster := range project.clusters {
+		if expected := cluster.gcpCluster.Name == "ancient"; cluster.outdated != expected {
+			t.Errorf("cluster[%s]: expected outdated[%t]", cluster.gcpCluster.Name, expected)
+		}
+	}
+	if len(project.findings) != 1 || project.findings[0].resource != "cluster/ancient" {
+		t.Errorf("expected one finding for the ancient cluster, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	if out := buf.String(); strings.Count(out, "OUTDATED") != 1 || !strings.Contains(out, "auto-upgrade[true]") {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	groupEnv       = "env"
+	groupComponent = "component"
+	groupNone      = "none"
+)
+
+var groupNames = []string{groupEnv, groupComponent, groupNone}
+
+// checkGroupBy rejects a --group-by that is not one of groupNames
+func checkGroupBy(name string) error {
+	if !containsString(groupNames, name) {
+		return fmt.Errorf("unknown grouping %q: expecting one of %v", name, groupNames)
+	}
+	return nil
+}
+
+// projectGroup is the projects sharing an env or component label value
+type projectGroup struct {
+	value    string
+	projects []*reportProject
+}
+
+// groupProjects splits the projects by --group-by into groups ordered by
+// value, each keeping the projects in the order given. Without grouping
+// there is one group of them all.
+func groupProjects(projects []*reportProject) []*projectGroup {
+	by := viper.GetString("groupBy")
+	if by != groupEnv && by != groupComponent {
+		return []*projectGroup{{projects: projects}}
+	}
+	byValue := make(map[string]*projectGroup)
+	var groups []*projectGroup
+	for _, project := range projects {
+		value := project.env
+		if by == groupComponent {
+			value = project.component
+		}
+		group, ok := byValue[value]
+		if !ok {
+			group = &projectGroup{value: value}
+			byValue[value] = group
+			groups = append(groups, group)
+		}
+		group.projects = append(group.projects, project)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].value < groups[j].value })
+	return groups
+}
+
+// DisplayHeader introduces the group's projects, eg env[prod]: 3 projects;
+// the single group made without grouping has none
+func (g *projectGroup) DisplayHeader(w io.Writer) {
+	by := viper.GetString("groupBy")
+	if by != groupEnv && by != groupComponent {
+		return
+	}
+	fmt.Fprintf(w, "%s[%s]: %d projects\n", by, supplyDefault(g.value, "-"), len(g.projects))
+}
+
+// reportableProjects leaves out the projects with nothing to report, unless
+// --include-empty asks for them to be listed as such
+func reportableProjects(projects []*reportProject) []*reportProject {
+	if viper.GetBool("includeEmpty") {
+		return projects
+	}
+	var reportable []*reportProject
+	for _, project := range projects {
+		if !project.empty() {
+			reportable = append(reportable, project)
+		}
+	}
+	return reportable
+}
+
+// displayEmpty is the single line standing for a project with nothing to report
+func (p *reportProject) displayEmpty(w io.Writer) {
+	fmt.Fprintf(w, "project[%s]: nothing to report\n", p.gcpProject.ProjectId)
+}
+
+// displayProjects shows the text report of each project with something to
+// report, under a header for each group with --group-by
+func displayProjects(w io.Writer, projects []*reportProject) {
+	for _, group := range groupProjects(reportableProjects(projects)) {
+		group.DisplayHeader(w)
+		for _, project := range group.projects {
+			if project.empty() {
+				project.displayEmpty(w)
+				continue
+			}
+			project.Display(w)
+		}
+	}
+}
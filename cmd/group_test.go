@@ -0,0 +1,88 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestDisplayProjectsGrouped(t *testing.T) {
+	defer viper.Set("groupBy", viper.GetString("groupBy"))
+	projects := sortFixture()
+	for _, project := range projects {
+		project.addresses = []*reportAddress{{gcpAddress: &compute.Address{Name: "lb", Status: "IN_USE"}, project: project}}
+	}
+
+	viper.Set("groupBy", groupEnv)
+	var buf bytes.Buffer
+	displayProjects(&buf, projects)
+	out := buf.String()
+	for _, expected := range []struct{ header, projects string }{
+		{"env[dev]: 1 projects", "p-c"},
+		{"env[prod]: 2 projects", "p-d,p-b"},
+		{"env[test]: 1 projects", "p-a"},
+	} {
+		start := strings.Index(out, expected.header)
+		if start < 0 {
+			t.Fatalf("expected header %q, have:\n%s", expected.header, out)
+		}
+		section := out[start+len(expected.header):]
+		if end := strings.Index(section, "env["); end >= 0 {
+			section = section[:end]
+		}
+		for _, id := range strings.Split(expected.projects, ",") {
+			if !strings.Contains(section, "project["+id+"]") {
+				t.Errorf("expected %s under %q, have:\n%s", id, expected.header, out)
+			}
+		}
+	}
+	if strings.Index(out, "env[dev]") > strings.Index(out, "env[prod]") {
+		t.Errorf("expected groups ordered by env, have:\n%s", out)
+	}
+
+	viper.Set("groupBy", groupNone)
+	buf.Reset()
+	displayProjects(&buf, projects)
+	if strings.Contains(buf.String(), "env[") {
+		t.Errorf("expected no headers without grouping, have:\n%s", buf.String())
+	}
+
+	if checkGroupBy("region") == nil {
+		t.Error("expected an unknown grouping to be refused")
+	}
+}
+
+func TestIncludeEmpty(t *testing.T) {
+	defer viper.Set("groupBy", viper.GetString("groupBy"))
+	defer viper.Set("includeEmpty", viper.GetBool("includeEmpty"))
+	viper.Set("groupBy", groupNone)
+	projects := sortFixture()
+	for _, project := range projects[1:] {
+		project.addresses = []*reportAddress{{gcpAddress: &compute.Address{Name: "lb", Status: "IN_USE"}, project: project}}
+	}
+	empty := projects[0].gcpProject.ProjectId
+
+	viper.Set("includeEmpty", false)
+	var buf bytes.Buffer
+	displayProjects(&buf, projects)
+	if out := buf.String(); strings.Contains(out, empty) || strings.Count(out, "static addresses") != 3 {
+		t.Errorf("expected the empty project %s left out by default, have:\n%s", empty, out)
+	}
+
+	viper.Set("includeEmpty", true)
+	buf.Reset()
+	displayProjects(&buf, projects)
+	out := buf.String()
+	if !strings.Contains(out, "project["+empty+"]: nothing to report\n") || strings.Count(out, "nothing to report") != 1 {
+		t.Errorf("expected the empty project %s alone listed as such, have:\n%s", empty, out)
+	}
+	if strings.Count(out, "static addresses") != 3 {
+		t.Errorf("expected the other projects still reported, have:\n%s", out)
+	}
+}
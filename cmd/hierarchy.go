@@ -0,0 +1,105 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	crmv2 "google.golang.org/api/cloudresourcemanager/v2"
+)
+
+// TakerHierarchy walks the resource hierarchy. Nodes are named as the API
+// names them, eg "organizations/123" or "folders/456".
+type TakerHierarchy interface {
+	ListFolders(ctx context.Context, parent string) ([]string, error)
+	ListProjects(ctx context.Context, parent string) ([]*cloudresourcemanager.Project, error)
+}
+
+type TakerHierarchyGCP struct {
+	crmService   *cloudresourcemanager.Service
+	crmv2Service *crmv2.Service
+	// filter is the --project-filter further narrowing the projects listed
+	filter string
+}
+
+// hierarchyRoot returns the organization or folder given with --organization
+// or --folder, or "" when projects are not to be found through the hierarchy.
+func hierarchyRoot() (string, error) {
+	organization, folder := viper.GetString("organization"), viper.GetString("folder")
+	switch {
+	case organization != "" && folder != "":
+		return "", fmt.Errorf("--organization and --folder cannot be used together")
+	case organization != "":
+		return "organizations/" + strings.TrimPrefix(organization, "organizations/"), nil
+	case folder != "":
+		return "folders/" + strings.TrimPrefix(folder, "folders/"), nil
+	}
+	return "", nil
+}
+
+// ListFolders lists the folders directly under parent
+func (taker *TakerHierarchyGCP) ListFolders(ctx context.Context, parent string) (folders []string, err error) {
+	err = doWithRetry(ctx, func() error {
+		folders = nil
+		return taker.crmv2Service.Folders.List().Parent(parent).Pages(ctx, func(page *crmv2.ListFoldersResponse) error {
+			for _, folder := range page.Folders {
+				folders = append(folders, folder.Name)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// ListProjects lists the projects directly under parent that match the
+// taker's filter
+func (taker *TakerHierarchyGCP) ListProjects(ctx context.Context, parent string) (projects []*cloudresourcemanager.Project, err error) {
+	parts := strings.SplitN(parent, "/", 2)
+	filter := fmt.Sprintf("parent.type:%s parent.id:%s", strings.TrimSuffix(parts[0], "s"), parts[1])
+	if taker.filter != "" {
+		filter += " " + taker.filter
+	}
+	err = doWithRetry(ctx, func() error {
+		projects = nil
+		return taker.crmService.Projects.List().Filter(filter).Pages(ctx, func(page *cloudresourcemanager.ListProjectsResponse) error {
+			projects = append(projects, page.Projects...)
+			return nil
+		})
+	})
+	return
+}
+
+// listHierarchyProjects gathers every project under root, going through
+// nested folders breadth first.
+func listHierarchyProjects(ctx context.Context, taker TakerHierarchy, root string) ([]*cloudresourcemanager.Project, error) {
+	var projects []*cloudresourcemanager.Project
+	queue := []string{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		var nodeProjects []*cloudresourcemanager.Project
+		var folders []string
+		listErr := limited(func() (err error) {
+			nodeProjects, err = taker.ListProjects(ctx, node)
+			return
+		})
+		if listErr == nil {
+			listErr = limited(func() (err error) {
+				folders, err = taker.ListFolders(ctx, node)
+				return
+			})
+		}
+		if listErr != nil {
+			return nil, fmt.Errorf("cannot list contents of %s: %v", node, listErr)
+		}
+		projects = append(projects, nodeProjects...)
+		queue = append(queue, folders...)
+	}
+	return projects, nil
+}
@@ -0,0 +1,84 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+// a fake hierarchy two folders deep:
+// organizations/1 -> folders/10 -> folders/100, with a sibling folders/11
+var h2folders = map[string][]string{
+	"organizations/1": []string{"folders/10", "folders/11"},
+	"folders/10":      []string{"folders/100"},
+}
+
+var h2projects = map[string][]*cloudresourcemanager.Project{
+	"organizations/1": []*cloudresourcemanager.Project{&cloudresourcemanager.Project{ProjectId: "top"}},
+	"folders/10":      []*cloudresourcemanager.Project{&cloudresourcemanager.Project{ProjectId: "team-a"}},
+	"folders/11":      []*cloudresourcemanager.Project{&cloudresourcemanager.Project{ProjectId: "team-b"}},
+	"folders/100": []*cloudresourcemanager.Project{
+		&cloudresourcemanager.Project{ProjectId: "team-a-dev", Labels: map[string]string{"env": "dev"}},
+		&cloudresourcemanager.Project{ProjectId: "team-a-prod", Labels: map[string]string{"env": "prod"}},
+	},
+}
+
+type TestHierarchyTaker struct{}
+
+func (tt *TestHierarchyTaker) ListFolders(ctx context.Context, parent string) ([]string, error) {
+	return h2folders[parent], nil
+}
+
+func (tt *TestHierarchyTaker) ListProjects(ctx context.Context, parent string) ([]*cloudresourcemanager.Project, error) {
+	return h2projects[parent], nil
+}
+
+func TestListHierarchyProjects(t *testing.T) {
+	viper.Set("envKey", "env")
+	viper.Set("componentKey", "component")
+	for _, tt := range []struct {
+		root     string
+		expected []string
+	}{
+		{"organizations/1", []string{"top", "team-a", "team-b", "team-a-dev", "team-a-prod"}},
+		{"folders/10", []string{"team-a", "team-a-dev", "team-a-prod"}},
+		{"folders/100", []string{"team-a-dev", "team-a-prod"}},
+	} {
+		projects, err := listHierarchyProjects(context.Background(), &TestHierarchyTaker{}, tt.root)
+		if err != nil {
+			t.Fatalf("root %s: unexpected error: %v", tt.root, err)
+		}
+		if have := idProj(filterProjects(projects, nil, &projectSelector{})); !reflect.DeepEqual(have, tt.expected) {
+			t.Errorf("root %s: expected %v, have %v", tt.root, tt.expected, have)
+		}
+	}
+
+	projects, _ := listHierarchyProjects(context.Background(), &TestHierarchyTaker{}, "organizations/1")
+	selector, _ := newProjectSelector(nil, []string{"prod"}, nil, nil)
+	if have := idProj(filterProjects(projects, nil, selector)); !reflect.DeepEqual(have, []string{"team-a-prod"}) {
+		t.Errorf("expected hierarchy projects to go through the selector, have %v", have)
+	}
+}
+
+func TestHierarchyRoot(t *testing.T) {
+	defer viper.Set("organization", "")
+	defer viper.Set("folder", "")
+	viper.Set("folder", "456")
+	if root, err := hierarchyRoot(); err != nil || root != "folders/456" {
+		t.Errorf("expected folders/456, have %s %v", root, err)
+	}
+	viper.Set("organization", "organizations/123")
+	if _, err := hierarchyRoot(); err == nil {
+		t.Errorf("expected --organization and --folder to conflict")
+	}
+	viper.Set("folder", "")
+	if root, _ := hierarchyRoot(); root != "organizations/123" {
+		t.Errorf("expected organizations/123, have %s", root)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"html/template"
+)
+
+// htmlReport renders the report tree into a single self-contained page;
+// html/template escapes every value taken from GCP
+var htmlReport = template.Must(template.New("html").Funcs(template.FuncMap{
+	"ago":      ago,
+	"duration": humanDuration,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gcp-reports</title>
+<meta name="gcp-reports-schema-version" content="{{.SchemaVersion}}">
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+th { background: #eee; }
+tr.stale td { background: #f8d7da; }
+tr.missing td { background: #fff3cd; }
+</style>
+</head>
+<body>
+<h1>gcp-reports: {{.Summary.Projects}} projects</h1>
+{{range .Projects}}
+<h2 id="{{.ProjectID}}">{{.ProjectID}}</h2>
+<p>env[{{.Env}}] component[{{.Component}}]</p>
+{{with .Application}}
+<table>
+<caption>application {{.ID}}: {{.ServingStatus}}</caption>
+<tr><th>service</th><th>version</th><th>status</th><th>deployed</th><th>instances</th></tr>
+{{range $service := .Services}}{{range .Versions}}<tr><td>{{$service.ID}}</td><td>{{.ID}}</td><td>{{.ServingStatus}}</td><td>{{ago .DeployTime}}</td><td>{{.Instances}}</td></tr>
+{{end}}{{end}}</table>
+{{end}}
+{{if .SQLInstances}}
+<table>
+<caption>Cloud SQL backups</caption>
+<tr><th>instance</th><th>backup enabled</th><th>last backup</th></tr>
+{{range .SQLInstances}}<tr{{if .Stale}} class="stale"{{end}}><td>{{.Name}}</td><td>{{.BackupEnabled}}</td><td>{{ago .LastBackup}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if or .BackupBuckets .MissingKinds}}
+<table>
+<caption>Datastore backups</caption>
+<tr><th>bucket</th><th>kind</th><th>last backup</th></tr>
+{{range $bucket := .BackupBuckets}}{{range .Kinds}}<tr{{if .Stale}} class="stale"{{end}}><td>{{$bucket.Name}}</td><td>{{.Kind}}</td><td>{{ago .LastBackup}}</td></tr>
+{{end}}{{end}}{{range .MissingKinds}}<tr class="missing"><td></td><td>{{.}}</td><td>missing</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Findings}}
+<ul>
+{{range .Findings}}<li>{{.Resource}}: {{.Problem}}</li>
+{{end}}</ul>
+{{end}}
+{{end}}
+<p>generated {{.GeneratedAt.Format "2006-01-02T15:04:05Z07:00"}}, schema version {{.SchemaVersion}}</p>
+</body>
+</html>
+`))
@@ -0,0 +1,54 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	storage "google.golang.org/api/storage/v1"
+)
+
+func TestHTMLReport(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+
+	apps := goldenProject()
+	backups := &reportProject{gcpProject: gcpP[1], component: "<script>alert(1)</script>"}
+	instance := &reportSQLInstance{
+		gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "db"},
+		backupRuns:     []*reportBackupRun{{gcpBackupRun: &sqladmin.BackupRun{Status: "SUCCESSFUL", EndTime: "2017-05-01T01:00:00Z"}}},
+		project:        backups,
+	}
+	instance.CheckFreshness(now, 24*time.Hour)
+	backups.sqlInstances = []*reportSQLInstance{instance}
+	backups.backupBuckets = []*reportBucket{{
+		gcpBucket: &storage.Bucket{Name: "b1"}, isBackup: true, project: backups,
+		kindMap: map[string][]*reportObject{"Widget": {{updateTime: now.Add(-time.Hour)}}},
+	}}
+
+	var out bytes.Buffer
+	if err := setupFormat(formatHTML, &out); err != nil {
+		t.Fatalf("unexpected format error: %v", err)
+	}
+	defer setupFormat(formatText, nil)
+	if !renderReport(&out, []*reportProject{apps, backups}) {
+		t.Fatalf("html format should take over the output")
+	}
+
+	page := out.String()
+	for _, project := range []*reportProject{apps, backups} {
+		if !strings.Contains(page, project.gcpProject.ProjectId) {
+			t.Errorf("expected project %s in the page", project.gcpProject.ProjectId)
+		}
+	}
+	if strings.Count(page, `<tr class="stale">`) != 1 {
+		t.Errorf("expected exactly the stale sql instance marked stale:\n%s", page)
+	}
+	if strings.Contains(page, "<script>") || !strings.Contains(page, "&lt;script&gt;") {
+		t.Errorf("expected the component label escaped")
+	}
+}
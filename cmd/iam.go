@@ -0,0 +1,156 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+const ownerRole = "roles/owner"
+
+// iamCmd represents the iam command
+var iamCmd = &cobra.Command{
+	Use:   "iam",
+	Short: "Show the IAM policy bindings of projects available from given credentials",
+	Long: `Show who has access to each project visible from the account used,
+as a list of roles and the members bound to them. Use --role to list only
+some roles and --member-type (user, serviceAccount, group, domain) to list
+only some kinds of member. When --org-domain is given, any owner who is not
+part of that domain is flagged as EXTERNAL-OWNER. For instance:
+    gcp-reports iam --role roles/owner --org-domain example.com our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, cloudresourcemanager.CloudPlatformReadOnlyScope, func(clients *clients) (projectIngester, error) {
+			crmService, err := cloudresourcemanager.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish resource manager service: %v", err)
+			}
+			taker := &TakerIAMPolicyGCP{crmService: crmService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestIAMPolicy(ctx, taker)
+			}, nil
+		})
+	},
+}
+
+type TakerIAMPolicy interface {
+	GetIamPolicy(context.Context, *reportProject) (*cloudresourcemanager.Policy, error)
+}
+
+type TakerIAMPolicyGCP struct {
+	crmService *cloudresourcemanager.Service
+}
+
+type reportBinding struct {
+	role    string
+	members []string
+	// external holds the members of an owner binding outside the organization
+	external []string
+
+	project *reportProject // parent
+}
+
+func (rb *reportBinding) Parent() reportNode {
+	return rb.project
+}
+
+// GetIamPolicy fetches the IAM policy attached to the project
+func (taker *TakerIAMPolicyGCP) GetIamPolicy(ctx context.Context, project *reportProject) (policy *cloudresourcemanager.Policy, err error) {
+	err = doWithRetry(ctx, func() (callErr error) {
+		policy, callErr = taker.crmService.Projects.GetIamPolicy(project.gcpProject.ProjectId,
+			&cloudresourcemanager.GetIamPolicyRequest{}).Context(ctx).Do()
+		return
+	})
+	return
+}
+
+// IngestIAMPolicy ingests the bindings of the project's IAM policy, keeping
+// only the roles and member types asked for.
+func (p *reportProject) IngestIAMPolicy(ctx context.Context, taker TakerIAMPolicy) error {
+	var policy *cloudresourcemanager.Policy
+	policyErr := limited(func() (err error) {
+		policy, err = taker.GetIamPolicy(ctx, p)
+		return
+	})
+	if policyErr != nil {
+		return policyErr
+	}
+
+	roles := getStringSlice("role")
+	memberTypes := getStringSlice("memberType")
+	orgDomain := viper.GetString("orgDomain")
+	for _, gcpBinding := range policy.Bindings {
+		if len(roles) > 0 && !containsString(roles, gcpBinding.Role) {
+			continue
+		}
+		binding := &reportBinding{role: gcpBinding.Role, project: p}
+		for _, member := range gcpBinding.Members {
+			if len(memberTypes) > 0 && !containsString(memberTypes, memberType(member)) {
+				continue
+			}
+			binding.members = append(binding.members, member)
+			if gcpBinding.Role == ownerRole && orgDomain != "" && !inDomain(member, orgDomain) {
+				binding.external = append(binding.external, member)
+				p.addFinding(severityCritical, "iam/"+ownerRole, fmt.Sprintf("owner %s is outside %s", member, orgDomain))
+			}
+		}
+		if len(binding.members) == 0 {
+			continue
+		}
+		sort.Strings(binding.members)
+		p.bindings = append(p.bindings, binding)
+	}
+	sort.Slice(p.bindings, func(i, j int) bool { return p.bindings[i].role < p.bindings[j].role })
+	return nil
+}
+
+// memberType is the kind of an IAM member, eg "user" for "user:jo@example.com"
+func memberType(member string) string {
+	if i := strings.Index(member, ":"); i >= 0 {
+		return member[:i]
+	}
+	return member
+}
+
+// inDomain reports whether the IAM member belongs to the given domain.
+// Members without an identity, such as allUsers, never do.
+func inDomain(member, domain string) bool {
+	identity := member[len(memberType(member)):]
+	identity = strings.TrimPrefix(identity, ":")
+	if memberType(member) == "domain" {
+		return identity == domain
+	}
+	return strings.HasSuffix(identity, "@"+domain)
+}
+
+// Display shows the role followed by one line per member
+func (rb *reportBinding) Display(w io.Writer) {
+	fmt.Fprintf(w, "  role[%s]\n", rb.role)
+	for _, member := range rb.members {
+		fmt.Fprintf(w, "    member[%s]", member)
+		if containsString(rb.external, member) {
+			fmt.Fprintf(w, " %s", alert("EXTERNAL-OWNER"))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(iamCmd)
+
+	iamCmd.Flags().StringSlice("role", []string{}, "only show bindings for these roles")
+	iamCmd.Flags().StringSlice("member-type", []string{}, "only show members of these types (user, serviceAccount, group, domain)")
+	iamCmd.Flags().String("org-domain", "", "flag owners who are not part of this domain")
+	viper.BindPFlag("role", iamCmd.Flags().Lookup("role"))
+	viper.BindPFlag("memberType", iamCmd.Flags().Lookup("member-type"))
+	viper.BindPFlag("orgDomain", iamCmd.Flags().Lookup("org-domain"))
+}
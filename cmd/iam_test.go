@@ -0,0 +1,87 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+var p2policy = map[string]*cloudresourcemanager.Policy{
+	"test1-project-000": &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{
+			&cloudresourcemanager.Binding{Role: "roles/viewer", Members: []string{
+				"group:devs@example.com", "serviceAccount:ci@test1-project-000.iam.gserviceaccount.com"}},
+			&cloudresourcemanager.Binding{Role: "roles/owner", Members: []string{
+				"user:boss@example.com", "user:contractor@gmail.com", "domain:example.com"}},
+		},
+	},
+}
+
+type TestIAMPolicyTaker struct{}
+
+func (tt *TestIAMPolicyTaker) GetIamPolicy(ctx context.Context, rp *reportProject) (*cloudresourcemanager.Policy, error) {
+	if policy, ok := p2policy[rp.gcpProject.ProjectId]; ok {
+		return policy, nil
+	}
+	return &cloudresourcemanager.Policy{}, nil
+}
+
+func ingestIAMFixture(t *testing.T, role, memberType []string, orgDomain string) *reportProject {
+	viper.Set("role", role)
+	viper.Set("memberType", memberType)
+	viper.Set("orgDomain", orgDomain)
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestIAMPolicy(context.Background(), &TestIAMPolicyTaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	return project
+}
+
+func TestIngestIAMBindings(t *testing.T) {
+	defer viper.Set("role", []string{})
+	defer viper.Set("memberType", []string{})
+	defer viper.Set("orgDomain", "")
+
+	project := ingestIAMFixture(t, nil, nil, "")
+	if len(project.bindings) != 2 || project.bindings[0].role != "roles/owner" {
+		t.Fatalf("expected owner and viewer bindings ordered by role, have %d", len(project.bindings))
+	}
+	if len(project.findings) != 0 {
+		t.Errorf("expected no owner findings without an organization domain, have %v", project.findings)
+	}
+
+	project = ingestIAMFixture(t, []string{"roles/viewer"}, nil, "")
+	if len(project.bindings) != 1 || len(project.bindings[0].members) != 2 {
+		t.Errorf("expected only the viewer binding with 2 members")
+	}
+
+	project = ingestIAMFixture(t, nil, []string{"serviceAccount"}, "")
+	if len(project.bindings) != 1 || project.bindings[0].role != "roles/viewer" {
+		t.Errorf("expected only the viewer binding holding a service account")
+	}
+}
+
+func TestIAMExternalOwner(t *testing.T) {
+	defer viper.Set("orgDomain", "")
+
+	project := ingestIAMFixture(t, nil, nil, "example.com")
+	owner := project.bindings[0]
+	if len(owner.external) != 1 || owner.external[0] != "user:contractor@gmail.com" {
+		t.Errorf("expected only the gmail owner flagged, have %v", owner.external)
+	}
+	if len(project.findings) != 1 {
+		t.Errorf("expected one finding, have %v", project.findings)
+	}
+	var buf bytes.Buffer
+	project.Display(&buf)
+	if out := buf.String(); strings.Count(out, "EXTERNAL-OWNER") != 1 {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+// artifactRegistryEndpoint is the base of the Artifact Registry REST API,
+// which the vendored google.golang.org/api has no client for
+const artifactRegistryEndpoint = "https://artifactregistry.googleapis.com/v1/"
+
+// imagesCmd represents the images command
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Show Artifact Registry repositories and when an image was last pushed",
+	Long: `Show the Artifact Registry repositories of each project visible from the
+account used, with how many images each docker repository holds and when the
+newest was pushed. Docker repositories without a push within the --within
+window (default 30 days) are flagged as STALE. For instance:
+    gcp-reports images --within 720h our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, cloudresourcemanager.CloudPlatformReadOnlyScope, func(clients *clients) (projectIngester, error) {
+			taker := &TakerArtifactsGCP{client: clients.http, endpoint: artifactRegistryEndpoint}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestRepositories(ctx, taker, time.Now())
+			}, nil
+		})
+	},
+}
+
+// artifactRepository is the part of an Artifact Registry repository reported on
+type artifactRepository struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+}
+
+// artifactImage is the part of an Artifact Registry docker image reported on
+type artifactImage struct {
+	Name       string   `json:"name"`
+	URI        string   `json:"uri"`
+	Tags       []string `json:"tags"`
+	UploadTime string   `json:"uploadTime"`
+}
+
+type TakerArtifacts interface {
+	ListRepositories(context.Context, *reportProject) ([]*artifactRepository, error)
+	ListImages(context.Context, *artifactRepository) ([]*artifactImage, error)
+}
+
+type TakerArtifactsGCP struct {
+	client   *http.Client
+	endpoint string
+}
+
+type reportRepository struct {
+	gcpRepository *artifactRepository
+	// images and newestPush are only known for docker repositories
+	docker     bool
+	images     int
+	newestPush time.Time
+	stale      bool
+
+	project *reportProject // parent
+}
+
+func (rr *reportRepository) Parent() reportNode {
+	return rr.project
+}
+
+// get decodes the JSON of one page of resource into page, passing pageToken
+// when continuing a listing
+func (taker *TakerArtifactsGCP) get(ctx context.Context, resource, pageToken string, page interface{}) error {
+	address := taker.endpoint + resource
+	if pageToken != "" {
+		address += "?pageToken=" + url.QueryEscape(pageToken)
+	}
+	return getJSON(ctx, taker.client, address, page)
+}
+
+// ListRepositories gathers the repositories of the project in every location
+func (taker *TakerArtifactsGCP) ListRepositories(ctx context.Context, project *reportProject) (repos []*artifactRepository, err error) {
+	var locations []string
+	err = doWithRetry(ctx, func() error {
+		locations = nil
+		pageToken := ""
+		for {
+			var page struct {
+				Locations []struct {
+					LocationID string `json:"locationId"`
+				} `json:"locations"`
+				NextPageToken string `json:"nextPageToken"`
+			}
+			if err := taker.get(ctx, "projects/"+project.gcpProject.ProjectId+"/locations", pageToken, &page); err != nil {
+				return err
+			}
+			for _, location := range page.Locations {
+				locations = append(locations, location.LocationID)
+			}
+			if pageToken = page.NextPageToken; pageToken == "" {
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		return
+	}
+	for _, location := range locations {
+		parent := "projects/" + project.gcpProject.ProjectId + "/locations/" + location
+		err = doWithRetry(ctx, func() error {
+			var found []*artifactRepository
+			pageToken := ""
+			for {
+				var page struct {
+					Repositories  []*artifactRepository `json:"repositories"`
+					NextPageToken string                `json:"nextPageToken"`
+				}
+				if err := taker.get(ctx, parent+"/repositories", pageToken, &page); err != nil {
+					return err
+				}
+				found = append(found, page.Repositories...)
+				if pageToken = page.NextPageToken; pageToken == "" {
+					repos = append(repos, found...)
+					return nil
+				}
+			}
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ListImages gathers the docker images held by the repository
+func (taker *TakerArtifactsGCP) ListImages(ctx context.Context, repo *artifactRepository) (images []*artifactImage, err error) {
+	err = doWithRetry(ctx, func() error {
+		images = nil
+		pageToken := ""
+		for {
+			var page struct {
+				DockerImages  []*artifactImage `json:"dockerImages"`
+				NextPageToken string           `json:"nextPageToken"`
+			}
+			if err := taker.get(ctx, repo.Name+"/dockerImages", pageToken, &page); err != nil {
+				return err
+			}
+			images = append(images, page.DockerImages...)
+			if pageToken = page.NextPageToken; pageToken == "" {
+				return nil
+			}
+		}
+	})
+	return
+}
+
+// IngestRepositories ingests the project's repositories ordered by name,
+// marking docker repositories without an image pushed within the configured
+// window of now.
+func (p *reportProject) IngestRepositories(ctx context.Context, taker TakerArtifacts, now time.Time) error {
+	var gcpRepos []*artifactRepository
+	listErr := limited(func() (err error) {
+		gcpRepos, err = taker.ListRepositories(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+
+	window := viper.GetDuration("imageWithin")
+	for _, gcpRepo := range gcpRepos {
+		repo := &reportRepository{gcpRepository: gcpRepo, docker: gcpRepo.Format == "DOCKER", project: p}
+		p.repositories = append(p.repositories, repo)
+		if !repo.docker {
+			continue
+		}
+		var images []*artifactImage
+		imagesErr := limited(func() (err error) {
+			images, err = taker.ListImages(ctx, gcpRepo)
+			return
+		})
+		if imagesErr != nil {
+			return imagesErr
+		}
+		repo.images = len(images)
+		for _, image := range images {
+			uploadTime, parseErr := time.Parse(time.RFC3339, image.UploadTime)
+			if parseErr != nil {
+				logger.Warnf("cannot parse upload time of image %s: %v", image.Name, parseErr)
+				continue
+			}
+			if uploadTime.After(repo.newestPush) {
+				repo.newestPush = uploadTime
+			}
+		}
+		if now.Sub(repo.newestPush) > window {
+			repo.stale = true
+			problem := fmt.Sprintf("no image pushed within %v", window)
+			if repo.newestPush.IsZero() {
+				problem = "holds no images"
+			}
+			p.addFinding(severityInfo, "repository/"+path.Base(gcpRepo.Name), problem)
+		}
+	}
+	sort.Slice(p.repositories, func(i, j int) bool {
+		return p.repositories[i].gcpRepository.Name < p.repositories[j].gcpRepository.Name
+	})
+	return nil
+}
+
+// displayRepositories shows the repositories as a table
+func displayRepositories(w io.Writer, repos []*reportRepository) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  REPOSITORY\tFORMAT\tLOCATION\tIMAGES\tLAST PUSH\tSTATUS")
+	for _, repo := range repos {
+		images, lastPush, status := "-", "-", healthy("OK")
+		if repo.docker {
+			images, lastPush = fmt.Sprint(repo.images), "never"
+		}
+		if !repo.newestPush.IsZero() {
+			lastPush = formatTime(repo.newestPush)
+		}
+		if repo.stale {
+			status = alert("STALE")
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%s\t%s\t%s\n", path.Base(repo.gcpRepository.Name), repo.gcpRepository.Format,
+			resourceLocation(repo.gcpRepository.Name), images, lastPush, status)
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(imagesCmd)
+
+	imagesCmd.Flags().Duration("within", 30*24*time.Hour, "flag repositories without an image pushed within this interval from now")
+	viper.BindPFlag("imageWithin", imagesCmd.Flags().Lookup("within"))
+}
@@ -0,0 +1,107 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var p2repos = map[string][]*artifactRepository{
+	"test1-project-000": []*artifactRepository{
+		&artifactRepository{Name: "projects/test1-project-000/locations/us-central1/repositories/web", Format: "DOCKER"},
+		&artifactRepository{Name: "projects/test1-project-000/locations/europe-west1/repositories/batch", Format: "DOCKER"},
+		&artifactRepository{Name: "projects/test1-project-000/locations/us-central1/repositories/jars", Format: "MAVEN"},
+	},
+}
+
+var p2images = map[string][]*artifactImage{
+	"projects/test1-project-000/locations/us-central1/repositories/web": []*artifactImage{
+		&artifactImage{Name: "web@sha256:1", UploadTime: "2018-03-01T10:00:00.123456Z"},
+		&artifactImage{Name: "web@sha256:2", UploadTime: "2018-03-09T10:00:00Z"},
+	},
+	"projects/test1-project-000/locations/europe-west1/repositories/batch": []*artifactImage{
+		&artifactImage{Name: "batch@sha256:1", UploadTime: "2017-11-20T08:00:00Z"},
+	},
+}
+
+type TestArtifactsTaker struct{}
+
+func (tt *TestArtifactsTaker) ListRepositories(ctx context.Context, rp *reportProject) ([]*artifactRepository, error) {
+	return p2repos[rp.gcpProject.ProjectId], nil
+}
+
+func (tt *TestArtifactsTaker) ListImages(ctx context.Context, repo *artifactRepository) ([]*artifactImage, error) {
+	return p2images[repo.Name], nil
+}
+
+func TestIngestRepositories(t *testing.T) {
+	viper.Set("imageWithin", 30*24*time.Hour)
+	defer viper.Set("imageWithin", 0)
+	now := time.Date(2018, 3, 10, 0, 0, 0, 0, time.UTC)
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestRepositories(context.Background(), &TestArtifactsTaker{}, now); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.repositories) != 3 {
+		t.Fatalf("expected 3 repositories, have %d", len(project.repositories))
+	}
+	batch, jars, web := project.repositories[0], project.repositories[1], project.repositories[2]
+	if !batch.stale || batch.images != 1 {
+		t.Errorf("expected batch to hold 1 image and be stale, have %d and %t", batch.images, batch.stale)
+	}
+	if web.stale || web.images != 2 || !web.newestPush.Equal(time.Date(2018, 3, 9, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected web to hold 2 images, the newest pushed 2018-03-09, have %d pushed %v", web.images, web.newestPush)
+	}
+	if jars.docker || jars.stale {
+		t.Errorf("expected the maven repository to go unchecked")
+	}
+	if len(project.findings) != 1 || project.findings[0].resource != "repository/batch" {
+		t.Errorf("expected a finding for batch alone, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	if strings.Count(out, "STALE") != 1 || !strings.Contains(out, "europe-west1") {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
+
+func TestArtifactsGCPPaging(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/projects/test1-project-000/locations":
+			fmt.Fprint(w, `{"locations": [{"locationId": "us-central1"}]}`)
+		case r.URL.Path == "/projects/test1-project-000/locations/us-central1/repositories" && r.URL.Query().Get("pageToken") == "":
+			fmt.Fprint(w, `{"repositories": [{"name": "projects/test1-project-000/locations/us-central1/repositories/web", "format": "DOCKER"}], "nextPageToken": "more"}`)
+		case r.URL.Path == "/projects/test1-project-000/locations/us-central1/repositories":
+			fmt.Fprint(w, `{"repositories": [{"name": "projects/test1-project-000/locations/us-central1/repositories/jars", "format": "MAVEN"}]}`)
+		default:
+			http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	taker := &TakerArtifactsGCP{client: server.Client(), endpoint: server.URL + "/"}
+	project := filterFixture(fpTT[0])[0]
+	repos, err := taker.ListRepositories(context.Background(), project)
+	if err != nil {
+		t.Fatalf("unexpected list error: %v", err)
+	}
+	if len(repos) != 2 || repos[1].Format != "MAVEN" {
+		t.Errorf("expected both pages of repositories, have %v", repos)
+	}
+	if _, err := taker.ListImages(context.Background(), &artifactRepository{Name: "projects/other"}); err == nil {
+		t.Errorf("expected an API error to be returned")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// reportJUnit is set by --format junit
+var reportJUnit bool
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// checkedResources names the resources of the project whose checks pass or
+// fail on their own, as findings name them: the Cloud SQL instances, the
+// Datastore kinds of backup buckets, missing or not, and the certificates.
+func (p *reportProject) checkedResources() []string {
+	var resources []string
+	check := func(resource string) {
+		if !containsString(resources, resource) {
+			resources = append(resources, resource)
+		}
+	}
+	for _, instance := range p.sqlInstances {
+		check("sql/" + instance.gcpSQLInstance.Name)
+	}
+	for _, bucket := range p.backupBuckets {
+		if !bucket.isBackup {
+			continue
+		}
+		for _, kind := range bucket.sortedKinds() {
+			check("kind/" + kind)
+		}
+	}
+	for _, kind := range p.missingKinds {
+		check("kind/" + kind)
+	}
+	for _, cert := range p.certificates {
+		check("certificate/" + cert.gcpCertificate.Id)
+	}
+	return resources
+}
+
+// newJUnitTestSuite makes a test suite of the project, with a test case for
+// each resource checked and each other resource with a finding. A case fails
+// on findings of warn severity or above, info findings being left out.
+func newJUnitTestSuite(p *reportProject) junitTestSuite {
+	suite := junitTestSuite{Name: p.gcpProject.ProjectId, Timestamp: displayNow().UTC().Format("2006-01-02T15:04:05")}
+	resources := p.checkedResources()
+	failures := make(map[string][]finding)
+	for _, f := range p.findings {
+		if f.severity < severityWarn {
+			continue
+		}
+		if !containsString(resources, f.resource) {
+			resources = append(resources, f.resource)
+		}
+		failures[f.resource] = append(failures[f.resource], f)
+	}
+	for _, resource := range resources {
+		testCase := junitTestCase{Name: resource, Classname: p.gcpProject.ProjectId}
+		if found := failures[resource]; len(found) > 0 {
+			highest := found[0].severity
+			var problems []string
+			for _, f := range found {
+				if f.severity > highest {
+					highest = f.severity
+				}
+				problems = append(problems, f.problem)
+			}
+			testCase.Failure = &junitFailure{Message: found[0].problem, Type: highest.String(), Text: strings.Join(problems, "\n")}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Tests = len(suite.Cases)
+	return suite
+}
+
+// writeJUnitReport writes the projects as a JUnit XML report, a test suite
+// for each, for CI to gate on
+func writeJUnitReport(w io.Writer, projects []*reportProject) error {
+	report := junitTestSuites{Name: "gcp-reports"}
+	for _, project := range projects {
+		suite := newJUnitTestSuite(project)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Suites = append(report.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,61 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	storage "google.golang.org/api/storage/v1"
+)
+
+func TestJUnitReport(t *testing.T) {
+	now := time.Now()
+
+	project := &reportProject{gcpProject: gcpP[0], component: "c1", env: "e1"}
+	instance := &reportSQLInstance{
+		gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "db"},
+		backupRuns:     []*reportBackupRun{{gcpBackupRun: &sqladmin.BackupRun{Status: "SUCCESSFUL", EndTime: now.Add(-72 * time.Hour).Format(time.RFC3339)}}},
+		project:        project,
+	}
+	instance.CheckFreshness(now, 24*time.Hour)
+	project.sqlInstances = []*reportSQLInstance{instance}
+	bucket := &reportBucket{gcpBucket: &storage.Bucket{Name: "b1"}, isBackup: true, project: project}
+	for kind, age := range map[string]time.Duration{"Widget": time.Hour, "Gadget": 48 * time.Hour} {
+		bucket.objects = append(bucket.objects, &reportObject{gcpObject: &storage.Object{}, kind: kind, updateTime: now.Add(-age)})
+	}
+	bucket.UpdateKindMap()
+	bucket.CheckFreshness(now, 24*time.Hour)
+	project.backupBuckets = []*reportBucket{bucket}
+	project.addFinding(severityInfo, "object/b1/stray", "is not under backup/<component>/<env>/")
+
+	var out bytes.Buffer
+	if err := setupFormat(formatJUnit, &out); err != nil {
+		t.Fatalf("unexpected format error: %v", err)
+	}
+	defer setupFormat(formatText, nil)
+	if !renderReport(&out, []*reportProject{project, goldenProject()}) {
+		t.Fatalf("junit format should take over the output")
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("cannot parse the JUnit report: %v\n%s", err, out.String())
+	}
+	if report.Tests != 3 || report.Failures != 2 || len(report.Suites) != 2 {
+		t.Fatalf("expected 3 cases, 2 failing, in 2 suites, have %d, %d in %d:\n%s", report.Tests, report.Failures, len(report.Suites), out.String())
+	}
+	failed := make(map[string]string)
+	for _, testCase := range report.Suites[0].Cases {
+		if testCase.Failure != nil {
+			failed[testCase.Name] = testCase.Failure.Type
+		}
+	}
+	if len(failed) != 2 || failed["sql/db"] != "warn" || failed["kind/Gadget"] != "warn" {
+		t.Errorf("expected the stale sql instance and kind to fail, have %v", failed)
+	}
+}
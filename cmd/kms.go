@@ -0,0 +1,212 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+)
+
+// kmsCmd represents the kms command
+var kmsCmd = &cobra.Command{
+	Use:   "kms",
+	Short: "Audit the rotation of the Cloud KMS keys available from given credentials",
+	Long: `Show the Cloud KMS key rings of each project visible from the account used,
+and their crypto keys with purpose, rotation period and next rotation time.
+Symmetric keys, the ones usable as customer-managed encryption keys, which
+have no rotation schedule are flagged as NO-ROTATION, and those whose next
+rotation time has passed as OVERDUE. For instance:
+    gcp-reports kms our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, cloudkms.CloudPlatformScope, func(clients *clients) (projectIngester, error) {
+			kmsService, err := cloudkms.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish cloud kms service: %v", err)
+			}
+			taker := &TakerKMSGCP{kmsService: kmsService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestKeyRings(ctx, taker, time.Now())
+			}, nil
+		})
+	},
+}
+
+type TakerKMS interface {
+	ListKeyRings(context.Context, *reportProject) ([]*cloudkms.KeyRing, error)
+	ListCryptoKeys(context.Context, *reportKeyRing) ([]*cloudkms.CryptoKey, error)
+}
+
+type TakerKMSGCP struct {
+	kmsService *cloudkms.Service
+}
+
+type reportKeyRing struct {
+	gcpKeyRing *cloudkms.KeyRing
+	cryptoKeys []*reportCryptoKey
+
+	project *reportProject // parent
+}
+
+func (rk *reportKeyRing) Parent() reportNode {
+	return rk.project
+}
+
+type reportCryptoKey struct {
+	gcpCryptoKey *cloudkms.CryptoKey
+	// noRotation is set for a symmetric key without a rotation schedule
+	noRotation bool
+	// overdue is set when the key's next rotation time has passed
+	overdue bool
+
+	keyRing *reportKeyRing // parent
+}
+
+// ListKeyRings gathers the key rings of the project in every location
+func (taker *TakerKMSGCP) ListKeyRings(ctx context.Context, project *reportProject) (keyRings []*cloudkms.KeyRing, err error) {
+	var locations []string
+	err = doWithRetry(ctx, func() error {
+		locations = nil
+		return taker.kmsService.Projects.Locations.List("projects/"+project.gcpProject.ProjectId).Pages(ctx, func(page *cloudkms.ListLocationsResponse) error {
+			for _, location := range page.Locations {
+				locations = append(locations, location.Name)
+			}
+			return nil
+		})
+	})
+	for _, location := range locations {
+		if err != nil {
+			return
+		}
+		var locationKeyRings []*cloudkms.KeyRing
+		err = doWithRetry(ctx, func() error {
+			locationKeyRings = nil
+			return taker.kmsService.Projects.Locations.KeyRings.List(location).Pages(ctx, func(page *cloudkms.ListKeyRingsResponse) error {
+				locationKeyRings = append(locationKeyRings, page.KeyRings...)
+				return nil
+			})
+		})
+		keyRings = append(keyRings, locationKeyRings...)
+	}
+	return
+}
+
+// ListCryptoKeys gathers the crypto keys of the key ring
+func (taker *TakerKMSGCP) ListCryptoKeys(ctx context.Context, keyRing *reportKeyRing) (cryptoKeys []*cloudkms.CryptoKey, err error) {
+	err = doWithRetry(ctx, func() error {
+		cryptoKeys = nil
+		return taker.kmsService.Projects.Locations.KeyRings.CryptoKeys.List(keyRing.gcpKeyRing.Name).Pages(ctx, func(page *cloudkms.ListCryptoKeysResponse) error {
+			cryptoKeys = append(cryptoKeys, page.CryptoKeys...)
+			return nil
+		})
+	})
+	return
+}
+
+// IngestKeyRings ingests the project's key rings ordered by name, each with
+// its crypto keys ordered by name, and marks the symmetric keys which do not
+// rotate or whose next rotation is overdue as of now.
+func (p *reportProject) IngestKeyRings(ctx context.Context, taker TakerKMS, now time.Time) error {
+	var gcpKeyRings []*cloudkms.KeyRing
+	listErr := limited(func() (err error) {
+		gcpKeyRings, err = taker.ListKeyRings(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+	for _, gcpKeyRing := range gcpKeyRings {
+		p.keyRings = append(p.keyRings, &reportKeyRing{gcpKeyRing: gcpKeyRing, project: p})
+	}
+	sort.Slice(p.keyRings, func(i, j int) bool { return p.keyRings[i].gcpKeyRing.Name < p.keyRings[j].gcpKeyRing.Name })
+
+	for _, keyRing := range p.keyRings {
+		var gcpCryptoKeys []*cloudkms.CryptoKey
+		keyErr := limited(func() (err error) {
+			gcpCryptoKeys, err = taker.ListCryptoKeys(ctx, keyRing)
+			return
+		})
+		if keyErr != nil {
+			return keyErr
+		}
+		for _, gcpCryptoKey := range gcpCryptoKeys {
+			keyRing.cryptoKeys = append(keyRing.cryptoKeys, &reportCryptoKey{gcpCryptoKey: gcpCryptoKey, keyRing: keyRing})
+		}
+		sort.Slice(keyRing.cryptoKeys, func(i, j int) bool {
+			return keyRing.cryptoKeys[i].gcpCryptoKey.Name < keyRing.cryptoKeys[j].gcpCryptoKey.Name
+		})
+		for _, key := range keyRing.cryptoKeys {
+			key.CheckRotation(now)
+		}
+	}
+	return nil
+}
+
+// CheckRotation marks a symmetric key without a rotation schedule, or whose
+// next rotation time is before now. Asymmetric keys cannot rotate on their own
+// and are left alone.
+func (rk *reportCryptoKey) CheckRotation(now time.Time) {
+	gcpCryptoKey := rk.gcpCryptoKey
+	if gcpCryptoKey.Purpose != "ENCRYPT_DECRYPT" {
+		return
+	}
+	resource := "kms/" + path.Base(rk.keyRing.gcpKeyRing.Name) + "/" + path.Base(gcpCryptoKey.Name)
+	project := rk.keyRing.project
+	if gcpCryptoKey.RotationPeriod == "" || gcpCryptoKey.NextRotationTime == "" {
+		rk.noRotation = true
+		project.addFinding(severityWarn, resource, "has no rotation schedule")
+		return
+	}
+	next, err := time.Parse(time.RFC3339, gcpCryptoKey.NextRotationTime)
+	if err != nil {
+		logger.Warnf("cannot parse next rotation time of key %s: %v", gcpCryptoKey.Name, err)
+		return
+	}
+	if next.Before(now) {
+		rk.overdue = true
+		project.addFinding(severityWarn, resource, fmt.Sprintf("rotation was due %s", formatTime(next)))
+	}
+}
+
+// rotationPeriod shows how often the key rotates, eg 90d, or - when it does not
+func (rk *reportCryptoKey) rotationPeriod() string {
+	period, err := time.ParseDuration(rk.gcpCryptoKey.RotationPeriod)
+	if err != nil {
+		return supplyDefault(rk.gcpCryptoKey.RotationPeriod, "-")
+	}
+	return humanDuration(period)
+}
+
+// displayKeyRings shows the crypto keys of the key rings as a table
+func displayKeyRings(w io.Writer, keyRings []*reportKeyRing) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  KEY RING\tLOCATION\tCRYPTO KEY\tPURPOSE\tROTATION PERIOD\tNEXT ROTATION\tSTATUS")
+	for _, keyRing := range keyRings {
+		for _, key := range keyRing.cryptoKeys {
+			gcpCryptoKey := key.gcpCryptoKey
+			status := healthy("OK")
+			switch {
+			case key.noRotation:
+				status = alert("NO-ROTATION")
+			case key.overdue:
+				status = alert("OVERDUE")
+			}
+			fmt.Fprintf(table, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n", path.Base(keyRing.gcpKeyRing.Name), resourceLocation(keyRing.gcpKeyRing.Name),
+				path.Base(gcpCryptoKey.Name), gcpCryptoKey.Purpose, key.rotationPeriod(),
+				supplyDefault(formatTimestamp(gcpCryptoKey.NextRotationTime), "-"), status)
+		}
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(kmsCmd)
+}
@@ -0,0 +1,86 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	cloudkms "google.golang.org/api/cloudkms/v1"
+)
+
+const keyRingName = "projects/test1-project-000/locations/europe-west1/keyRings/cmek"
+
+var p2keyRings = map[string][]*cloudkms.KeyRing{
+	"test1-project-000": []*cloudkms.KeyRing{
+		&cloudkms.KeyRing{Name: keyRingName},
+	},
+}
+
+var keyRing2cryptoKeys = map[string][]*cloudkms.CryptoKey{
+	keyRingName: []*cloudkms.CryptoKey{
+		&cloudkms.CryptoKey{Name: keyRingName + "/cryptoKeys/storage", Purpose: "ENCRYPT_DECRYPT",
+			RotationPeriod: "7776000s", NextRotationTime: "2017-07-01T00:00:00Z"},
+		&cloudkms.CryptoKey{Name: keyRingName + "/cryptoKeys/bigquery", Purpose: "ENCRYPT_DECRYPT"},
+		&cloudkms.CryptoKey{Name: keyRingName + "/cryptoKeys/datastore", Purpose: "ENCRYPT_DECRYPT",
+			RotationPeriod: "2592000s", NextRotationTime: "2017-05-01T00:00:00Z"},
+		&cloudkms.CryptoKey{Name: keyRingName + "/cryptoKeys/signing", Purpose: "ASYMMETRIC_SIGN"},
+	},
+}
+
+type TestKMSTaker struct{}
+
+func (tt *TestKMSTaker) ListKeyRings(ctx context.Context, rp *reportProject) ([]*cloudkms.KeyRing, error) {
+	return p2keyRings[rp.gcpProject.ProjectId], nil
+}
+
+func (tt *TestKMSTaker) ListCryptoKeys(ctx context.Context, rk *reportKeyRing) ([]*cloudkms.CryptoKey, error) {
+	return keyRing2cryptoKeys[rk.gcpKeyRing.Name], nil
+}
+
+func TestIngestKeyRings(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestKeyRings(context.Background(), &TestKMSTaker{}, now); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.keyRings) != 1 || len(project.keyRings[0].cryptoKeys) != 4 {
+		t.Fatalf("expected one key ring with four keys, have %v", project.keyRings)
+	}
+	for _, key := range project.keyRings[0].cryptoKeys {
+		name := key.gcpCryptoKey.Name[strings.LastIndex(key.gcpCryptoKey.Name, "/")+1:]
+		if expected := name == "bigquery"; key.noRotation != expected {
+			t.Errorf("key %s: expected no rotation %t", name, expected)
+		}
+		if expected := name == "datastore"; key.overdue != expected {
+			t.Errorf("key %s: expected overdue %t", name, expected)
+		}
+	}
+	if len(project.findings) != 2 || project.findings[0].resource != "kms/cmek/bigquery" || project.findings[1].resource != "kms/cmek/datastore" {
+		t.Errorf("expected the non-rotating and overdue keys flagged, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"project[test1-project-000]: 1 KMS key rings", "europe-west1", "90d", "NO-ROTATION", "OVERDUE", "ASYMMETRIC_SIGN"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected display to contain %q, have:\n%s", expected, out)
+		}
+	}
+}
+
+func TestCheckRotationScheduled(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+	project := filterFixture(fpTT[0])[0]
+	keyRing := &reportKeyRing{gcpKeyRing: &cloudkms.KeyRing{Name: keyRingName}, project: project}
+	key := &reportCryptoKey{gcpCryptoKey: keyRing2cryptoKeys[keyRingName][0], keyRing: keyRing}
+	key.CheckRotation(now)
+	if key.noRotation || key.overdue || len(project.findings) != 0 {
+		t.Errorf("expected a key rotating on schedule to pass, have %t %t %v", key.noRotation, key.overdue, project.findings)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+type logLevel int
+
+const (
+	levelError logLevel = iota
+	levelWarn
+	levelInfo
+	levelDebug
+)
+
+var logLevelNames = []string{"error", "warn", "info", "debug"}
+
+// leveledLogger writes diagnostics at or above its level, leaving stdout
+// to the report itself.
+type leveledLogger struct {
+	level logLevel
+	out   *log.Logger
+}
+
+var logger = &leveledLogger{level: levelInfo, out: log.New(os.Stderr, "", log.LstdFlags)}
+
+// parseLogLevel maps a --log-level name onto its level
+func parseLogLevel(name string) (logLevel, error) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return logLevel(level), nil
+		}
+	}
+	return levelInfo, fmt.Errorf("unknown log level %q: expecting one of %s", name, strings.Join(logLevelNames, ", "))
+}
+
+func (l *leveledLogger) logf(level logLevel, format string, args ...interface{}) {
+	if level > l.level {
+		return
+	}
+	l.out.Printf(strings.ToUpper(logLevelNames[level])+": "+format, args...)
+}
+
+func (l *leveledLogger) Debugf(format string, args ...interface{}) {
+	l.logf(levelDebug, format, args...)
+}
+
+func (l *leveledLogger) Infof(format string, args ...interface{}) {
+	l.logf(levelInfo, format, args...)
+}
+
+func (l *leveledLogger) Warnf(format string, args ...interface{}) {
+	l.logf(levelWarn, format, args...)
+}
+
+func (l *leveledLogger) Errorf(format string, args ...interface{}) {
+	l.logf(levelError, format, args...)
+}
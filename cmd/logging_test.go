@@ -0,0 +1,45 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogLevelSuppressesDebug(t *testing.T) {
+	saved := logger
+	defer func() { logger = saved }()
+
+	for _, tt := range []struct {
+		level       string
+		expectDebug bool
+	}{
+		{"error", false},
+		{"debug", true},
+	} {
+		level, err := parseLogLevel(tt.level)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s: %v", tt.level, err)
+		}
+		var buf bytes.Buffer
+		logger = &leveledLogger{level: level, out: log.New(&buf, "", 0)}
+		ingestErr := ingestProjects(context.Background(), filterFixture(fpTT[0])[:1], func(ctx context.Context, project *reportProject) error {
+			return nil
+		})
+		if ingestErr != nil {
+			t.Fatalf("unexpected ingest error: %v", ingestErr)
+		}
+		if have := strings.Contains(buf.String(), "project pre:"); have != tt.expectDebug {
+			t.Errorf("level %s: expected debug lines[%t], have:\n%s", tt.level, tt.expectDebug, buf.String())
+		}
+	}
+
+	if _, err := parseLogLevel("chatty"); err == nil {
+		t.Errorf("expected an error for an unknown level")
+	}
+}
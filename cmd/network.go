@@ -0,0 +1,247 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// networkCmd represents the network command
+var networkCmd = &cobra.Command{
+	Use:   "network",
+	Short: "Show the VPC networks and subnets available from given credentials",
+	Long: `Show the VPC networks of each project visible from the account used, and
+their subnets with region, primary and secondary ranges, and whether private
+Google access is enabled. Subnets with a range overlapping one of the
+--reserved-range CIDRs, set aside for on-premises or peered networks, are
+flagged as OVERLAP. For instance:
+    gcp-reports network --reserved-range 10.128.0.0/9,192.168.0.0/16 our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		reserved, err := reservedRanges()
+		if err != nil {
+			return err
+		}
+		return runReport(args, compute.ComputeReadonlyScope, func(clients *clients) (projectIngester, error) {
+			computeService, err := compute.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish compute engine service: %v", err)
+			}
+			taker := &TakerNetworkGCP{computeService: computeService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestNetworks(ctx, taker, reserved)
+			}, nil
+		})
+	},
+}
+
+type TakerNetwork interface {
+	ListNetworks(context.Context, *reportProject) ([]*compute.Network, error)
+	ListSubnetworks(context.Context, *reportProject) ([]*compute.Subnetwork, error)
+}
+
+type TakerNetworkGCP struct {
+	computeService *compute.Service
+}
+
+type reportNetwork struct {
+	gcpNetwork *compute.Network
+	subnets    []*reportSubnet
+
+	project *reportProject // parent
+}
+
+func (rn *reportNetwork) Parent() reportNode {
+	return rn.project
+}
+
+type reportSubnet struct {
+	gcpSubnet *compute.Subnetwork
+	// overlaps are the reserved ranges which any of the subnet's ranges overlap
+	overlaps []string
+
+	network *reportNetwork // parent
+}
+
+// reservedRanges parses the configured --reserved-range CIDRs
+func reservedRanges() ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, value := range getStringSlice("reservedRanges") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid reserved range %q: expecting a CIDR such as 10.0.0.0/8", value)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+// ListNetworks gathers the VPC networks of the project
+func (taker *TakerNetworkGCP) ListNetworks(ctx context.Context, project *reportProject) (networks []*compute.Network, err error) {
+	err = doWithRetry(ctx, func() error {
+		networks = nil
+		return taker.computeService.Networks.List(project.gcpProject.ProjectId).Pages(ctx, func(page *compute.NetworkList) error {
+			networks = append(networks, page.Items...)
+			return nil
+		})
+	})
+	return
+}
+
+// ListSubnetworks gathers the subnets of the project across all its regions
+func (taker *TakerNetworkGCP) ListSubnetworks(ctx context.Context, project *reportProject) (subnets []*compute.Subnetwork, err error) {
+	err = doWithRetry(ctx, func() error {
+		subnets = nil
+		return taker.computeService.Subnetworks.AggregatedList(project.gcpProject.ProjectId).Pages(ctx, func(page *compute.SubnetworkAggregatedList) error {
+			for _, scoped := range page.Items {
+				subnets = append(subnets, scoped.Subnetworks...)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// IngestNetworks ingests the project's networks ordered by name, each with
+// its subnets ordered by region and name, and marks the subnets with a range
+// overlapping any of reserved.
+func (p *reportProject) IngestNetworks(ctx context.Context, taker TakerNetwork, reserved []*net.IPNet) error {
+	var gcpNetworks []*compute.Network
+	var gcpSubnets []*compute.Subnetwork
+	listErr := limited(func() (err error) {
+		gcpNetworks, err = taker.ListNetworks(ctx, p)
+		return
+	})
+	if listErr == nil {
+		listErr = limited(func() (err error) {
+			gcpSubnets, err = taker.ListSubnetworks(ctx, p)
+			return
+		})
+	}
+	if listErr != nil {
+		return listErr
+	}
+
+	bySelfLink := make(map[string]*reportNetwork)
+	for _, gcpNetwork := range gcpNetworks {
+		network := &reportNetwork{gcpNetwork: gcpNetwork, project: p}
+		bySelfLink[gcpNetwork.SelfLink] = network
+		p.networks = append(p.networks, network)
+	}
+	sort.Slice(p.networks, func(i, j int) bool { return p.networks[i].gcpNetwork.Name < p.networks[j].gcpNetwork.Name })
+
+	for _, gcpSubnet := range gcpSubnets {
+		network, ok := bySelfLink[gcpSubnet.Network]
+		if !ok {
+			continue
+		}
+		subnet := &reportSubnet{gcpSubnet: gcpSubnet, network: network}
+		for _, cidr := range subnet.ranges() {
+			for _, reservedRange := range reserved {
+				if cidrOverlaps(cidr, reservedRange) {
+					subnet.overlaps = append(subnet.overlaps, reservedRange.String())
+					p.addFinding(severityWarn, "subnet/"+path.Base(gcpSubnet.Region)+"/"+gcpSubnet.Name,
+						fmt.Sprintf("range %s overlaps reserved range %s", cidr, reservedRange))
+				}
+			}
+		}
+		network.subnets = append(network.subnets, subnet)
+	}
+	for _, network := range p.networks {
+		sort.Slice(network.subnets, func(i, j int) bool {
+			si, sj := network.subnets[i].gcpSubnet, network.subnets[j].gcpSubnet
+			if si.Region != sj.Region {
+				return path.Base(si.Region) < path.Base(sj.Region)
+			}
+			return si.Name < sj.Name
+		})
+	}
+	return nil
+}
+
+// ranges are the subnet's primary range followed by its secondary ones
+func (rs *reportSubnet) ranges() []string {
+	ranges := []string{rs.gcpSubnet.IpCidrRange}
+	for _, secondary := range rs.gcpSubnet.SecondaryIpRanges {
+		ranges = append(ranges, secondary.IpCidrRange)
+	}
+	return ranges
+}
+
+// cidrOverlaps reports whether the CIDR shares any address with ipNet; one
+// that does not parse overlaps nothing
+func cidrOverlaps(cidr string, ipNet *net.IPNet) bool {
+	_, other, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	return other.Contains(ipNet.IP) || ipNet.Contains(other.IP)
+}
+
+// mode is how the network's subnets come to be: auto, custom or legacy
+func (rn *reportNetwork) mode() string {
+	switch {
+	case rn.gcpNetwork.IPv4Range != "":
+		return "legacy"
+	case rn.gcpNetwork.AutoCreateSubnetworks:
+		return "auto"
+	}
+	return "custom"
+}
+
+// displayNetworks shows the networks as a table, followed by a table of
+// their subnets
+func displayNetworks(w io.Writer, networks []*reportNetwork) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  NETWORK\tMODE\tROUTING\tSUBNETS")
+	subnets := 0
+	for _, network := range networks {
+		routing := "-"
+		if network.gcpNetwork.RoutingConfig != nil {
+			routing = supplyDefault(network.gcpNetwork.RoutingConfig.RoutingMode, "-")
+		}
+		subnets += len(network.subnets)
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%d\n", network.gcpNetwork.Name, network.mode(), routing, len(network.subnets))
+	}
+	table.Flush()
+
+	if subnets == 0 {
+		return
+	}
+	table = newTable(w)
+	fmt.Fprintln(table, "  NETWORK\tSUBNET\tREGION\tRANGE\tSECONDARY\tPRIVATE GOOGLE ACCESS\tSTATUS")
+	for _, network := range networks {
+		for _, subnet := range network.subnets {
+			gcpSubnet := subnet.gcpSubnet
+			secondary := "-"
+			if ranges := subnet.ranges(); len(ranges) > 1 {
+				secondary = strings.Join(ranges[1:], ",")
+			}
+			status := healthy("OK")
+			if len(subnet.overlaps) > 0 {
+				status = fmt.Sprintf("%s %s", alert("OVERLAP"), strings.Join(subnet.overlaps, ","))
+			}
+			fmt.Fprintf(table, "  %s\t%s\t%s\t%s\t%s\t%t\t%s\n", network.gcpNetwork.Name, gcpSubnet.Name, path.Base(gcpSubnet.Region),
+				gcpSubnet.IpCidrRange, secondary, gcpSubnet.PrivateIpGoogleAccess, status)
+		}
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(networkCmd)
+
+	networkCmd.Flags().StringSlice("reserved-range", []string{}, "comma-separated CIDRs which subnet ranges should not overlap, eg ranges used on premises")
+	viper.BindPFlag("reservedRanges", networkCmd.Flags().Lookup("reserved-range"))
+}
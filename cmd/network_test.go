@@ -0,0 +1,108 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	compute "google.golang.org/api/compute/v1"
+)
+
+const networkPrefix = "https://www.googleapis.com/compute/v1/projects/test1-project-000/"
+
+var p2networks = map[string][]*compute.Network{
+	"test1-project-000": []*compute.Network{
+		&compute.Network{Name: "prod", SelfLink: networkPrefix + "global/networks/prod", RoutingConfig: &compute.NetworkRoutingConfig{RoutingMode: "GLOBAL"}},
+		&compute.Network{Name: "default", SelfLink: networkPrefix + "global/networks/default", AutoCreateSubnetworks: true},
+	},
+}
+
+var p2subnets = map[string][]*compute.Subnetwork{
+	"test1-project-000": []*compute.Subnetwork{
+		&compute.Subnetwork{Name: "prod-eu", Network: networkPrefix + "global/networks/prod", Region: networkPrefix + "regions/europe-west1",
+			IpCidrRange: "172.16.0.0/20", PrivateIpGoogleAccess: true,
+			SecondaryIpRanges: []*compute.SubnetworkSecondaryRange{{RangeName: "pods", IpCidrRange: "10.200.0.0/14"}}},
+		&compute.Subnetwork{Name: "prod-us", Network: networkPrefix + "global/networks/prod", Region: networkPrefix + "regions/us-central1",
+			IpCidrRange: "172.16.16.0/20"},
+		&compute.Subnetwork{Name: "default", Network: networkPrefix + "global/networks/default", Region: networkPrefix + "regions/us-central1",
+			IpCidrRange: "10.128.0.0/20"},
+		&compute.Subnetwork{Name: "orphan", Network: networkPrefix + "global/networks/gone", Region: networkPrefix + "regions/us-central1",
+			IpCidrRange: "10.0.0.0/8"},
+	},
+}
+
+type TestNetworkTaker struct{}
+
+func (tt *TestNetworkTaker) ListNetworks(ctx context.Context, rp *reportProject) ([]*compute.Network, error) {
+	return p2networks[rp.gcpProject.ProjectId], nil
+}
+
+func (tt *TestNetworkTaker) ListSubnetworks(ctx context.Context, rp *reportProject) ([]*compute.Subnetwork, error) {
+	return p2subnets[rp.gcpProject.ProjectId], nil
+}
+
+func TestIngestNetworks(t *testing.T) {
+	viper.Set("reservedRanges", []string{"10.128.0.0/9", "192.168.0.0/16"})
+	defer viper.Set("reservedRanges", []string{})
+	reserved, err := reservedRanges()
+	if err != nil {
+		t.Fatalf("unexpected range error: %v", err)
+	}
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestNetworks(context.Background(), &TestNetworkTaker{}, reserved); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.networks) != 2 {
+		t.Fatalf("expected 2 networks, have %d", len(project.networks))
+	}
+	defaultNetwork, prod := project.networks[0], project.networks[1]
+	if len(defaultNetwork.subnets) != 1 || len(prod.subnets) != 2 {
+		t.Fatalf("expected the subnets grouped by network, the orphan left out, have %d and %d", len(defaultNetwork.subnets), len(prod.subnets))
+	}
+	if eu, us := prod.subnets[0], prod.subnets[1]; !reflect.DeepEqual(eu.overlaps, []string{"10.128.0.0/9"}) || len(us.overlaps) != 0 {
+		t.Errorf("expected the pods range of prod-eu alone to overlap in prod, have %v and %v", eu.overlaps, us.overlaps)
+	}
+	if overlaps := defaultNetwork.subnets[0].overlaps; !reflect.DeepEqual(overlaps, []string{"10.128.0.0/9"}) {
+		t.Errorf("expected the default subnet to overlap, have %v", overlaps)
+	}
+	if len(project.findings) != 2 {
+		t.Errorf("expected a finding per overlap, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"project[test1-project-000]: 2 VPC networks", "auto", "GLOBAL", "10.200.0.0/14", "OVERLAP 10.128.0.0/9"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected display to contain %q, have:\n%s", expected, out)
+		}
+	}
+}
+
+func TestCIDROverlaps(t *testing.T) {
+	_, reserved, _ := net.ParseCIDR("10.128.0.0/9")
+	for cidr, expected := range map[string]bool{
+		"10.128.0.0/20": true,
+		"10.0.0.0/8":    true,
+		"10.127.0.0/16": false,
+		"172.16.0.0/12": false,
+		"not-a-range":   false,
+	} {
+		if have := cidrOverlaps(cidr, reserved); have != expected {
+			t.Errorf("%s: expected overlap %t, have %t", cidr, expected, have)
+		}
+	}
+
+	viper.Set("reservedRanges", []string{"10.0.0.0"})
+	defer viper.Set("reservedRanges", []string{})
+	if _, err := reservedRanges(); err == nil {
+		t.Error("expected an address without a prefix length to be refused")
+	}
+}
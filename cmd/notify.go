@@ -0,0 +1,107 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// notifyTimeout bounds each notification POST
+const notifyTimeout = 30 * time.Second
+
+// notifiedFinding is one finding in a --notify-webhook payload
+type notifiedFinding struct {
+	Project  string `json:"project"`
+	Severity string `json:"severity"`
+	Resource string `json:"resource"`
+	Problem  string `json:"problem"`
+}
+
+// notifiableFindings are the projects' findings of warn severity or above,
+// those worth interrupting someone for
+func notifiableFindings(projects []*reportProject) (notified []notifiedFinding) {
+	for _, p := range projects {
+		p.findingsMu.Lock()
+		for _, f := range p.findings {
+			if f.severity >= severityWarn {
+				notified = append(notified, notifiedFinding{Project: p.gcpProject.ProjectId,
+					Severity: f.severity.String(), Resource: f.resource, Problem: f.problem})
+			}
+		}
+		p.findingsMu.Unlock()
+	}
+	return
+}
+
+// notificationText lists the findings one per line, below a headline
+func notificationText(findings []notifiedFinding, projects int) string {
+	var text bytes.Buffer
+	fmt.Fprintf(&text, "gcp-reports: %d findings across %d projects scanned", len(findings), projects)
+	for _, f := range findings {
+		fmt.Fprintf(&text, "\n• [%s] %s %s: %s", f.Severity, f.Project, f.Resource, f.Problem)
+	}
+	return text.String()
+}
+
+// notify posts the projects' findings to the --notify-slack and
+// --notify-webhook URLs given. Nothing is sent without a finding to report,
+// unless --notify-always is set. Slack is sent its incoming-webhook message;
+// a generic webhook also receives the findings as structured JSON.
+func notify(client *http.Client, projects []*reportProject) error {
+	slackURL, webhookURL := viper.GetString("notifySlack"), viper.GetString("notifyWebhook")
+	if slackURL == "" && webhookURL == "" {
+		return nil
+	}
+	findings := notifiableFindings(projects)
+	if len(findings) == 0 && !viper.GetBool("notifyAlways") {
+		return nil
+	}
+	text := notificationText(findings, len(projects))
+	if slackURL != "" {
+		if err := postJSON(client, slackURL, map[string]string{"text": text}); err != nil {
+			return fmt.Errorf("cannot notify slack: %v", err)
+		}
+	}
+	if webhookURL != "" {
+		payload := struct {
+			Text     string            `json:"text"`
+			Findings []notifiedFinding `json:"findings"`
+		}{text, findings}
+		if err := postJSON(client, webhookURL, payload); err != nil {
+			return fmt.Errorf("cannot notify webhook: %v", err)
+		}
+	}
+	return nil
+}
+
+// postJSON posts payload as JSON to address, expecting a 2xx response
+func postJSON(client *http.Client, address string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", req.URL.Host, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestNotify(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+	defer viper.Set("notifySlack", "")
+	defer viper.Set("notifyWebhook", "")
+	defer viper.Set("notifyAlways", false)
+
+	healthy := &reportProject{gcpProject: gcpP[0]}
+	stale := &reportProject{gcpProject: gcpP[1]}
+	stale.addFinding(severityInfo, "topic/audit", "has no subscriptions")
+	stale.addFinding(severityWarn, "kind/orders", "newest backup is 30h0m0s old, older than 24h0m0s")
+
+	viper.Set("notifySlack", server.URL+"/slack")
+	viper.Set("notifyWebhook", server.URL+"/webhook")
+	if err := notify(server.Client(), []*reportProject{healthy}); err != nil || len(bodies) != 0 {
+		t.Fatalf("expected nothing sent without findings, have %v (%v)", bodies, err)
+	}
+	if err := notify(server.Client(), []*reportProject{healthy, stale}); err != nil {
+		t.Fatalf("unexpected notify error: %v", err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("expected a slack and a webhook post, have %v", bodies)
+	}
+	var slack map[string]string
+	if err := json.Unmarshal([]byte(bodies[0]), &slack); err != nil || !strings.Contains(slack["text"], gcpP[1].ProjectId+" kind/orders") {
+		t.Errorf("expected the stale kind in the slack message, have %s", bodies[0])
+	}
+	if strings.Contains(bodies[0], "topic/audit") {
+		t.Errorf("expected info findings to be left out, have %s", bodies[0])
+	}
+	var webhook struct {
+		Findings []notifiedFinding `json:"findings"`
+	}
+	if err := json.Unmarshal([]byte(bodies[1]), &webhook); err != nil || len(webhook.Findings) != 1 ||
+		webhook.Findings[0].Resource != "kind/orders" || webhook.Findings[0].Severity != "warn" {
+		t.Errorf("unexpected webhook payload %s", bodies[1])
+	}
+
+	bodies = nil
+	viper.Set("notifyAlways", true)
+	viper.Set("notifyWebhook", "")
+	if err := notify(server.Client(), []*reportProject{healthy}); err != nil || len(bodies) != 1 {
+		t.Errorf("expected --notify-always to send without findings, have %v (%v)", bodies, err)
+	}
+
+	failing := httptest.NewServer(http.NotFoundHandler())
+	defer failing.Close()
+	viper.Set("notifySlack", failing.URL)
+	if err := notify(failing.Client(), []*reportProject{stale}); err == nil {
+		t.Errorf("expected a failing webhook to be reported")
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// progress redraws an "N/M projects done" line as projects finish ingesting,
+// so that a scan of many projects does not look hung. A nil progress shows
+// nothing.
+type progress struct {
+	w     io.Writer
+	done  int
+	total int
+}
+
+// newProgress is the progress of total projects written to w, or nil when w
+// is not a terminal or --quiet is set: redraws only make sense to a person
+// watching, and the report itself goes to stdout regardless.
+func newProgress(w io.Writer, total int, terminal bool) *progress {
+	if !terminal || viper.GetBool("quiet") || total == 0 {
+		return nil
+	}
+	p := &progress{w: w, total: total}
+	p.draw()
+	return p
+}
+
+// stderrProgress is the progress of total projects shown on stderr
+func stderrProgress(total int) *progress {
+	return newProgress(os.Stderr, total, isTerminal(os.Stderr))
+}
+
+func (p *progress) draw() {
+	fmt.Fprintf(p.w, "\r%d/%d projects done", p.done, p.total)
+}
+
+// Done counts one more project as done
+func (p *progress) Done() {
+	if p == nil {
+		return
+	}
+	p.done++
+	p.draw()
+}
+
+// Finish clears the progress line, leaving the terminal as it was
+func (p *progress) Finish() {
+	if p == nil {
+		return
+	}
+	fmt.Fprint(p.w, "\r\033[K")
+}
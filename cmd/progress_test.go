@@ -0,0 +1,47 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestProgress(t *testing.T) {
+	var out bytes.Buffer
+	bar := newProgress(&out, 2, true)
+	bar.Done()
+	bar.Done()
+	bar.Finish()
+	if expected := "\r0/2 projects done\r1/2 projects done\r2/2 projects done\r\033[K"; out.String() != expected {
+		t.Errorf("expected %q on a terminal, have %q", expected, out.String())
+	}
+}
+
+func TestProgressDisabled(t *testing.T) {
+	defer viper.Set("quiet", viper.GetBool("quiet"))
+	var out bytes.Buffer
+	for _, tt := range []struct {
+		terminal, quiet bool
+	}{
+		{false, false},
+		{true, true},
+	} {
+		viper.Set("quiet", tt.quiet)
+		bar := newProgress(&out, 2, tt.terminal)
+		bar.Done()
+		bar.Finish()
+		if bar != nil || out.Len() != 0 {
+			t.Errorf("terminal %t quiet %t: expected no progress, have %q", tt.terminal, tt.quiet, out.String())
+		}
+	}
+
+	// go test's stderr is not a terminal unless run interactively
+	if !isTerminal(os.Stderr) && stderrProgress(2) != nil {
+		t.Error("expected no progress on a stderr that is not a terminal")
+	}
+}
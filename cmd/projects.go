@@ -0,0 +1,279 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	crmv2 "google.golang.org/api/cloudresourcemanager/v2"
+)
+
+// selectProjects lists the projects visible through client and narrows them
+// down by the given components, those of --components, and the
+// project-selection flags. The scopes are the command's defaults, as given to
+// newClient for client.
+func selectProjects(ctx context.Context, client *http.Client, components []string, scopes ...string) ([]*reportProject, error) {
+	selector, selErr := newProjectSelector(mergeComponents(components, componentFilter), envFilter, labelFilter, labelPatternFilter)
+	if selErr != nil {
+		return nil, selErr
+	}
+	exclusion, exclErr := newProjectExclusion(excludeProjectFilter, excludeLabelFilter)
+	if exclErr != nil {
+		return nil, exclErr
+	}
+	listFilter := strings.TrimSpace(viper.GetString("projectListFilter"))
+	if filterErr := checkProjectFilter(listFilter); filterErr != nil {
+		return nil, filterErr
+	}
+
+	cloudResourceManagerService, err := cloudresourcemanager.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("cannot establish cloud resource-manager service: %v", err)
+	}
+	if effective, err := effectiveScopes(scopes...); err == nil {
+		scopes = effective
+	}
+	root, rootErr := hierarchyRoot()
+	if rootErr != nil {
+		return nil, rootErr
+	}
+	var gcpProjects []*cloudresourcemanager.Project
+	var projErr error
+	if root != "" {
+		crmv2Service, err := crmv2.New(client)
+		if err != nil {
+			return nil, fmt.Errorf("cannot establish cloud resource-manager v2 service: %v", err)
+		}
+		taker := &TakerHierarchyGCP{crmService: cloudResourceManagerService, crmv2Service: crmv2Service, filter: listFilter}
+		gcpProjects, projErr = listHierarchyProjects(ctx, taker, root)
+	} else {
+		taker := &TakerProjectsGCP{crmService: cloudResourceManagerService}
+		gcpProjects, projErr = listProjects(ctx, taker, listFilter, projectCacheKey(listFilter, scopes...))
+	}
+	if projErr != nil {
+		return nil, fmt.Errorf("cannot list projects at Google Cloud: %v", projErr)
+	}
+	warnMissingLabelKeys(gcpProjects, selector)
+	return limitProjects(exclusion.apply(filterProjects(gcpProjects, projectFilter, selector)))
+}
+
+// mergeComponents combines the components given as arguments with those of
+// --components, leaving out repeats
+func mergeComponents(args []string, flagged []string) []string {
+	var components []string
+	for _, component := range append(append([]string{}, args...), flagged...) {
+		if component != "" && !containsString(components, component) {
+			components = append(components, component)
+		}
+	}
+	return components
+}
+
+// limitProjects guards against filters selecting far more projects than meant,
+// say an empty one scanning a whole organization: with --max-projects, more
+// projects than that are an error, or with --truncate-projects are cut down to
+// the first ones.
+func limitProjects(projects []*reportProject) ([]*reportProject, error) {
+	max := viper.GetInt("maxProjects")
+	switch {
+	case max < 0:
+		return nil, errors.New("--max-projects must not be negative")
+	case max == 0 || len(projects) <= max:
+		return projects, nil
+	case viper.GetBool("truncateProjects"):
+		logger.Warnf("%d projects selected, scanning only the first %d allowed by --max-projects", len(projects), max)
+		return projects[:max], nil
+	}
+	return nil, fmt.Errorf("%d projects selected, more than the %d allowed by --max-projects: narrow the filters, raise the limit or give --truncate-projects",
+		len(projects), max)
+}
+
+type TakerProjects interface {
+	// ListProjects lists the projects visible to the credentials in use,
+	// narrowed down server-side by filter unless it is ""
+	ListProjects(ctx context.Context, filter string) ([]*cloudresourcemanager.Project, error)
+}
+
+type TakerProjectsGCP struct {
+	crmService *cloudresourcemanager.Service
+}
+
+// ListProjects lists every page of the projects matching filter
+func (taker *TakerProjectsGCP) ListProjects(ctx context.Context, filter string) (projects []*cloudresourcemanager.Project, err error) {
+	err = doWithRetry(ctx, func() error {
+		projects = nil
+		call := taker.crmService.Projects.List()
+		if filter != "" {
+			call = call.Filter(filter)
+		}
+		return call.Pages(ctx, func(page *cloudresourcemanager.ListProjectsResponse) error {
+			projects = append(projects, page.Projects...)
+			return nil
+		})
+	})
+	return
+}
+
+// projectFilterFields are the project fields a --project-filter term may
+// match on, besides labels.<key>
+var projectFilterFields = []string{"name", "id", "lifecycleState", "parent.type", "parent.id"}
+
+// checkProjectFilter rejects a --project-filter that is plainly not a
+// resource-manager filter: each term, bar the AND, OR and NOT operators, must
+// be field:value or field=value on a known project field or a label. The
+// value itself is left for the server to judge.
+func checkProjectFilter(filter string) error {
+	for _, term := range filterTerms(filter) {
+		if term == "AND" || term == "OR" || term == "NOT" {
+			continue
+		}
+		i := strings.IndexAny(term, ":=")
+		if i <= 0 || i == len(term)-1 {
+			return fmt.Errorf("bad --project-filter term %q: expecting field:value or field=value, eg labels.env:prod", term)
+		}
+		field := term[:i]
+		if !containsString(projectFilterFields, field) && !(strings.HasPrefix(field, "labels.") && len(field) > len("labels.")) {
+			return fmt.Errorf("bad --project-filter term %q: unknown field %q, expecting one of %v or labels.<key>", term, field, projectFilterFields)
+		}
+	}
+	return nil
+}
+
+// filterTerms splits a filter at white space outside double quotes
+func filterTerms(filter string) []string {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+	for _, r := range filter {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms
+}
+
+// listProjects fetches the projects visible to the credentials in use that
+// match filter. When project caching is enabled the list is served from, and
+// saved to, a cache file named for cacheKey.
+func listProjects(ctx context.Context, taker TakerProjects, filter, cacheKey string) ([]*cloudresourcemanager.Project, error) {
+	ttl := viper.GetDuration("cacheProjects")
+	useCache := ttl > 0 && !viper.GetBool("noCache")
+	cachePath := filepath.Join(projectCacheDir(), cacheKey+".json")
+	if useCache {
+		if projects, ok := readProjectCache(cachePath, ttl); ok {
+			return projects, nil
+		}
+	}
+
+	projects, projErr := taker.ListProjects(ctx, filter)
+	if projErr != nil {
+		return nil, projErr
+	}
+
+	if useCache {
+		if cacheErr := writeProjectCache(cachePath, projects); cacheErr != nil {
+			logger.Warnf("cannot cache project list: %v", cacheErr)
+		}
+	}
+	return projects, nil
+}
+
+// projectCacheDir is where cached project lists live
+func projectCacheDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "gcp-reports")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".cache", "gcp-reports")
+}
+
+// projectCacheKey distinguishes cache files by the account and scopes in use,
+// so that different credentials never share a cached project list, and by the
+// --project-filter narrowing the list.
+func projectCacheKey(filter string, scopes ...string) string {
+	key := credentialsIdentity() + "\x00" + strings.Join(scopes, " ")
+	if filter != "" {
+		key += "\x00" + filter
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// credentialsIdentity names the account behind the --credentials key file or
+// the application default credentials, looking in the same places
+// google.FindDefaultCredentials does.
+func credentialsIdentity() string {
+	filename := viper.GetString("credentials")
+	if filename == "" {
+		filename = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if filename == "" {
+		filename = filepath.Join(os.Getenv("HOME"), ".config", "gcloud", "application_default_credentials.json")
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		// metadata server credentials, most likely
+		return "default"
+	}
+	var id struct {
+		ClientEmail string `json:"client_email"`
+		ClientID    string `json:"client_id"`
+	}
+	if json.Unmarshal(b, &id) != nil {
+		return filename
+	}
+	return id.ClientEmail + id.ClientID
+}
+
+// readProjectCache returns the cached projects if the cache file is younger than ttl
+func readProjectCache(path string, ttl time.Duration) ([]*cloudresourcemanager.Project, bool) {
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > ttl {
+		return nil, false
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var projects []*cloudresourcemanager.Project
+	if json.Unmarshal(b, &projects) != nil {
+		return nil, false
+	}
+	return projects, true
+}
+
+func writeProjectCache(path string, projects []*cloudresourcemanager.Project) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(projects)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
@@ -0,0 +1,182 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+func TestProjectCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcp-reports-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "projects.json")
+
+	if _, ok := readProjectCache(path, time.Hour); ok {
+		t.Errorf("expected a cache miss before anything is written")
+	}
+	if err := writeProjectCache(path, gcpP); err != nil {
+		t.Fatalf("cannot write cache: %v", err)
+	}
+	projects, ok := readProjectCache(path, time.Hour)
+	if !ok {
+		t.Fatalf("expected a cache hit after writing")
+	}
+	if len(projects) != len(gcpP) || projects[6].ProjectId != gcpP[6].ProjectId || projects[6].Labels["env"] != "e1" {
+		t.Errorf("cached projects did not round-trip: %v", idProj(filterProjects(projects, nil, &projectSelector{})))
+	}
+
+	stale := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := readProjectCache(path, time.Hour); ok {
+		t.Errorf("expected an expired cache to miss")
+	}
+}
+
+func TestProjectCacheKey(t *testing.T) {
+	if projectCacheKey("", "scope-a") == projectCacheKey("", "scope-b") {
+		t.Errorf("expected different scopes to have different cache keys")
+	}
+	if projectCacheKey("", "scope-a") != projectCacheKey("", "scope-a") {
+		t.Errorf("expected the cache key to be stable")
+	}
+}
+
+func TestLimitProjects(t *testing.T) {
+	defer viper.Set("maxProjects", viper.GetInt("maxProjects"))
+	defer viper.Set("truncateProjects", viper.GetBool("truncateProjects"))
+	projects := filterProjects(gcpP, nil, &projectSelector{})
+
+	viper.Set("maxProjects", 0)
+	if limited, err := limitProjects(projects); err != nil || len(limited) != len(projects) {
+		t.Errorf("expected no limit by default, have %d projects, %v", len(limited), err)
+	}
+
+	viper.Set("maxProjects", 3)
+	viper.Set("truncateProjects", false)
+	if _, err := limitProjects(projects); err == nil || !strings.Contains(err.Error(), "more than the 3 allowed") {
+		t.Errorf("expected too many projects refused, have %v", err)
+	}
+
+	viper.Set("truncateProjects", true)
+	limited, err := limitProjects(projects)
+	if err != nil || len(limited) != 3 || limited[0] != projects[0] || limited[2] != projects[2] {
+		t.Errorf("expected the first three projects kept, have %v, %v", idProj(limited), err)
+	}
+
+	viper.Set("maxProjects", len(projects))
+	viper.Set("truncateProjects", false)
+	if limited, err := limitProjects(projects); err != nil || len(limited) != len(projects) {
+		t.Errorf("expected projects up to the limit allowed, have %d projects, %v", len(limited), err)
+	}
+
+	viper.Set("maxProjects", -1)
+	if _, err := limitProjects(projects); err == nil {
+		t.Error("expected a negative limit refused")
+	}
+}
+
+func TestMergeComponents(t *testing.T) {
+	components := mergeComponents([]string{"c1"}, []string{"c2", "c1"})
+	if !reflect.DeepEqual(components, []string{"c1", "c2"}) {
+		t.Errorf("expected argument and flag components combined, have %v", components)
+	}
+	if components := mergeComponents(nil, []string{"c2"}); !reflect.DeepEqual(components, []string{"c2"}) {
+		t.Errorf("expected the flag components alone without arguments, have %v", components)
+	}
+
+	viper.Set("envKey", "env")
+	viper.Set("componentKey", "component")
+	selector, _ := newProjectSelector(components, nil, nil, nil)
+	selected := idProj(filterProjects(gcpP, nil, selector))
+	expected := []string{"test1-project-000", "test1-project-001", "test1-project-003", "test1-project-004",
+		"test1-project-006", "test1-project-007", "test1-project-008"}
+	if !reflect.DeepEqual(selected, expected) {
+		t.Errorf("expected the projects of either component, have %v", selected)
+	}
+}
+
+func TestEnvFlag(t *testing.T) {
+	defer viper.Set("credentials", "")
+	defer RootCmd.SetArgs(nil)
+	defer func() { envFilter = nil }()
+
+	viper.Set("envKey", "env")
+	viper.Set("componentKey", "component")
+	viper.Set("credentials", filepath.Join(os.TempDir(), "gcp-reports-missing-key.json"))
+	for _, command := range []string{"apps", "backups"} {
+		envFilter = nil
+		RootCmd.SetArgs([]string{command, "-e", "e1", "--env-filter", "e2"})
+		RootCmd.Execute()
+		if !reflect.DeepEqual(envFilter, []string{"e1", "e2"}) {
+			t.Errorf("%s: expected both -e and the older --env-filter to fill the env filter, have %v", command, envFilter)
+		}
+		selector, _ := newProjectSelector(nil, envFilter, nil, nil)
+		selected := idProj(filterProjects(gcpP, nil, selector))
+		expected := []string{"test1-project-000", "test1-project-002", "test1-project-006", "test1-project-007"}
+		if !reflect.DeepEqual(selected, expected) {
+			t.Errorf("%s: expected the projects of env e1 or e2, have %v", command, selected)
+		}
+	}
+
+	selector, _ := newProjectSelector(nil, nil, nil, nil)
+	if selected := filterProjects(gcpP, nil, selector); len(selected) != len(gcpP) {
+		t.Errorf("expected no env filter to report on all environments, have %v", idProj(selected))
+	}
+}
+
+type filterProjectsTaker struct {
+	filters []string
+}
+
+func (tt *filterProjectsTaker) ListProjects(ctx context.Context, filter string) ([]*cloudresourcemanager.Project, error) {
+	tt.filters = append(tt.filters, filter)
+	return gcpP[:2], nil
+}
+
+func TestProjectListFilter(t *testing.T) {
+	defer viper.Set("cacheProjects", viper.GetDuration("cacheProjects"))
+	viper.Set("cacheProjects", time.Duration(0))
+
+	taker := &filterProjectsTaker{}
+	projects, err := listProjects(context.Background(), taker, "labels.env:e1 lifecycleState:ACTIVE", "unused")
+	if err != nil {
+		t.Fatalf("cannot list projects: %v", err)
+	}
+	if !reflect.DeepEqual(taker.filters, []string{"labels.env:e1 lifecycleState:ACTIVE"}) {
+		t.Errorf("expected the filter to be passed on to the list call, have %q", taker.filters)
+	}
+	if len(projects) != 2 {
+		t.Errorf("expected the projects listed, have %d", len(projects))
+	}
+
+	if projectCacheKey("labels.env:e1", "scope-a") == projectCacheKey("", "scope-a") {
+		t.Errorf("expected a filter to have its own cache key")
+	}
+
+	for _, filter := range []string{"", "labels.env:prod", "name:how* AND labels.color=red", `name:"My Project"`, "NOT lifecycleState:DELETE_REQUESTED"} {
+		if err := checkProjectFilter(filter); err != nil {
+			t.Errorf("expected %q to be accepted, have %v", filter, err)
+		}
+	}
+	for _, filter := range []string{"prod", "labels.env:", ":prod", "labels.:x", "owner:me"} {
+		if err := checkProjectFilter(filter); err == nil {
+			t.Errorf("expected %q to be rejected", filter)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+// defaultMessageRetention is what Pub/Sub retains when a subscription sets nothing
+const defaultMessageRetention = 7 * 24 * time.Hour
+
+// pubsubCmd represents the pubsub command
+var pubsubCmd = &cobra.Command{
+	Use:   "pubsub",
+	Short: "Show Pub/Sub topics and subscriptions available from given credentials",
+	Long: `Show the Pub/Sub topics of each project visible from the account used,
+with their subscriptions' ack deadlines and message retention. Topics without
+any subscription are flagged as UNSUBSCRIBED, and subscriptions retaining
+messages for less than --min-retention (default 24h) as SHORT-RETENTION.
+For instance:
+    gcp-reports pubsub --min-retention 72h our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, pubsub.CloudPlatformScope, func(clients *clients) (projectIngester, error) {
+			pubsubService, err := pubsub.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish pubsub service: %v", err)
+			}
+			taker := &TakerPubSubGCP{pubsubService: pubsubService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestTopics(ctx, taker)
+			}, nil
+		})
+	},
+}
+
+type TakerPubSub interface {
+	ListTopics(context.Context, *reportProject) ([]*pubsub.Topic, error)
+	ListSubscriptions(context.Context, *reportProject) ([]*pubsub.Subscription, error)
+}
+
+type TakerPubSubGCP struct {
+	pubsubService *pubsub.Service
+}
+
+type reportTopic struct {
+	gcpTopic      *pubsub.Topic
+	subscriptions []*reportSubscription
+
+	project *reportProject // parent
+}
+
+type reportSubscription struct {
+	gcpSubscription *pubsub.Subscription
+	retention       time.Duration
+	shortRetention  bool
+}
+
+func (rt *reportTopic) Parent() reportNode {
+	return rt.project
+}
+
+// ListTopics gathers all the topics of the project
+func (taker *TakerPubSubGCP) ListTopics(ctx context.Context, project *reportProject) (topics []*pubsub.Topic, err error) {
+	err = doWithRetry(ctx, func() error {
+		topics = nil
+		return taker.pubsubService.Projects.Topics.List("projects/"+project.gcpProject.ProjectId).Pages(ctx,
+			func(page *pubsub.ListTopicsResponse) error {
+				topics = append(topics, page.Topics...)
+				return nil
+			})
+	})
+	return
+}
+
+// ListSubscriptions gathers all the subscriptions of the project, whatever their topic
+func (taker *TakerPubSubGCP) ListSubscriptions(ctx context.Context, project *reportProject) (subs []*pubsub.Subscription, err error) {
+	err = doWithRetry(ctx, func() error {
+		subs = nil
+		return taker.pubsubService.Projects.Subscriptions.List("projects/"+project.gcpProject.ProjectId).Pages(ctx,
+			func(page *pubsub.ListSubscriptionsResponse) error {
+				subs = append(subs, page.Subscriptions...)
+				return nil
+			})
+	})
+	return
+}
+
+// IngestTopics ingests the project's topics and hangs each subscription off
+// its topic. Subscriptions to topics in other projects are not reported.
+func (p *reportProject) IngestTopics(ctx context.Context, taker TakerPubSub) error {
+	var gcpTopics []*pubsub.Topic
+	var gcpSubs []*pubsub.Subscription
+	listErr := limited(func() (err error) {
+		gcpTopics, err = taker.ListTopics(ctx, p)
+		return
+	})
+	if listErr == nil {
+		listErr = limited(func() (err error) {
+			gcpSubs, err = taker.ListSubscriptions(ctx, p)
+			return
+		})
+	}
+	if listErr != nil {
+		return listErr
+	}
+
+	byName := make(map[string]*reportTopic)
+	for _, gcpTopic := range gcpTopics {
+		topic := &reportTopic{gcpTopic: gcpTopic, project: p}
+		byName[gcpTopic.Name] = topic
+		p.topics = append(p.topics, topic)
+	}
+	sort.Slice(p.topics, func(i, j int) bool { return p.topics[i].gcpTopic.Name < p.topics[j].gcpTopic.Name })
+
+	minRetention := viper.GetDuration("minRetention")
+	for _, gcpSub := range gcpSubs {
+		topic, ok := byName[gcpSub.Topic]
+		if !ok {
+			continue
+		}
+		sub := &reportSubscription{gcpSubscription: gcpSub, retention: defaultMessageRetention}
+		if gcpSub.MessageRetentionDuration != "" {
+			retention, parseErr := time.ParseDuration(gcpSub.MessageRetentionDuration)
+			if parseErr != nil {
+				logger.Warnf("cannot parse message retention of %s: %v", gcpSub.Name, parseErr)
+			} else {
+				sub.retention = retention
+			}
+		}
+		if sub.retention < minRetention {
+			sub.shortRetention = true
+			p.addFinding(severityWarn, "subscription/"+path.Base(gcpSub.Name),
+				fmt.Sprintf("retains messages for %v, less than %v", sub.retention, minRetention))
+		}
+		topic.subscriptions = append(topic.subscriptions, sub)
+	}
+	for _, topic := range p.topics {
+		if len(topic.subscriptions) == 0 {
+			p.addFinding(severityInfo, "topic/"+path.Base(topic.gcpTopic.Name), "has no subscriptions")
+		}
+	}
+	return nil
+}
+
+// Display shows the topic followed by one line per subscription
+func (rt *reportTopic) Display(w io.Writer) {
+	fmt.Fprintf(w, "  topic[%32s] subscriptions[%d]", path.Base(rt.gcpTopic.Name), len(rt.subscriptions))
+	if len(rt.subscriptions) == 0 {
+		fmt.Fprintf(w, " %s", alert("UNSUBSCRIBED"))
+	}
+	fmt.Fprintf(w, "\n")
+	for _, sub := range rt.subscriptions {
+		fmt.Fprintf(w, "    subscription[%32s] ack-deadline[%3ds] retention[%v]",
+			path.Base(sub.gcpSubscription.Name), sub.gcpSubscription.AckDeadlineSeconds, sub.retention)
+		if sub.shortRetention {
+			fmt.Fprintf(w, " %s", alert("SHORT-RETENTION"))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(pubsubCmd)
+
+	pubsubCmd.Flags().Duration("min-retention", 24*time.Hour, "flag subscriptions retaining messages for less than this")
+	viper.BindPFlag("minRetention", pubsubCmd.Flags().Lookup("min-retention"))
+}
@@ -0,0 +1,75 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+var p2topics = map[string][]*pubsub.Topic{
+	"test1-project-000": []*pubsub.Topic{
+		&pubsub.Topic{Name: "projects/test1-project-000/topics/orders"},
+		&pubsub.Topic{Name: "projects/test1-project-000/topics/audit"},
+	},
+}
+
+var p2subs = map[string][]*pubsub.Subscription{
+	"test1-project-000": []*pubsub.Subscription{
+		&pubsub.Subscription{Name: "projects/test1-project-000/subscriptions/billing", Topic: "projects/test1-project-000/topics/orders",
+			AckDeadlineSeconds: 10},
+		&pubsub.Subscription{Name: "projects/test1-project-000/subscriptions/shipping", Topic: "projects/test1-project-000/topics/orders",
+			AckDeadlineSeconds: 60, MessageRetentionDuration: "3600s"},
+		&pubsub.Subscription{Name: "projects/test1-project-000/subscriptions/elsewhere", Topic: "projects/other/topics/events"},
+	},
+}
+
+type TestPubSubTaker struct{}
+
+func (tt *TestPubSubTaker) ListTopics(ctx context.Context, rp *reportProject) ([]*pubsub.Topic, error) {
+	return p2topics[rp.gcpProject.ProjectId], nil
+}
+
+func (tt *TestPubSubTaker) ListSubscriptions(ctx context.Context, rp *reportProject) ([]*pubsub.Subscription, error) {
+	return p2subs[rp.gcpProject.ProjectId], nil
+}
+
+func TestIngestTopics(t *testing.T) {
+	viper.Set("minRetention", 24*time.Hour)
+	defer viper.Set("minRetention", 0)
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestTopics(context.Background(), &TestPubSubTaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.topics) != 2 {
+		t.Fatalf("expected 2 topics, have %d", len(project.topics))
+	}
+	audit, orders := project.topics[0], project.topics[1]
+	if len(audit.subscriptions) != 0 || len(orders.subscriptions) != 2 {
+		t.Fatalf("expected 0 audit and 2 orders subscriptions, have %d and %d",
+			len(audit.subscriptions), len(orders.subscriptions))
+	}
+	if orders.subscriptions[0].shortRetention || orders.subscriptions[0].retention != defaultMessageRetention {
+		t.Errorf("expected billing to keep the default retention")
+	}
+	if !orders.subscriptions[1].shortRetention {
+		t.Errorf("expected shipping to be flagged for short retention")
+	}
+	if len(project.findings) != 2 {
+		t.Errorf("expected 2 findings, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	if strings.Count(out, "UNSUBSCRIBED") != 1 || strings.Count(out, "SHORT-RETENTION") != 1 {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+const (
+	backupAgeMetricType = "custom.googleapis.com/gcp_reports/backup_age_seconds"
+	// maxSeriesPerRequest is the most time series one create call accepts
+	maxSeriesPerRequest = 200
+)
+
+type TakerMonitoring interface {
+	CreateTimeSeries(ctx context.Context, metricProject string, series []*monitoring.TimeSeries) error
+	ListAlertPolicies(context.Context, *reportProject) ([]*monitoring.AlertPolicy, error)
+}
+
+type TakerMonitoringGCP struct {
+	monitoringService *monitoring.Service
+}
+
+// CreateTimeSeries writes the series to the metric project, in as many calls as needed
+func (taker *TakerMonitoringGCP) CreateTimeSeries(ctx context.Context, metricProject string, series []*monitoring.TimeSeries) error {
+	for start := 0; start < len(series); start += maxSeriesPerRequest {
+		end := start + maxSeriesPerRequest
+		if end > len(series) {
+			end = len(series)
+		}
+		request := &monitoring.CreateTimeSeriesRequest{TimeSeries: series[start:end]}
+		if err := doWithRetry(ctx, func() error {
+			_, err := taker.monitoringService.Projects.TimeSeries.Create("projects/"+metricProject, request).Context(ctx).Do()
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupTimeSeries builds one gauge point per backed-up resource, giving the
+// age of its most recent backup. A kind backed up into several buckets is
+// reported once, with its freshest backup; resources never backed up have no
+// age and are left out.
+func backupTimeSeries(metricProject string, projects []*reportProject, now time.Time) []*monitoring.TimeSeries {
+	var series []*monitoring.TimeSeries
+	for _, project := range projects {
+		lastBackups := make(map[string]time.Time)
+		for _, instance := range project.sqlInstances {
+			if last, ok := instance.lastBackup(); ok {
+				lastBackups["sql/"+instance.gcpSQLInstance.Name] = last
+			}
+		}
+		for _, bucket := range project.backupBuckets {
+			for kind, objects := range bucket.kindMap {
+				resource := "kind/" + kind
+				if last, ok := lastBackups[resource]; !ok || objects[0].updateTime.After(last) {
+					lastBackups[resource] = objects[0].updateTime
+				}
+			}
+		}
+
+		var resources []string
+		for resource := range lastBackups {
+			resources = append(resources, resource)
+		}
+		sort.Strings(resources)
+		for _, resource := range resources {
+			age := now.Sub(lastBackups[resource]).Seconds()
+			series = append(series, &monitoring.TimeSeries{
+				Metric: &monitoring.Metric{
+					Type:   backupAgeMetricType,
+					Labels: map[string]string{"project": project.gcpProject.ProjectId, "resource": resource},
+				},
+				Resource: &monitoring.MonitoredResource{
+					Type:   "global",
+					Labels: map[string]string{"project_id": metricProject},
+				},
+				MetricKind: "GAUGE",
+				ValueType:  "DOUBLE",
+				Points: []*monitoring.Point{{
+					Interval: &monitoring.TimeInterval{EndTime: now.Format(time.RFC3339)},
+					Value:    &monitoring.TypedValue{DoubleValue: &age},
+				}},
+			})
+		}
+	}
+	return series
+}
+
+// pushBackupMetrics writes the backup age of every resource of projects to
+// Cloud Monitoring in metricProject
+func pushBackupMetrics(ctx context.Context, taker TakerMonitoring, metricProject string, projects []*reportProject, now time.Time) error {
+	series := backupTimeSeries(metricProject, projects, now)
+	if len(series) == 0 {
+		return nil
+	}
+	return taker.CreateTimeSeries(ctx, metricProject, series)
+}
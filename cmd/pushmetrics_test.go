@@ -0,0 +1,67 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	monitoring "google.golang.org/api/monitoring/v3"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	storage "google.golang.org/api/storage/v1"
+)
+
+type TestMonitoringTaker struct {
+	pushed map[string][]*monitoring.TimeSeries
+}
+
+func (tt *TestMonitoringTaker) CreateTimeSeries(ctx context.Context, metricProject string, series []*monitoring.TimeSeries) error {
+	tt.pushed[metricProject] = append(tt.pushed[metricProject], series...)
+	return nil
+}
+
+func TestBackupTimeSeries(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+	hourAgo, _ := time.Parse(time.RFC3339, "2017-06-02T11:00:00Z")
+	dayAgo, _ := time.Parse(time.RFC3339, "2017-06-01T12:00:00Z")
+
+	project := &reportProject{gcpProject: gcpP[0]}
+	project.sqlInstances = []*reportSQLInstance{{
+		gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "db"},
+		backupRuns:     []*reportBackupRun{{gcpBackupRun: &sqladmin.BackupRun{Status: "SUCCESSFUL", EndTime: "2017-06-02T11:00:00Z"}}},
+		project:        project,
+	}, {
+		gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "never-backed-up"},
+		project:        project,
+	}}
+	project.backupBuckets = []*reportBucket{
+		{gcpBucket: &storage.Bucket{Name: "b1"}, isBackup: true, project: project,
+			kindMap: map[string][]*reportObject{"Widget": {{updateTime: dayAgo}}}},
+		{gcpBucket: &storage.Bucket{Name: "b2"}, isBackup: true, project: project,
+			kindMap: map[string][]*reportObject{"Widget": {{updateTime: hourAgo}}}},
+	}
+
+	taker := &TestMonitoringTaker{pushed: make(map[string][]*monitoring.TimeSeries)}
+	if err := pushBackupMetrics(context.Background(), taker, "metrics-home", []*reportProject{project}, now); err != nil {
+		t.Fatalf("unexpected push error: %v", err)
+	}
+	series := taker.pushed["metrics-home"]
+	if len(series) != 2 {
+		t.Fatalf("expected 2 time series, have %d", len(series))
+	}
+	for index, resource := range []string{"kind/Widget", "sql/db"} {
+		ts := series[index]
+		if ts.Metric.Type != backupAgeMetricType || ts.Metric.Labels["resource"] != resource ||
+			ts.Metric.Labels["project"] != "test1-project-000" {
+			t.Errorf("series %d: unexpected metric %+v", index, ts.Metric)
+		}
+		if ts.Resource.Type != "global" || ts.Resource.Labels["project_id"] != "metrics-home" {
+			t.Errorf("series %d: unexpected resource %+v", index, ts.Resource)
+		}
+		if age := *ts.Points[0].Value.DoubleValue; age != 3600 {
+			t.Errorf("series %d: expected the freshest backup an hour old, have %v", index, age)
+		}
+	}
+}
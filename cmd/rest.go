@@ -0,0 +1,44 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// getJSON fetches address through client and decodes the JSON response into
+// v. It serves the APIs the vendored google.golang.org/api has no client for;
+// a failing status becomes a *googleapi.Error so doWithRetry can retry it.
+func getJSON(ctx context.Context, client *http.Client, address string, v interface{}) error {
+	req, err := http.NewRequest("GET", address, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// resourceLocation is the location segment of a resource name such as
+// projects/p/locations/us-central1/services/s
+func resourceLocation(name string) string {
+	parts := strings.Split(name, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "locations" {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
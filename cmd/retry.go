@@ -0,0 +1,49 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// retryBaseDelay is the wait before the first retry; each later retry waits
+// twice as long as the one before, plus some jitter.
+var retryBaseDelay = 500 * time.Millisecond
+
+// doWithRetry calls fn until it succeeds, fails with an error that is not
+// retryable, or has been retried 'maxRetries' times; ctx being done while it
+// waits to retry returns ctx's error. Each call, a retry or not, first waits
+// its turn under --qps. The time taken, retries included, is recorded in
+// apiTimings against the taker method calling it, and a final 403 is
+// returned as a permissionDeniedError naming that method.
+func doWithRetry(ctx context.Context, fn func() error) error {
+	call, start := callerName(1), time.Now()
+	defer func() { apiTimings.record(call, time.Since(start)) }()
+	maxRetries := viper.GetInt("maxRetries")
+	delay := retryBaseDelay
+	if err := waitRate(ctx); err != nil {
+		return err
+	}
+	err := fn()
+	for attempt := 0; attempt < maxRetries && isRetryable(err); attempt++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay + time.Duration(rand.Int63n(int64(delay)/2+1))):
+		}
+		delay *= 2
+		if err = waitRate(ctx); err != nil {
+			return err
+		}
+		err = fn()
+	}
+	if _, apiErr, denied := permissionDenied(err); denied {
+		return &permissionDeniedError{call: call, cause: apiErr}
+	}
+	return err
+}
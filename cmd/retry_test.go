@@ -0,0 +1,85 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/api/googleapi"
+)
+
+// flakyCall fails with the given errors in turn, then succeeds
+type flakyCall struct {
+	errs  []error
+	calls int
+}
+
+func (fc *flakyCall) do() (string, error) {
+	fc.calls++
+	if fc.calls <= len(fc.errs) {
+		return "", fc.errs[fc.calls-1]
+	}
+	return "listed", nil
+}
+
+func TestDoWithRetry(t *testing.T) {
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = 500 * time.Millisecond }()
+	viper.Set("maxRetries", 4)
+
+	unavailable := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	fc := &flakyCall{errs: []error{unavailable, unavailable}}
+	var result string
+	err := doWithRetry(context.Background(), func() (err error) {
+		result, err = fc.do()
+		return
+	})
+	if err != nil || result != "listed" {
+		t.Errorf("expected the third call to succeed, have result[%s] err[%v]", result, err)
+	}
+	if fc.calls != 3 {
+		t.Errorf("expected 3 calls, have %d", fc.calls)
+	}
+
+	fc = &flakyCall{errs: []error{&googleapi.Error{Code: http.StatusNotFound}}}
+	if err = doWithRetry(context.Background(), func() (err error) { _, err = fc.do(); return }); err == nil || fc.calls != 1 {
+		t.Errorf("expected a 404 to fail without retry, have %d calls and err[%v]", fc.calls, err)
+	}
+
+	fc = &flakyCall{errs: []error{errors.New("connection reset")}}
+	if err = doWithRetry(context.Background(), func() (err error) { _, err = fc.do(); return }); err == nil || fc.calls != 1 {
+		t.Errorf("expected a non-API error to fail without retry, have %d calls and err[%v]", fc.calls, err)
+	}
+
+	viper.Set("maxRetries", 1)
+	fc = &flakyCall{errs: []error{unavailable, unavailable}}
+	if err = doWithRetry(context.Background(), func() (err error) { _, err = fc.do(); return }); err != unavailable || fc.calls != 2 {
+		t.Errorf("expected to give up after one retry, have %d calls and err[%v]", fc.calls, err)
+	}
+	viper.Set("maxRetries", 4)
+}
+
+func TestDoWithRetryCancelled(t *testing.T) {
+	defer viper.Set("maxRetries", viper.GetInt("maxRetries"))
+	viper.Set("maxRetries", 4)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// the default 500ms backoff outlasts the context
+	unavailable := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	fc := &flakyCall{errs: []error{unavailable, unavailable}}
+	start := time.Now()
+	err := doWithRetry(ctx, func() (err error) { _, err = fc.do(); return })
+	if err != context.DeadlineExceeded || fc.calls != 1 {
+		t.Errorf("expected the wait to retry cut short by the deadline, have %d calls and err[%v]", fc.calls, err)
+	}
+	if waited := time.Since(start); waited > 250*time.Millisecond {
+		t.Errorf("expected the retry abandoned at the deadline, waited %v", waited)
+	}
+}
@@ -5,16 +5,32 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 var (
-	cfgFile   string
-	verbose   bool
-	envFilter []string
+	cfgFile            string
+	verbose            bool
+	envFilter          []string
+	componentFilter    []string
+	labelFilter        []string
+	labelPatternFilter []string
+	projectFilter      []string
+
+	excludeProjectFilter []string
+	excludeLabelFilter   []string
+
+	// logLevelErr holds a --log-level that did not parse, reported once the command runs
+	logLevelErr error
+	// configErr holds a --config file that could not be read, reported likewise
+	configErr error
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -27,15 +43,102 @@ examples and usage of using your application. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
+	// Execute reports the error a command returns
+	SilenceErrors: true,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// the command line has parsed, so later errors need no usage shown
+		cmd.SilenceUsage = true
+		// config init is how a missing --config file comes to exist
+		if configErr != nil && cmd.CommandPath() != "gcp-reports config init" {
+			return configErr
+		}
+		if logLevelErr != nil {
+			return logLevelErr
+		}
+		reportedProjects = nil
+		apiTimings.reset()
+		var err error
+		if exitCodes, err = parseExitCodes(getStringSlice("exitCodeOn")); err != nil {
+			return err
+		}
+		if err := checkTimeFormat(viper.GetString("timeFormat")); err != nil {
+			return err
+		}
+		if err := checkSort(viper.GetString("sort")); err != nil {
+			return err
+		}
+		if err := checkGroupBy(viper.GetString("groupBy")); err != nil {
+			return err
+		}
+		if err := setupColor(viper.GetString("color")); err != nil {
+			return err
+		}
+		if err := setRate(viper.GetFloat64("qps")); err != nil {
+			return err
+		}
+		if displayFields, err = parseFields(cmd.Name(), getStringSlice("fields")); err != nil {
+			return err
+		}
+		var out io.Writer = os.Stdout
+		reportOutput = nil
+		if outputFile := viper.GetString("output"); outputFile != "" {
+			file, err := os.Create(outputFile)
+			if err != nil {
+				return fmt.Errorf("cannot create output: %v", err)
+			}
+			out, reportOutput = file, file
+			if viper.GetString("color") == colorAuto {
+				// a file is no terminal to color for
+				setupColor(colorNever)
+			}
+		}
+		if err := setupTemplate(viper.GetString("template"), viper.GetString("templateString")); err != nil || reportTemplate != nil {
+			return err
+		}
+		return setupFormat(viper.GetString("format"), out)
+	},
+	// a command which completed shows, when verbose, the time spent in each
+	// API, and may still exit non-zero for its findings
+	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		if verbose || logger.level >= levelDebug {
+			apiTimings.Display(os.Stderr)
+		}
+		if code := exitCodeFor(reportedProjects, exitCodes); code != 0 {
+			highest, _ := highestSeverity(reportedProjects)
+			return &exitCodeError{code: code, severity: highest}
+		}
+		return nil
+	},
+}
+
+// flagAliases are the former names of flags, still accepted for the new ones
+var flagAliases = map[string]string{
+	"env-filter": "env",
+}
+
+// normalizeFlagName maps a flag name given to the one it is now known by
+func normalizeFlagName(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if alias, ok := flagAliases[name]; ok {
+		name = alias
+	}
+	return pflag.NormalizedName(name)
 }
 
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := RootCmd.Execute(); err != nil {
+	err := RootCmd.Execute()
+	if notifyErr := notify(http.DefaultClient, reportedProjects); notifyErr != nil {
+		logger.Errorf("%v", notifyErr)
+	}
+	if err != nil {
+		if exitErr, ok := err.(*exitCodeError); ok {
+			logger.Infof("%v", exitErr)
+			os.Exit(exitErr.code)
+		}
 		fmt.Println(err)
 		os.Exit(-1)
 	}
@@ -43,16 +146,87 @@ func Execute() {
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	RootCmd.SetGlobalNormalizationFunc(normalizeFlagName)
 
 	// Here you will define your flags and configuration settings.
 	// Cobra supports Persistent Flags, which, if defined here,
 	// will be global for your application.
 
-	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cloud-reports.yaml)")
+	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.gcp-reports.yaml); any setting may also come from a GCP_REPORTS_ environment variable, eg GCP_REPORTS_ENVKEY")
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	RootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "show lots of detail")
-	RootCmd.PersistentFlags().StringSliceVar(&envFilter, "env-filter", []string{}, "list of environment names to filter listings by")
+	RootCmd.PersistentFlags().BoolP("quiet", "q", false, "show only the problems in the text report, a line each and nothing when every resource is healthy, and hide the progress count on stderr")
+	viper.BindPFlag("quiet", RootCmd.PersistentFlags().Lookup("quiet"))
+	RootCmd.PersistentFlags().StringSliceVarP(&envFilter, "env", "e", []string{}, "environment name to filter listings by (repeatable or comma-separated); none reports on all environments")
+	RootCmd.PersistentFlags().StringSliceVar(&componentFilter, "components", []string{}, "comma-separated component names to filter listings by, in addition to any given as arguments")
+	RootCmd.PersistentFlags().StringArrayVar(&labelFilter, "label", []string{}, "project label selector key=value (repeatable); values of one key are alternatives, distinct keys must all match")
+	RootCmd.PersistentFlags().StringArrayVar(&labelPatternFilter, "label-regex", []string{}, "project label selector key=pattern (repeatable); the whole label value must match the regular expression")
+	RootCmd.PersistentFlags().StringArrayVar(&projectFilter, "project", []string{}, "project ID to report on (repeatable); label filters still apply to the projects named")
+	RootCmd.PersistentFlags().String("project-filter", "", "resource-manager filter narrowing the projects listed server-side before the other filters apply, eg 'labels.env:prod lifecycleState:ACTIVE'")
+	viper.BindPFlag("projectListFilter", RootCmd.PersistentFlags().Lookup("project-filter"))
+	RootCmd.PersistentFlags().StringArrayVar(&excludeProjectFilter, "exclude-project", []string{}, "project ID to leave out of the report (repeatable)")
+	RootCmd.PersistentFlags().StringArrayVar(&excludeLabelFilter, "exclude-label", []string{}, "leave out projects carrying this label key=value (repeatable)")
+	RootCmd.PersistentFlags().String("organization", "", "find projects anywhere under this organization ID, nested folders included")
+	viper.BindPFlag("organization", RootCmd.PersistentFlags().Lookup("organization"))
+	RootCmd.PersistentFlags().String("folder", "", "find projects anywhere under this folder ID, nested folders included")
+	viper.BindPFlag("folder", RootCmd.PersistentFlags().Lookup("folder"))
+	RootCmd.PersistentFlags().Bool("dry-run", false, "list the projects the filters select, with their env and component labels, without scanning them")
+	viper.BindPFlag("dryRun", RootCmd.PersistentFlags().Lookup("dry-run"))
+	RootCmd.PersistentFlags().Int("max-projects", 0, "refuse to scan more projects than this once filtered, guarding against a filter selecting too many (0 for no limit)")
+	viper.BindPFlag("maxProjects", RootCmd.PersistentFlags().Lookup("max-projects"))
+	RootCmd.PersistentFlags().Bool("truncate-projects", false, "scan the first --max-projects projects selected rather than refusing when more are")
+	viper.BindPFlag("truncateProjects", RootCmd.PersistentFlags().Lookup("truncate-projects"))
+	RootCmd.PersistentFlags().Int("concurrency", 8, "maximum number of GCP API calls in flight at once")
+	viper.BindPFlag("concurrency", RootCmd.PersistentFlags().Lookup("concurrency"))
+	RootCmd.PersistentFlags().Float64("qps", 0, "maximum number of GCP API requests made each second, retries included, to keep clear of quota errors (0 is no limit)")
+	viper.BindPFlag("qps", RootCmd.PersistentFlags().Lookup("qps"))
+	RootCmd.PersistentFlags().Duration("timeout", 5*time.Minute, "give up on ingestion that has not completed within this interval")
+	viper.BindPFlag("timeout", RootCmd.PersistentFlags().Lookup("timeout"))
+	RootCmd.PersistentFlags().Duration("per-project-timeout", 0, "fail a project whose ingestion has not completed within this interval, letting the others proceed (0 bounds projects by --timeout alone)")
+	viper.BindPFlag("perProjectTimeout", RootCmd.PersistentFlags().Lookup("per-project-timeout"))
+	RootCmd.PersistentFlags().Int("max-retries", 4, "how many times to retry a GCP API call failing with a transient error")
+	viper.BindPFlag("maxRetries", RootCmd.PersistentFlags().Lookup("max-retries"))
+	RootCmd.PersistentFlags().Duration("cache-projects", 0, "reuse the project list cached on disk if younger than this (0 disables caching)")
+	viper.BindPFlag("cacheProjects", RootCmd.PersistentFlags().Lookup("cache-projects"))
+	RootCmd.PersistentFlags().Bool("no-cache", false, "ignore any cached project list")
+	viper.BindPFlag("noCache", RootCmd.PersistentFlags().Lookup("no-cache"))
+	RootCmd.PersistentFlags().String("credentials", "", "service account key or user credentials JSON file to authenticate with instead of application-default credentials")
+	viper.BindPFlag("credentials", RootCmd.PersistentFlags().Lookup("credentials"))
+	RootCmd.PersistentFlags().StringSlice("scopes", []string{}, "comma-separated OAuth scopes to request (default is each command's read-only scope)")
+	viper.BindPFlag("scopes", RootCmd.PersistentFlags().Lookup("scopes"))
+	RootCmd.PersistentFlags().String("log-level", "info", "diagnostics written to stderr: error, warn, info or debug")
+	viper.BindPFlag("logLevel", RootCmd.PersistentFlags().Lookup("log-level"))
+	RootCmd.PersistentFlags().String("time-format", timeFormatRelative, "how times are displayed: relative (eg 3d ago), local, or rfc3339")
+	viper.BindPFlag("timeFormat", RootCmd.PersistentFlags().Lookup("time-format"))
+	RootCmd.PersistentFlags().String("sort", sortProject, "order of the projects reported, except as streamed by --format ndjson: project, env, component, or staleness for the most severe findings first")
+	viper.BindPFlag("sort", RootCmd.PersistentFlags().Lookup("sort"))
+	RootCmd.PersistentFlags().String("save-snapshot", "", "also write the report as --format ndjson to this file, whatever the format, for the diff command")
+	viper.BindPFlag("saveSnapshot", RootCmd.PersistentFlags().Lookup("save-snapshot"))
+	RootCmd.PersistentFlags().Bool("include-empty", false, "list the projects with nothing to report in the text report too, one line each")
+	viper.BindPFlag("includeEmpty", RootCmd.PersistentFlags().Lookup("include-empty"))
+	RootCmd.PersistentFlags().String("group-by", groupEnv, "show the projects of the text report under a header for each env or component, or none")
+	viper.BindPFlag("groupBy", RootCmd.PersistentFlags().Lookup("group-by"))
+	RootCmd.PersistentFlags().StringSlice("fields", []string{}, "comma-separated columns of the text report's tables to show, by lower-case header with dashes, eg version,runtime,instances (default shows all)")
+	viper.BindPFlag("fields", RootCmd.PersistentFlags().Lookup("fields"))
+	RootCmd.PersistentFlags().String("color", colorAuto, "highlight problems in the text report: auto (only on a terminal, unless NO_COLOR is set), always or never")
+	viper.BindPFlag("color", RootCmd.PersistentFlags().Lookup("color"))
+	RootCmd.PersistentFlags().String("format", formatText, "report output: text, ndjson for one JSON object per project written as each project completes, html for a single page, or junit for a JUnit XML report of the resources checked, for CI")
+	viper.BindPFlag("format", RootCmd.PersistentFlags().Lookup("format"))
+	RootCmd.PersistentFlags().String("template", "", "render the report through the Go text/template in this file; overrides --format")
+	viper.BindPFlag("template", RootCmd.PersistentFlags().Lookup("template"))
+	RootCmd.PersistentFlags().String("template-string", "", "render the report through this Go text/template; overrides --format")
+	viper.BindPFlag("templateString", RootCmd.PersistentFlags().Lookup("template-string"))
+	RootCmd.PersistentFlags().StringSlice("exit-code-on", []string{}, "comma-separated severity=code pairs, eg warn=2,critical=3: exit with the code of the highest severity reached by a finding")
+	viper.BindPFlag("exitCodeOn", RootCmd.PersistentFlags().Lookup("exit-code-on"))
+	RootCmd.PersistentFlags().String("notify-slack", "", "Slack incoming webhook URL to post warn and critical findings to once the report is done")
+	viper.BindPFlag("notifySlack", RootCmd.PersistentFlags().Lookup("notify-slack"))
+	RootCmd.PersistentFlags().String("notify-webhook", "", "URL to post warn and critical findings to as JSON once the report is done")
+	viper.BindPFlag("notifyWebhook", RootCmd.PersistentFlags().Lookup("notify-webhook"))
+	RootCmd.PersistentFlags().Bool("notify-always", false, "notify even when there are no findings to report")
+	viper.BindPFlag("notifyAlways", RootCmd.PersistentFlags().Lookup("notify-always"))
+	RootCmd.PersistentFlags().String("output", "", "file to write the report to, in whichever --format (default stdout)")
+	viper.BindPFlag("output", RootCmd.PersistentFlags().Lookup("output"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -63,10 +237,19 @@ func initConfig() {
 
 	viper.SetConfigName(".gcp-reports") // name of config file (without extension)
 	viper.AddConfigPath("$HOME")        // adding home directory as first search path
+	viper.SetEnvPrefix("GCP_REPORTS")   // eg GCP_REPORTS_TIMEOUT=10m
 	viper.AutomaticEnv()                // read in environment variables that match
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	// If a config file is found, read it in; the log level it may set is
+	// settled before anything is logged. Only a file named with --config
+	// has to exist.
+	readErr := viper.ReadInConfig()
+	configErr = nil
+	if readErr != nil && cfgFile != "" {
+		configErr = fmt.Errorf("cannot read config file %s: %v", cfgFile, readErr)
+	}
+	logger.level, logLevelErr = parseLogLevel(viper.GetString("logLevel"))
+	if readErr == nil {
+		logger.Infof("Using config file: %s", viper.ConfigFileUsed())
 	}
 }
@@ -0,0 +1,179 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+// cloudRunEndpoint is the base of the Cloud Run Admin REST API, which the
+// vendored google.golang.org/api has no client for
+const cloudRunEndpoint = "https://run.googleapis.com/v2/"
+
+// runInvokerRole is the role allowing a member to call a Cloud Run service
+const runInvokerRole = "roles/run.invoker"
+
+// runCmd represents the run command
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Show Cloud Run services available from given credentials",
+	Long: `Show the Cloud Run services of each project visible from the account used,
+with their region, latest ready revision and instance limits. Services which
+grant the invoker role to allUsers, so anyone may call them without
+authenticating, are flagged as PUBLIC. For instance:
+    gcp-reports run our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, cloudresourcemanager.CloudPlatformReadOnlyScope, func(clients *clients) (projectIngester, error) {
+			taker := &TakerCloudRunGCP{client: clients.http, endpoint: cloudRunEndpoint}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestRunServices(ctx, taker)
+			}, nil
+		})
+	},
+}
+
+// runService is the part of a Cloud Run service reported on
+type runService struct {
+	Name                string `json:"name"`
+	URI                 string `json:"uri"`
+	LatestReadyRevision string `json:"latestReadyRevision"`
+	Template            struct {
+		Scaling struct {
+			MinInstanceCount int64 `json:"minInstanceCount"`
+			MaxInstanceCount int64 `json:"maxInstanceCount"`
+		} `json:"scaling"`
+	} `json:"template"`
+}
+
+type TakerCloudRun interface {
+	ListServices(context.Context, *reportProject) ([]*runService, error)
+	GetIamPolicy(context.Context, *runService) (*cloudresourcemanager.Policy, error)
+}
+
+type TakerCloudRunGCP struct {
+	client   *http.Client
+	endpoint string
+}
+
+type reportRunService struct {
+	gcpService *runService
+	public     bool
+
+	project *reportProject // parent
+}
+
+func (rs *reportRunService) Parent() reportNode {
+	return rs.project
+}
+
+// ListServices gathers the services of the project in every region
+func (taker *TakerCloudRunGCP) ListServices(ctx context.Context, project *reportProject) (services []*runService, err error) {
+	err = doWithRetry(ctx, func() error {
+		services = nil
+		address := taker.endpoint + "projects/" + project.gcpProject.ProjectId + "/locations/-/services"
+		pageToken := ""
+		for {
+			var page struct {
+				Services      []*runService `json:"services"`
+				NextPageToken string        `json:"nextPageToken"`
+			}
+			pageAddress := address
+			if pageToken != "" {
+				pageAddress += "?pageToken=" + url.QueryEscape(pageToken)
+			}
+			if err := getJSON(ctx, taker.client, pageAddress, &page); err != nil {
+				return err
+			}
+			services = append(services, page.Services...)
+			if pageToken = page.NextPageToken; pageToken == "" {
+				return nil
+			}
+		}
+	})
+	return
+}
+
+// GetIamPolicy fetches who may do what with the service
+func (taker *TakerCloudRunGCP) GetIamPolicy(ctx context.Context, service *runService) (policy *cloudresourcemanager.Policy, err error) {
+	err = doWithRetry(ctx, func() error {
+		policy = &cloudresourcemanager.Policy{}
+		return getJSON(ctx, taker.client, taker.endpoint+service.Name+":getIamPolicy", policy)
+	})
+	return
+}
+
+// IngestRunServices ingests the project's services ordered by name, marking
+// those anyone may invoke without authenticating.
+func (p *reportProject) IngestRunServices(ctx context.Context, taker TakerCloudRun) error {
+	var gcpServices []*runService
+	listErr := limited(func() (err error) {
+		gcpServices, err = taker.ListServices(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+
+	for _, gcpService := range gcpServices {
+		var policy *cloudresourcemanager.Policy
+		policyErr := limited(func() (err error) {
+			policy, err = taker.GetIamPolicy(ctx, gcpService)
+			return
+		})
+		if policyErr != nil {
+			return policyErr
+		}
+		service := &reportRunService{gcpService: gcpService, project: p}
+		for _, binding := range policy.Bindings {
+			if binding.Role == runInvokerRole && containsString(binding.Members, "allUsers") {
+				service.public = true
+				p.addFinding(severityCritical, "run/"+path.Base(gcpService.Name), "allUsers may invoke it without authenticating")
+				break
+			}
+		}
+		p.runServices = append(p.runServices, service)
+	}
+	sort.Slice(p.runServices, func(i, j int) bool {
+		return p.runServices[i].gcpService.Name < p.runServices[j].gcpService.Name
+	})
+	return nil
+}
+
+// displayRunServices shows the services as a table
+func displayRunServices(w io.Writer, services []*reportRunService) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  RUN SERVICE\tREGION\tLATEST REVISION\tMIN\tMAX\tUNAUTHENTICATED\tSTATUS")
+	for _, service := range services {
+		scaling := service.gcpService.Template.Scaling
+		maxInstances := "-"
+		if scaling.MaxInstanceCount > 0 {
+			maxInstances = fmt.Sprint(scaling.MaxInstanceCount)
+		}
+		revision := "-"
+		if service.gcpService.LatestReadyRevision != "" {
+			revision = path.Base(service.gcpService.LatestReadyRevision)
+		}
+		unauthenticated, status := "no", healthy("OK")
+		if service.public {
+			unauthenticated, status = "yes", alert("PUBLIC")
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%d\t%s\t%s\t%s\n", path.Base(service.gcpService.Name), resourceLocation(service.gcpService.Name),
+			revision, scaling.MinInstanceCount, maxInstances, unauthenticated, status)
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(runCmd)
+}
@@ -0,0 +1,101 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+var p2runServices = map[string][]*runService{
+	"test1-project-000": []*runService{
+		&runService{Name: "projects/test1-project-000/locations/us-central1/services/storefront",
+			LatestReadyRevision: "projects/test1-project-000/locations/us-central1/services/storefront/revisions/storefront-00042"},
+		&runService{Name: "projects/test1-project-000/locations/europe-west1/services/billing"},
+	},
+}
+
+var p2runPolicies = map[string]*cloudresourcemanager.Policy{
+	"projects/test1-project-000/locations/us-central1/services/storefront": &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{
+			&cloudresourcemanager.Binding{Role: runInvokerRole, Members: []string{"allUsers"}},
+		},
+	},
+	"projects/test1-project-000/locations/europe-west1/services/billing": &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{
+			&cloudresourcemanager.Binding{Role: runInvokerRole, Members: []string{"serviceAccount:orders@test1-project-000.iam.gserviceaccount.com"}},
+			&cloudresourcemanager.Binding{Role: "roles/run.viewer", Members: []string{"allUsers"}},
+		},
+	},
+}
+
+type TestCloudRunTaker struct{}
+
+func (tt *TestCloudRunTaker) ListServices(ctx context.Context, rp *reportProject) ([]*runService, error) {
+	return p2runServices[rp.gcpProject.ProjectId], nil
+}
+
+func (tt *TestCloudRunTaker) GetIamPolicy(ctx context.Context, service *runService) (*cloudresourcemanager.Policy, error) {
+	return p2runPolicies[service.Name], nil
+}
+
+func TestIngestRunServices(t *testing.T) {
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestRunServices(context.Background(), &TestCloudRunTaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.runServices) != 2 {
+		t.Fatalf("expected 2 services, have %d", len(project.runServices))
+	}
+	billing, storefront := project.runServices[0], project.runServices[1]
+	if billing.public {
+		t.Errorf("expected billing, invokable by a service account alone, not to be public")
+	}
+	if !storefront.public {
+		t.Errorf("expected storefront, invokable by allUsers, to be public")
+	}
+	if len(project.findings) != 1 || project.findings[0].resource != "run/storefront" {
+		t.Errorf("expected a finding for storefront alone, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	if strings.Count(out, "PUBLIC") != 1 || !strings.Contains(out, "storefront-00042") {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
+
+func TestCloudRunGCPPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/test1-project-000/locations/-/services":
+			fmt.Fprint(w, `{"services": [{"name": "projects/test1-project-000/locations/us-central1/services/storefront",
+				"template": {"scaling": {"minInstanceCount": 1, "maxInstanceCount": 10}}}]}`)
+		case "/projects/test1-project-000/locations/us-central1/services/storefront:getIamPolicy":
+			fmt.Fprint(w, `{"bindings": [{"role": "roles/run.invoker", "members": ["allUsers"]}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	taker := &TakerCloudRunGCP{client: server.Client(), endpoint: server.URL + "/"}
+	project := filterFixture(fpTT[0])[0]
+	services, err := taker.ListServices(context.Background(), project)
+	if err != nil || len(services) != 1 || services[0].Template.Scaling.MaxInstanceCount != 10 {
+		t.Fatalf("unexpected services %v, error %v", services, err)
+	}
+	policy, err := taker.GetIamPolicy(context.Background(), services[0])
+	if err != nil || len(policy.Bindings) != 1 || policy.Bindings[0].Members[0] != "allUsers" {
+		t.Errorf("unexpected policy %v, error %v", policy, err)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	cloudscheduler "google.golang.org/api/cloudscheduler/v1beta1"
+)
+
+type TakerScheduler interface {
+	ListJobs(context.Context, *reportProject) ([]*cloudscheduler.Job, error)
+}
+
+type TakerSchedulerGCP struct {
+	schedulerService *cloudscheduler.Service
+}
+
+type reportSchedulerJob struct {
+	gcpJob *cloudscheduler.Job
+	// kinds are the backed up kinds the job exports: those it names, or all
+	// of them when it names none
+	kinds []string
+	// noRecentBackup is set when every kind the job exports is stale
+	noRecentBackup bool
+
+	project *reportProject // parent
+}
+
+func (rj *reportSchedulerJob) Parent() reportNode {
+	return rj.project
+}
+
+// ListJobs gathers the Cloud Scheduler jobs of the project in every location
+func (taker *TakerSchedulerGCP) ListJobs(ctx context.Context, project *reportProject) (jobs []*cloudscheduler.Job, err error) {
+	var locations []string
+	err = doWithRetry(ctx, func() error {
+		locations = nil
+		return taker.schedulerService.Projects.Locations.List("projects/"+project.gcpProject.ProjectId).Pages(ctx, func(page *cloudscheduler.ListLocationsResponse) error {
+			for _, location := range page.Locations {
+				locations = append(locations, location.Name)
+			}
+			return nil
+		})
+	})
+	for _, location := range locations {
+		if err != nil {
+			return
+		}
+		var locationJobs []*cloudscheduler.Job
+		err = doWithRetry(ctx, func() error {
+			locationJobs = nil
+			return taker.schedulerService.Projects.Locations.Jobs.List(location).Pages(ctx, func(page *cloudscheduler.ListJobsResponse) error {
+				locationJobs = append(locationJobs, page.Jobs...)
+				return nil
+			})
+		})
+		jobs = append(jobs, locationJobs...)
+	}
+	return
+}
+
+// IngestSchedulerJobs ingests the project's scheduler jobs whose ID or
+// description matches pattern, the ones taken to run backups, ordered by name.
+func (p *reportProject) IngestSchedulerJobs(ctx context.Context, taker TakerScheduler, pattern *regexp.Regexp) error {
+	var gcpJobs []*cloudscheduler.Job
+	listErr := limited(func() (err error) {
+		gcpJobs, err = taker.ListJobs(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+	for _, gcpJob := range gcpJobs {
+		if pattern.MatchString(path.Base(gcpJob.Name)) || pattern.MatchString(gcpJob.Description) {
+			p.schedulerJobs = append(p.schedulerJobs, &reportSchedulerJob{gcpJob: gcpJob, project: p})
+		}
+	}
+	sort.Slice(p.schedulerJobs, func(i, j int) bool { return p.schedulerJobs[i].gcpJob.Name < p.schedulerJobs[j].gcpJob.Name })
+	return nil
+}
+
+// CheckSchedules correlates the backup jobs ingested with the kinds found
+// in the backup buckets: kinds which no job exports are unscheduled, and jobs
+// whose kinds are all stale have produced no recent backup.
+func (p *reportProject) CheckSchedules() {
+	// a kind is fresh when any of the buckets has a fresh backup of it
+	fresh := make(map[string]bool)
+	var kinds []string
+	for _, bucket := range p.backupBuckets {
+		if !bucket.isBackup {
+			continue
+		}
+		for _, kind := range bucket.kindNames() {
+			if !containsString(kinds, kind) {
+				kinds = append(kinds, kind)
+			}
+			if !bucket.staleKinds[kind] {
+				fresh[kind] = true
+			}
+		}
+	}
+	sort.Strings(kinds)
+
+	scheduled := make(map[string]bool)
+	for _, job := range p.schedulerJobs {
+		job.kinds = nil
+		text := job.text()
+		for _, kind := range kinds {
+			if regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(kind) + `\b`).MatchString(text) {
+				job.kinds = append(job.kinds, kind)
+			}
+		}
+		if len(job.kinds) == 0 {
+			job.kinds = kinds
+		}
+		job.noRecentBackup = len(job.kinds) > 0
+		for _, kind := range job.kinds {
+			scheduled[kind] = true
+			if fresh[kind] {
+				job.noRecentBackup = false
+			}
+		}
+		if job.noRecentBackup {
+			p.addFinding(severityWarn, "job/"+path.Base(job.gcpJob.Name), "produced no recent backup of the kinds it exports")
+		}
+	}
+
+	p.unscheduledKinds = nil
+	for _, kind := range kinds {
+		if !scheduled[kind] {
+			p.unscheduledKinds = append(p.unscheduledKinds, kind)
+			p.addFinding(severityWarn, "kind/"+kind, "is backed up without a Cloud Scheduler job exporting it")
+		}
+	}
+}
+
+// text is what the job names and sends, searched for the kinds it exports
+func (rj *reportSchedulerJob) text() string {
+	gcpJob := rj.gcpJob
+	parts := []string{path.Base(gcpJob.Name), gcpJob.Description}
+	if target := gcpJob.HttpTarget; target != nil {
+		parts = append(parts, target.Uri, decodeBase64(target.Body))
+	}
+	if target := gcpJob.AppEngineHttpTarget; target != nil {
+		parts = append(parts, target.RelativeUri, decodeBase64(target.Body))
+	}
+	if target := gcpJob.PubsubTarget; target != nil {
+		parts = append(parts, decodeBase64(target.Data))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// decodeBase64 decodes a payload as the API sends it, leaving one that will
+// not decode as it is
+func decodeBase64(s string) string {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return s
+	}
+	return string(decoded)
+}
+
+// displaySchedulerJobs shows the backup jobs as a table
+func displaySchedulerJobs(w io.Writer, jobs []*reportSchedulerJob) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  SCHEDULER JOB\tLOCATION\tSCHEDULE\tSTATE\tLAST ATTEMPT\tKINDS\tSTATUS")
+	for _, job := range jobs {
+		gcpJob := job.gcpJob
+		status := healthy("OK")
+		if job.noRecentBackup {
+			status = alert("NO-RECENT-BACKUP")
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n", path.Base(gcpJob.Name), resourceLocation(gcpJob.Name),
+			supplyDefault(gcpJob.Schedule, "-"), gcpJob.State, supplyDefault(formatTimestamp(gcpJob.LastAttemptTime), "never"),
+			supplyDefault(strings.Join(job.kinds, ","), "-"), status)
+	}
+	table.Flush()
+}
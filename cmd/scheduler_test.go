@@ -0,0 +1,109 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	cloudscheduler "google.golang.org/api/cloudscheduler/v1beta1"
+	storage "google.golang.org/api/storage/v1"
+)
+
+const schedulerPrefix = "projects/test1-project-000/locations/us-central1/jobs/"
+
+var p2jobs = map[string][]*cloudscheduler.Job{
+	"test1-project-000": []*cloudscheduler.Job{
+		&cloudscheduler.Job{Name: schedulerPrefix + "export-widgets", Schedule: "0 2 * * *", State: "ENABLED",
+			AppEngineHttpTarget: &cloudscheduler.AppEngineHttpTarget{RelativeUri: "/cloud-datastore-export?kind=Widget"}},
+		&cloudscheduler.Job{Name: schedulerPrefix + "nightly", Description: "Datastore backup", Schedule: "0 3 * * *", State: "ENABLED",
+			HttpTarget: &cloudscheduler.HttpTarget{Uri: "https://datastore.googleapis.com/v1/projects/test1-project-000:export",
+				Body: base64.StdEncoding.EncodeToString([]byte(`{"entityFilter":{"kinds":["Sprocket"]}}`))}},
+		&cloudscheduler.Job{Name: schedulerPrefix + "warm-cache", Schedule: "*/5 * * * *", State: "ENABLED"},
+	},
+}
+
+// kindObjects maps each kind to a single backup object of it
+func kindObjects(kinds ...string) map[string][]*reportObject {
+	kindMap := make(map[string][]*reportObject)
+	for _, kind := range kinds {
+		kindMap[kind] = []*reportObject{{gcpObject: &storage.Object{Id: "backups/datastore." + kind + ".backup_info"}, kind: kind}}
+	}
+	return kindMap
+}
+
+type TestSchedulerTaker struct{}
+
+func (tt *TestSchedulerTaker) ListJobs(ctx context.Context, rp *reportProject) ([]*cloudscheduler.Job, error) {
+	return p2jobs[rp.gcpProject.ProjectId], nil
+}
+
+func TestCheckSchedules(t *testing.T) {
+	project := filterFixture(fpTT[0])[0]
+	project.backupBuckets = []*reportBucket{
+		&reportBucket{gcpBucket: &storage.Bucket{Name: "backups"}, isBackup: true, project: project,
+			kindMap:    kindObjects("Widget", "Sprocket", "Gadget"),
+			staleKinds: map[string]bool{"Sprocket": true}},
+		&reportBucket{gcpBucket: &storage.Bucket{Name: "scratch"}, project: project,
+			kindMap: kindObjects("Gizmo")},
+	}
+	if err := project.IngestSchedulerJobs(context.Background(), &TestSchedulerTaker{}, regexp.MustCompile("(?i)backup|export")); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.schedulerJobs) != 2 {
+		t.Fatalf("expected the two jobs matching the pattern, have %d", len(project.schedulerJobs))
+	}
+	project.CheckSchedules()
+
+	widgets, nightly := project.schedulerJobs[0], project.schedulerJobs[1]
+	if !reflect.DeepEqual(widgets.kinds, []string{"Widget"}) || widgets.noRecentBackup {
+		t.Errorf("expected export-widgets to export Widget recently, have %v %t", widgets.kinds, widgets.noRecentBackup)
+	}
+	if !reflect.DeepEqual(nightly.kinds, []string{"Sprocket"}) || !nightly.noRecentBackup {
+		t.Errorf("expected nightly to export the stale Sprocket, have %v %t", nightly.kinds, nightly.noRecentBackup)
+	}
+	if !reflect.DeepEqual(project.unscheduledKinds, []string{"Gadget"}) {
+		t.Errorf("expected Gadget alone unscheduled, have %v", project.unscheduledKinds)
+	}
+	var resources []string
+	for _, f := range project.findings {
+		resources = append(resources, f.resource)
+	}
+	if !reflect.DeepEqual(resources, []string{"job/nightly", "kind/Gadget"}) {
+		t.Errorf("expected findings for nightly and Gadget, have %v", resources)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"export-widgets", "us-central1", "NO-RECENT-BACKUP", "kind[Gadget]", "UNSCHEDULED"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected display to contain %q, have:\n%s", expected, out)
+		}
+	}
+}
+
+func TestCheckSchedulesJobNamingNoKind(t *testing.T) {
+	project := filterFixture(fpTT[0])[0]
+	project.backupBuckets = []*reportBucket{
+		&reportBucket{gcpBucket: &storage.Bucket{Name: "backups"}, isBackup: true, project: project,
+			kindMap:    kindObjects("Widget", "Gadget"),
+			staleKinds: map[string]bool{"Widget": true, "Gadget": true}},
+	}
+	project.schedulerJobs = []*reportSchedulerJob{
+		&reportSchedulerJob{gcpJob: &cloudscheduler.Job{Name: schedulerPrefix + "backup-all"}, project: project},
+	}
+	project.CheckSchedules()
+	if job := project.schedulerJobs[0]; !reflect.DeepEqual(job.kinds, []string{"Gadget", "Widget"}) || !job.noRecentBackup {
+		t.Errorf("expected a job naming no kind to export them all, stale, have %v %t", job.kinds, job.noRecentBackup)
+	}
+	if len(project.unscheduledKinds) != 0 {
+		t.Errorf("expected no unscheduled kinds, have %v", project.unscheduledKinds)
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	logging "google.golang.org/api/logging/v2"
+)
+
+// secretManagerEndpoint is the base of the Secret Manager REST API, which the
+// vendored google.golang.org/api has no client for
+const secretManagerEndpoint = "https://secretmanager.googleapis.com/v1/"
+
+// accessSecretMethod is the audit logged method reading a secret's payload
+const accessSecretMethod = "google.cloud.secretmanager.v1.SecretManagerService.AccessSecretVersion"
+
+// secretsCmd represents the secrets command
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Show the Secret Manager secrets available from given credentials",
+	Long: `Show the Secret Manager secrets of each project visible from the account
+used, with their replication policy, how many versions each has, when it was
+created and when it was last accessed. Accesses are found in the data access
+audit logs, which must be turned on for Secret Manager. Secrets older than the
+--within interval (default 90d) which were not accessed within it are flagged
+as IDLE, and secrets whose replicas are not encrypted with a customer-managed
+key as NO-CMEK. For instance:
+    gcp-reports secrets --within 720h our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, cloudresourcemanager.CloudPlatformScope, func(clients *clients) (projectIngester, error) {
+			loggingService, err := logging.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish logging service: %v", err)
+			}
+			taker := &TakerSecretsGCP{client: clients.http, endpoint: secretManagerEndpoint, loggingService: loggingService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestSecrets(ctx, taker, time.Now())
+			}, nil
+		})
+	},
+}
+
+// secretEncryption names the customer-managed key encrypting a secret replica
+type secretEncryption struct {
+	KmsKeyName string `json:"kmsKeyName"`
+}
+
+// secretManagerSecret is the part of a Secret Manager secret reported on
+type secretManagerSecret struct {
+	Name        string `json:"name"`
+	CreateTime  string `json:"createTime"`
+	Replication struct {
+		Automatic *struct {
+			CustomerManagedEncryption *secretEncryption `json:"customerManagedEncryption"`
+		} `json:"automatic"`
+		UserManaged *struct {
+			Replicas []struct {
+				Location                  string            `json:"location"`
+				CustomerManagedEncryption *secretEncryption `json:"customerManagedEncryption"`
+			} `json:"replicas"`
+		} `json:"userManaged"`
+	} `json:"replication"`
+}
+
+// secretVersion is the part of a secret version reported on
+type secretVersion struct {
+	Name       string `json:"name"`
+	CreateTime string `json:"createTime"`
+	State      string `json:"state"`
+}
+
+type TakerSecrets interface {
+	ListSecrets(context.Context, *reportProject) ([]*secretManagerSecret, error)
+	ListSecretVersions(context.Context, *reportSecret) ([]*secretVersion, error)
+	// LastAccess is when the secret was last accessed since the given time,
+	// or the zero time when it was not
+	LastAccess(context.Context, *reportSecret, time.Time) (time.Time, error)
+}
+
+type TakerSecretsGCP struct {
+	client         *http.Client
+	endpoint       string
+	loggingService *logging.Service
+}
+
+type reportSecret struct {
+	gcpSecret  *secretManagerSecret
+	versions   []*secretVersion
+	lastAccess time.Time
+	// idle is set for a secret older than --within not accessed within it
+	idle bool
+	// noCMEK is set when any replica of the secret lacks a customer-managed key
+	noCMEK bool
+
+	project *reportProject // parent
+}
+
+func (rs *reportSecret) Parent() reportNode {
+	return rs.project
+}
+
+// ListSecrets gathers the secrets of the project
+func (taker *TakerSecretsGCP) ListSecrets(ctx context.Context, project *reportProject) (secrets []*secretManagerSecret, err error) {
+	err = doWithRetry(ctx, func() error {
+		secrets = nil
+		address := taker.endpoint + "projects/" + project.gcpProject.ProjectId + "/secrets"
+		pageToken := ""
+		for {
+			var page struct {
+				Secrets       []*secretManagerSecret `json:"secrets"`
+				NextPageToken string                 `json:"nextPageToken"`
+			}
+			pageAddress := address
+			if pageToken != "" {
+				pageAddress += "?pageToken=" + url.QueryEscape(pageToken)
+			}
+			if err := getJSON(ctx, taker.client, pageAddress, &page); err != nil {
+				return err
+			}
+			secrets = append(secrets, page.Secrets...)
+			if pageToken = page.NextPageToken; pageToken == "" {
+				return nil
+			}
+		}
+	})
+	return
+}
+
+// ListSecretVersions gathers the versions of the secret
+func (taker *TakerSecretsGCP) ListSecretVersions(ctx context.Context, secret *reportSecret) (versions []*secretVersion, err error) {
+	err = doWithRetry(ctx, func() error {
+		versions = nil
+		address := taker.endpoint + secret.gcpSecret.Name + "/versions"
+		pageToken := ""
+		for {
+			var page struct {
+				Versions      []*secretVersion `json:"versions"`
+				NextPageToken string           `json:"nextPageToken"`
+			}
+			pageAddress := address
+			if pageToken != "" {
+				pageAddress += "?pageToken=" + url.QueryEscape(pageToken)
+			}
+			if err := getJSON(ctx, taker.client, pageAddress, &page); err != nil {
+				return err
+			}
+			versions = append(versions, page.Versions...)
+			if pageToken = page.NextPageToken; pageToken == "" {
+				return nil
+			}
+		}
+	})
+	return
+}
+
+// LastAccess finds the newest data access audit log entry reading a version
+// of the secret since the given time
+func (taker *TakerSecretsGCP) LastAccess(ctx context.Context, secret *reportSecret, since time.Time) (lastAccess time.Time, err error) {
+	filter := fmt.Sprintf(`protoPayload.methodName=%q AND protoPayload.resourceName:%q AND timestamp>=%q`,
+		accessSecretMethod, secret.gcpSecret.Name+"/", since.UTC().Format(time.RFC3339))
+	err = doWithRetry(ctx, func() error {
+		lastAccess = time.Time{}
+		response, listErr := taker.loggingService.Entries.List(&logging.ListLogEntriesRequest{
+			ResourceNames: []string{"projects/" + secret.project.gcpProject.ProjectId},
+			Filter:        filter,
+			OrderBy:       "timestamp desc",
+			PageSize:      1,
+		}).Context(ctx).Do()
+		if listErr != nil {
+			return listErr
+		}
+		if len(response.Entries) > 0 {
+			lastAccess, _ = time.Parse(time.RFC3339, response.Entries[0].Timestamp)
+		}
+		return nil
+	})
+	return
+}
+
+// IngestSecrets ingests the project's secrets ordered by name with their
+// versions and last access, marking those idle for --within as of now and
+// those lacking a customer-managed key.
+func (p *reportProject) IngestSecrets(ctx context.Context, taker TakerSecrets, now time.Time) error {
+	var gcpSecrets []*secretManagerSecret
+	listErr := limited(func() (err error) {
+		gcpSecrets, err = taker.ListSecrets(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+	for _, gcpSecret := range gcpSecrets {
+		p.secrets = append(p.secrets, &reportSecret{gcpSecret: gcpSecret, project: p})
+	}
+	sort.Slice(p.secrets, func(i, j int) bool { return p.secrets[i].gcpSecret.Name < p.secrets[j].gcpSecret.Name })
+
+	within := viper.GetDuration("secretWithin")
+	since := now.Add(-within)
+	for _, secret := range p.secrets {
+		secretErr := limited(func() (err error) {
+			if secret.versions, err = taker.ListSecretVersions(ctx, secret); err != nil {
+				return
+			}
+			secret.lastAccess, err = taker.LastAccess(ctx, secret, since)
+			return
+		})
+		if secretErr != nil {
+			return secretErr
+		}
+		sort.Slice(secret.versions, func(i, j int) bool { return secret.versions[i].CreateTime < secret.versions[j].CreateTime })
+
+		resource := "secret/" + path.Base(secret.gcpSecret.Name)
+		createTime, parseErr := time.Parse(time.RFC3339, secret.gcpSecret.CreateTime)
+		if parseErr == nil && createTime.Before(since) && secret.lastAccess.IsZero() {
+			secret.idle = true
+			p.addFinding(severityWarn, resource, fmt.Sprintf("not accessed within %v", within))
+		}
+		if !secret.encrypted() {
+			secret.noCMEK = true
+			p.addFinding(severityWarn, resource, "is not encrypted with a customer-managed key")
+		}
+	}
+	return nil
+}
+
+// encrypted reports whether every replica of the secret is encrypted with a
+// customer-managed key
+func (rs *reportSecret) encrypted() bool {
+	replication := rs.gcpSecret.Replication
+	switch {
+	case replication.Automatic != nil:
+		return replication.Automatic.CustomerManagedEncryption != nil
+	case replication.UserManaged != nil:
+		for _, replica := range replication.UserManaged.Replicas {
+			if replica.CustomerManagedEncryption == nil {
+				return false
+			}
+		}
+		return len(replication.UserManaged.Replicas) > 0
+	}
+	return false
+}
+
+// replication shows the replication policy: automatic, or the locations of
+// the user-managed replicas
+func (rs *reportSecret) replication() string {
+	replication := rs.gcpSecret.Replication
+	if replication.UserManaged == nil {
+		return "automatic"
+	}
+	var locations []string
+	for _, replica := range replication.UserManaged.Replicas {
+		locations = append(locations, replica.Location)
+	}
+	return strings.Join(locations, ",")
+}
+
+// enabledVersions counts the versions of the secret which can be accessed
+func (rs *reportSecret) enabledVersions() (enabled int) {
+	for _, version := range rs.versions {
+		if version.State == "ENABLED" {
+			enabled++
+		}
+	}
+	return
+}
+
+// displaySecrets shows the secrets as a table
+func displaySecrets(w io.Writer, secrets []*reportSecret) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  SECRET\tREPLICATION\tVERSIONS\tENABLED\tCREATED\tLAST ACCESS\tSTATUS")
+	for _, secret := range secrets {
+		var problems []string
+		if secret.idle {
+			problems = append(problems, alert("IDLE"))
+		}
+		if secret.noCMEK {
+			problems = append(problems, alert("NO-CMEK"))
+		}
+		status := healthy("OK")
+		if len(problems) > 0 {
+			status = strings.Join(problems, " ")
+		}
+		lastAccess := "-"
+		if !secret.lastAccess.IsZero() {
+			lastAccess = formatTime(secret.lastAccess)
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%d\t%d\t%s\t%s\t%s\n", path.Base(secret.gcpSecret.Name), secret.replication(),
+			len(secret.versions), secret.enabledVersions(), formatTimestamp(secret.gcpSecret.CreateTime), lastAccess, status)
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(secretsCmd)
+
+	secretsCmd.Flags().Duration("within", 90*24*time.Hour, "flag secrets not accessed within this interval from now")
+	viper.BindPFlag("secretWithin", secretsCmd.Flags().Lookup("within"))
+}
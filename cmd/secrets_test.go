@@ -0,0 +1,100 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const secretPrefix = "projects/123456789/secrets/"
+
+// secretsFixture decodes the secrets as the Secret Manager API sends them
+func secretsFixture(t *testing.T) []*secretManagerSecret {
+	var secrets []*secretManagerSecret
+	err := json.Unmarshal([]byte(`[
+		{"name": "`+secretPrefix+`db-password", "createTime": "2017-01-01T00:00:00Z",
+		 "replication": {"automatic": {"customerManagedEncryption": {"kmsKeyName": "projects/test1-project-000/locations/global/keyRings/cmek/cryptoKeys/secrets"}}}},
+		{"name": "`+secretPrefix+`old-token", "createTime": "2017-01-01T00:00:00Z",
+		 "replication": {"userManaged": {"replicas": [
+		   {"location": "europe-west1", "customerManagedEncryption": {"kmsKeyName": "projects/test1-project-000/locations/europe-west1/keyRings/cmek/cryptoKeys/secrets"}},
+		   {"location": "europe-west4", "customerManagedEncryption": {"kmsKeyName": "projects/test1-project-000/locations/europe-west4/keyRings/cmek/cryptoKeys/secrets"}}]}}},
+		{"name": "`+secretPrefix+`api-key", "createTime": "2017-05-30T00:00:00Z",
+		 "replication": {"automatic": {}}}
+	]`), &secrets)
+	if err != nil {
+		t.Fatalf("cannot decode secrets fixture: %v", err)
+	}
+	return secrets
+}
+
+type TestSecretsTaker struct {
+	secrets []*secretManagerSecret
+	// accesses are the last access times by secret ID
+	accesses map[string]time.Time
+}
+
+func (tt *TestSecretsTaker) ListSecrets(ctx context.Context, rp *reportProject) ([]*secretManagerSecret, error) {
+	return tt.secrets, nil
+}
+
+func (tt *TestSecretsTaker) ListSecretVersions(ctx context.Context, rs *reportSecret) ([]*secretVersion, error) {
+	return []*secretVersion{
+		{Name: rs.gcpSecret.Name + "/versions/2", CreateTime: "2017-02-01T00:00:00Z", State: "ENABLED"},
+		{Name: rs.gcpSecret.Name + "/versions/1", CreateTime: "2017-01-01T00:00:00Z", State: "DISABLED"},
+	}, nil
+}
+
+func (tt *TestSecretsTaker) LastAccess(ctx context.Context, rs *reportSecret, since time.Time) (time.Time, error) {
+	if access := tt.accesses[rs.gcpSecret.Name[len(secretPrefix):]]; access.After(since) {
+		return access, nil
+	}
+	return time.Time{}, nil
+}
+
+func TestIngestSecrets(t *testing.T) {
+	defer viper.Set("secretWithin", viper.GetDuration("secretWithin"))
+	viper.Set("secretWithin", 30*24*time.Hour)
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+	taker := &TestSecretsTaker{secrets: secretsFixture(t), accesses: map[string]time.Time{
+		"db-password": now.Add(-time.Hour),
+		"old-token":   now.Add(-60 * 24 * time.Hour),
+	}}
+
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestSecrets(context.Background(), taker, now); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.secrets) != 3 {
+		t.Fatalf("expected three secrets, have %d", len(project.secrets))
+	}
+	apiKey, dbPassword, oldToken := project.secrets[0], project.secrets[1], project.secrets[2]
+	if dbPassword.idle || dbPassword.noCMEK {
+		t.Errorf("expected db-password accessed and encrypted, have idle %t, no CMEK %t", dbPassword.idle, dbPassword.noCMEK)
+	}
+	if !oldToken.idle || oldToken.noCMEK {
+		t.Errorf("expected old-token idle but encrypted, have idle %t, no CMEK %t", oldToken.idle, oldToken.noCMEK)
+	}
+	if apiKey.idle || !apiKey.noCMEK {
+		t.Errorf("expected the recent api-key not idle but without CMEK, have idle %t, no CMEK %t", apiKey.idle, apiKey.noCMEK)
+	}
+	if len(project.findings) != 2 || project.findings[0].resource != "secret/api-key" || project.findings[1].resource != "secret/old-token" {
+		t.Errorf("expected api-key and old-token flagged, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"project[test1-project-000]: 3 secrets", "automatic", "europe-west1,europe-west4", "IDLE", "NO-CMEK"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected display to contain %q, have:\n%s", expected, out)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Export backup and App Engine state as Prometheus metrics",
+	Long: `Run the apps and backups ingestion every --interval and expose the
+results as Prometheus metrics on --listen, under /metrics. Projects are
+selected the same way as for the other reports. For instance:
+    gcp-reports serve --listen :9090 --interval 15m our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		client, err := newClient(ctx, cloudresourcemanager.CloudPlatformReadOnlyScope)
+		if err != nil {
+			return fmt.Errorf("cannot create a gcloud client: %v", err)
+		}
+		appEngine, err := appengine.New(client)
+		if err != nil {
+			return fmt.Errorf("cannot establish app engine service: %v", err)
+		}
+		sqladminService, err := sqladmin.New(client)
+		if err != nil {
+			return fmt.Errorf("cannot create an sql admin service: %v", err)
+		}
+		storageService, err := storage.New(client)
+		if err != nil {
+			return fmt.Errorf("cannot use storage API successfully: %v", err)
+		}
+		collector := &metricsCollector{
+			taker:         &TakerGCP{appEngine: appEngine},
+			sqladminTaker: &TakerSQLAdminGCP{sqladminService: sqladminService},
+			storageTaker:  &TakerStorageGCP{storageService: storageService},
+		}
+
+		registry := prometheus.NewRegistry()
+		metrics := newReportMetrics(registry)
+		setConcurrency(viper.GetInt("concurrency"))
+		go func() {
+			for {
+				collector.collect(client, args, metrics)
+				time.Sleep(viper.GetDuration("interval"))
+			}
+		}()
+
+		http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		logger.Infof("serving metrics on %s/metrics", viper.GetString("listen"))
+		return http.ListenAndServe(viper.GetString("listen"), nil)
+	},
+}
+
+// reportMetrics are the gauges exported by serve
+type reportMetrics struct {
+	backupStale        *prometheus.GaugeVec
+	sqlBackupAge       *prometheus.GaugeVec
+	appengineInstances *prometheus.GaugeVec
+}
+
+func newReportMetrics(registry prometheus.Registerer) *reportMetrics {
+	metrics := &reportMetrics{
+		backupStale: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gcp_reports_backup_stale",
+			Help: "1 when the resource has no backup within the --within interval, 0 otherwise.",
+		}, []string{"project", "resource"}),
+		sqlBackupAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gcp_reports_sql_backup_age_seconds",
+			Help: "Age of the most recent successful Cloud SQL backup.",
+		}, []string{"project", "instance"}),
+		appengineInstances: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gcp_reports_appengine_instances",
+			Help: "Number of App Engine instances running a version.",
+		}, []string{"project", "service", "version"}),
+	}
+	registry.MustRegister(metrics.backupStale, metrics.sqlBackupAge, metrics.appengineInstances)
+	return metrics
+}
+
+// metricsCollector runs the ingestion behind every round of metrics
+type metricsCollector struct {
+	taker         Taker
+	sqladminTaker TakerSQLAdmin
+	storageTaker  TakerStorage
+}
+
+// collect ingests the selected projects afresh and records them in metrics
+func (mc *metricsCollector) collect(client *http.Client, components []string, metrics *reportMetrics) {
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+	defer cancel()
+	projects, projErr := selectProjects(ctx, client, components, cloudresourcemanager.CloudPlatformReadOnlyScope)
+	if projErr != nil {
+		logger.Errorf("%v", projErr)
+		return
+	}
+	if ingestErr := ingestProjects(ctx, projects, func(ctx context.Context, project *reportProject) error {
+		if err := project.IngestStorage(ctx, mc.storageTaker); err != nil {
+			logger.Warnf("project %s: %v", project.gcpProject.ProjectId, err)
+		}
+		if err := project.IngestSQLInstances(ctx, mc.sqladminTaker); err != nil {
+			logger.Warnf("project %s: %v", project.gcpProject.ProjectId, err)
+		}
+		return project.Ingest(ctx, mc.taker)
+	}); ingestErr != nil {
+		logger.Errorf("%v", ingestErr)
+	}
+	metrics.record(projects, time.Now())
+}
+
+// record replaces the gauges with those of the ingested projects, so that
+// resources which have gone away stop being reported.
+func (m *reportMetrics) record(projects []*reportProject, now time.Time) {
+	m.backupStale.Reset()
+	m.sqlBackupAge.Reset()
+	m.appengineInstances.Reset()
+
+	staleness := func(stale bool) float64 {
+		if stale {
+			return 1
+		}
+		return 0
+	}
+	for _, project := range projects {
+		projectID := project.gcpProject.ProjectId
+		for _, instance := range project.sqlInstances {
+			if instance.backupsDisabled {
+				continue
+			}
+			name := instance.gcpSQLInstance.Name
+			m.backupStale.WithLabelValues(projectID, "sql/"+name).Set(staleness(instance.stale))
+			if last, ok := instance.lastBackup(); ok {
+				m.sqlBackupAge.WithLabelValues(projectID, name).Set(now.Sub(last).Seconds())
+			}
+		}
+		for _, bucket := range project.backupBuckets {
+			for kind := range bucket.kindMap {
+				m.backupStale.WithLabelValues(projectID, "kind/"+kind).Set(staleness(bucket.staleKinds[kind]))
+			}
+		}
+		for _, kind := range project.missingKinds {
+			m.backupStale.WithLabelValues(projectID, "kind/"+kind).Set(1)
+		}
+		if project.application == nil {
+			continue
+		}
+		for _, service := range project.application.services {
+			for _, version := range service.versions {
+				m.appengineInstances.WithLabelValues(projectID, service.gcpService.Id, version.gcpVersion.Id).
+					Set(float64(len(version.instances)))
+			}
+		}
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().String("listen", ":9090", "address to serve metrics on")
+	serveCmd.Flags().Duration("interval", 15*time.Minute, "pause between rounds of ingestion")
+	viper.BindPFlag("listen", serveCmd.Flags().Lookup("listen"))
+	viper.BindPFlag("interval", serveCmd.Flags().Lookup("interval"))
+}
@@ -0,0 +1,79 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	storage "google.golang.org/api/storage/v1"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+	project := goldenProject()
+	instance := &reportSQLInstance{
+		gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "golden-sql",
+			Settings: &sqladmin.Settings{BackupConfiguration: &sqladmin.BackupConfiguration{Enabled: true}}},
+		backupRuns: []*reportBackupRun{{gcpBackupRun: &sqladmin.BackupRun{Status: "SUCCESSFUL", EndTime: "2017-06-02T11:00:00Z"}}},
+		project:    project,
+	}
+	instance.CheckFreshness(now, 24*time.Hour)
+	project.sqlInstances = []*reportSQLInstance{instance}
+	bucket := &reportBucket{gcpBucket: &storage.Bucket{Name: "golden-backups"}, isBackup: true, project: project,
+		kindMap: map[string][]*reportObject{"Widget": {{}}}, staleKinds: map[string]bool{"Widget": true}}
+	project.backupBuckets = []*reportBucket{bucket}
+
+	registry := prometheus.NewRegistry()
+	newReportMetrics(registry).record([]*reportProject{project}, now)
+	server := httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("cannot scrape metrics: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	for _, expected := range []string{
+		`gcp_reports_backup_stale{project="test1-project-000",resource="kind/Widget"} 1`,
+		`gcp_reports_backup_stale{project="test1-project-000",resource="sql/golden-sql"} 0`,
+		`gcp_reports_sql_backup_age_seconds{instance="golden-sql",project="test1-project-000"} 3600`,
+		`gcp_reports_appengine_instances{project="test1-project-000",service="default",version="v2"} 1`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("expected scrape to contain %s, have:\n%s", expected, body)
+		}
+	}
+}
+
+func TestMetricsWithoutSettings(t *testing.T) {
+	project := goldenProject()
+	instance := &reportSQLInstance{gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "bare-sql"}, project: project}
+	instance.CheckProtection()
+	project.sqlInstances = []*reportSQLInstance{instance}
+
+	registry := prometheus.NewRegistry()
+	newReportMetrics(registry).record([]*reportProject{project}, time.Now())
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("cannot gather metrics: %v", err)
+	}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if strings.Contains(label.GetValue(), "bare-sql") {
+					t.Errorf("expected no metric for an instance without backups, have %s %v", family.GetName(), metric)
+				}
+			}
+		}
+	}
+}
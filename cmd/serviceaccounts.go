@@ -0,0 +1,169 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	iam "google.golang.org/api/iam/v1"
+)
+
+// serviceAccountsCmd represents the service-accounts command
+var serviceAccountsCmd = &cobra.Command{
+	Use:   "service-accounts",
+	Short: "Show the service accounts of projects available from given credentials",
+	Long: `Show the service accounts of each project visible from the account
+used, with their display names, emails and user-managed keys. Keys created
+longer ago than --key-max-age (default 90 days) are flagged as OLD. For instance:
+    gcp-reports service-accounts --key-max-age 720h our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, iam.CloudPlatformScope, func(clients *clients) (projectIngester, error) {
+			iamService, err := iam.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish iam service: %v", err)
+			}
+			taker := &TakerIAMGCP{iamService: iamService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestServiceAccounts(ctx, taker)
+			}, nil
+		})
+	},
+}
+
+type TakerIAM interface {
+	ListServiceAccounts(context.Context, *reportProject) ([]*iam.ServiceAccount, error)
+	ListServiceAccountKeys(context.Context, *reportServiceAccount) ([]*iam.ServiceAccountKey, error)
+}
+
+type TakerIAMGCP struct {
+	iamService *iam.Service
+}
+
+type reportServiceAccount struct {
+	gcpAccount *iam.ServiceAccount
+	keys       []*reportServiceAccountKey
+
+	project *reportProject // parent
+}
+
+type reportServiceAccountKey struct {
+	gcpKey  *iam.ServiceAccountKey
+	created time.Time
+	old     bool
+}
+
+func (rsa *reportServiceAccount) Parent() reportNode {
+	return rsa.project
+}
+
+// ListServiceAccounts gathers all the service accounts of the project
+func (taker *TakerIAMGCP) ListServiceAccounts(ctx context.Context, project *reportProject) (accounts []*iam.ServiceAccount, err error) {
+	err = doWithRetry(ctx, func() error {
+		accounts = nil
+		return taker.iamService.Projects.ServiceAccounts.List("projects/"+project.gcpProject.ProjectId).Pages(ctx,
+			func(page *iam.ListServiceAccountsResponse) error {
+				accounts = append(accounts, page.Accounts...)
+				return nil
+			})
+	})
+	return
+}
+
+// ListServiceAccountKeys gathers the user-managed keys of the service account;
+// keys managed by Google itself are rotated automatically and left out.
+func (taker *TakerIAMGCP) ListServiceAccountKeys(ctx context.Context, account *reportServiceAccount) (keys []*iam.ServiceAccountKey, err error) {
+	err = doWithRetry(ctx, func() error {
+		keysResponse, listErr := taker.iamService.Projects.ServiceAccounts.Keys.List(account.gcpAccount.Name).
+			KeyTypes("USER_MANAGED").Context(ctx).Do()
+		if listErr == nil {
+			keys = keysResponse.Keys
+		}
+		return listErr
+	})
+	return
+}
+
+// IngestServiceAccounts ingests the service accounts of the project along
+// with their user-managed keys, marking keys older than the configured age.
+func (p *reportProject) IngestServiceAccounts(ctx context.Context, taker TakerIAM) error {
+	var gcpAccounts []*iam.ServiceAccount
+	listErr := limited(func() (err error) {
+		gcpAccounts, err = taker.ListServiceAccounts(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+	sort.Slice(gcpAccounts, func(i, j int) bool { return gcpAccounts[i].Email < gcpAccounts[j].Email })
+
+	maxAge := viper.GetDuration("keyMaxAge")
+	for _, gcpAccount := range gcpAccounts {
+		account := &reportServiceAccount{gcpAccount: gcpAccount, project: p}
+		p.serviceAccounts = append(p.serviceAccounts, account)
+		if err := account.IngestKeys(ctx, taker, maxAge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IngestKeys gathers the keys of the service account
+func (rsa *reportServiceAccount) IngestKeys(ctx context.Context, taker TakerIAM, maxAge time.Duration) error {
+	var gcpKeys []*iam.ServiceAccountKey
+	listErr := limited(func() (err error) {
+		gcpKeys, err = taker.ListServiceAccountKeys(ctx, rsa)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+	for _, gcpKey := range gcpKeys {
+		key := &reportServiceAccountKey{gcpKey: gcpKey}
+		created, parseErr := time.Parse(time.RFC3339, gcpKey.ValidAfterTime)
+		if parseErr != nil {
+			logger.Warnf("cannot parse creation time of key %s: %v", gcpKey.Name, parseErr)
+		} else {
+			key.created = created
+			if maxAge > 0 && time.Since(created) > maxAge {
+				key.old = true
+				rsa.project.addFinding(severityWarn, "service-account/"+rsa.gcpAccount.Email,
+					fmt.Sprintf("key %s is older than %v", path.Base(gcpKey.Name), maxAge))
+			}
+		}
+		rsa.keys = append(rsa.keys, key)
+	}
+	return nil
+}
+
+// Display shows the service account followed by its keys
+func (rsa *reportServiceAccount) Display(w io.Writer) {
+	fmt.Fprintf(w, "  account[%48s] name[%24s] keys[%d]\n",
+		rsa.gcpAccount.Email, rsa.gcpAccount.DisplayName, len(rsa.keys))
+	for _, key := range rsa.keys {
+		created := "unknown"
+		if !key.created.IsZero() {
+			created = key.created.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "    key[%s] created[%s]", path.Base(key.gcpKey.Name), created)
+		if key.old {
+			fmt.Fprintf(w, " %s", alert("OLD"))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(serviceAccountsCmd)
+
+	serviceAccountsCmd.Flags().Duration("key-max-age", 90*24*time.Hour, "flag user-managed keys created longer ago than this")
+	viper.BindPFlag("keyMaxAge", serviceAccountsCmd.Flags().Lookup("key-max-age"))
+}
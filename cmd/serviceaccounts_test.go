@@ -0,0 +1,71 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	iam "google.golang.org/api/iam/v1"
+)
+
+func keyCreated(age time.Duration) string {
+	return time.Now().Add(-age).Format(time.RFC3339)
+}
+
+var p2sa = map[string][]*iam.ServiceAccount{
+	"test1-project-000": []*iam.ServiceAccount{
+		&iam.ServiceAccount{Name: "projects/test1-project-000/serviceAccounts/deploy", Email: "deploy@test1-project-000.iam.gserviceaccount.com", DisplayName: "deployer"},
+		&iam.ServiceAccount{Name: "projects/test1-project-000/serviceAccounts/app", Email: "app@test1-project-000.iam.gserviceaccount.com"},
+	},
+}
+
+var sa2k = map[string][]*iam.ServiceAccountKey{
+	"projects/test1-project-000/serviceAccounts/deploy": []*iam.ServiceAccountKey{
+		&iam.ServiceAccountKey{Name: "projects/test1-project-000/serviceAccounts/deploy/keys/fresh", ValidAfterTime: keyCreated(24 * time.Hour)},
+		&iam.ServiceAccountKey{Name: "projects/test1-project-000/serviceAccounts/deploy/keys/ancient", ValidAfterTime: keyCreated(400 * 24 * time.Hour)},
+	},
+}
+
+type TestIAMTaker struct{}
+
+func (tt *TestIAMTaker) ListServiceAccounts(ctx context.Context, rp *reportProject) ([]*iam.ServiceAccount, error) {
+	return p2sa[rp.gcpProject.ProjectId], nil
+}
+
+func (tt *TestIAMTaker) ListServiceAccountKeys(ctx context.Context, rsa *reportServiceAccount) ([]*iam.ServiceAccountKey, error) {
+	return sa2k[rsa.gcpAccount.Name], nil
+}
+
+func TestServiceAccountKeyAge(t *testing.T) {
+	viper.Set("keyMaxAge", 90*24*time.Hour)
+	defer viper.Set("keyMaxAge", 0)
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestServiceAccounts(context.Background(), &TestIAMTaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.serviceAccounts) != 2 {
+		t.Fatalf("expected 2 service accounts, have %d", len(project.serviceAccounts))
+	}
+	app, deploy := project.serviceAccounts[0], project.serviceAccounts[1]
+	if len(app.keys) != 0 {
+		t.Errorf("expected no keys for %s, have %d", app.gcpAccount.Email, len(app.keys))
+	}
+	if len(deploy.keys) != 2 || deploy.keys[0].old || !deploy.keys[1].old {
+		t.Errorf("expected only the ancient key of %s to be old", deploy.gcpAccount.Email)
+	}
+	if len(project.findings) != 1 {
+		t.Errorf("expected one finding, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	if out := buf.String(); strings.Count(out, " OLD") != 1 || !strings.Contains(out, "key[ancient]") {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// severity grades how urgently a finding needs attention
+type severity int
+
+const (
+	severityInfo severity = iota
+	severityWarn
+	severityCritical
+)
+
+var severityNames = []string{"info", "warn", "critical"}
+
+func (s severity) String() string {
+	return severityNames[s]
+}
+
+// parseSeverity maps a severity name onto its severity
+func parseSeverity(name string) (severity, error) {
+	for s, severityName := range severityNames {
+		if strings.EqualFold(name, severityName) {
+			return severity(s), nil
+		}
+	}
+	return severityInfo, fmt.Errorf("unknown severity %q: expecting one of %s", name, strings.Join(severityNames, ", "))
+}
+
+// exitCodes maps a severity to the exit code given when a finding of at
+// least that severity is reported, as set by --exit-code-on
+var exitCodes map[severity]int
+
+// parseExitCodes parses --exit-code-on entries such as warn=2 and critical=3
+func parseExitCodes(entries []string) (map[severity]int, error) {
+	codes := make(map[severity]int)
+	for _, entry := range entries {
+		eq := strings.Index(entry, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid --exit-code-on %q: expecting severity=code", entry)
+		}
+		s, err := parseSeverity(strings.TrimSpace(entry[:eq]))
+		if err != nil {
+			return nil, err
+		}
+		code, err := strconv.Atoi(strings.TrimSpace(entry[eq+1:]))
+		if err != nil || code < 1 || code > 125 {
+			return nil, fmt.Errorf("invalid --exit-code-on %q: expecting a code from 1 to 125", entry)
+		}
+		codes[s] = code
+	}
+	return codes, nil
+}
+
+// highestSeverity is the most severe of the projects' findings; found is
+// false when there are none.
+func highestSeverity(projects []*reportProject) (highest severity, found bool) {
+	for _, p := range projects {
+		p.findingsMu.Lock()
+		for _, f := range p.findings {
+			if !found || f.severity > highest {
+				highest, found = f.severity, true
+			}
+		}
+		p.findingsMu.Unlock()
+	}
+	return
+}
+
+// exitCodeFor is the code of the most severe mapping which the projects'
+// findings reach, or 0 when they reach none.
+func exitCodeFor(projects []*reportProject, codes map[severity]int) int {
+	highest, found := highestSeverity(projects)
+	if !found {
+		return 0
+	}
+	var mapped []int
+	for s := range codes {
+		mapped = append(mapped, int(s))
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(mapped)))
+	for _, s := range mapped {
+		if severity(s) <= highest {
+			return codes[severity(s)]
+		}
+	}
+	return 0
+}
+
+// exitCodeError ends a command that completed, but whose findings call for
+// a non-zero exit code
+type exitCodeError struct {
+	code     int
+	severity severity
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("findings of severity %s were reported", e.severity)
+}
@@ -0,0 +1,60 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/api/sqladmin/v1beta4"
+)
+
+func TestParseExitCodes(t *testing.T) {
+	codes, err := parseExitCodes([]string{"warn=2", " Critical = 3"})
+	if err != nil || len(codes) != 2 || codes[severityWarn] != 2 || codes[severityCritical] != 3 {
+		t.Errorf("unexpected codes %v (%v)", codes, err)
+	}
+	for _, bad := range []string{"warn", "severe=2", "warn=two", "critical=0", "critical=300"} {
+		if _, err := parseExitCodes([]string{bad}); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestExitCodeForSeverities(t *testing.T) {
+	healthy := &reportProject{gcpProject: gcpP[0]}
+	warned := &reportProject{gcpProject: gcpP[1]}
+	warned.addFinding(severityInfo, "topic/audit", "has no subscriptions")
+	warned.addFinding(severityWarn, "kind/orders", "newest backup is 30h0m0s old, older than 24h0m0s")
+
+	// a Cloud SQL instance whose automated backups are disabled is critical
+	critical := &reportProject{gcpProject: gcpP[2]}
+	taker := &TestSQLAdminTaker{instances: []*sqladmin.DatabaseInstance{
+		{Name: "db", Settings: &sqladmin.Settings{AvailabilityType: "REGIONAL", BackupConfiguration: &sqladmin.BackupConfiguration{}}},
+	}}
+	if err := critical.IngestSQLInstances(context.Background(), taker); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+
+	warnAndCritical := map[severity]int{severityWarn: 2, severityCritical: 3}
+	for _, tt := range []struct {
+		projects []*reportProject
+		codes    map[severity]int
+		expected int
+	}{
+		{[]*reportProject{healthy}, warnAndCritical, 0},
+		{[]*reportProject{healthy, warned}, warnAndCritical, 2},
+		{[]*reportProject{warned, critical, healthy}, warnAndCritical, 3},
+		{[]*reportProject{warned}, map[severity]int{severityCritical: 3}, 0},
+		{[]*reportProject{critical}, map[severity]int{severityWarn: 2}, 2},
+		{[]*reportProject{warned, critical}, nil, 0},
+	} {
+		if code := exitCodeFor(tt.projects, tt.codes); code != tt.expected {
+			t.Errorf("%d projects with codes %v: expected exit code %d, have %d", len(tt.projects), tt.codes, tt.expected, code)
+		}
+	}
+	if highest, found := highestSeverity([]*reportProject{warned, critical}); !found || highest != severityCritical {
+		t.Errorf("expected critical to be the highest severity, have %v", highest)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	logging "google.golang.org/api/logging/v2"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// sinksCmd represents the sinks command
+var sinksCmd = &cobra.Command{
+	Use:   "sinks",
+	Short: "Audit the Cloud Logging sinks available from given credentials",
+	Long: `Show the Cloud Logging sinks of each project visible from the account used,
+with their filter and destination. Sinks exporting logs to a destination
+outside the project's organization, such as a bucket or dataset of an external
+project, or one that cannot be seen from the account used, are flagged as
+EXTERNAL. Destinations starting with one of --allowed-destination-prefix are
+accepted wherever they are. For instance:
+    gcp-reports sinks --allowed-destination-prefix storage.googleapis.com/audit- our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		allowed := getStringSlice("allowedDestinationPrefix")
+		return runReport(args, cloudresourcemanager.CloudPlatformReadOnlyScope, func(clients *clients) (projectIngester, error) {
+			loggingService, err := logging.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish cloud logging service: %v", err)
+			}
+			storageService, err := storage.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish cloud storage service: %v", err)
+			}
+			crmService, err := cloudresourcemanager.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish cloud resource-manager service: %v", err)
+			}
+			taker := &TakerLoggingGCP{loggingService: loggingService, storageService: storageService, crmService: crmService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestSinks(ctx, taker, allowed)
+			}, nil
+		})
+	},
+}
+
+type TakerLogging interface {
+	ListSinks(context.Context, *reportProject) ([]*logging.LogSink, error)
+	// BucketProject finds the number of the project owning a storage bucket
+	BucketProject(ctx context.Context, bucket string) (string, error)
+	// ProjectOrganization finds the ID of the organization a project, given
+	// by ID or number, is under, or "" for a project outside any
+	ProjectOrganization(ctx context.Context, project string) (string, error)
+}
+
+type TakerLoggingGCP struct {
+	loggingService *logging.Service
+	storageService *storage.Service
+	crmService     *cloudresourcemanager.Service
+
+	// organizations caches the organization of each project looked up, as
+	// many sinks share their destination project
+	mu            sync.Mutex
+	organizations map[string]string
+}
+
+type reportSink struct {
+	gcpSink *logging.LogSink
+	// destinationProject is the project owning the destination, when known
+	destinationProject string
+	// external is set when the destination is outside the project's
+	// organization, or cannot be seen, and is not allowed by prefix
+	external bool
+
+	project *reportProject // parent
+}
+
+func (rs *reportSink) Parent() reportNode {
+	return rs.project
+}
+
+// ListSinks gathers the logging sinks of the project
+func (taker *TakerLoggingGCP) ListSinks(ctx context.Context, project *reportProject) (sinks []*logging.LogSink, err error) {
+	err = doWithRetry(ctx, func() error {
+		sinks = nil
+		return taker.loggingService.Projects.Sinks.List("projects/"+project.gcpProject.ProjectId).Pages(ctx, func(page *logging.ListSinksResponse) error {
+			sinks = append(sinks, page.Sinks...)
+			return nil
+		})
+	})
+	return
+}
+
+// BucketProject finds the number of the project owning the bucket
+func (taker *TakerLoggingGCP) BucketProject(ctx context.Context, bucket string) (project string, err error) {
+	err = doWithRetry(ctx, func() error {
+		gcpBucket, callErr := taker.storageService.Buckets.Get(bucket).Context(ctx).Do()
+		if callErr == nil {
+			project = fmt.Sprint(gcpBucket.ProjectNumber)
+		}
+		return callErr
+	})
+	return
+}
+
+// ProjectOrganization finds the organization at the top of the project's
+// ancestry
+func (taker *TakerLoggingGCP) ProjectOrganization(ctx context.Context, project string) (organization string, err error) {
+	taker.mu.Lock()
+	organization, ok := taker.organizations[project]
+	taker.mu.Unlock()
+	if ok {
+		return organization, nil
+	}
+	err = doWithRetry(ctx, func() error {
+		ancestry, callErr := taker.crmService.Projects.GetAncestry(project, &cloudresourcemanager.GetAncestryRequest{}).Context(ctx).Do()
+		if callErr != nil {
+			return callErr
+		}
+		organization = ""
+		for _, ancestor := range ancestry.Ancestor {
+			if ancestor.ResourceId != nil && ancestor.ResourceId.Type == "organization" {
+				organization = ancestor.ResourceId.Id
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	taker.mu.Lock()
+	defer taker.mu.Unlock()
+	if taker.organizations == nil {
+		taker.organizations = make(map[string]string)
+	}
+	taker.organizations[project] = organization
+	return organization, nil
+}
+
+// destinationResource splits a sink destination into the project it names,
+// eg for bigquery.googleapis.com/projects/p/datasets/d, or the storage bucket
+// it names, eg for storage.googleapis.com/b
+func destinationResource(destination string) (project, bucket string) {
+	if strings.HasPrefix(destination, "storage.googleapis.com/") {
+		return "", strings.TrimPrefix(destination, "storage.googleapis.com/")
+	}
+	parts := strings.Split(destination, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "projects" {
+			return parts[i+1], ""
+		}
+	}
+	return "", ""
+}
+
+// IngestSinks ingests the project's logging sinks ordered by name and marks
+// those exporting outside the project's organization, unless their
+// destination starts with one of allowed.
+func (p *reportProject) IngestSinks(ctx context.Context, taker TakerLogging, allowed []string) error {
+	var gcpSinks []*logging.LogSink
+	listErr := limited(func() (err error) {
+		gcpSinks, err = taker.ListSinks(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+	if len(gcpSinks) == 0 {
+		return nil
+	}
+	var organization string
+	orgErr := limited(func() (err error) {
+		organization, err = taker.ProjectOrganization(ctx, p.gcpProject.ProjectId)
+		return
+	})
+	if orgErr != nil {
+		return orgErr
+	}
+
+	for _, gcpSink := range gcpSinks {
+		sink := &reportSink{gcpSink: gcpSink, project: p}
+		p.sinks = append(p.sinks, sink)
+		if sinkErr := sink.CheckDestination(ctx, taker, organization, allowed); sinkErr != nil {
+			return sinkErr
+		}
+	}
+	sort.Slice(p.sinks, func(i, j int) bool { return p.sinks[i].gcpSink.Name < p.sinks[j].gcpSink.Name })
+	return nil
+}
+
+// CheckDestination marks the sink external when its destination is not
+// allowed by prefix, and is owned by a project under another organization
+// than the sink project's, or by one the account used cannot see.
+func (rs *reportSink) CheckDestination(ctx context.Context, taker TakerLogging, organization string, allowed []string) error {
+	destination := rs.gcpSink.Destination
+	for _, prefix := range allowed {
+		if prefix != "" && strings.HasPrefix(destination, prefix) {
+			return nil
+		}
+	}
+	project, bucket := destinationResource(destination)
+	if bucket != "" {
+		err := limited(func() (err error) {
+			project, err = taker.BucketProject(ctx, bucket)
+			return
+		})
+		if err != nil && !isPermissionDenied(err) && !isNotFound(err) {
+			return err
+		}
+	}
+	rs.destinationProject = project
+
+	own := rs.project.gcpProject
+	if project == own.ProjectId || project == fmt.Sprint(own.ProjectNumber) {
+		return nil
+	}
+	problem := fmt.Sprintf("exports logs to %s, which cannot be seen from here", destination)
+	if project != "" {
+		var destinationOrganization string
+		err := limited(func() (err error) {
+			destinationOrganization, err = taker.ProjectOrganization(ctx, project)
+			return
+		})
+		switch {
+		case err == nil && organization != "" && destinationOrganization == organization:
+			return nil
+		case err == nil:
+			problem = fmt.Sprintf("exports logs to %s, of project %s outside the organization", destination, project)
+		case !isPermissionDenied(err) && !isNotFound(err):
+			return err
+		}
+	}
+	rs.external = true
+	rs.project.addFinding(severityWarn, "sink/"+rs.gcpSink.Name, problem)
+	return nil
+}
+
+// displaySinks shows the sinks as a table
+func displaySinks(w io.Writer, sinks []*reportSink) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  SINK\tDESTINATION\tDESTINATION PROJECT\tFILTER\tSTATUS")
+	for _, sink := range sinks {
+		gcpSink := sink.gcpSink
+		status := healthy("OK")
+		if sink.external {
+			status = alert("EXTERNAL")
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%s\t%s\n", gcpSink.Name, ellipsize(gcpSink.Destination, 40, 16),
+			supplyDefault(sink.destinationProject, "-"), supplyDefault(ellipsize(gcpSink.Filter, 40, 16), "-"), status)
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(sinksCmd)
+
+	sinksCmd.Flags().StringSlice("allowed-destination-prefix", []string{}, "comma-separated sink destination prefixes to accept wherever they are, eg storage.googleapis.com/audit-")
+	viper.BindPFlag("allowedDestinationPrefix", sinksCmd.Flags().Lookup("allowed-destination-prefix"))
+}
@@ -0,0 +1,105 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+	logging "google.golang.org/api/logging/v2"
+)
+
+var p2sinks = map[string][]*logging.LogSink{
+	"test1-project-000": []*logging.LogSink{
+		&logging.LogSink{Name: "partner", Destination: "storage.googleapis.com/partner-logs", Filter: "severity>=ERROR"},
+		&logging.LogSink{Name: "central", Destination: "bigquery.googleapis.com/projects/test1-project-001/datasets/logs"},
+		&logging.LogSink{Name: "own", Destination: "storage.googleapis.com/own-logs"},
+		&logging.LogSink{Name: "hidden", Destination: "pubsub.googleapis.com/projects/elsewhere/topics/logs"},
+		&logging.LogSink{Name: "audit", Destination: "storage.googleapis.com/audit-logs"},
+	},
+}
+
+var bucket2project = map[string]string{
+	"partner-logs": "999",
+	"own-logs":     "test1-project-000",
+	"audit-logs":   "999",
+}
+
+var project2organization = map[string]string{
+	"test1-project-000": "100",
+	"test1-project-001": "100",
+	"999":               "200",
+}
+
+type TestLoggingTaker struct{}
+
+func (tt *TestLoggingTaker) ListSinks(ctx context.Context, rp *reportProject) ([]*logging.LogSink, error) {
+	return p2sinks[rp.gcpProject.ProjectId], nil
+}
+
+func (tt *TestLoggingTaker) BucketProject(ctx context.Context, bucket string) (string, error) {
+	return bucket2project[bucket], nil
+}
+
+func (tt *TestLoggingTaker) ProjectOrganization(ctx context.Context, project string) (string, error) {
+	organization, ok := project2organization[project]
+	if !ok {
+		return "", &googleapi.Error{Code: http.StatusForbidden}
+	}
+	return organization, nil
+}
+
+func TestIngestSinks(t *testing.T) {
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestSinks(context.Background(), &TestLoggingTaker{}, []string{"storage.googleapis.com/audit-"}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	var names, external []string
+	for _, sink := range project.sinks {
+		names = append(names, sink.gcpSink.Name)
+		if sink.external {
+			external = append(external, sink.gcpSink.Name)
+		}
+	}
+	if strings.Join(names, ",") != "audit,central,hidden,own,partner" {
+		t.Errorf("expected the sinks in name order, have %v", names)
+	}
+	if strings.Join(external, ",") != "hidden,partner" {
+		t.Errorf("expected the external and unseen destinations alone flagged, have %v", external)
+	}
+	if len(project.findings) != 2 || project.findings[0].resource != "sink/partner" ||
+		!strings.Contains(project.findings[0].problem, "of project 999 outside the organization") ||
+		!strings.Contains(project.findings[1].problem, "cannot be seen") {
+		t.Errorf("unexpected findings %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	for _, expected := range []string{"project[test1-project-000]: 5 logging sinks", "EXTERNAL", "severity>=ERROR", "test1-project-001"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in the display, have:\n%s", expected, out)
+		}
+	}
+}
+
+func TestDestinationResource(t *testing.T) {
+	for _, tt := range []struct {
+		destination, project, bucket string
+	}{
+		{"storage.googleapis.com/logs", "", "logs"},
+		{"bigquery.googleapis.com/projects/p1/datasets/d", "p1", ""},
+		{"pubsub.googleapis.com/projects/p2/topics/t", "p2", ""},
+		{"logging.googleapis.com/projects/p3/locations/global/buckets/b", "p3", ""},
+		{"unknown", "", ""},
+	} {
+		if project, bucket := destinationResource(tt.destination); project != tt.project || bucket != tt.bucket {
+			t.Errorf("%s: expected project[%s] bucket[%s], have project[%s] bucket[%s]", tt.destination, tt.project, tt.bucket, project, bucket)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// snapshotsCmd represents the snapshots command
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "Report on persistent disk snapshots",
+	Long: `Show the persistent disks of each project visible from the account used,
+with how many snapshots each has and when the newest ready one was taken. As
+with backups, disks whose newest snapshot is older than the --within interval
+(default 24h) are flagged as STALE, and disks without any as NO-SNAPSHOTS.
+With --verbose, the snapshots themselves are listed too. For instance:
+    gcp-reports snapshots --within 168h our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, compute.ComputeReadonlyScope, func(clients *clients) (projectIngester, error) {
+			computeService, err := compute.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot establish compute engine service: %v", err)
+			}
+			taker := &TakerDisksGCP{computeService: computeService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestDisks(ctx, taker, time.Now())
+			}, nil
+		})
+	},
+}
+
+type TakerDisks interface {
+	ListDisks(context.Context, *reportProject) ([]*compute.Disk, error)
+	ListSnapshots(context.Context, *reportProject) ([]*compute.Snapshot, error)
+}
+
+type TakerDisksGCP struct {
+	computeService *compute.Service
+}
+
+type reportDisk struct {
+	gcpDisk   *compute.Disk
+	snapshots []*reportSnapshot
+	// newestSnapshot is when the newest ready snapshot was taken
+	newestSnapshot time.Time
+	stale          bool
+
+	project *reportProject // parent
+}
+
+type reportSnapshot struct {
+	gcpSnapshot  *compute.Snapshot
+	creationTime time.Time
+
+	disk *reportDisk // parent
+}
+
+func (rd *reportDisk) Parent() reportNode {
+	return rd.project
+}
+
+// ListDisks gathers the persistent disks of the project across all its zones and regions
+func (taker *TakerDisksGCP) ListDisks(ctx context.Context, project *reportProject) (disks []*compute.Disk, err error) {
+	err = doWithRetry(ctx, func() error {
+		disks = nil
+		return taker.computeService.Disks.AggregatedList(project.gcpProject.ProjectId).Pages(ctx, func(page *compute.DiskAggregatedList) error {
+			for _, scoped := range page.Items {
+				disks = append(disks, scoped.Disks...)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// ListSnapshots gathers the disk snapshots of the project
+func (taker *TakerDisksGCP) ListSnapshots(ctx context.Context, project *reportProject) (snapshots []*compute.Snapshot, err error) {
+	err = doWithRetry(ctx, func() error {
+		snapshots = nil
+		return taker.computeService.Snapshots.List(project.gcpProject.ProjectId).Pages(ctx, func(page *compute.SnapshotList) error {
+			snapshots = append(snapshots, page.Items...)
+			return nil
+		})
+	})
+	return
+}
+
+// IngestDisks ingests the project's disks ordered by name, each with its
+// snapshots oldest first, and marks the disks without a ready snapshot taken
+// within the configured window of now. Snapshots of disks since deleted are
+// not reported.
+func (p *reportProject) IngestDisks(ctx context.Context, taker TakerDisks, now time.Time) error {
+	var gcpDisks []*compute.Disk
+	var gcpSnapshots []*compute.Snapshot
+	listErr := limited(func() (err error) {
+		gcpDisks, err = taker.ListDisks(ctx, p)
+		return
+	})
+	if listErr == nil {
+		listErr = limited(func() (err error) {
+			gcpSnapshots, err = taker.ListSnapshots(ctx, p)
+			return
+		})
+	}
+	if listErr != nil {
+		return listErr
+	}
+
+	byID := make(map[string]*reportDisk)
+	for _, gcpDisk := range gcpDisks {
+		disk := &reportDisk{gcpDisk: gcpDisk, project: p}
+		byID[fmt.Sprint(gcpDisk.Id)] = disk
+		p.disks = append(p.disks, disk)
+	}
+	sort.Slice(p.disks, func(i, j int) bool { return p.disks[i].gcpDisk.Name < p.disks[j].gcpDisk.Name })
+
+	for _, gcpSnapshot := range gcpSnapshots {
+		disk, ok := byID[gcpSnapshot.SourceDiskId]
+		if !ok {
+			continue
+		}
+		snapshot := &reportSnapshot{gcpSnapshot: gcpSnapshot, disk: disk}
+		creationTime, parseErr := time.Parse(time.RFC3339, gcpSnapshot.CreationTimestamp)
+		if parseErr != nil {
+			logger.Warnf("cannot parse creation time of snapshot %s: %v", gcpSnapshot.Name, parseErr)
+		} else {
+			snapshot.creationTime = creationTime
+			if gcpSnapshot.Status == "READY" && creationTime.After(disk.newestSnapshot) {
+				disk.newestSnapshot = creationTime
+			}
+		}
+		disk.snapshots = append(disk.snapshots, snapshot)
+	}
+
+	within := viper.GetDuration("snapshotWithin")
+	for _, disk := range p.disks {
+		sort.SliceStable(disk.snapshots, func(i, j int) bool {
+			return disk.snapshots[i].creationTime.Before(disk.snapshots[j].creationTime)
+		})
+		if now.Sub(disk.newestSnapshot) > within {
+			disk.stale = true
+			problem := fmt.Sprintf("no snapshot taken within %v", within)
+			if len(disk.snapshots) == 0 {
+				problem = "has no snapshots"
+			}
+			p.addFinding(severityWarn, "disk/"+disk.gcpDisk.Name, problem)
+		}
+	}
+	return nil
+}
+
+// location is the zone of a zonal disk, otherwise the region of a regional one
+func (rd *reportDisk) location() string {
+	if rd.gcpDisk.Zone != "" {
+		return path.Base(rd.gcpDisk.Zone)
+	}
+	return path.Base(rd.gcpDisk.Region)
+}
+
+// displayDisks shows the disks as a table, followed with --verbose by a
+// table of their snapshots
+func displayDisks(w io.Writer, disks []*reportDisk) {
+	table := newTable(w)
+	fmt.Fprintln(table, "  DISK\tLOCATION\tSIZE\tSNAPSHOTS\tNEWEST SNAPSHOT\tSTATUS")
+	for _, disk := range disks {
+		newest, status := "never", healthy("OK")
+		if !disk.newestSnapshot.IsZero() {
+			newest = formatTime(disk.newestSnapshot)
+		}
+		switch {
+		case disk.stale && len(disk.snapshots) == 0:
+			status = alert("NO-SNAPSHOTS")
+		case disk.stale:
+			status = alert("STALE")
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%dGB\t%d\t%s\t%s\n", disk.gcpDisk.Name, disk.location(), disk.gcpDisk.SizeGb,
+			len(disk.snapshots), newest, status)
+	}
+	table.Flush()
+
+	snapshots := 0
+	for _, disk := range disks {
+		snapshots += len(disk.snapshots)
+	}
+	if !verbose || snapshots == 0 {
+		return
+	}
+	table = newTable(w)
+	fmt.Fprintln(table, "  DISK\tSNAPSHOT\tSTATUS\tCREATED\tSTORED")
+	for _, disk := range disks {
+		for _, snapshot := range disk.snapshots {
+			created := "unknown"
+			if !snapshot.creationTime.IsZero() {
+				created = formatTime(snapshot.creationTime)
+			}
+			fmt.Fprintf(table, "  %s\t%s\t%s\t%s\t%d\n", disk.gcpDisk.Name, snapshot.gcpSnapshot.Name,
+				snapshot.gcpSnapshot.Status, created, snapshot.gcpSnapshot.StorageBytes)
+		}
+	}
+	table.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(snapshotsCmd)
+
+	snapshotsCmd.Flags().DurationP("within", "w", 24*time.Hour, "interval from now the newest snapshot of each disk should have been taken in")
+	viper.BindPFlag("snapshotWithin", snapshotsCmd.Flags().Lookup("within"))
+}
@@ -0,0 +1,76 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	compute "google.golang.org/api/compute/v1"
+)
+
+var p2disks = map[string][]*compute.Disk{
+	"test1-project-000": []*compute.Disk{
+		&compute.Disk{Id: 101, Name: "db-data", Zone: "projects/test1-project-000/zones/us-central1-a", SizeGb: 500},
+		&compute.Disk{Id: 102, Name: "scratch", Zone: "projects/test1-project-000/zones/us-central1-b", SizeGb: 10},
+		&compute.Disk{Id: 103, Name: "web-boot", Region: "projects/test1-project-000/regions/us-central1", SizeGb: 20},
+	},
+}
+
+var p2snapshots = map[string][]*compute.Snapshot{
+	"test1-project-000": []*compute.Snapshot{
+		&compute.Snapshot{Name: "db-data-0301", SourceDiskId: "101", Status: "READY", CreationTimestamp: "2018-03-01T02:00:00.000-08:00"},
+		&compute.Snapshot{Name: "db-data-0305", SourceDiskId: "101", Status: "READY", CreationTimestamp: "2018-03-05T02:00:00.000-08:00"},
+		&compute.Snapshot{Name: "web-boot-0309", SourceDiskId: "103", Status: "READY", CreationTimestamp: "2018-03-09T12:00:00Z"},
+		&compute.Snapshot{Name: "web-boot-0310", SourceDiskId: "103", Status: "CREATING", CreationTimestamp: "2018-03-10T00:00:00Z"},
+		&compute.Snapshot{Name: "deleted-disk-0309", SourceDiskId: "999", Status: "READY", CreationTimestamp: "2018-03-09T12:00:00Z"},
+	},
+}
+
+type TestDisksTaker struct{}
+
+func (tt *TestDisksTaker) ListDisks(ctx context.Context, rp *reportProject) ([]*compute.Disk, error) {
+	return p2disks[rp.gcpProject.ProjectId], nil
+}
+
+func (tt *TestDisksTaker) ListSnapshots(ctx context.Context, rp *reportProject) ([]*compute.Snapshot, error) {
+	return p2snapshots[rp.gcpProject.ProjectId], nil
+}
+
+func TestIngestDisks(t *testing.T) {
+	viper.Set("snapshotWithin", 24*time.Hour)
+	defer viper.Set("snapshotWithin", 0)
+	now := time.Date(2018, 3, 10, 1, 0, 0, 0, time.UTC)
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestDisks(context.Background(), &TestDisksTaker{}, now); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.disks) != 3 {
+		t.Fatalf("expected 3 disks, have %d", len(project.disks))
+	}
+	dbData, scratch, webBoot := project.disks[0], project.disks[1], project.disks[2]
+	if !dbData.stale || len(dbData.snapshots) != 2 || dbData.snapshots[1].gcpSnapshot.Name != "db-data-0305" {
+		t.Errorf("expected db-data to have 2 snapshots, newest last, and be stale")
+	}
+	if !scratch.stale || len(scratch.snapshots) != 0 {
+		t.Errorf("expected scratch to have no snapshots and be stale")
+	}
+	if webBoot.stale || !webBoot.newestSnapshot.Equal(time.Date(2018, 3, 9, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected web-boot to be fresh from its newest ready snapshot, have %v", webBoot.newestSnapshot)
+	}
+	if len(project.findings) != 2 || project.findings[1].problem != "has no snapshots" {
+		t.Errorf("expected findings for db-data and scratch, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	if strings.Count(out, "STALE") != 1 || strings.Count(out, "NO-SNAPSHOTS") != 1 || !strings.Contains(out, "us-central1-a") {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
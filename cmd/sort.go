@@ -0,0 +1,101 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	sortProject   = "project"
+	sortEnv       = "env"
+	sortComponent = "component"
+	sortStaleness = "staleness"
+)
+
+var sortNames = []string{sortProject, sortEnv, sortComponent, sortStaleness}
+
+// checkSort rejects a --sort that is not one of sortNames
+func checkSort(name string) error {
+	if !containsString(sortNames, name) {
+		return fmt.Errorf("unknown sort %q: expecting one of %v", name, sortNames)
+	}
+	return nil
+}
+
+// sortProjects orders the projects in place as --sort asks, by project ID
+// when otherwise equal. By staleness, the projects with the most severe
+// findings come first, and of those the ones with the most findings.
+func sortProjects(projects []*reportProject) {
+	byID := func(i, j int) bool { return projects[i].gcpProject.ProjectId < projects[j].gcpProject.ProjectId }
+	less := byID
+	switch viper.GetString("sort") {
+	case sortEnv:
+		less = func(i, j int) bool {
+			if projects[i].env != projects[j].env {
+				return projects[i].env < projects[j].env
+			}
+			return byID(i, j)
+		}
+	case sortComponent:
+		less = func(i, j int) bool {
+			if projects[i].component != projects[j].component {
+				return projects[i].component < projects[j].component
+			}
+			return byID(i, j)
+		}
+	case sortStaleness:
+		type staleness struct {
+			highest  severity
+			found    bool
+			findings int
+		}
+		grades := make(map[*reportProject]staleness, len(projects))
+		for _, p := range projects {
+			highest, found := highestSeverity([]*reportProject{p})
+			p.findingsMu.Lock()
+			grades[p] = staleness{highest: highest, found: found, findings: len(p.findings)}
+			p.findingsMu.Unlock()
+		}
+		less = func(i, j int) bool {
+			gi, gj := grades[projects[i]], grades[projects[j]]
+			switch {
+			case gi.found != gj.found:
+				return gi.found
+			case gi.highest != gj.highest:
+				return gi.highest > gj.highest
+			case gi.findings != gj.findings:
+				return gi.findings > gj.findings
+			}
+			return byID(i, j)
+		}
+	}
+	sort.SliceStable(projects, less)
+}
+
+// kindNames lists the bucket's kinds alphabetically, so that whatever is
+// done kind by kind happens in the same order on every run
+func (rb *reportBucket) kindNames() []string {
+	var kinds []string
+	for kind := range rb.kindMap {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// sortedKinds lists the bucket's kinds by name or, sorting by staleness,
+// those with the oldest newest backup first
+func (rb *reportBucket) sortedKinds() []string {
+	kinds := rb.kindNames()
+	if viper.GetString("sort") == sortStaleness {
+		sort.SliceStable(kinds, func(i, j int) bool {
+			return rb.kindMap[kinds[i]][0].updateTime.Before(rb.kindMap[kinds[j]][0].updateTime)
+		})
+	}
+	return kinds
+}
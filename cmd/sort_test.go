@@ -0,0 +1,117 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	storage "google.golang.org/api/storage/v1"
+)
+
+func sortFixture() []*reportProject {
+	var projects []*reportProject
+	for _, fixture := range []struct{ id, env string }{
+		{"p-d", "prod"},
+		{"p-a", "test"},
+		{"p-c", "dev"},
+		{"p-b", "prod"},
+	} {
+		projects = append(projects, &reportProject{gcpProject: &cloudresourcemanager.Project{ProjectId: fixture.id}, env: fixture.env})
+	}
+	return projects
+}
+
+func projectIDs(projects []*reportProject) (ids []string) {
+	for _, p := range projects {
+		ids = append(ids, p.gcpProject.ProjectId)
+	}
+	return
+}
+
+func TestSortProjects(t *testing.T) {
+	defer viper.Set("sort", viper.GetString("sort"))
+
+	viper.Set("sort", sortEnv)
+	projects := sortFixture()
+	sortProjects(projects)
+	if ids := projectIDs(projects); !reflect.DeepEqual(ids, []string{"p-c", "p-b", "p-d", "p-a"}) {
+		t.Errorf("expected projects by env then ID, have %v", ids)
+	}
+
+	viper.Set("sort", sortStaleness)
+	projects = sortFixture()
+	projects[0].addFinding(severityWarn, "sql/db", "no backup completed within 24h0m0s")
+	projects[1].addFinding(severityWarn, "sql/db", "no backup completed within 24h0m0s")
+	projects[1].addFinding(severityInfo, "object/x", "is not under backup/<component>/<env>/")
+	projects[2].addFinding(severityCritical, "kind/Widget", "no backup object found")
+	sortProjects(projects)
+	if ids := projectIDs(projects); !reflect.DeepEqual(ids, []string{"p-c", "p-a", "p-d", "p-b"}) {
+		t.Errorf("expected the most severe and numerous findings first, have %v", ids)
+	}
+
+	if checkSort("age") == nil {
+		t.Error("expected an unknown sort to be refused")
+	}
+}
+
+func TestSortedKinds(t *testing.T) {
+	defer viper.Set("sort", viper.GetString("sort"))
+	now := time.Now()
+	bucket := &reportBucket{kindMap: map[string][]*reportObject{
+		"Widget": {{updateTime: now.Add(-2 * time.Hour)}},
+		"Gadget": {{updateTime: now.Add(-time.Hour)}},
+		"Gizmo":  {{updateTime: now.Add(-3 * time.Hour)}},
+	}}
+
+	viper.Set("sort", sortProject)
+	if kinds := bucket.sortedKinds(); !reflect.DeepEqual(kinds, []string{"Gadget", "Gizmo", "Widget"}) {
+		t.Errorf("expected kinds by name, have %v", kinds)
+	}
+	viper.Set("sort", sortStaleness)
+	if kinds := bucket.sortedKinds(); !reflect.DeepEqual(kinds, []string{"Gizmo", "Widget", "Gadget"}) {
+		t.Errorf("expected the stalest kinds first, have %v", kinds)
+	}
+}
+
+func TestKindOutputStable(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+	viper.Set("timeFormat", timeFormatRFC3339)
+	defer viper.Set("timeFormat", timeFormatRelative)
+	run := func() (string, []string) {
+		project := &reportProject{gcpProject: gcpP[0]}
+		bucket := &reportBucket{gcpBucket: &storage.Bucket{Id: "golden-backups", Name: "golden-backups"}, isBackup: true, project: project}
+		for i, kind := range []string{"Widget", "Gadget", "Sprocket", "Gizmo", "Cog", "Lever", "Pulley", "Wheel"} {
+			bucket.objects = append(bucket.objects, &reportObject{gcpObject: &storage.Object{Id: "golden-backups/datastore." + kind + ".backup_info"},
+				kind: kind, updateTime: now.Add(-time.Duration(i) * 12 * time.Hour)})
+		}
+		bucket.UpdateKindMap()
+		bucket.CheckFreshness(now, 24*time.Hour)
+		var buf bytes.Buffer
+		bucket.Display(&buf)
+		var resources []string
+		for _, f := range project.findings {
+			resources = append(resources, f.resource)
+		}
+		return buf.String(), resources
+	}
+
+	first, firstFindings := run()
+	for i := 0; i < 10; i++ {
+		if out, findings := run(); out != first || !reflect.DeepEqual(findings, firstFindings) {
+			t.Fatalf("expected identical output on every run, have:\n%s\nthen:\n%s", first, out)
+		}
+	}
+	if !reflect.DeepEqual(firstFindings, []string{"kind/Cog", "kind/Gizmo", "kind/Lever", "kind/Pulley", "kind/Wheel"}) {
+		t.Errorf("expected stale kinds found alphabetically, have %v", firstFindings)
+	}
+	if cog, widget := strings.Index(first, "Cog"), strings.Index(first, "Widget"); cog < 0 || widget < cog {
+		t.Errorf("expected kinds displayed alphabetically:\n%s", first)
+	}
+}
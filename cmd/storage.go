@@ -0,0 +1,155 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// storageCmd represents the storage command
+var storageCmd = &cobra.Command{
+	Use:   "storage",
+	Short: "Audit the Cloud Storage buckets available from given credentials",
+	Long: `Audit every Cloud Storage bucket of each project visible from the account
+used, not only the backup buckets: versioning, number of lifecycle rules,
+retention policy and whether the bucket is readable by anyone. Buckets open
+to allUsers or allAuthenticatedUsers are flagged as PUBLIC, and buckets
+without any lifecycle rule as NO-LIFECYCLE. For instance:
+    gcp-reports storage our-foo
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(args, storage.CloudPlatformReadOnlyScope, func(clients *clients) (projectIngester, error) {
+			storageService, err := storage.New(clients.http)
+			if err != nil {
+				return nil, fmt.Errorf("cannot use storage API successfully: %v", err)
+			}
+			taker := &TakerStorageGCP{storageService: storageService}
+			return func(ctx context.Context, project *reportProject) error {
+				return project.IngestBucketAudit(ctx, taker)
+			}, nil
+		})
+	},
+}
+
+type TakerBucketAudit interface {
+	ListBuckets(context.Context, *reportProject) ([]*storage.Bucket, error)
+	GetBucketIamPolicy(context.Context, *reportBucket) (*storage.Policy, error)
+}
+
+// bucketAudit holds the configuration of a bucket that matters for its upkeep
+type bucketAudit struct {
+	versioning      bool
+	lifecycleRules  int
+	retention       time.Duration
+	retentionLocked bool
+	public          bool
+}
+
+// publicMembers are the IAM and ACL entities making a bucket readable by anyone
+var publicMembers = []string{"allUsers", "allAuthenticatedUsers"}
+
+// GetBucketIamPolicy fetches the IAM policy of the bucket
+func (taker TakerStorageGCP) GetBucketIamPolicy(ctx context.Context, bucket *reportBucket) (policy *storage.Policy, err error) {
+	err = doWithRetry(ctx, func() (callErr error) {
+		policy, callErr = taker.storageService.Buckets.GetIamPolicy(bucket.gcpBucket.Name).Context(ctx).Do()
+		return
+	})
+	return
+}
+
+// IngestBucketAudit ingests every bucket of the project with its audit details
+func (p *reportProject) IngestBucketAudit(ctx context.Context, taker TakerBucketAudit) error {
+	var gcpBuckets []*storage.Bucket
+	listErr := limited(func() (err error) {
+		gcpBuckets, err = taker.ListBuckets(ctx, p)
+		return
+	})
+	if listErr != nil {
+		return listErr
+	}
+	for _, gcpBucket := range gcpBuckets {
+		bucket := &reportBucket{gcpBucket: gcpBucket, project: p}
+		if err := bucket.IngestAudit(ctx, taker); err != nil {
+			return err
+		}
+		p.storageBuckets = append(p.storageBuckets, bucket)
+	}
+	sort.Slice(p.storageBuckets, func(i, j int) bool {
+		return p.storageBuckets[i].gcpBucket.Name < p.storageBuckets[j].gcpBucket.Name
+	})
+	return nil
+}
+
+// IngestAudit fills in the bucket's audit from its configuration and IAM policy
+func (rb *reportBucket) IngestAudit(ctx context.Context, taker TakerBucketAudit) error {
+	var policy *storage.Policy
+	policyErr := limited(func() (err error) {
+		policy, err = taker.GetBucketIamPolicy(ctx, rb)
+		return
+	})
+	if policyErr != nil {
+		return policyErr
+	}
+
+	gcpBucket := rb.gcpBucket
+	audit := &bucketAudit{}
+	if gcpBucket.Versioning != nil {
+		audit.versioning = gcpBucket.Versioning.Enabled
+	}
+	if gcpBucket.Lifecycle != nil {
+		audit.lifecycleRules = len(gcpBucket.Lifecycle.Rule)
+	}
+	if gcpBucket.RetentionPolicy != nil {
+		audit.retention = time.Duration(gcpBucket.RetentionPolicy.RetentionPeriod) * time.Second
+		audit.retentionLocked = gcpBucket.RetentionPolicy.IsLocked
+	}
+	for _, binding := range policy.Bindings {
+		for _, member := range binding.Members {
+			if containsString(publicMembers, member) {
+				audit.public = true
+			}
+		}
+	}
+	for _, acl := range gcpBucket.Acl {
+		if containsString(publicMembers, acl.Entity) {
+			audit.public = true
+		}
+	}
+	rb.audit = audit
+
+	name := "bucket/" + gcpBucket.Name
+	if audit.public {
+		rb.project.addFinding(severityCritical, name, "is publicly readable")
+	}
+	if audit.lifecycleRules == 0 {
+		rb.project.addFinding(severityInfo, name, "has no lifecycle rule")
+	}
+	return nil
+}
+
+// DisplayAudit shows the bucket's audit on a single line
+func (rb *reportBucket) DisplayAudit(w io.Writer) {
+	audit := rb.audit
+	fmt.Fprintf(w, "  bucket[%32s] location[%12s] versioning[%t] lifecycle-rules[%d] retention[%v] locked[%t]",
+		rb.gcpBucket.Name, rb.gcpBucket.Location, audit.versioning, audit.lifecycleRules,
+		audit.retention, audit.retentionLocked)
+	if audit.public {
+		fmt.Fprintf(w, " %s", alert("PUBLIC"))
+	}
+	if audit.lifecycleRules == 0 {
+		fmt.Fprintf(w, " %s", alert("NO-LIFECYCLE"))
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+func init() {
+	RootCmd.AddCommand(storageCmd)
+}
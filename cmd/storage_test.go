@@ -0,0 +1,79 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+var p2auditBuckets = map[string][]*storage.Bucket{
+	"test1-project-000": []*storage.Bucket{
+		&storage.Bucket{Name: "tidy", Location: "US",
+			Versioning:      &storage.BucketVersioning{Enabled: true},
+			Lifecycle:       &storage.BucketLifecycle{Rule: []*storage.BucketLifecycleRule{&storage.BucketLifecycleRule{}, &storage.BucketLifecycleRule{}}},
+			RetentionPolicy: &storage.BucketRetentionPolicy{RetentionPeriod: 86400, IsLocked: true}},
+		&storage.Bucket{Name: "open", Location: "EU"},
+		&storage.Bucket{Name: "legacy-acl", Location: "EU",
+			Acl: []*storage.BucketAccessControl{&storage.BucketAccessControl{Entity: "allAuthenticatedUsers"}}},
+	},
+}
+
+var bucket2policy = map[string]*storage.Policy{
+	"open": &storage.Policy{Bindings: []*storage.PolicyBindings{
+		&storage.PolicyBindings{Role: "roles/storage.objectViewer", Members: []string{"allUsers"}},
+	}},
+}
+
+type TestBucketAuditTaker struct{}
+
+func (tt *TestBucketAuditTaker) ListBuckets(ctx context.Context, rp *reportProject) ([]*storage.Bucket, error) {
+	return p2auditBuckets[rp.gcpProject.ProjectId], nil
+}
+
+func (tt *TestBucketAuditTaker) GetBucketIamPolicy(ctx context.Context, rb *reportBucket) (*storage.Policy, error) {
+	if policy, ok := bucket2policy[rb.gcpBucket.Name]; ok {
+		return policy, nil
+	}
+	return &storage.Policy{}, nil
+}
+
+func TestIngestBucketAudit(t *testing.T) {
+	project := filterFixture(fpTT[0])[0]
+	if err := project.IngestBucketAudit(context.Background(), &TestBucketAuditTaker{}); err != nil {
+		t.Fatalf("unexpected ingest error: %v", err)
+	}
+	if len(project.storageBuckets) != 3 {
+		t.Fatalf("expected 3 buckets, have %d", len(project.storageBuckets))
+	}
+	audits := make(map[string]*bucketAudit)
+	for _, bucket := range project.storageBuckets {
+		audits[bucket.gcpBucket.Name] = bucket.audit
+	}
+	tidy := audits["tidy"]
+	if !tidy.versioning || tidy.lifecycleRules != 2 || tidy.retention != 24*time.Hour || !tidy.retentionLocked || tidy.public {
+		t.Errorf("unexpected audit of tidy bucket: %+v", tidy)
+	}
+	if open := audits["open"]; !open.public || open.versioning || open.lifecycleRules != 0 {
+		t.Errorf("unexpected audit of open bucket: %+v", open)
+	}
+	if !audits["legacy-acl"].public {
+		t.Errorf("expected a bucket with a public ACL to be flagged")
+	}
+	if len(project.findings) != 4 {
+		t.Errorf("expected 4 findings, have %v", project.findings)
+	}
+
+	var buf bytes.Buffer
+	project.Display(&buf)
+	out := buf.String()
+	if strings.Count(out, "PUBLIC") != 2 || strings.Count(out, "NO-LIFECYCLE") != 2 {
+		t.Errorf("unexpected display:\n%s", out)
+	}
+}
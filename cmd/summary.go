@@ -0,0 +1,109 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+)
+
+// reportSummary tallies an ingested report tree
+type reportSummary struct {
+	Projects     int `json:"projects"`
+	Applications int `json:"applications"`
+	Services     int `json:"services"`
+	Versions     int `json:"versions"`
+	Instances    int `json:"instances"`
+
+	SQLInstances      int `json:"sqlInstances"`
+	StaleSQLInstances int `json:"staleSqlInstances"`
+	SQLBackupsOff     int `json:"sqlBackupsOff"`
+	SQLNoPITR         int `json:"sqlNoPitr"`
+	BackupBuckets     int `json:"backupBuckets"`
+	MislocatedBuckets int `json:"mislocatedBuckets"`
+	StaleKinds        int `json:"staleKinds"`
+	MissingKinds      int `json:"missingKinds"`
+}
+
+// Summarize walks what has been ingested for the project and counts it up
+func (p *reportProject) Summarize() reportSummary {
+	summary := reportSummary{Projects: 1}
+	if app := p.application; app != nil {
+		summary.Applications++
+		for _, service := range app.services {
+			summary.Services++
+			for _, version := range service.versions {
+				summary.Versions++
+				summary.Instances += len(version.instances)
+			}
+		}
+	}
+	for _, instance := range p.sqlInstances {
+		summary.SQLInstances++
+		if instance.stale {
+			summary.StaleSQLInstances++
+		}
+		if instance.backupsDisabled {
+			summary.SQLBackupsOff++
+		}
+		if instance.noPITR {
+			summary.SQLNoPITR++
+		}
+	}
+	for _, bucket := range p.backupBuckets {
+		if bucket.isBackup {
+			summary.BackupBuckets++
+			if bucket.mislocated {
+				summary.MislocatedBuckets++
+			}
+			summary.StaleKinds += len(bucket.staleKinds)
+		}
+	}
+	summary.MissingKinds = len(p.missingKinds)
+	return summary
+}
+
+// summarizeProjects adds up the summaries of all the projects
+func summarizeProjects(projects []*reportProject) reportSummary {
+	var total reportSummary
+	for _, project := range projects {
+		total.add(project.Summarize())
+	}
+	return total
+}
+
+func (s *reportSummary) add(other reportSummary) {
+	s.Projects += other.Projects
+	s.Applications += other.Applications
+	s.Services += other.Services
+	s.Versions += other.Versions
+	s.Instances += other.Instances
+	s.SQLInstances += other.SQLInstances
+	s.StaleSQLInstances += other.StaleSQLInstances
+	s.SQLBackupsOff += other.SQLBackupsOff
+	s.SQLNoPITR += other.SQLNoPITR
+	s.BackupBuckets += other.BackupBuckets
+	s.MislocatedBuckets += other.MislocatedBuckets
+	s.StaleKinds += other.StaleKinds
+	s.MissingKinds += other.MissingKinds
+}
+
+// DisplayApps shows the footer of the apps report
+func (s reportSummary) DisplayApps(w io.Writer) {
+	fmt.Fprintf(w, "summary: projects[%d] apps[%d] services[%d] versions[%d] instances[%d]\n",
+		s.Projects, s.Applications, s.Services, s.Versions, s.Instances)
+}
+
+// DisplayBackups shows the footer of the backups report
+func (s reportSummary) DisplayBackups(w io.Writer) {
+	fmt.Fprintf(w, "summary: projects[%d] sql instances[%d] stale[%d] backups off[%d] no pitr[%d] backup buckets[%d] mislocated[%d] kinds stale[%d] missing[%d]\n",
+		s.Projects, s.SQLInstances, s.StaleSQLInstances, s.SQLBackupsOff, s.SQLNoPITR, s.BackupBuckets, s.MislocatedBuckets, s.StaleKinds, s.MissingKinds)
+}
+
+// BackupProblems counts what --fail-on-stale fails the backups report for:
+// stale or missing backups, SQL instances without backups or PITR, and
+// backup buckets outside the allowed locations
+func (s reportSummary) BackupProblems() int {
+	return s.StaleSQLInstances + s.SQLBackupsOff + s.SQLNoPITR + s.StaleKinds + s.MissingKinds + s.MislocatedBuckets
+}
@@ -0,0 +1,51 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	storage "google.golang.org/api/storage/v1"
+)
+
+func TestSummarize(t *testing.T) {
+	apps := goldenProject()
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+
+	backups := &reportProject{gcpProject: gcpP[1], missingKinds: []string{"Gizmo"}}
+	for _, endTime := range []string{"2017-06-02T01:00:00Z", "2017-05-01T01:00:00Z"} {
+		instance := &reportSQLInstance{
+			gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "db-" + endTime[5:10]},
+			backupRuns:     []*reportBackupRun{{gcpBackupRun: &sqladmin.BackupRun{Status: "SUCCESSFUL", EndTime: endTime}}},
+			project:        backups,
+		}
+		instance.CheckFreshness(now, 24*time.Hour)
+		backups.sqlInstances = append(backups.sqlInstances, instance)
+	}
+	backups.backupBuckets = []*reportBucket{
+		{gcpBucket: &storage.Bucket{Name: "b1"}, isBackup: true, staleKinds: map[string]bool{"Widget": true}, project: backups},
+		{gcpBucket: &storage.Bucket{Name: "b2"}, project: backups},
+	}
+
+	expected := reportSummary{
+		Projects: 2, Applications: 1, Services: 1, Versions: 2, Instances: 1,
+		SQLInstances: 2, StaleSQLInstances: 1, BackupBuckets: 1, StaleKinds: 1, MissingKinds: 1,
+	}
+	summary := summarizeProjects([]*reportProject{apps, backups})
+	if summary != expected {
+		t.Errorf("expected summary %+v, have %+v", expected, summary)
+	}
+
+	var buf bytes.Buffer
+	summary.DisplayApps(&buf)
+	summary.DisplayBackups(&buf)
+	const display = "summary: projects[2] apps[1] services[1] versions[2] instances[1]\n" +
+		"summary: projects[2] sql instances[2] stale[1] backups off[0] no pitr[0] backup buckets[1] mislocated[0] kinds stale[1] missing[1]\n"
+	if buf.String() != display {
+		t.Errorf("unexpected display:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// reportTemplate is set by --template or --template-string, and takes
+// precedence over --format
+var reportTemplate *template.Template
+
+// templateNow is the clock the ago template func measures from
+var templateNow = time.Now
+
+var templateFuncs = template.FuncMap{
+	"duration": humanDuration,
+	"ago":      ago,
+	"join":     strings.Join,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+}
+
+// ago shows how long before now t was; t may be a time or a time pointer,
+// with a nil or zero time shown as never
+func ago(t interface{}) string {
+	var when time.Time
+	switch t := t.(type) {
+	case time.Time:
+		when = t
+	case *time.Time:
+		if t != nil {
+			when = *t
+		}
+	}
+	if when.IsZero() {
+		return "never"
+	}
+	return relativeTime(when, templateNow())
+}
+
+// humanDuration shows a duration in its two largest units, eg 3d4h or 5m10s,
+// dropping the second when it is zero
+func humanDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + humanDuration(-d)
+	}
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}}
+	var parts []string
+	for _, unit := range units {
+		if count := d / unit.size; count > 0 || len(parts) > 0 {
+			parts = append(parts, fmt.Sprintf("%d%s", count, unit.suffix))
+			d -= count * unit.size
+		}
+		if len(parts) == 2 {
+			break
+		}
+	}
+	if len(parts) == 2 && strings.HasPrefix(parts[1], "0") {
+		parts = parts[:1]
+	}
+	return strings.Join(parts, "")
+}
+
+// setupTemplate parses the template named by --template, or given inline by
+// --template-string; with neither, it leaves output to --format
+func setupTemplate(file, text string) (err error) {
+	reportTemplate = nil
+	switch {
+	case file != "" && text != "":
+		return errors.New("only one of --template and --template-string may be given")
+	case file != "":
+		content, readErr := ioutil.ReadFile(file)
+		if readErr != nil {
+			return fmt.Errorf("cannot read template: %v", readErr)
+		}
+		text = string(content)
+	case text == "":
+		return nil
+	}
+	reportTemplate, err = template.New("report").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return fmt.Errorf("cannot parse template: %v", err)
+	}
+	return nil
+}
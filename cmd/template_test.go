@@ -0,0 +1,77 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+	templateNow = func() time.Time { return now }
+	defer func() { templateNow = time.Now }()
+
+	project := goldenProject()
+	project.sqlInstances = []*reportSQLInstance{{
+		gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "db"},
+		backupRuns:     []*reportBackupRun{{gcpBackupRun: &sqladmin.BackupRun{Status: "SUCCESSFUL", EndTime: "2017-05-31T09:30:00Z"}}},
+		project:        project,
+	}, {
+		gcpSQLInstance: &sqladmin.DatabaseInstance{Name: "unbacked"},
+		project:        project,
+	}}
+
+	err := setupTemplate("", `{{range .Projects}}{{.ProjectID | upper}}:{{range .Application.Services}} {{.ID}}({{len .Versions}}){{end}}
+{{range .SQLInstances}}  {{.Name}} last backup {{ago .LastBackup}}
+{{end}}{{end}}{{.Summary.Projects}} project(s)
+`)
+	if err != nil {
+		t.Fatalf("unexpected template error: %v", err)
+	}
+	defer setupTemplate("", "")
+
+	var out bytes.Buffer
+	if !renderReport(&out, []*reportProject{project}) {
+		t.Fatalf("a template should take over the output")
+	}
+	expected := "TEST1-PROJECT-000: default(2)\n  db last backup 2d2h ago\n  unbacked last backup never\n1 project(s)\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\nhave:\n%s", expected, out.String())
+	}
+}
+
+func TestSetupTemplate(t *testing.T) {
+	defer setupTemplate("", "")
+	if err := setupTemplate("report.tmpl", "{{.}}"); err == nil {
+		t.Errorf("expected an error when both a template file and string are given")
+	}
+	if err := setupTemplate("", "{{.Projects"); err == nil {
+		t.Errorf("expected an error for a template that does not parse")
+	}
+	if err := setupTemplate("", ""); err != nil || reportTemplate != nil {
+		t.Errorf("expected no template without a file or string, have %v %v", reportTemplate, err)
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	for _, tt := range []struct {
+		d        time.Duration
+		expected string
+	}{
+		{1500 * time.Millisecond, "2s"},
+		{5*time.Minute + 10*time.Second, "5m10s"},
+		{26*time.Hour + 30*time.Minute, "1d2h"},
+		{2 * time.Hour, "2h"},
+		{72 * time.Hour, "3d"},
+		{-90 * time.Second, "-1m30s"},
+	} {
+		if have := humanDuration(tt.d); have != tt.expected {
+			t.Errorf("%v: expected %s, have %s", tt.d, tt.expected, have)
+		}
+	}
+}
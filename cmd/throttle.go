@@ -0,0 +1,59 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+)
+
+// apiSlots is a counting semaphore bounding how many GCP API calls are in
+// flight at once, across the whole ingestion tree.
+var apiSlots = make(chan struct{}, 8)
+
+// apiRate is a token bucket bounding how many GCP API requests are made each
+// second, retries included; nil leaves the rate unbounded.
+var apiRate *rate.Limiter
+
+// setConcurrency resizes the API call semaphore. It must not be called while
+// an ingestion is running.
+func setConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	apiSlots = make(chan struct{}, n)
+}
+
+// setRate bounds API requests to qps each second, spaced evenly rather than
+// in bursts; 0 lifts the bound. It must not be called while an ingestion is
+// running.
+func setRate(qps float64) error {
+	switch {
+	case qps < 0:
+		return fmt.Errorf("--qps must not be negative, have %v", qps)
+	case qps == 0:
+		apiRate = nil
+	default:
+		apiRate = rate.NewLimiter(rate.Limit(qps), 1)
+	}
+	return nil
+}
+
+// waitRate waits for the next request --qps allows, failing when ctx is done
+// first
+func waitRate(ctx context.Context) error {
+	if limiter := apiRate; limiter != nil {
+		return limiter.Wait(ctx)
+	}
+	return nil
+}
+
+// limited runs fn while holding one of the API call slots
+func limited(fn func() error) error {
+	apiSlots <- struct{}{}
+	defer func() { <-apiSlots }()
+	return fn()
+}
@@ -0,0 +1,122 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appengine "google.golang.org/api/appengine/v1"
+)
+
+// countingTaker wraps TestTaker, recording the highest number of calls in flight at once
+type countingTaker struct {
+	TestTaker
+	inFlight    int32
+	maxInFlight int32
+}
+
+func (ct *countingTaker) enter() {
+	n := atomic.AddInt32(&ct.inFlight, 1)
+	for {
+		seen := atomic.LoadInt32(&ct.maxInFlight)
+		if n <= seen || atomic.CompareAndSwapInt32(&ct.maxInFlight, seen, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	atomic.AddInt32(&ct.inFlight, -1)
+}
+
+func (ct *countingTaker) GetApplication(ctx context.Context, rp *reportProject) (*appengine.Application, error) {
+	ct.enter()
+	return ct.TestTaker.GetApplication(ctx, rp)
+}
+
+func (ct *countingTaker) ListServices(ctx context.Context, ra *reportApplication) ([]*appengine.Service, error) {
+	ct.enter()
+	return ct.TestTaker.ListServices(ctx, ra)
+}
+
+func (ct *countingTaker) ListVersions(ctx context.Context, rs *reportService) ([]*appengine.Version, error) {
+	ct.enter()
+	return ct.TestTaker.ListVersions(ctx, rs)
+}
+
+func (ct *countingTaker) ListVersionInstances(ctx context.Context, rv *reportVersion) ([]*appengine.Instance, error) {
+	ct.enter()
+	return ct.TestTaker.ListVersionInstances(ctx, rv)
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	setConcurrency(2)
+	defer setConcurrency(8)
+
+	taker := &countingTaker{}
+	var wg sync.WaitGroup
+	for _, project := range filterFixture(fpTT[0]) {
+		wg.Add(1)
+		go func(project *reportProject) {
+			defer wg.Done()
+			project.Ingest(context.Background(), taker)
+		}(project)
+	}
+	wg.Wait()
+
+	if taker.maxInFlight > 2 {
+		t.Errorf("expected at most 2 API calls in flight, saw %d", taker.maxInFlight)
+	}
+	if taker.maxInFlight == 0 {
+		t.Errorf("expected the taker to be called at all")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	if err := setRate(2); err != nil {
+		t.Fatal(err)
+	}
+	defer setRate(0)
+
+	var mu sync.Mutex
+	var calls []time.Time
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limited(func() error {
+				return doWithRetry(context.Background(), func() error {
+					mu.Lock()
+					defer mu.Unlock()
+					calls = append(calls, time.Now())
+					return nil
+				})
+			})
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(calls, func(i, j int) bool { return calls[i].Before(calls[j]) })
+	for i := 1; i < len(calls); i++ {
+		// 2 each second is one every 500ms, less some timing tolerance
+		if gap := calls[i].Sub(calls[i-1]); gap < 400*time.Millisecond {
+			t.Errorf("expected calls at least 400ms apart at 2 qps, call %d came %v after the one before", i, gap)
+		}
+	}
+
+	// a context done first cuts the wait short
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := doWithRetry(ctx, func() error { return nil }); err == nil {
+		t.Error("expected a cancelled context to stop the wait for the rate")
+	}
+
+	if setRate(-1) == nil {
+		t.Error("expected a negative --qps to be refused")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	timeFormatRFC3339  = "rfc3339"
+	timeFormatRelative = "relative"
+	timeFormatLocal    = "local"
+)
+
+var timeFormatNames = []string{timeFormatRFC3339, timeFormatRelative, timeFormatLocal}
+
+// displayNow is the clock relative times are measured from
+var displayNow = time.Now
+
+// checkTimeFormat rejects a --time-format that is not one of timeFormatNames
+func checkTimeFormat(name string) error {
+	if !containsString(timeFormatNames, name) {
+		return fmt.Errorf("unknown time format %q: expecting one of %v", name, timeFormatNames)
+	}
+	return nil
+}
+
+// formatTime shows t as --time-format asks: how long ago, in local time, or
+// as RFC3339 in UTC
+func formatTime(t time.Time) string {
+	switch viper.GetString("timeFormat") {
+	case timeFormatRFC3339:
+		return t.UTC().Format(time.RFC3339)
+	case timeFormatLocal:
+		return t.Local().Format("2006-01-02 15:04:05 MST")
+	}
+	return relativeTime(t, displayNow())
+}
+
+// formatTimestamp shows an RFC3339 timestamp from GCP by formatTime, leaving
+// one that does not parse as it is
+func formatTimestamp(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return formatTime(t)
+}
+
+// relativeTime shows how long before now t was, eg 3d ago
+func relativeTime(t, now time.Time) string {
+	since := now.Sub(t)
+	switch {
+	case since < 0:
+		return "in " + humanDuration(-since)
+	case since < time.Second:
+		return "just now"
+	}
+	return humanDuration(since) + " ago"
+}
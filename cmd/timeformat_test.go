@@ -0,0 +1,56 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+	for _, tt := range []struct {
+		since    time.Duration
+		expected string
+	}{
+		{0, "just now"},
+		{42 * time.Second, "42s ago"},
+		{25 * time.Minute, "25m ago"},
+		{59*time.Minute + 30*time.Second, "59m30s ago"},
+		{3*time.Hour + 15*time.Minute, "3h15m ago"},
+		{72 * time.Hour, "3d ago"},
+		{10*24*time.Hour + 5*time.Hour, "10d5h ago"},
+		{-2 * time.Hour, "in 2h"},
+	} {
+		if have := relativeTime(now.Add(-tt.since), now); have != tt.expected {
+			t.Errorf("%v: expected %s, have %s", tt.since, tt.expected, have)
+		}
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2017-06-02T12:00:00Z")
+	displayNow = func() time.Time { return now }
+	defer func() {
+		displayNow = time.Now
+		viper.Set("timeFormat", timeFormatRelative)
+	}()
+
+	viper.Set("timeFormat", timeFormatRelative)
+	if have := formatTimestamp("2017-05-30T12:00:00Z"); have != "3d ago" {
+		t.Errorf("expected a relative time, have %s", have)
+	}
+	viper.Set("timeFormat", timeFormatRFC3339)
+	if have := formatTimestamp("2017-05-30T14:00:00+02:00"); have != "2017-05-30T12:00:00Z" {
+		t.Errorf("expected RFC3339 in UTC, have %s", have)
+	}
+	if have := formatTimestamp("not-a-time"); have != "not-a-time" {
+		t.Errorf("expected an unparseable timestamp left alone, have %s", have)
+	}
+	if err := checkTimeFormat("epoch"); err == nil {
+		t.Errorf("expected an error for an unknown time format")
+	}
+}
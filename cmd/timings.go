@@ -0,0 +1,114 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiTimings accumulates how long the GCP API calls of a run took, by the
+// taker method making them
+var apiTimings = newCallTimings()
+
+type callTiming struct {
+	calls int
+	total time.Duration
+}
+
+// callTimings is safe for the concurrent ingestion of many projects
+type callTimings struct {
+	mu     sync.Mutex
+	byCall map[string]*callTiming
+}
+
+func newCallTimings() *callTimings {
+	return &callTimings{byCall: make(map[string]*callTiming)}
+}
+
+// record adds one call of the named method taking d
+func (ct *callTimings) record(call string, d time.Duration) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	timing, ok := ct.byCall[call]
+	if !ok {
+		timing = &callTiming{}
+		ct.byCall[call] = timing
+	}
+	timing.calls++
+	timing.total += d
+}
+
+// reset forgets the calls recorded so far
+func (ct *callTimings) reset() {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.byCall = make(map[string]*callTiming)
+}
+
+// get is the timing of the named method, zero when it was not called
+func (ct *callTimings) get(call string) callTiming {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if timing, ok := ct.byCall[call]; ok {
+		return *timing
+	}
+	return callTiming{}
+}
+
+// Display shows the time spent in each method as a table, the method taking
+// longest first
+func (ct *callTimings) Display(w io.Writer) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if len(ct.byCall) == 0 {
+		return
+	}
+	var calls []string
+	for call := range ct.byCall {
+		calls = append(calls, call)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		ti, tj := ct.byCall[calls[i]], ct.byCall[calls[j]]
+		if ti.total != tj.total {
+			return ti.total > tj.total
+		}
+		return calls[i] < calls[j]
+	})
+	table := newTable(w)
+	fmt.Fprintln(table, "API CALL\tCALLS\tTOTAL\tMEAN")
+	for _, call := range calls {
+		timing := ct.byCall[call]
+		fmt.Fprintf(table, "%s\t%d\t%v\t%v\n", call, timing.calls, timing.total.Round(time.Millisecond),
+			(timing.total / time.Duration(timing.calls)).Round(time.Millisecond))
+	}
+	table.Flush()
+}
+
+// closureSuffix matches the .funcN naming an anonymous function
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+// callerName names the function skip frames above its caller, eg
+// TakerStorageGCP.ListObjects, without package path or closure suffixes
+func callerName(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "unknown"
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = name[strings.Index(name, ".")+1:]
+	name = strings.NewReplacer("(*", "", ")", "").Replace(name)
+	return closureSuffix.ReplaceAllString(name, "")
+}
@@ -0,0 +1,49 @@
+// Copyright © 2017 Michael Boe <mboe@acm.org>
+// This file is part of gcp-reports.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubTimedTaker makes its GCP calls through doWithRetry as the real takers do
+type stubTimedTaker struct{}
+
+func (taker *stubTimedTaker) ListThings() error {
+	return doWithRetry(context.Background(), func() error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+}
+
+func TestAPITimings(t *testing.T) {
+	apiTimings.reset()
+	defer apiTimings.reset()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			(&stubTimedTaker{}).ListThings()
+		}()
+	}
+	wg.Wait()
+
+	timing := apiTimings.get("stubTimedTaker.ListThings")
+	if timing.calls != 4 || timing.total < 4*time.Millisecond {
+		t.Errorf("expected four calls of at least 1ms recorded, have %d taking %v", timing.calls, timing.total)
+	}
+
+	var buf bytes.Buffer
+	apiTimings.Display(&buf)
+	if out := buf.String(); !strings.Contains(out, "stubTimedTaker.ListThings") || !strings.Contains(out, "MEAN") {
+		t.Errorf("expected the breakdown to show the call, have:\n%s", out)
+	}
+}